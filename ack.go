@@ -0,0 +1,261 @@
+package uptime
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// incident is opened when a check goes down, and closed when it recovers.
+// Its token goes out with every result delivered while it is open, so that
+// an alert can carry it, e.g. in a Reply-To address; quoting it back
+// acknowledges the incident, which stops it from being escalated any
+// further. Results keep going to subscribers either way.
+type incident struct {
+	Id             string        `json:"id"`
+	Job            healthcheckId `json:"job"`
+	Token          string        `json:"token"`
+	OpenedAt       time.Time     `json:"opened_at"`
+	AcknowledgedAt *time.Time    `json:"acknowledged_at,omitempty"`
+	AcknowledgedBy string        `json:"acknowledged_by,omitempty"`
+	ClosedAt       *time.Time    `json:"closed_at,omitempty"`
+	// Deploy, if set, is the deploy of the check's service the incident
+	// opened shortly after.
+	Deploy *deployEvent `json:"deploy,omitempty"`
+
+	// alias, url and service describe the check, which may be gone by the
+	// time a past incident is looked at.
+	alias   int
+	url     string
+	service string
+}
+
+// ackTokenRegex finds an acknowledgement token anywhere in an inbound
+// message: recipient address, subject or body.
+var ackTokenRegex = regexp.MustCompile(`ack-[0-9a-f]{24}`)
+
+func newAckToken() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return "ack-" + hex.EncodeToString(b)
+}
+
+var errUnknownAckToken = errors.New("no open incident for this token")
+
+// maxClosedIncidents is how many past incidents are kept.
+const maxClosedIncidents = 1000
+
+type incidentLog struct {
+	// deploys, if set, are the deploys incidents are attributed to.
+	deploys *deployLog
+
+	mu      sync.Mutex
+	byJob   map[healthcheckId]*incident
+	byToken map[string]*incident
+	closed  []*incident
+}
+
+func newIncidentLog(deploys *deployLog) *incidentLog {
+	return &incidentLog{
+		deploys: deploys,
+		byJob:   make(map[healthcheckId]*incident),
+		byToken: make(map[string]*incident),
+	}
+}
+
+// observe opens or closes the job's incident according to whether, after a
+// result, the job is down, and returns a copy of the incident the result
+// belongs to, if any. A recovery belongs to the incident it closes.
+func (l *incidentLog) observe(healthcheck HealthcheckQuery, resp HealthcheckResponse, down bool) *incident {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	id := healthcheck.Id
+	if resp.neutral() {
+		return l.copy(l.byJob[id])
+	}
+	current, ok := l.byJob[id]
+	switch {
+	case down && !ok:
+		current = &incident{
+			Id:       newUUID(),
+			Job:      id,
+			Token:    newAckToken(),
+			OpenedAt: resp.Timestamp,
+			Deploy:   l.deploys.correlate(healthcheck.Labels[serviceLabel], resp.Timestamp),
+			alias:    healthcheck.Alias,
+			url:      healthcheck.Url,
+			service:  healthcheck.Labels[serviceLabel],
+		}
+		l.byJob[id] = current
+		l.byToken[current.Token] = current
+	case !down && ok:
+		closedAt := resp.Timestamp
+		current.ClosedAt = &closedAt
+		delete(l.byJob, id)
+		delete(l.byToken, current.Token)
+		l.closed = append(l.closed, current)
+		if len(l.closed) > maxClosedIncidents {
+			l.closed = l.closed[len(l.closed)-maxClosedIncidents:]
+		}
+	}
+	return l.copy(current)
+}
+
+func (l *incidentLog) copy(i *incident) *incident {
+	if i == nil {
+		return nil
+	}
+	c := *i
+	return &c
+}
+
+// attribute attributes the open incidents of a service's checks that
+// opened shortly after a deploy, and aren't attributed to another one yet,
+// to it.
+func (l *incidentLog) attribute(e deployEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, i := range l.byJob {
+		if i.Deploy == nil && i.service == e.Service && l.deploys.follows(e, i.OpenedAt) {
+			deploy := e
+			i.Deploy = &deploy
+		}
+	}
+}
+
+func (l *incidentLog) acknowledge(token string, by string, at time.Time) (*incident, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	i, ok := l.byToken[token]
+	if !ok {
+		return nil, errUnknownAckToken
+	}
+	if i.AcknowledgedAt == nil {
+		i.AcknowledgedAt = &at
+		i.AcknowledgedBy = by
+	}
+	return l.copy(i), nil
+}
+
+// list returns every open incident and the past ones still kept, oldest
+// first.
+func (l *incidentLog) list() []*incident {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	incidents := make([]*incident, 0, len(l.closed)+len(l.byJob))
+	for _, i := range l.closed {
+		incidents = append(incidents, l.copy(i))
+	}
+	for _, i := range l.byJob {
+		incidents = append(incidents, l.copy(i))
+	}
+	sort.Slice(incidents, func(i, j int) bool {
+		return incidents[i].OpenedAt.Before(incidents[j].OpenedAt)
+	})
+	return incidents
+}
+
+// forJob returns a job's open incident and the past ones still kept,
+// oldest first.
+func (l *incidentLog) forJob(id healthcheckId) []*incident {
+	var incidents []*incident
+	for _, i := range l.list() {
+		if i.Job == id {
+			incidents = append(incidents, i)
+		}
+	}
+	return incidents
+}
+
+func (l *incidentLog) forget(id healthcheckId) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if i, ok := l.byJob[id]; ok {
+		delete(l.byToken, i.Token)
+		delete(l.byJob, id)
+	}
+}
+
+// inboundAck extracts the token and sender from an acknowledgement: either
+// JSON {"token": ..., "by": ...}, or an inbound email as posted by mail
+// providers' inbound webhooks, with the token anywhere in its fields.
+func inboundAck(r *http.Request) (token string, by string, err error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		var d struct {
+			Token string `json:"token"`
+			By    string `json:"by"`
+		}
+		err = json.NewDecoder(r.Body).Decode(&d)
+		if err != nil {
+			return "", "", err
+		}
+		return ackTokenRegex.FindString(d.Token), d.By, nil
+	}
+
+	var form url.Values
+	if mediaType == "multipart/form-data" {
+		err = r.ParseMultipartForm(1 << 20)
+		if err != nil {
+			return "", "", err
+		}
+		form = r.MultipartForm.Value
+	} else {
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			return "", "", err
+		}
+		form, err = url.ParseQuery(string(body))
+		if err != nil {
+			return "", "", err
+		}
+	}
+	for _, key := range []string{"recipient", "to", "To", "subject", "Subject", "body-plain", "stripped-text", "text", "TextBody"} {
+		if token = ackTokenRegex.FindString(strings.Join(form[key], " ")); token != "" {
+			break
+		}
+	}
+	for _, key := range []string{"sender", "from", "From"} {
+		if by = form.Get(key); by != "" {
+			break
+		}
+	}
+	return token, by, nil
+}
+
+// handleAck serves POST /incidents/ack, which acknowledges the incident
+// whose token the request carries.
+func (h *HealthcheckServer) handleAck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	token, by, err := inboundAck(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if token == "" {
+		writeError(w, http.StatusBadRequest, errors.New("no acknowledgement token found"))
+		return
+	}
+	i, err := h.incidents.acknowledge(token, by, h.clock.Now())
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(i)
+}
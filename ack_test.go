@@ -0,0 +1,89 @@
+package uptime
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcknowledgedIncidentStopsEscalationOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.yaml")
+	err := os.WriteFile(path, []byte(`namespaces:
+  team:
+    escalation:
+      - after: 1m
+        webhooks: [http://203.0.113.1/oncall]
+      - after: 10m
+        webhooks: [http://203.0.113.1/manager]
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transitions, err := newTransitionNotifier("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	transitions.Policies, err = readNotificationPolicies(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, clk := newConfiguredTestServer(t, Config{Transitions: transitions}, func(healthcheck HealthcheckQuery, ctx context.Context) HealthcheckResponse {
+		return failCheckReason(ctx, reasonUnexpectedStatus, "unexpected status 500")
+	})
+	// Not delivered: the test looks at what is queued instead.
+	subscription := &resultSubscription{Id: "s", queue: make(chan []byte, subscriptionQueueSize)}
+	h.subscriptions.subscriptions[subscription.Id] = subscription
+	h.AddHealthcheck(HealthcheckQuery{Url: "http://203.0.113.1", Namespace: "team", Frequency: time.Minute})
+
+	// step runs the check once more, and returns the escalations and
+	// results it queued.
+	step := func() (escalations []string, results []resultEvent) {
+		clk.Advance(time.Minute)
+		h.scheduler.dispatchDue()
+		h.scheduler.waitIdle()
+		for len(transitions.queue) > 0 {
+			escalations = append(escalations, (<-transitions.queue).url)
+		}
+		for len(subscription.queue) > 0 {
+			var event resultEvent
+			json.Unmarshal(<-subscription.queue, &event)
+			results = append(results, event)
+		}
+		return escalations, results
+	}
+
+	escalations, results := step()
+	if len(escalations) != 0 || len(results) != 1 || results[0].Incident == nil {
+		t.Fatalf("first failure: got %d escalations and %d results, want none and one with an incident", len(escalations), len(results))
+	}
+	escalations, results = step()
+	if len(escalations) != 1 || escalations[0] != "http://203.0.113.1/oncall" {
+		t.Fatalf("down for a minute: got escalations %v, want the first step's", escalations)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/incidents/ack", strings.NewReader(`{"token":"`+results[0].Incident.Token+`","by":"oncall"}`))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.Handler().ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d acknowledging, want 200: %s", w.Code, w.Body)
+	}
+
+	// The second step is due after 10 minutes down, but the incident is
+	// acknowledged by then; results still go to subscribers.
+	for i := 0; i < 10; i++ {
+		escalations, results = step()
+		if len(escalations) != 0 {
+			t.Fatalf("acknowledged: got escalations %v, want none", escalations)
+		}
+		if len(results) != 1 || results[0].Incident == nil || results[0].Incident.AcknowledgedAt == nil {
+			t.Fatalf("acknowledged: got %d results, want one with the acknowledged incident", len(results))
+		}
+	}
+}
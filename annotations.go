@@ -0,0 +1,265 @@
+package uptime
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// annotationsPerJob is how many of its latest annotations are kept per
+// job.
+const annotationsPerJob = 1000
+
+// annotation is a note about a time range of a check's history, e.g. a
+// deploy or a provider's incident. Notes about a point in time end when
+// they start.
+type annotation struct {
+	Id        string        `json:"id"`
+	Job       healthcheckId `json:"job"`
+	From      time.Time     `json:"from"`
+	To        time.Time     `json:"to"`
+	Text      string        `json:"text"`
+	Tags      []string      `json:"tags,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+	CreatedBy string        `json:"created_by,omitempty"`
+}
+
+// overlaps reports whether the annotation covers any of (after, until],
+// or of the time since after if until is zero.
+func (a annotation) overlaps(after, until time.Time) bool {
+	return (until.IsZero() || !a.From.After(until)) && a.To.After(after)
+}
+
+// annotationStore keeps the annotations of every job in memory, ordered by
+// when they start.
+type annotationStore struct {
+	mu          sync.Mutex
+	annotations map[healthcheckId][]annotation
+}
+
+func newAnnotationStore() *annotationStore {
+	return &annotationStore{annotations: make(map[healthcheckId][]annotation)}
+}
+
+func (s *annotationStore) add(a annotation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	annotations := append(s.annotations[a.Job], a)
+	sort.SliceStable(annotations, func(i, j int) bool {
+		return annotations[i].From.Before(annotations[j].From)
+	})
+	if len(annotations) > annotationsPerJob {
+		annotations = annotations[len(annotations)-annotationsPerJob:]
+	}
+	s.annotations[a.Job] = annotations
+}
+
+// list returns a job's annotations overlapping (after, until], oldest
+// first. A zero until doesn't bound them.
+func (s *annotationStore) list(id healthcheckId, after, until time.Time) []annotation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := []annotation{}
+	for _, a := range s.annotations[id] {
+		if a.overlaps(after, until) {
+			list = append(list, a)
+		}
+	}
+	return list
+}
+
+// remove deletes an annotation of a job, and reports whether it had it.
+func (s *annotationStore) remove(id healthcheckId, annotationId string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	annotations := s.annotations[id]
+	for i, a := range annotations {
+		if a.Id == annotationId {
+			s.annotations[id] = append(annotations[:i:i], annotations[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (s *annotationStore) forget(id healthcheckId) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.annotations, id)
+}
+
+// annotate sets the annotations of results, newest first as listed: each
+// result gets those overlapping the time since the result before it.
+func (s *annotationStore) annotate(id healthcheckId, results []HealthcheckResponse) {
+	for i := range results {
+		after := results[i].Timestamp
+		if i+1 < len(results) {
+			after = results[i+1].Timestamp
+		}
+		for _, a := range s.list(id, after, results[i].Timestamp) {
+			results[i].Annotations = append(results[i].Annotations, a.Text)
+		}
+	}
+}
+
+// handleJobAnnotations serves GET /jobs/{id}/annotations, listing a job's
+// annotations, from and to optionally bounding them, POST, which adds one,
+// and DELETE with the id of one to remove.
+func (h *HealthcheckServer) handleJobAnnotations(w http.ResponseWriter, r *http.Request, jobId healthcheckId) {
+	switch r.Method {
+	case http.MethodGet:
+		var from, to time.Time
+		var err error
+		if s := r.URL.Query().Get("from"); s != "" {
+			from, err = time.Parse(time.RFC3339, s)
+		}
+		if s := r.URL.Query().Get("to"); s != "" && err == nil {
+			to, err = time.Parse(time.RFC3339, s)
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("from and to must be RFC 3339 times"))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(h.annotations.list(jobId, from.Add(-time.Nanosecond), to))
+	case http.MethodPost:
+		var d struct {
+			Text string    `json:"text"`
+			From time.Time `json:"from"`
+			To   time.Time `json:"to"`
+			Tags []string  `json:"tags"`
+		}
+		err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&d)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if d.Text == "" {
+			writeError(w, http.StatusBadRequest, errors.New("text is required"))
+			return
+		}
+		now := h.clock.Now()
+		if d.From.IsZero() {
+			d.From = now
+		}
+		if d.To.IsZero() {
+			d.To = d.From
+		}
+		if d.To.Before(d.From) {
+			writeError(w, http.StatusBadRequest, errors.New("to can't be before from"))
+			return
+		}
+		a := annotation{
+			Id:        newUUID(),
+			Job:       jobId,
+			From:      d.From,
+			To:        d.To,
+			Text:      d.Text,
+			Tags:      d.Tags,
+			CreatedAt: now,
+			CreatedBy: requestActor(r),
+		}
+		h.annotations.add(a)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(a)
+	case http.MethodDelete:
+		if !h.annotations.remove(jobId, r.URL.Query().Get("id")) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// grafanaAnnotationQuery is the request of Grafana's JSON data source
+// for annotations. The annotation's query is the id or alias of the job
+// whose annotations to show, or empty for all jobs'.
+type grafanaAnnotationQuery struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	// Annotation is echoed back with every annotation.
+	Annotation json.RawMessage `json:"annotation"`
+}
+
+type grafanaAnnotation struct {
+	Annotation json.RawMessage `json:"annotation"`
+	Time       int64           `json:"time"`
+	TimeEnd    int64           `json:"timeEnd"`
+	IsRegion   bool            `json:"isRegion"`
+	Title      string          `json:"title"`
+	Text       string          `json:"text"`
+	Tags       []string        `json:"tags"`
+}
+
+// handleGrafana serves the endpoints of a Grafana JSON data source rooted
+// at /grafana/: the connection test, and annotation queries.
+func (h *HealthcheckServer) handleGrafana(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/grafana/":
+		w.WriteHeader(http.StatusOK)
+		return
+	case "/grafana/annotations":
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var query grafanaAnnotationQuery
+	err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&query)
+	var annotation struct {
+		Query string `json:"query"`
+	}
+	if err == nil && query.Annotation != nil {
+		err = json.Unmarshal(query.Annotation, &annotation)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var healthchecks []HealthcheckQuery
+	if annotation.Query != "" {
+		id, ok := h.resolveId(annotation.Query)
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("no job %q", annotation.Query))
+			return
+		}
+		healthcheck, _ := h.GetHealthcheck(id)
+		healthchecks = append(healthchecks, healthcheck)
+	} else {
+		healthchecks = h.ListHealthchecks()
+	}
+	result := []grafanaAnnotation{}
+	for _, healthcheck := range healthchecks {
+		for _, a := range h.annotations.list(healthcheck.Id, query.Range.From.Add(-time.Nanosecond), query.Range.To) {
+			tags := a.Tags
+			if tags == nil {
+				tags = []string{}
+			}
+			result = append(result, grafanaAnnotation{
+				Annotation: query.Annotation,
+				Time:       a.From.UnixMilli(),
+				TimeEnd:    a.To.UnixMilli(),
+				IsRegion:   a.To.After(a.From),
+				Title:      "#" + strconv.Itoa(healthcheck.Alias) + " " + healthcheck.Url,
+				Text:       a.Text,
+				Tags:       tags,
+			})
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,88 @@
+package uptime
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	artifactModeRange = "range"
+	artifactModeHead  = "head"
+)
+
+// ArtifactCheck verifies a large download is available without fetching
+// it: either a HEAD request, or a GET for its first byte only.
+type ArtifactCheck struct {
+	Mode          string `json:"mode"`
+	ContentLength int64  `json:"content_length,omitempty"`
+	ETag          string `json:"etag,omitempty"`
+	AcceptRanges  bool   `json:"accept_ranges,omitempty"`
+}
+
+func (a *ArtifactCheck) validate(h HealthcheckQuery) error {
+	if a.Mode != artifactModeRange && a.Mode != artifactModeHead {
+		return fmt.Errorf("invalid artifact mode %q, expected range or head", a.Mode)
+	}
+	if a.ContentLength < 0 {
+		return fmt.Errorf("invalid artifact content_length %d", a.ContentLength)
+	}
+	if h.hasBodyAssertions() {
+		return fmt.Errorf("artifact checks can't be combined with body assertions")
+	}
+	return nil
+}
+
+func (a *ArtifactCheck) prepare(req *http.Request) {
+	switch a.Mode {
+	case artifactModeHead:
+		req.Method = http.MethodHead
+	case artifactModeRange:
+		req.Header.Set("Range", "bytes=0-0")
+	}
+}
+
+func (a *ArtifactCheck) check(resp *http.Response) error {
+	var length int64
+	switch a.Mode {
+	case artifactModeHead:
+		length = resp.ContentLength
+	case artifactModeRange:
+		if resp.StatusCode != http.StatusPartialContent {
+			return fmt.Errorf("Range request not honored, got status %d", resp.StatusCode)
+		}
+		var err error
+		length, err = parseContentRangeSize(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return err
+		}
+	}
+	if a.ContentLength != 0 && length != a.ContentLength {
+		return fmt.Errorf("Unexpected content length, %d != %d", length, a.ContentLength)
+	}
+	if a.AcceptRanges && resp.Header.Get("Accept-Ranges") != "bytes" {
+		return fmt.Errorf("Range requests not supported, Accept-Ranges is %q", resp.Header.Get("Accept-Ranges"))
+	}
+	if a.ETag != "" && resp.Header.Get("ETag") != a.ETag {
+		return fmt.Errorf("Unexpected ETag, %s != %s", resp.Header.Get("ETag"), a.ETag)
+	}
+	return nil
+}
+
+// parseContentRangeSize returns the complete length from a Content-Range
+// header such as "bytes 0-0/1234", or -1 if the server doesn't know it.
+func parseContentRangeSize(header string) (int64, error) {
+	_, size, ok := strings.Cut(header, "/")
+	if !strings.HasPrefix(header, "bytes ") || !ok {
+		return 0, fmt.Errorf("Invalid Content-Range %q", header)
+	}
+	if size == "*" {
+		return -1, nil
+	}
+	n, err := strconv.ParseInt(size, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid Content-Range %q", header)
+	}
+	return n, nil
+}
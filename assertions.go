@@ -0,0 +1,99 @@
+package uptime
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+func (h HealthcheckQuery) hasBodyAssertions() bool {
+	return h.JqQuery.Query != nil || h.ExpectedBody != nil || h.ExpectedSha256 != "" || h.Validator != ""
+}
+
+// checkBody runs the healthcheck's assertions on the response body. The
+// body is only buffered when an assertion needs it in full; a checksum
+// alone is computed while streaming, so large artifacts can be verified.
+// Unless decompression is disabled, assertions see the decoded body, and
+// the body compared against expected_body and jq queries is converted to
+// UTF-8 first. The validator, if any, runs last, once the other
+// assertions passed.
+func checkBody(ctx context.Context, h HealthcheckQuery, resp *http.Response) error {
+	var r io.Reader = resp.Body
+	var err error
+	if !h.DisableDecompression {
+		r, err = decodeContent(resp)
+		if err != nil {
+			return err
+		}
+	}
+	hash := sha256.New()
+	var body []byte
+	if h.JqQuery.Query != nil || h.ExpectedBody != nil || h.Validator != "" {
+		body, err = io.ReadAll(io.TeeReader(r, hash))
+	} else {
+		_, err = io.Copy(hash, r)
+	}
+	if err != nil {
+		return fmt.Errorf("Error reading response body: %w", err)
+	}
+	if body != nil && !h.DisableDecompression {
+		body, err = decodeCharset(resp, body)
+		if err != nil {
+			return err
+		}
+	}
+
+	trace := traceFrom(ctx)
+	if h.ExpectedBody != nil {
+		if !bytes.Equal(body, []byte(*h.ExpectedBody)) {
+			err = fmt.Errorf("Response body doesn't match the expected body")
+		}
+		trace.assert("expected_body", excerpt([]byte(*h.ExpectedBody)), excerpt(body), err)
+		if err != nil {
+			return err
+		}
+	}
+	if h.ExpectedSha256 != "" {
+		sum := hex.EncodeToString(hash.Sum(nil))
+		if sum != h.ExpectedSha256 {
+			err = fmt.Errorf("Response body checksum mismatch, %s != %s", sum, h.ExpectedSha256)
+		}
+		trace.assert("expected_sha256", h.ExpectedSha256, sum, err)
+		if err != nil {
+			return err
+		}
+	}
+	// Optionally check the response body against a jq query
+	if h.JqQuery.Query != nil {
+		err = checkJSON(ctx, h, body)
+		trace.assert("jq_query", marshalledJqQuery{
+			Query:       h.JqQuery.Query.String(),
+			Expectation: h.JqQuery.Expectation,
+			Mode:        h.JqQuery.Mode,
+		}, excerpt(body), err)
+		if err != nil {
+			return err
+		}
+	}
+	if h.Validator != "" {
+		err = callValidator(ctx, h, resp, body)
+		trace.assert("validator", h.Validator, nil, err)
+		return err
+	}
+	return nil
+}
+
+func parseSha256(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("invalid expected_sha256 %q, expected 64 hex characters", s)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,367 @@
+package uptime
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The roles of API keys: read keys may only read, admin keys may also
+// change anything, including keys, and upload keys may only upload
+// results, as agents do.
+const (
+	roleRead   = "read"
+	roleAdmin  = "admin"
+	roleUpload = "upload"
+)
+
+// uploadPath is where agents upload results, the only thing upload keys
+// may do.
+const uploadPath = "/results/upload"
+
+var (
+	errUnauthorized = errors.New("missing or invalid API key, expected an Authorization: Bearer header")
+	errForbidden    = errors.New("this API key may only read, changes need an admin key")
+	errUploadOnly   = errors.New("this API key may only upload results")
+	errKeyExists    = errors.New("already exists")
+	errNoAdminKey   = errors.New("the first key must be an admin key, so that keys can still be managed")
+	errLastAdminKey = errors.New("the last admin key can't be deleted, as the API would be left without one")
+)
+
+// keyNameRegex is what key names look like, so that they can be used in
+// paths.
+var keyNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+var keyPathRegex = regexp.MustCompile(`^/keys/([^/]+)$`)
+
+// selfAuthenticatedPosts are endpoints changing things that verify requests
+// themselves: slash commands are signed, and acknowledgements carry the
+// incident's token.
+var selfAuthenticatedPosts = map[string]bool{
+	"/chatops/command": true,
+	"/incidents/ack":   true,
+}
+
+// publicPaths are the pages served to anyone even when reads need a key:
+// the dashboard, which asks for one, the status page and the public API.
+var publicPaths = []string{"/dashboard/", "/status", "/public/", "/healthz"}
+
+// apiKey is a named key to the API. Only its hash is kept, along with its
+// first characters to tell keys apart.
+type apiKey struct {
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	Prefix    string    `json:"prefix"`
+	CreatedAt time.Time `json:"created_at"`
+	hash      [sha256.Size]byte
+}
+
+// apiKeys are the keys the API accepts. While there are none, the API is
+// open.
+type apiKeys struct {
+	mu     sync.Mutex
+	byName map[string]*apiKey
+	byHash map[[sha256.Size]byte]*apiKey
+}
+
+func newAPIKeys() *apiKeys {
+	return &apiKeys{
+		byName: make(map[string]*apiKey),
+		byHash: make(map[[sha256.Size]byte]*apiKey),
+	}
+}
+
+func (k *apiKeys) add(name string, key string, role string, now time.Time) (*apiKey, error) {
+	if !keyNameRegex.MatchString(name) {
+		return nil, fmt.Errorf("invalid key name %q, expected letters, digits, '.', '_' or '-'", name)
+	}
+	if role != roleRead && role != roleAdmin && role != roleUpload {
+		return nil, fmt.Errorf("invalid role %q, expected %s, %s or %s", role, roleRead, roleAdmin, roleUpload)
+	}
+	if key == "" {
+		return nil, fmt.Errorf("key %q: empty key", name)
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, ok := k.byName[name]; ok {
+		return nil, fmt.Errorf("key %q %w", name, errKeyExists)
+	}
+	if role != roleAdmin && k.adminsLocked() == 0 {
+		return nil, fmt.Errorf("key %q: %w", name, errNoAdminKey)
+	}
+	hash := sha256.Sum256([]byte(key))
+	if _, ok := k.byHash[hash]; ok {
+		return nil, fmt.Errorf("key %q: the same key is already used", name)
+	}
+	// Short keys show less, so that the prefix doesn't give them away.
+	prefix := key[:min(8, len(key)/4)]
+	a := &apiKey{Name: name, Role: role, Prefix: prefix, CreatedAt: now, hash: hash}
+	k.byName[name] = a
+	k.byHash[hash] = a
+	return a, nil
+}
+
+func (k *apiKeys) lookup(key string) (apiKey, bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	a, ok := k.byHash[sha256.Sum256([]byte(key))]
+	if !ok {
+		return apiKey{}, false
+	}
+	return *a, true
+}
+
+// remove revokes a key, unless it is the last admin key: removing it
+// would leave keys nobody can manage, or open the API to anyone.
+func (k *apiKeys) remove(name string) (bool, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	a, ok := k.byName[name]
+	if !ok {
+		return false, nil
+	}
+	if a.Role == roleAdmin && k.adminsLocked() == 1 {
+		return true, errLastAdminKey
+	}
+	delete(k.byName, name)
+	delete(k.byHash, a.hash)
+	return true, nil
+}
+
+func (k *apiKeys) adminsLocked() int {
+	admins := 0
+	for _, a := range k.byName {
+		if a.Role == roleAdmin {
+			admins++
+		}
+	}
+	return admins
+}
+
+func (k *apiKeys) list() []apiKey {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	keys := make([]apiKey, 0, len(k.byName))
+	for _, a := range k.byName {
+		keys = append(keys, *a)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Name < keys[j].Name })
+	return keys
+}
+
+func (k *apiKeys) empty() bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return len(k.byName) == 0
+}
+
+// generateAPIKey returns a new random key.
+func generateAPIKey() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return "uck_" + hex.EncodeToString(b)
+}
+
+// apiKeysFile is the format of the -api-keys file.
+type apiKeysFile struct {
+	Keys []struct {
+		Name string `yaml:"name"`
+		Key  string `yaml:"key"`
+		Role string `yaml:"role"`
+	} `yaml:"keys"`
+}
+
+// readAPIKeys adds the keys of a YAML file to keys.
+func readAPIKeys(path string, keys *apiKeys) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var file apiKeysFile
+	err = yaml.Unmarshal(data, &file)
+	if err != nil {
+		return fmt.Errorf("invalid API keys: %w", err)
+	}
+	// Admin keys go first, as other keys need one.
+	sort.SliceStable(file.Keys, func(i, j int) bool {
+		return file.Keys[i].Role == roleAdmin && file.Keys[j].Role != roleAdmin
+	})
+	now := time.Now()
+	for _, key := range file.Keys {
+		_, err = keys.add(key.Name, key.Key, key.Role, now)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readTokenFile reads a token from a file, e.g. a mounted secret, ignoring
+// surrounding whitespace.
+func readTokenFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("%s: empty token", path)
+	}
+	return token, nil
+}
+
+// needsAdmin returns whether a request may change anything, so that it
+// must carry an admin key.
+func needsAdmin(r *http.Request) bool {
+	switch {
+	case r.URL.Path == "/keys" || strings.HasPrefix(r.URL.Path, "/keys/"):
+		// Keys are only shown to admins.
+		return true
+	case r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions:
+		return false
+	case r.Method == http.MethodPost && (readOnlyPosts[r.URL.Path] || selfAuthenticatedPosts[r.URL.Path]):
+		return false
+	}
+	return true
+}
+
+func publicPath(path string) bool {
+	if path == "/" {
+		return true
+	}
+	for _, prefix := range publicPaths {
+		if path == prefix || strings.HasSuffix(prefix, "/") && strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type apiKeyContextKey struct{}
+
+// requestKey returns the name of the key a request was authenticated with.
+func requestKey(r *http.Request) string {
+	name, _ := r.Context().Value(apiKeyContextKey{}).(string)
+	return name
+}
+
+// authenticate wraps the API so that, once there are keys, changes are
+// only accepted from requests carrying an admin key as a bearer token, and
+// reads, with authenticateReads, from those carrying any key.
+func authenticate(keys *apiKeys, authenticateReads bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if keys.empty() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		admin := needsAdmin(r)
+		given, hasKey := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		key, ok := keys.lookup(strings.TrimSpace(given))
+		switch {
+		case !admin && !authenticateReads && !hasKey:
+		case !admin && publicPath(r.URL.Path):
+		case !hasKey || !ok:
+			w.Header().Set("WWW-Authenticate", `Bearer realm="uptime-checker"`)
+			writeError(w, http.StatusUnauthorized, errUnauthorized)
+			return
+		case key.Role == roleUpload && r.Method == http.MethodPost && r.URL.Path == uploadPath:
+		case key.Role == roleUpload && !admin && !authenticateReads:
+			// Reads are open anyway.
+		case key.Role == roleUpload:
+			writeError(w, http.StatusForbidden, errUploadOnly)
+			return
+		case admin && key.Role != roleAdmin:
+			writeError(w, http.StatusForbidden, errForbidden)
+			return
+		}
+		if ok {
+			r = r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key.Name))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleKeys serves /keys: GET lists the keys, without them, and POST
+// creates one, generating it unless given, and returns it, the only time
+// it is shown. /keys/{name} serves GET and DELETE, which revokes the key.
+func (h *HealthcheckServer) handleKeys(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/keys" || r.URL.Path == "/keys/":
+		switch r.Method {
+		case http.MethodGet:
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(h.keys.list())
+		case http.MethodPost:
+			var definition struct {
+				Name string `json:"name"`
+				Role string `json:"role"`
+				Key  string `json:"key"`
+			}
+			err := json.NewDecoder(r.Body).Decode(&definition)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			if definition.Key == "" {
+				definition.Key = generateAPIKey()
+			}
+			key, err := h.keys.add(definition.Name, definition.Key, definition.Role, h.clock.Now())
+			if errors.Is(err, errKeyExists) || errors.Is(err, errNoAdminKey) {
+				writeError(w, http.StatusConflict, err)
+				return
+			}
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(struct {
+				*apiKey
+				Key string `json:"key"`
+			}{key, definition.Key})
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	case keyPathRegex.MatchString(r.URL.Path):
+		name := keyPathRegex.FindStringSubmatch(r.URL.Path)[1]
+		switch r.Method {
+		case http.MethodGet:
+			for _, key := range h.keys.list() {
+				if key.Name == name {
+					w.WriteHeader(http.StatusOK)
+					json.NewEncoder(w).Encode(key)
+					return
+				}
+			}
+			w.WriteHeader(http.StatusNotFound)
+		case http.MethodDelete:
+			found, err := h.keys.remove(name)
+			if !found {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				writeError(w, http.StatusConflict, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
@@ -0,0 +1,244 @@
+package uptime
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxImportBytes bounds the size of imported history, enough for a year
+// of results at one a minute.
+const maxImportBytes = 64 << 20
+
+// importedResult is a result of a check run by another monitoring tool.
+type importedResult struct {
+	Timestamp time.Time
+	Up        bool
+}
+
+// importedOutage is a period an imported check was down: from its first
+// failed result to the next passing one.
+type importedOutage struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// importedHistory is what is known of a check from before it was created
+// on this server: when the imported results start and end, and the
+// outages they show.
+type importedHistory struct {
+	From    time.Time        `json:"from"`
+	To      time.Time        `json:"to"`
+	Outages []importedOutage `json:"outages"`
+}
+
+// backfills keeps the history imported for checks, which their stats
+// cover on top of what this server monitored itself.
+type backfills struct {
+	mu      sync.Mutex
+	history map[healthcheckId]importedHistory
+}
+
+func newBackfills() *backfills {
+	return &backfills{history: make(map[healthcheckId]importedHistory)}
+}
+
+func (b *backfills) set(id healthcheckId, history importedHistory) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.history[id] = history
+}
+
+func (b *backfills) get(id healthcheckId) (importedHistory, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	history, ok := b.history[id]
+	return history, ok
+}
+
+func (b *backfills) forget(id healthcheckId) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.history, id)
+}
+
+// parseImportedStatus accepts the ways other tools spell a result's
+// status.
+func parseImportedStatus(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "up", "true", "1", "ok":
+		return true, nil
+	case "down", "false", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid status %q, expected UP or DOWN", s)
+}
+
+// parseImportedTimestamp accepts RFC 3339 timestamps and Unix times in
+// seconds.
+func parseImportedTimestamp(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if seconds, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q, expected RFC 3339 or Unix seconds", s)
+}
+
+// readImportedResults reads results as CSV with a header row naming the
+// timestamp and status columns, other columns being ignored, or as a JSON
+// array of {"timestamp": ..., "status": ...} objects.
+func readImportedResults(r io.Reader, contentType string) ([]importedResult, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	var rows [][2]string
+	if mediaType == "text/csv" {
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		header, err := reader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("invalid csv: %w", err)
+		}
+		timestampCol, statusCol := -1, -1
+		for i, name := range header {
+			switch strings.ToLower(strings.TrimSpace(name)) {
+			case "timestamp":
+				timestampCol = i
+			case "status":
+				statusCol = i
+			}
+		}
+		if timestampCol < 0 || statusCol < 0 {
+			return nil, errors.New("csv header must name a timestamp and a status column")
+		}
+		for {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid csv: %w", err)
+			}
+			if timestampCol >= len(record) || statusCol >= len(record) {
+				return nil, fmt.Errorf("line %d: missing columns", len(rows)+2)
+			}
+			rows = append(rows, [2]string{record[timestampCol], record[statusCol]})
+		}
+	} else {
+		var results []struct {
+			Timestamp json.RawMessage `json:"timestamp"`
+			Status    json.RawMessage `json:"status"`
+		}
+		err := json.NewDecoder(r).Decode(&results)
+		if err != nil {
+			return nil, err
+		}
+		for _, result := range results {
+			// Timestamps and statuses may be strings, numbers or booleans.
+			rows = append(rows, [2]string{strings.Trim(string(result.Timestamp), `"`), strings.Trim(string(result.Status), `"`)})
+		}
+	}
+
+	results := make([]importedResult, 0, len(rows))
+	for i, row := range rows {
+		timestamp, err := parseImportedTimestamp(row[0])
+		if err != nil {
+			return nil, fmt.Errorf("result %d: %w", i+1, err)
+		}
+		up, err := parseImportedStatus(row[1])
+		if err != nil {
+			return nil, fmt.Errorf("result %d: %w", i+1, err)
+		}
+		results = append(results, importedResult{Timestamp: timestamp, Up: up})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Timestamp.Before(results[j].Timestamp)
+	})
+	return results, nil
+}
+
+// backfill turns imported results, oldest first, into the check's history
+// up to until, and its daily rollups.
+func backfill(results []importedResult, until time.Time) (importedHistory, []dayRollup) {
+	history := importedHistory{From: results[0].Timestamp, To: until, Outages: []importedOutage{}}
+	var days []dayRollup
+	var down *importedOutage
+	for _, result := range results {
+		day := truncateToDay(result.Timestamp)
+		if len(days) == 0 || days[len(days)-1].Day.Before(day) {
+			days = append(days, dayRollup{Day: day})
+		}
+		today := &days[len(days)-1]
+		today.Total++
+		if result.Up {
+			today.Up++
+		}
+		switch {
+		case !result.Up && down == nil:
+			down = &importedOutage{From: result.Timestamp}
+		case result.Up && down != nil:
+			down.To = result.Timestamp
+			history.Outages = append(history.Outages, *down)
+			down = nil
+		}
+	}
+	if down != nil {
+		// Still down when the imported results end.
+		down.To = until
+		history.Outages = append(history.Outages, *down)
+	}
+	return history, days
+}
+
+// handleImportJobHistory serves POST /jobs/{id}/import, which imports a
+// check's history from another monitoring tool, so that migrating doesn't
+// reset its uptime. Only results from before the check was created count,
+// as this server's own take over from there; importing again replaces the
+// previous import. The import is stored with the check, if checks are.
+func (h *HealthcheckServer) handleImportJobHistory(w http.ResponseWriter, r *http.Request, jobId healthcheckId) {
+	healthcheck, ok := h.GetHealthcheck(jobId)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	results, err := readImportedResults(http.MaxBytesReader(w, r.Body, maxImportBytes), r.Header.Get("Content-Type"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	until := healthcheck.CreatedAt
+	skipped := 0
+	for len(results) > 0 && !results[len(results)-1].Timestamp.Before(until) {
+		results = results[:len(results)-1]
+		skipped++
+	}
+	if len(results) == 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("no results from before the check was created, at %s", until.Format(time.RFC3339)))
+		return
+	}
+	history, days := backfill(results, until)
+	err = h.config.JobStore.saveBackfill(jobId, history, days)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.backfills.set(jobId, history)
+	h.rollups.backfill(jobId, days)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(struct {
+		Imported int `json:"imported"`
+		Skipped  int `json:"skipped"`
+		importedHistory
+	}{len(results), skipped, history})
+}
@@ -0,0 +1,56 @@
+package uptime
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImportedHistoryStored(t *testing.T) {
+	store, err := openJobStore(filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.close()
+	check := func(healthcheck HealthcheckQuery, ctx context.Context) HealthcheckResponse {
+		return HealthcheckResponse{Status: true}
+	}
+	h, _ := newConfiguredTestServer(t, Config{SuppressNotifications: true, JobStore: store}, check)
+	healthcheck := h.AddHealthcheck(HealthcheckQuery{Type: "http", Url: "http://203.0.113.1", ExpectedStatus: 200, Frequency: time.Minute})
+
+	csv := "timestamp,status\n1999-12-31T10:00:00Z,UP\n1999-12-31T11:00:00Z,DOWN\n1999-12-31T12:00:00Z,UP\n"
+	r := httptest.NewRequest(http.MethodPost, "/jobs/"+string(healthcheck.Id)+"/import", strings.NewReader(csv))
+	r.Header.Set("Content-Type", "text/csv")
+	w := httptest.NewRecorder()
+	h.Handler().ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200: %s", w.Code, w.Body)
+	}
+
+	// A server restarted on the same database.
+	restarted, clk := newConfiguredTestServer(t, Config{SuppressNotifications: true, JobStore: store}, check)
+	restored, err := store.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, healthcheck := range restored {
+		restarted.RestoreHealthcheck(healthcheck)
+	}
+	history, ok := restarted.backfills.get(healthcheck.Id)
+	if !ok || len(history.Outages) != 1 {
+		t.Fatalf("got imported history %+v after a restart, want one outage", history)
+	}
+	days := restarted.rollups.history(healthcheck.Id, clk.Now())
+	if yesterday := days[len(days)-2]; yesterday.Up != 2 || yesterday.Total != 3 {
+		t.Errorf("got %d of %d results up the day before the check was created, want 2 of 3", yesterday.Up, yesterday.Total)
+	}
+
+	restarted.StopHealthcheck(healthcheck.Id)
+	if _, _, ok := store.backfill(healthcheck.Id); ok {
+		t.Error("the imported history outlived its check")
+	}
+}
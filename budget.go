@@ -0,0 +1,139 @@
+package uptime
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// runBudgetWindow is the interval check execution time is accounted over.
+const runBudgetWindow = time.Minute
+
+// runBudget accounts for the time workers spend running checks. The
+// budget of a window is the time all workers together have in it; once
+// the schedule consumes most of it, a burst or a few slow targets are
+// enough for due checks to start waiting for a worker, and so run late.
+// Crossing AlertAt is logged, exposed on /metrics and, if WebhookUrl is
+// set, posted to it, as is falling back below it.
+type runBudget struct {
+	logger     *slog.Logger
+	AlertAt    float64
+	WebhookUrl string
+
+	mu       sync.Mutex
+	consumed time.Duration
+	total    time.Duration
+	// utilization is the fraction of the budget used in the last full
+	// window.
+	utilization float64
+	exceeded    bool
+}
+
+type runBudgetAlert struct {
+	Event       string  `json:"event"`
+	Utilization float64 `json:"utilization"`
+	Consumed    float64 `json:"consumed_seconds"`
+	Budget      float64 `json:"budget_seconds"`
+	Workers     int     `json:"workers"`
+	Waiting     int     `json:"waiting"`
+	Skipped     int64   `json:"skipped_runs"`
+}
+
+// record accounts for a check run. A nil runBudget discards it.
+func (b *runBudget) record(d time.Duration) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.consumed += d
+	b.total += d
+}
+
+// close ends a window in which workers had budget to spend, and reports
+// the window's utilization and whether it crossed AlertAt either way.
+func (b *runBudget) close(budget time.Duration) (consumed time.Duration, utilization float64, changed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	consumed = b.consumed
+	b.consumed = 0
+	if budget > 0 {
+		utilization = float64(consumed) / float64(budget)
+	}
+	b.utilization = utilization
+	exceeded := utilization >= b.AlertAt
+	changed = exceeded != b.exceeded
+	b.exceeded = exceeded
+	return consumed, utilization, changed
+}
+
+// watchRunBudget closes a window every runBudgetWindow.
+func (h *HealthcheckServer) watchRunBudget() {
+	b := h.config.RunBudget
+	ticker := time.NewTicker(runBudgetWindow)
+	defer ticker.Stop()
+	for tick(ticker, h.done) {
+		stats := h.scheduler.stats()
+		budget := time.Duration(stats.Workers) * runBudgetWindow
+		consumed, utilization, changed := b.close(budget)
+		if !changed {
+			continue
+		}
+		alert := runBudgetAlert{
+			Event:       "run_budget_recovered",
+			Utilization: utilization,
+			Consumed:    consumed.Seconds(),
+			Budget:      budget.Seconds(),
+			Workers:     stats.Workers,
+			Waiting:     stats.Waiting,
+			Skipped:     stats.Skipped,
+		}
+		attrs := []any{
+			slog.Float64("utilization", utilization),
+			slog.Duration("consumed", consumed),
+			slog.Duration("budget", budget),
+			slog.Int("waiting", stats.Waiting),
+		}
+		if utilization >= b.AlertAt {
+			alert.Event = "run_budget_exceeded"
+			h.logger.Warn("run-budget-exceeded", attrs...)
+		} else {
+			h.logger.Info("run-budget-recovered", attrs...)
+		}
+		if b.WebhookUrl != "" {
+			b.notify(alert)
+		}
+	}
+}
+
+func (b *runBudget) notify(alert runBudgetAlert) {
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		return
+	}
+	resp, err := webhookClient.Post(b.WebhookUrl, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		b.logger.Error("run-budget-notify-failed", slog.String("url", b.WebhookUrl), slog.String("error", err.Error()))
+		return
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBytes))
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		b.logger.Error("run-budget-notify-failed", slog.String("url", b.WebhookUrl), slog.Int("status", resp.StatusCode))
+	}
+}
+
+func (b *runBudget) writeMetrics(w io.Writer) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	total, utilization := b.total, b.utilization
+	b.mu.Unlock()
+	writeFloatMetric(w, "uptime_run_budget_utilization", "gauge", "Fraction of the workers' time spent running checks over the last minute.", utilization)
+	writeFloatMetric(w, "uptime_run_budget_consumed_seconds_total", "counter", "Time spent running checks.", total.Seconds())
+}
@@ -0,0 +1,133 @@
+package uptime
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// maxBulkJobs is how many checks a single bulk request may create.
+const maxBulkJobs = 1000
+
+// handleBulkAddJobs serves POST /jobs/bulk, which creates every check of
+// a JSON array at once, or none of them if any is invalid or, unless
+// ?force=true, duplicates an existing check or another of the array. It
+// returns the created checks, in the order given.
+func (h *HealthcheckServer) handleBulkAddJobs(w http.ResponseWriter, r *http.Request) {
+	var definitions []json.RawMessage
+	err := json.NewDecoder(r.Body).Decode(&definitions)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(definitions) == 0 || len(definitions) > maxBulkJobs {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("expected from 1 to %d jobs, got %d", maxBulkJobs, len(definitions)))
+		return
+	}
+	force := r.URL.Query().Get("force") == "true"
+	actor := requestActor(r)
+	healthchecks := make([]HealthcheckQuery, 0, len(definitions))
+	for i, definition := range definitions {
+		var healthcheck HealthcheckQuery
+		err = json.Unmarshal(definition, &healthcheck)
+		if err == nil {
+			err = h.config.AddressPolicy.validateTarget(healthcheck)
+		}
+		if err == nil {
+			err = healthcheck.validateRunAt(h.clock.Now())
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("job %d: %w", i, err))
+			return
+		}
+		for j := 0; !force && j < len(healthchecks); j++ {
+			if healthchecks[j].equivalent(healthcheck) {
+				writeError(w, http.StatusConflict, fmt.Errorf("job %d: equivalent to job %d, use ?force=true to create both", i, j))
+				return
+			}
+		}
+		healthcheck.CreatedBy = actor
+		healthchecks = append(healthchecks, healthcheck)
+	}
+	healthchecks, i, existingId := h.addHealthchecksUnlessDuplicate(healthchecks, force)
+	if healthchecks == nil {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(struct {
+			Error      string        `json:"error"`
+			Index      int           `json:"index"`
+			ExistingId healthcheckId `json:"existing_id"`
+		}{
+			Error:      fmt.Sprintf("job %d: an equivalent job already exists (id %s), use ?force=true to create it anyway", i, existingId),
+			Index:      i,
+			ExistingId: existingId,
+		})
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(healthchecks)
+}
+
+// addHealthchecksUnlessDuplicate adds the healthchecks, unless force is
+// false and one of them is equivalent to an existing check, in which case
+// it adds none and returns nil along with that one's index and the id of
+// the check it duplicates. Checking under the lock that adds them keeps
+// concurrent requests from both adding the same check.
+func (h *HealthcheckServer) addHealthchecksUnlessDuplicate(healthchecks []HealthcheckQuery, force bool) ([]HealthcheckQuery, int, healthcheckId) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i := 0; !force && i < len(healthchecks); i++ {
+		if existingId, ok := h.findDuplicateLocked(healthchecks[i]); ok {
+			return nil, i, existingId
+		}
+	}
+	added := make([]HealthcheckQuery, 0, len(healthchecks))
+	for _, healthcheck := range healthchecks {
+		added = append(added, h.addHealthcheckLocked(healthcheck))
+	}
+	return added, 0, ""
+}
+
+// handleBulkDeleteJobs serves DELETE /jobs/bulk, which deletes the checks
+// given by ?id=, by id or alias, or those having every ?tag=, and returns
+// them. Nothing is deleted if any id is unknown.
+func (h *HealthcheckServer) handleBulkDeleteJobs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	ids, tags := query["id"], query["tag"]
+	if len(ids) == 0 == (len(tags) == 0) {
+		writeError(w, http.StatusBadRequest, errors.New("expected either id or tag"))
+		return
+	}
+	var healthchecks []HealthcheckQuery
+	if len(ids) > 0 {
+		for _, s := range ids {
+			id, ok := h.resolveId(s)
+			if !ok {
+				writeError(w, http.StatusNotFound, fmt.Errorf("unknown job %q", s))
+				return
+			}
+			healthcheck, _ := h.GetHealthcheck(id)
+			healthchecks = append(healthchecks, healthcheck)
+		}
+	} else {
+		for _, healthcheck := range h.ListHealthchecks() {
+			if healthcheck.hasTags(tags) {
+				healthchecks = append(healthchecks, healthcheck)
+			}
+		}
+	}
+	deleted := []HealthcheckQuery{}
+	var deletedIds []healthcheckId
+	seen := make(map[healthcheckId]bool)
+	for _, healthcheck := range healthchecks {
+		if seen[healthcheck.Id] {
+			continue
+		}
+		seen[healthcheck.Id] = true
+		deletedIds = append(deletedIds, healthcheck.Id)
+		deleted = append(deleted, healthcheck)
+	}
+	h.StopHealthchecks(deletedIds)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(deleted)
+}
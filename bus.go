@@ -0,0 +1,149 @@
+package uptime
+
+import (
+	"sync"
+	"time"
+)
+
+// The events published on the bus.
+const (
+	// busCheckScheduled is published when a check is handed to the
+	// scheduler, busCheckStarted when one of its runs starts and
+	// busCheckCompleted with the result once it is done.
+	busCheckScheduled = "check-scheduled"
+	busCheckStarted   = "check-started"
+	busCheckCompleted = "check-completed"
+	// busResultUploaded is published with a result run elsewhere, by an
+	// agent.
+	busResultUploaded = "result-uploaded"
+	// busStateChanged is published when a check changes state, including
+	// from UNKNOWN on its first result.
+	busStateChanged = "state-changed"
+	// busNotificationSent is published once a notification was delivered,
+	// or failed to be.
+	busNotificationSent = "notification-sent"
+)
+
+// busEvent is something that happened to a check. Which fields are set
+// depends on its type.
+type busEvent struct {
+	Type string
+	Job  HealthcheckQuery
+	Time time.Time
+	// Result is the result of completed checks, uploaded results and the
+	// result changing a check's state.
+	Result HealthcheckResponse
+	// From, To and Incident describe state changes; Suppressed is set when
+	// they shouldn't be notified.
+	From       string
+	To         string
+	Incident   *incident
+	Suppressed bool
+	// Channel is where a notification went: the URL it was POSTed to,
+	// "email", or the notifier plugin; Err is why it failed, if it did.
+	Channel string
+	Err     error
+}
+
+// busSubscriber is a subsystem following what happens to checks. It is
+// handed events synchronously, in the order they are published, so it
+// must not block; subsystems with slow work queue it.
+type busSubscriber interface {
+	handle(event busEvent)
+}
+
+// eventBus hands the events subsystems subscribed to over to them, in the
+// order they subscribed. A nil eventBus discards everything.
+type eventBus struct {
+	mu          sync.RWMutex
+	subscribers map[string][]busSubscriber
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subscribers: make(map[string][]busSubscriber)}
+}
+
+func (b *eventBus) subscribe(s busSubscriber, types ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, t := range types {
+		b.subscribers[t] = append(b.subscribers[t], s)
+	}
+}
+
+func (b *eventBus) publish(event busEvent) {
+	if b == nil {
+		return
+	}
+	b.mu.RLock()
+	subscribers := b.subscribers[event.Type]
+	b.mu.RUnlock()
+	for _, s := range subscribers {
+		s.handle(event)
+	}
+}
+
+// logEvent returns the event as written to the event log and streamed,
+// for results and state changes.
+func (e busEvent) logEvent() (logEvent, bool) {
+	switch e.Type {
+	case busCheckCompleted, busResultUploaded:
+		return logEvent{Time: e.Result.Timestamp, Type: eventResult, Job: &e.Job, Result: &e.Result}, true
+	case busStateChanged:
+		return logEvent{Time: e.Time, Type: eventState, From: e.From, To: e.To, Job: &e.Job}, true
+	}
+	return logEvent{}, false
+}
+
+func (u *uptimeRollups) handle(e busEvent) {
+	u.record(e.Job.Id, e.Result)
+}
+
+func (l *locationResults) handle(e busEvent) {
+	l.record(e.Job.Id, e.Result)
+}
+
+func (s *resultStore) handle(e busEvent) {
+	s.record(e.Job.Id, e.Result)
+}
+
+func (m *checkMetrics) handle(e busEvent) {
+	if e.Type == busNotificationSent {
+		m.recordNotification(e.Job.Id, e.Err)
+		return
+	}
+	m.record(e.Job, e.Result)
+}
+
+func (s *staleChecks) handle(e busEvent) {
+	s.record(e.Job.Id, e.Result, e.Time)
+}
+
+func (l *eventLog) handle(e busEvent) {
+	if event, ok := e.logEvent(); ok {
+		l.write(event)
+	}
+}
+
+func (s *eventStream) handle(e busEvent) {
+	if event, ok := e.logEvent(); ok {
+		s.publish(event)
+	}
+}
+
+func (s *logShipper) handle(e busEvent) {
+	s.ship(e.Job, e.Result)
+}
+
+func (u *resultUploader) handle(e busEvent) {
+	u.record(e.Job, e.Result)
+}
+
+// handle notifies state changes, but not a check's first result, which
+// isn't a transition.
+func (n *transitionNotifier) handle(e busEvent) {
+	if e.From == "UNKNOWN" || e.Suppressed {
+		return
+	}
+	n.notify(e.Job, e.From, e.To, e.Result, e.Incident)
+}
@@ -0,0 +1,81 @@
+package uptime
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const icalTimeFormat = "20060102T150405Z"
+
+var icalEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+
+// writeICalLine writes a content line, folded at 75 octets as RFC 5545
+// requires.
+func writeICalLine(b *bytes.Buffer, name string, value string) {
+	line := name + ":" + value
+	for len(line) > 75 {
+		cut := 75
+		for cut > 1 && line[cut]&0xC0 == 0x80 {
+			// Don't split a UTF-8 sequence.
+			cut--
+		}
+		b.WriteString(line[:cut] + "\r\n")
+		line = " " + line[cut:]
+	}
+	b.WriteString(line + "\r\n")
+}
+
+// incidentCalendar renders incidents as an iCalendar feed. Open incidents
+// end now, and grow every time the feed is refreshed.
+func incidentCalendar(incidents []*incident, now time.Time) []byte {
+	var b bytes.Buffer
+	writeICalLine(&b, "BEGIN", "VCALENDAR")
+	writeICalLine(&b, "VERSION", "2.0")
+	writeICalLine(&b, "PRODID", "-//uptime-checker//incidents//EN")
+	writeICalLine(&b, "X-WR-CALNAME", "Uptime incidents")
+	for _, i := range incidents {
+		end := now
+		state := "ongoing"
+		if i.ClosedAt != nil {
+			end = *i.ClosedAt
+			state = "resolved"
+		}
+		description := fmt.Sprintf("Check #%d %s went down at %s, %s.", i.alias, i.url, i.OpenedAt.UTC().Format(time.RFC3339), state)
+		if i.AcknowledgedAt != nil {
+			description += "\nAcknowledged at " + i.AcknowledgedAt.UTC().Format(time.RFC3339)
+			if i.AcknowledgedBy != "" {
+				description += " by " + i.AcknowledgedBy
+			}
+			description += "."
+		}
+		if i.Deploy != nil {
+			description += fmt.Sprintf("\nFollowing the deploy of %s %s at %s.", i.Deploy.Service, i.Deploy.Version, i.Deploy.Timestamp.UTC().Format(time.RFC3339))
+		}
+
+		writeICalLine(&b, "BEGIN", "VEVENT")
+		writeICalLine(&b, "UID", i.Id+"@uptime-checker")
+		writeICalLine(&b, "DTSTAMP", now.UTC().Format(icalTimeFormat))
+		writeICalLine(&b, "DTSTART", i.OpenedAt.UTC().Format(icalTimeFormat))
+		writeICalLine(&b, "DTEND", end.UTC().Format(icalTimeFormat))
+		writeICalLine(&b, "SUMMARY", icalEscaper.Replace(fmt.Sprintf("DOWN: #%d %s", i.alias, i.url)))
+		writeICalLine(&b, "DESCRIPTION", icalEscaper.Replace(description))
+		writeICalLine(&b, "END", "VEVENT")
+	}
+	writeICalLine(&b, "END", "VCALENDAR")
+	return b.Bytes()
+}
+
+// handleCalendar serves GET /calendar.ics, a feed of past and ongoing
+// incidents calendar apps can subscribe to.
+func (h *HealthcheckServer) handleCalendar(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(incidentCalendar(h.incidents.list(), h.clock.Now()))
+}
@@ -0,0 +1,166 @@
+package uptime
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"time"
+)
+
+// checkTypeTLS inspects the certificate of an HTTPS endpoint, to catch
+// certificates about to expire before they do.
+const checkTypeTLS = "tls"
+
+// defaultExpiryDays is how many days before its certificate expires a tls
+// check fails, unless it says otherwise.
+const defaultExpiryDays = 14
+
+var tlsPorts = map[string]string{
+	"https": "443",
+}
+
+// TLSQuery is how close to expiry a tls check lets a certificate get:
+// within WarnDays, if set, the check is DEGRADED, and within ExpiryDays it
+// fails.
+type TLSQuery struct {
+	ExpiryDays int `json:"expiry_days"`
+	WarnDays   int `json:"warn_days,omitempty"`
+}
+
+func (q *TLSQuery) validate() error {
+	if q.ExpiryDays == 0 {
+		q.ExpiryDays = defaultExpiryDays
+	}
+	if q.ExpiryDays < 0 {
+		return fmt.Errorf("invalid tls.expiry_days %d, must be positive", q.ExpiryDays)
+	}
+	if q.WarnDays < 0 || q.WarnDays != 0 && q.WarnDays <= q.ExpiryDays {
+		return fmt.Errorf("invalid tls.warn_days %d, must be more than expiry_days", q.WarnDays)
+	}
+	return nil
+}
+
+func (q *TLSQuery) equal(other *TLSQuery) bool {
+	if q == nil || other == nil {
+		return q == other
+	}
+	return q.ExpiryDays == other.ExpiryDays && q.WarnDays == other.WarnDays
+}
+
+// certificateInfo describes the leaf certificate a tls check was
+// presented.
+type certificateInfo struct {
+	Subject       string    `json:"subject"`
+	Issuer        string    `json:"issuer"`
+	NotAfter      time.Time `json:"not_after"`
+	DaysRemaining int       `json:"days_remaining"`
+}
+
+// normalizeTLSURL normalizes the address of a tls check, given as
+// https://host[:port] or just host[:port].
+func normalizeTLSURL(raw string) (string, error) {
+	normalized, err := normalizeURLSchemes(raw, "https", tlsPorts)
+	if err != nil {
+		return "", err
+	}
+	u, _ := url.Parse(normalized)
+	if u.Path != "" && u.Path != "/" || u.RawQuery != "" {
+		return "", fmt.Errorf("invalid url %q: tls urls can't have a path or query", raw)
+	}
+	u.Path = ""
+	return u.String(), nil
+}
+
+// dialProbeTLS connects to address over TLS, the way probes connect; see
+// probeDialer.
+func dialProbeTLS(ctx context.Context, address string, config *tls.Config) (*tls.Conn, error) {
+	dialer, err := probeDialer(ctx, "tcp")
+	if err != nil {
+		return nil, err
+	}
+	rawConn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	conn := tls.Client(countTransfer(ctx, rawConn), config)
+	err = conn.HandshakeContext(ctx)
+	if err != nil {
+		rawConn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// checkTLS connects to the check's host and verifies the certificate chain
+// it presents against the system roots. It fails if the chain doesn't
+// verify, or the leaf certificate expires within TLS.ExpiryDays, and is
+// DEGRADED if it expires within TLS.WarnDays; either way the result
+// describes the certificate.
+func (h HealthcheckQuery) checkTLS(ctx context.Context) HealthcheckResponse {
+	u, err := url.Parse(h.Url)
+	if err != nil {
+		return failCheck(ctx, "%v", err)
+	}
+	query := h.TLS
+	if query == nil {
+		query = &TLSQuery{ExpiryDays: defaultExpiryDays}
+	}
+	timeout := h.timeout()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	port := u.Port()
+	if port == "" {
+		port = tlsPorts[u.Scheme]
+	}
+	// The chain is verified below, so that a certificate is described even
+	// if it doesn't verify.
+	conn, err := dialProbeTLS(ctx, net.JoinHostPort(u.Hostname(), port), &tls.Config{ServerName: u.Hostname(), InsecureSkipVerify: true})
+	if err != nil {
+		return failCheck(ctx, "%v", err)
+	}
+	defer conn.Close()
+	certificates := conn.ConnectionState().PeerCertificates
+	if len(certificates) == 0 {
+		return failCheckReason(ctx, reasonTLSFailed, "No certificate presented")
+	}
+	leaf := certificates[0]
+	now := time.Now()
+	info := &certificateInfo{
+		Subject:       leaf.Subject.String(),
+		Issuer:        leaf.Issuer.String(),
+		NotAfter:      leaf.NotAfter,
+		DaysRemaining: int(math.Floor(leaf.NotAfter.Sub(now).Hours() / 24)),
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, certificate := range certificates[1:] {
+		intermediates.AddCert(certificate)
+	}
+	_, err = leaf.Verify(x509.VerifyOptions{
+		DNSName:       u.Hostname(),
+		Intermediates: intermediates,
+		CurrentTime:   now,
+	})
+	var result HealthcheckResponse
+	switch {
+	case err != nil:
+		result = failCheckReason(ctx, reasonTLSFailed, "Certificate doesn't verify: %v", err)
+	case info.DaysRemaining < query.ExpiryDays:
+		result = failCheckReason(ctx, reasonCertificateExpiring, "Certificate expires in %d days, on %s", info.DaysRemaining, leaf.NotAfter.Format(time.DateOnly))
+	case info.DaysRemaining < query.WarnDays:
+		result = HealthcheckResponse{
+			Status: true,
+			State:  stateDegraded,
+			Reason: reasonCertificateExpiring,
+			Error:  fmt.Sprintf("Certificate expires in %d days, on %s", info.DaysRemaining, leaf.NotAfter.Format(time.DateOnly)),
+		}
+	default:
+		result = HealthcheckResponse{Status: true}
+	}
+	result.Certificate = info
+	return result
+}
@@ -0,0 +1,216 @@
+package uptime
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// maxChatRequestAge is how old a signed Slack request may be, so that
+	// a captured request can't be replayed later.
+	maxChatRequestAge = 5 * time.Minute
+	// maxChatStatusLines caps how many checks a status reply lists.
+	maxChatStatusLines = 20
+)
+
+const chatHelp = "Usage:\n" +
+	"  status [query]              overview, or checks whose alias, group or URL matches the query\n" +
+	"  pause <alias|id> [duration] pause a check, resuming it after the duration if given\n" +
+	"  resume <alias|id>           resume a paused check"
+
+var errChatUnauthorized = errors.New("invalid chat command signature")
+
+// verifyChatRequest checks a slash command request against the configured
+// secrets: Slack signs the body with the signing secret, Mattermost sends
+// its token along with the command.
+func (h *HealthcheckServer) verifyChatRequest(r *http.Request, body []byte, form url.Values) error {
+	if secret := h.config.ChatOpsSigningSecret; secret != "" && r.Header.Get("X-Slack-Signature") != "" {
+		timestamp := r.Header.Get("X-Slack-Request-Timestamp")
+		seconds, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return errChatUnauthorized
+		}
+		if age := h.clock.Now().Sub(time.Unix(seconds, 0)); age > maxChatRequestAge || age < -maxChatRequestAge {
+			return errChatUnauthorized
+		}
+		mac := hmac.New(sha256.New, []byte(secret))
+		fmt.Fprintf(mac, "v0:%s:", timestamp)
+		mac.Write(body)
+		expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+		if !hmac.Equal([]byte(expected), []byte(r.Header.Get("X-Slack-Signature"))) {
+			return errChatUnauthorized
+		}
+		return nil
+	}
+	if token := h.config.ChatOpsToken; token != "" && form.Get("token") != "" {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(form.Get("token"))) != 1 {
+			return errChatUnauthorized
+		}
+		return nil
+	}
+	return errChatUnauthorized
+}
+
+// handleChatCommand serves POST /chatops/command, the target of a Slack or
+// Mattermost slash command such as "/uptime status api" or
+// "/uptime pause 12 30m".
+func (h *HealthcheckServer) handleChatCommand(w http.ResponseWriter, r *http.Request) {
+	if h.config.ChatOpsSigningSecret == "" && h.config.ChatOpsToken == "" {
+		writeError(w, http.StatusNotFound, errors.New("chat commands aren't configured"))
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 64<<10))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	err = h.verifyChatRequest(r, body, form)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	reply := h.runChatCommand(strings.Fields(form.Get("text")))
+	h.logger.Info("chat-command",
+		slog.String("user", form.Get("user_name")),
+		slog.String("text", form.Get("text")),
+	)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(struct {
+		ResponseType string `json:"response_type"`
+		Text         string `json:"text"`
+	}{"ephemeral", reply})
+}
+
+func (h *HealthcheckServer) runChatCommand(args []string) string {
+	if len(args) == 0 {
+		return chatHelp
+	}
+	switch args[0] {
+	case "status":
+		return h.chatStatus(strings.Join(args[1:], " "))
+	case "pause":
+		if len(args) < 2 || len(args) > 3 {
+			return chatHelp
+		}
+		var resumeAfter time.Duration
+		if len(args) == 3 {
+			d, err := time.ParseDuration(args[2])
+			if err != nil || d <= 0 {
+				return fmt.Sprintf("Invalid duration %q.", args[2])
+			}
+			resumeAfter = d
+		}
+		return h.chatSetPaused(args[1], true, resumeAfter)
+	case "resume":
+		if len(args) != 2 {
+			return chatHelp
+		}
+		return h.chatSetPaused(args[1], false, 0)
+	default:
+		return chatHelp
+	}
+}
+
+func chatCheckName(healthcheck HealthcheckQuery) string {
+	name := fmt.Sprintf("#%d %s", healthcheck.Alias, healthcheck.Url)
+	if healthcheck.Group != "" {
+		name += " (" + healthcheck.Group + ")"
+	}
+	return name
+}
+
+func (h *HealthcheckServer) chatStatus(query string) string {
+	var b bytes.Buffer
+	if query == "" {
+		summary := h.summarize(0)
+		fmt.Fprintf(&b, "%d up, %d down, %d degraded, %d paused, %d unknown",
+			summary.States["up"], summary.States["down"], summary.States["degraded"],
+			summary.States["paused"], summary.States["unknown"])
+		for _, failure := range summary.Failing {
+			fmt.Fprintf(&b, "\n#%d %s: DOWN, %s", failure.Alias, failure.Url, failure.Error)
+		}
+		return b.String()
+	}
+
+	matched := 0
+	for _, healthcheck := range h.ListHealthchecks() {
+		if strconv.Itoa(healthcheck.Alias) != query && healthcheck.Group != query && !strings.Contains(healthcheck.Url, query) {
+			continue
+		}
+		matched++
+		if matched > maxChatStatusLines {
+			continue
+		}
+		status := "UNKNOWN"
+		if resp, ok := h.rollups.latest(healthcheck.Id); ok {
+			status = resp.statusString()
+		}
+		if healthcheck.Paused {
+			status = "PAUSED"
+		}
+		if b.Len() > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(chatCheckName(healthcheck) + ": " + status)
+	}
+	if matched == 0 {
+		return fmt.Sprintf("No checks match %q.", query)
+	}
+	if matched > maxChatStatusLines {
+		fmt.Fprintf(&b, "\n... and %d more", matched-maxChatStatusLines)
+	}
+	return b.String()
+}
+
+// chatSetPaused pauses or resumes a check. A check paused for a while is
+// resumed then, unless it is resumed, paused again or deleted in the
+// meantime.
+func (h *HealthcheckServer) chatSetPaused(ref string, paused bool, resumeAfter time.Duration) string {
+	if h.config.ReadOnly {
+		return "The server is in read-only mode, changes are rejected."
+	}
+	id, ok := h.resolveId(ref)
+	if !ok {
+		return fmt.Sprintf("No check %q.", ref)
+	}
+	var resumeAt time.Time
+	if paused && resumeAfter > 0 {
+		resumeAt = h.clock.Now().Add(resumeAfter)
+	}
+	healthcheck, ok := h.setJobPaused(id, paused, resumeAt)
+	if !ok {
+		return fmt.Sprintf("No check %q.", ref)
+	}
+	if !paused {
+		return "Resumed " + chatCheckName(healthcheck)
+	}
+	if resumeAfter == 0 {
+		return "Paused " + chatCheckName(healthcheck)
+	}
+	return fmt.Sprintf("Paused %s for %s", chatCheckName(healthcheck), resumeAfter)
+}
@@ -0,0 +1,80 @@
+package uptime
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The example request of Slack's "Verifying requests from Slack"
+// documentation.
+const (
+	slackExampleSecret    = "8f742231b10e8888abcd99yyyzzz85a5"
+	slackExampleTimestamp = "1531420618"
+	slackExampleBody      = "token=xyzz0WbapA4vBCDEFasx0q6G&team_id=T1DC2JH3J&team_domain=testteamnow&channel_id=G8PSS9T3V&channel_name=foobar&user_id=U2CERLKJA&user_name=roadrunner&command=%2Fwebhook-collect&text=&response_url=https%3A%2F%2Fhooks.slack.com%2Fcommands%2FT1DC2JH3J%2F397700885554%2F96rGlfmibIGlgcZRskXaIFfN&trigger_id=398738663015.47445629121.803a0bc887a14d10d2c447fce8b6703c"
+	slackExampleSignature = "v0=a2114d57b48eac39b9ad189dd8316235a7b4a8d21a10bd27519666489c69b503"
+)
+
+func slackSignature(secret string, timestamp string, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestChatCommandSignatures(t *testing.T) {
+	h, _ := newTestServer(t, func(healthcheck HealthcheckQuery, ctx context.Context) HealthcheckResponse {
+		return HealthcheckResponse{Status: true}
+	})
+	h.config.ChatOpsSigningSecret = slackExampleSecret
+	h.config.ChatOpsToken = "mattermost-token"
+	now := time.Unix(1531420618, 0)
+	stale := fmt.Sprint(now.Add(-maxChatRequestAge - time.Second).Unix())
+	early := fmt.Sprint(now.Add(maxChatRequestAge + time.Second).Unix())
+	recent := fmt.Sprint(now.Add(-maxChatRequestAge + time.Second).Unix())
+	status := "text=status&token="
+
+	tests := []struct {
+		name      string
+		timestamp string
+		signature string
+		body      string
+		status    int
+	}{
+		{"slack example", slackExampleTimestamp, slackExampleSignature, slackExampleBody, http.StatusOK},
+		{"recent enough", recent, slackSignature(slackExampleSecret, recent, status), status, http.StatusOK},
+		{"altered body", slackExampleTimestamp, slackExampleSignature, strings.Replace(slackExampleBody, "text=", "text=pause+1", 1), http.StatusUnauthorized},
+		{"wrong secret", slackExampleTimestamp, slackSignature("other", slackExampleTimestamp, slackExampleBody), slackExampleBody, http.StatusUnauthorized},
+		{"uppercase signature", slackExampleTimestamp, strings.ToUpper(slackExampleSignature), slackExampleBody, http.StatusUnauthorized},
+		{"stale", stale, slackSignature(slackExampleSecret, stale, status), status, http.StatusUnauthorized},
+		{"from the future", early, slackSignature(slackExampleSecret, early, status), status, http.StatusUnauthorized},
+		{"timestamp not signed", recent, slackSignature(slackExampleSecret, slackExampleTimestamp, status), status, http.StatusUnauthorized},
+		{"invalid timestamp", "soon", slackSignature(slackExampleSecret, "soon", status), status, http.StatusUnauthorized},
+		{"no timestamp", "", slackSignature(slackExampleSecret, "", status), status, http.StatusUnauthorized},
+		{"mattermost token", "", "", "text=status&token=mattermost-token", http.StatusOK},
+		{"wrong mattermost token", "", "", "text=status&token=mattermost-tokem", http.StatusUnauthorized},
+		{"unsigned", "", "", "text=status", http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		h.clock = newSimulatedClock(now)
+		r := httptest.NewRequest(http.MethodPost, "/chatops/command", strings.NewReader(test.body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if test.timestamp != "" {
+			r.Header.Set("X-Slack-Request-Timestamp", test.timestamp)
+		}
+		if test.signature != "" {
+			r.Header.Set("X-Slack-Signature", test.signature)
+		}
+		w := httptest.NewRecorder()
+		h.Handler().ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Errorf("%s: got status %d, want %d: %s", test.name, w.Code, test.status, w.Body)
+		}
+	}
+}
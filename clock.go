@@ -0,0 +1,108 @@
+package uptime
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the scheduler's source of time. The real clock is used when
+// serving; a simulated one lets the scheduling logic be stepped through
+// deterministically, much faster than real time.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a timer of a Clock, firing once.
+type Timer interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+type realTimer struct {
+	t *time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.t.C
+}
+
+func (t realTimer) Stop() {
+	t.t.Stop()
+}
+
+// simulatedClock only moves when Advance is called.
+type simulatedClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers map[*simulatedTimer]struct{}
+}
+
+func newSimulatedClock(start time.Time) *simulatedClock {
+	return &simulatedClock{
+		now:    start,
+		timers: make(map[*simulatedTimer]struct{}),
+	}
+}
+
+func (c *simulatedClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *simulatedClock) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &simulatedTimer{
+		clock: c,
+		when:  c.now.Add(d),
+		c:     make(chan time.Time, 1),
+	}
+	if d <= 0 {
+		t.c <- c.now
+		return t
+	}
+	c.timers[t] = struct{}{}
+	return t
+}
+
+// Advance moves the clock forward by d, firing every timer that expires in
+// between.
+func (c *simulatedClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	for t := range c.timers {
+		if !t.when.After(c.now) {
+			t.c <- t.when
+			delete(c.timers, t)
+		}
+	}
+}
+
+type simulatedTimer struct {
+	clock *simulatedClock
+	when  time.Time
+	c     chan time.Time
+}
+
+func (t *simulatedTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *simulatedTimer) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	delete(t.clock.timers, t)
+}
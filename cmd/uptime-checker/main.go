@@ -0,0 +1,8 @@
+// Command uptime-checker runs the uptime checker server.
+package main
+
+import uptime "github.com/otonnesen/uptime-checker"
+
+func main() {
+	uptime.Main()
+}
@@ -0,0 +1,62 @@
+package uptime
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// checksFile is the declarative configuration format: a YAML (or JSON)
+// document with a list of checks, each using the same fields as the jobs
+// API.
+type checksFile struct {
+	Checks []interface{} `yaml:"checks"`
+}
+
+// readChecksFile parses a checks file and returns the JSON encoding of
+// each of its checks, so they can be decoded (and validated) exactly like
+// API requests.
+func readChecksFile(path string) ([][]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseChecksFile(data)
+}
+
+func parseChecksFile(data []byte) ([][]byte, error) {
+	var file checksFile
+	err := yaml.Unmarshal(data, &file)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file: %w", err)
+	}
+	checks := make([][]byte, len(file.Checks))
+	for i, check := range file.Checks {
+		checks[i], err = json.Marshal(check)
+		if err != nil {
+			return nil, fmt.Errorf("invalid check %d: %w", i, err)
+		}
+	}
+	return checks, nil
+}
+
+// loadChecksFile reads and validates every check in a checks file.
+func loadChecksFile(path string, policy *addressPolicy) ([]HealthcheckQuery, error) {
+	data, err := readChecksFile(path)
+	if err != nil {
+		return nil, err
+	}
+	checks := make([]HealthcheckQuery, len(data))
+	for i := range data {
+		err = json.Unmarshal(data[i], &checks[i])
+		if err == nil {
+			err = policy.validateTarget(checks[i])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("check %d: %w", i, err)
+		}
+	}
+	return checks, nil
+}
@@ -0,0 +1,39 @@
+package uptime
+
+import (
+	"context"
+	"fmt"
+)
+
+// correlationHeader carries a run's correlation id on outgoing probe
+// requests, so a run can also be found in the target's logs.
+const correlationHeader = "X-Correlation-Id"
+
+type correlationIdKey struct{}
+
+// withCorrelationId returns a context for a single check run, identified
+// by a new correlation id that is logged, stored with the result and
+// included in notifications.
+func withCorrelationId(ctx context.Context) (context.Context, string) {
+	id := newUUID()
+	return context.WithValue(ctx, correlationIdKey{}, id), id
+}
+
+func correlationId(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIdKey{}).(string)
+	return id
+}
+
+// failCheck returns a failed result explaining why the check run failed.
+// Its reason is classified from the first error among args.
+func failCheck(ctx context.Context, format string, args ...interface{}) HealthcheckResponse {
+	result := failCheckReason(ctx, failureReason(args), format, args...)
+	result.targetGone = targetGone(args)
+	result.transient = transientError(args)
+	return result
+}
+
+// failCheckReason returns a failed result with the given reason code.
+func failCheckReason(ctx context.Context, reason string, format string, args ...interface{}) HealthcheckResponse {
+	return HealthcheckResponse{Status: false, Reason: reason, Error: fmt.Sprintf(format, args...)}
+}
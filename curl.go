@@ -0,0 +1,305 @@
+package uptime
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// curlFlags are the curl options that don't change the request a check
+// makes, and are ignored.
+var curlFlags = map[string]bool{
+	"-s": true, "--silent": true,
+	"-S": true, "--show-error": true,
+	"-v": true, "--verbose": true,
+	"-i": true, "--include": true,
+	"-L": true, "--location": true,
+	"-f": true, "--fail": true,
+	"--compressed": true,
+	"-g":           true, "--globoff": true,
+}
+
+// curlIgnoredOptions are the curl options taking an argument that don't
+// change the request a check makes, and are ignored.
+var curlIgnoredOptions = map[string]bool{
+	"-o": true, "--output": true,
+	"-m": true, "--max-time": true,
+	"--connect-timeout": true,
+	"-w":                true, "--write-out": true,
+	"--retry": true,
+}
+
+// parseCurl turns a curl command line into the fields of an equivalent
+// check. Options that would make the check differ from the command are
+// rejected rather than dropped.
+func parseCurl(command string) (map[string]interface{}, error) {
+	args, err := splitShellWords(command)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 || args[0] != "curl" {
+		return nil, errors.New("not a curl command")
+	}
+	var method, rawUrl, contentType string
+	var data []string
+	headers := map[string]string{}
+	var basicAuth *BasicAuth
+	get := false
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		value := func() (string, error) {
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("option %s requires an argument", arg)
+			}
+			i++
+			return args[i], nil
+		}
+		// --option=value
+		if strings.HasPrefix(arg, "--") && strings.Contains(arg, "=") {
+			name, v, _ := strings.Cut(arg, "=")
+			args = append(args[:i], append([]string{name, v}, args[i+1:]...)...)
+			arg = name
+		}
+		// Bundled flags such as -sSL, possibly ending with an option and
+		// its argument, such as -XPOST.
+		if len(arg) > 2 && arg[0] == '-' && arg[1] != '-' {
+			var expanded []string
+			for j := 1; j < len(arg); j++ {
+				option := "-" + arg[j:j+1]
+				expanded = append(expanded, option)
+				if !curlFlags[option] && option != "-I" && option != "-G" {
+					if j+1 < len(arg) {
+						expanded = append(expanded, arg[j+1:])
+					}
+					break
+				}
+			}
+			args = append(args[:i], append(expanded, args[i+1:]...)...)
+			arg = args[i]
+		}
+		switch {
+		case curlFlags[arg]:
+		case curlIgnoredOptions[arg]:
+			_, err = value()
+		case arg == "-X" || arg == "--request":
+			method, err = value()
+		case arg == "-I" || arg == "--head":
+			method = http.MethodHead
+		case arg == "-G" || arg == "--get":
+			get = true
+		case arg == "-H" || arg == "--header":
+			var header string
+			header, err = value()
+			if err == nil {
+				name, v, ok := strings.Cut(header, ":")
+				name = strings.TrimSpace(name)
+				switch {
+				case !ok:
+					err = fmt.Errorf("invalid header %q", header)
+				case strings.EqualFold(name, "content-type"):
+					contentType = strings.TrimSpace(v)
+				default:
+					headers[name] = strings.TrimSpace(v)
+				}
+			}
+		case arg == "-A" || arg == "--user-agent":
+			var agent string
+			agent, err = value()
+			headers["User-Agent"] = agent
+		case arg == "-u" || arg == "--user":
+			var user string
+			user, err = value()
+			if err == nil {
+				username, password, ok := strings.Cut(user, ":")
+				if !ok {
+					err = errors.New("--user requires a password")
+				}
+				basicAuth = &BasicAuth{Username: username, Password: password}
+			}
+		case arg == "-d" || arg == "--data" || arg == "--data-raw" || arg == "--data-binary" || arg == "--data-ascii":
+			var d string
+			d, err = value()
+			if err == nil && strings.HasPrefix(d, "@") && arg != "--data-raw" {
+				err = fmt.Errorf("reading data from files isn't supported")
+			}
+			data = append(data, d)
+		case arg == "--json":
+			var d string
+			d, err = value()
+			data = append(data, d)
+			contentType = "application/json"
+		case arg == "--url":
+			rawUrl, err = value()
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			err = fmt.Errorf("option %s isn't supported", arg)
+		default:
+			if rawUrl != "" {
+				err = errors.New("only one url is supported")
+			}
+			rawUrl = arg
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if rawUrl == "" {
+		return nil, errors.New("no url")
+	}
+
+	fields := map[string]interface{}{"url": rawUrl}
+	body := strings.Join(data, "&")
+	if get && len(data) > 0 {
+		u, err := url.Parse(rawUrl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid url %q: %w", rawUrl, err)
+		}
+		if u.RawQuery != "" {
+			u.RawQuery += "&"
+		}
+		u.RawQuery += body
+		fields["url"] = u.String()
+		body = ""
+	}
+	switch {
+	case method != "":
+	case body != "":
+		method = http.MethodPost
+	default:
+		method = http.MethodGet
+	}
+	fields["method"] = strings.ToUpper(method)
+	if body != "" {
+		fields["request_body"] = body
+		if contentType == "" {
+			// What curl sends data as, unless told otherwise.
+			contentType = "application/x-www-form-urlencoded"
+		}
+	}
+	if contentType != "" && body != "" {
+		fields["content_type"] = contentType
+	}
+	if len(headers) > 0 {
+		fields["headers"] = headers
+	}
+	if basicAuth != nil {
+		fields["basic_auth"] = basicAuth
+	}
+	return fields, nil
+}
+
+// splitShellWords splits a command line like a POSIX shell would, with
+// single and double quotes and backslash escapes, including escaped line
+// breaks, which may be CRLF ones of a command pasted from Windows.
+func splitShellWords(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			i++
+			if s[i] == '\r' && i+1 < len(s) && s[i+1] == '\n' {
+				i++
+			}
+			if s[i] != '\n' {
+				word.WriteByte(s[i])
+				inWord = true
+			}
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("unterminated single quote")
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '"':
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("\"\\$`\n", s[i+1]) >= 0 {
+					i++
+					if s[i] == '\n' {
+						continue
+					}
+				}
+				word.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, errors.New("unterminated double quote")
+			}
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// handleJobFromCurl creates a check equivalent to a curl command. The
+// request body is {"curl": "curl ..."}, along with any other job fields,
+// which override the ones taken from the command; the frequency defaults
+// to a minute and the expected status to 200.
+func (h *HealthcheckServer) handleJobFromCurl(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var overrides map[string]json.RawMessage
+	err := json.NewDecoder(r.Body).Decode(&overrides)
+	if err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var command string
+	if raw, ok := overrides["curl"]; ok {
+		err = json.Unmarshal(raw, &command)
+	}
+	if err != nil || command == "" {
+		writeError(w, http.StatusBadRequest, errors.New("curl must be a curl command"))
+		return
+	}
+	delete(overrides, "curl")
+
+	parsed, err := parseCurl(command)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid curl command: %w", err))
+		return
+	}
+	fields := map[string]interface{}{
+		"frequency":       "1m",
+		"expected_status": http.StatusOK,
+	}
+	for k, v := range parsed {
+		fields[k] = v
+	}
+	for k, v := range overrides {
+		fields[k] = v
+	}
+	merged, err := json.Marshal(fields)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	var healthcheck HealthcheckQuery
+	err = json.Unmarshal(merged, &healthcheck)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	h.createJob(w, r, healthcheck)
+}
@@ -0,0 +1,128 @@
+package uptime
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSplitShellWords(t *testing.T) {
+	tests := []struct {
+		in    string
+		words []string
+		err   bool
+	}{
+		{`curl  -s	https://example.com`, []string{"curl", "-s", "https://example.com"}, false},
+		{`curl 'https://example.com/a b'`, []string{"curl", "https://example.com/a b"}, false},
+		{`curl -H 'X-Quote: it'\''s'`, []string{"curl", "-H", "X-Quote: it's"}, false},
+		{`curl -d "{\"a\": \"\$HOME\"}"`, []string{"curl", "-d", `{"a": "$HOME"}`}, false},
+		{`curl -d "a\b"`, []string{"curl", "-d", `a\b`}, false},
+		{`curl -d 'a\"b'`, []string{"curl", "-d", `a\"b`}, false},
+		{`curl a\ b`, []string{"curl", "a b"}, false},
+		{"curl \\\n  -s \\\r\n https://example.com", []string{"curl", "-s", "https://example.com"}, false},
+		{"curl \"a\\\nb\"", []string{"curl", "ab"}, false},
+		{`curl ''`, []string{"curl", ""}, false},
+		{`curl 'a"b'"c'd"`, []string{"curl", `a"bc'd`}, false},
+		{`curl 'unterminated`, nil, true},
+		{`curl "unterminated`, nil, true},
+	}
+	for _, test := range tests {
+		words, err := splitShellWords(test.in)
+		if (err != nil) != test.err {
+			t.Errorf("%q: got error %v, want one: %t", test.in, err, test.err)
+			continue
+		}
+		if !test.err && !reflect.DeepEqual(words, test.words) {
+			t.Errorf("%q: got %q, want %q", test.in, words, test.words)
+		}
+	}
+}
+
+func TestParseCurl(t *testing.T) {
+	tests := []struct {
+		command string
+		// fields is the check's fields, as JSON, empty if the command is
+		// rejected.
+		fields string
+	}{
+		{
+			`curl https://example.com/health`,
+			`{"method":"GET","url":"https://example.com/health"}`,
+		},
+		{
+			`curl -sSL --compressed -m 5 -o /dev/null -w '%{http_code}' https://example.com`,
+			`{"method":"GET","url":"https://example.com"}`,
+		},
+		{
+			`curl -I https://example.com`,
+			`{"method":"HEAD","url":"https://example.com"}`,
+		},
+		{
+			`curl -XDELETE https://example.com/item`,
+			`{"method":"DELETE","url":"https://example.com/item"}`,
+		},
+		{
+			`curl --request=put --url=https://example.com -d x=1`,
+			`{"content_type":"application/x-www-form-urlencoded","method":"PUT","request_body":"x=1","url":"https://example.com"}`,
+		},
+		{
+			`curl -H 'Accept: application/json' -H "X-Api-Key:  secret " -A probe/1.0 https://example.com`,
+			`{"headers":{"Accept":"application/json","User-Agent":"probe/1.0","X-Api-Key":"secret"},"method":"GET","url":"https://example.com"}`,
+		},
+		{
+			`curl -H 'Content-Type: application/json' -d '{"name": "it'\''s"}' https://example.com/api`,
+			`{"content_type":"application/json","method":"POST","request_body":"{\"name\": \"it's\"}","url":"https://example.com/api"}`,
+		},
+		{
+			`curl --json '{"a":1}' https://example.com/api`,
+			`{"content_type":"application/json","method":"POST","request_body":"{\"a\":1}","url":"https://example.com/api"}`,
+		},
+		{
+			`curl -d a=1 --data-raw @b https://example.com`,
+			`{"content_type":"application/x-www-form-urlencoded","method":"POST","request_body":"a=1&@b","url":"https://example.com"}`,
+		},
+		{
+			`curl -G -d q=up -d page=2 'https://example.com/search?lang=en'`,
+			`{"method":"GET","url":"https://example.com/search?lang=en&q=up&page=2"}`,
+		},
+		{
+			`curl -u admin:p:ss https://example.com`,
+			`{"basic_auth":{"username":"admin","password":"p:ss"},"method":"GET","url":"https://example.com"}`,
+		},
+		{
+			"curl 'https://example.com' \\\n  -H 'Accept: */*' \\\n  --compressed",
+			`{"headers":{"Accept":"*/*"},"method":"GET","url":"https://example.com"}`,
+		},
+		{`wget https://example.com`, ""},
+		{`curl -s`, ""},
+		{`curl https://example.com https://example.org`, ""},
+		{`curl -k https://example.com`, ""},
+		{`curl -d @body.json https://example.com`, ""},
+		{`curl -u admin https://example.com`, ""},
+		{`curl -H 'no colon' https://example.com`, ""},
+		{`curl https://example.com -X`, ""},
+	}
+	for _, test := range tests {
+		fields, err := parseCurl(test.command)
+		if test.fields == "" {
+			if err == nil {
+				t.Errorf("%q: got %v, want an error", test.command, fields)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.command, err)
+			continue
+		}
+		encoded, err := json.Marshal(fields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got, want any
+		json.Unmarshal(encoded, &got)
+		json.Unmarshal([]byte(test.fields), &want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: got %s, want %s", test.command, encoded, test.fields)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package uptime
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// dashboardFiles are the dashboard's page, script and styles.
+//
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// dashboardHandler serves the dashboard's files under /dashboard/.
+var dashboardHandler = func() http.Handler {
+	files, err := fs.Sub(dashboardFiles, "dashboard")
+	if err != nil {
+		panic(err)
+	}
+	return http.StripPrefix("/dashboard/", http.FileServer(http.FS(files)))
+}()
+
+// handleDashboard serves GET /, a dashboard of every check built on the
+// JSON API: its status, latest latency, recent runs and uptime, with
+// buttons to pause, resume or delete it.
+func (h *HealthcheckServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	page, err := dashboardFiles.ReadFile("dashboard/index.html")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(page)
+}
@@ -0,0 +1,131 @@
+// The dashboard only uses the JSON API, refreshing every few seconds.
+"use strict";
+
+const refreshInterval = 10000;
+const sparkRuns = 40;
+
+function el(tag, attrs, ...children) {
+  const e = document.createElement(tag);
+  Object.assign(e, attrs);
+  e.append(...children);
+  return e;
+}
+
+// base is the path the server is served under, behind a reverse proxy.
+const base = location.pathname.replace(/\/dashboard\/.*$/, "");
+
+// apiToken is asked for the first time a change is rejected, when the
+// server requires one, and kept for the session.
+let apiToken = sessionStorage.getItem("apiToken");
+
+async function api(method, path) {
+  const headers = { "X-Requested-By": "dashboard" };
+  if (apiToken) {
+    headers.Authorization = "Bearer " + apiToken;
+  }
+  const resp = await fetch(base + path, { method, headers });
+  if (resp.status === 401) {
+    const token = prompt("API token");
+    if (token) {
+      apiToken = token.trim();
+      sessionStorage.setItem("apiToken", apiToken);
+      return api(method, path);
+    }
+  }
+  if (!resp.ok) {
+    let message = resp.status + " " + resp.statusText;
+    try {
+      message = (await resp.json()).error || message;
+    } catch (e) {}
+    throw new Error(method + " " + path + ": " + message);
+  }
+  return resp.status === 204 ? null : resp.json();
+}
+
+function showError(err) {
+  const p = document.getElementById("error");
+  p.textContent = err ? err.message : "";
+  p.hidden = !err;
+}
+
+function sparkline(results) {
+  const runs = results.slice(0, sparkRuns).reverse();
+  const slowest = Math.max(1, ...runs.map((r) => r.latency_ms || 0));
+  const spark = el("div", { className: "spark" });
+  for (const r of runs) {
+    const bar = el("span", {
+      className: r.status === "UP" ? "up" : r.status === "DOWN" ? "down" : "other",
+      title: r.timestamp + ": " + r.status + ", " + Math.round(r.latency_ms || 0) + " ms" + (r.error ? "\n" + r.error : ""),
+    });
+    bar.style.height = Math.max(8, (100 * (r.latency_ms || 0)) / slowest) + "%";
+    spark.append(bar);
+  }
+  return spark;
+}
+
+function actions(job) {
+  const id = encodeURIComponent(job.id);
+  const act = (label, className, method, path, confirmation) =>
+    el("button", {
+      className,
+      textContent: label,
+      onclick: async () => {
+        if (confirmation && !confirm(confirmation)) {
+          return;
+        }
+        try {
+          await api(method, path);
+          showError(null);
+        } catch (err) {
+          showError(err);
+        }
+        refresh();
+      },
+    });
+  return [
+    job.paused
+      ? act("Resume", "", "POST", "/jobs/" + id + "/resume")
+      : act("Pause", "", "POST", "/jobs/" + id + "/pause"),
+    act("Delete", "delete", "DELETE", "/jobs/" + id, "Delete check #" + job.alias + " " + job.url + "?"),
+  ];
+}
+
+async function row(job) {
+  const id = encodeURIComponent(job.id);
+  const [results, stats] = await Promise.all([
+    api("GET", "/jobs/" + id + "/results?limit=" + sparkRuns),
+    api("GET", "/jobs/" + id + "/stats?window=24h"),
+  ]);
+  const last = results[0];
+  let status = last ? last.status : "UNKNOWN";
+  if (job.paused) {
+    status = "PAUSED";
+  }
+  const uptime = stats[0].uptime_percent;
+  return el(
+    "tr",
+    {},
+    el("td", {}, "#" + job.alias + (job.group ? " " + job.group : ""), el("div", { className: "url", textContent: job.method + " " + job.url })),
+    el("td", { className: "status " + status, textContent: status, title: last && last.error ? last.error : "" }),
+    el("td", { className: "n", textContent: last ? Math.round(last.latency_ms) + " ms" : "" }),
+    el("td", {}, sparkline(results)),
+    el("td", { className: "n", textContent: uptime == null ? "" : uptime.toFixed(2) + "%" }),
+    el("td", { className: "n" }, ...actions(job)),
+  );
+}
+
+async function refresh() {
+  try {
+    const jobs = await api("GET", "/jobs");
+    jobs.sort((a, b) => a.alias - b.alias);
+    const rows = await Promise.all(jobs.map(row));
+    document.getElementById("checks").replaceChildren(...rows);
+    document.getElementById("empty").hidden = jobs.length > 0;
+    document.getElementById("updated").textContent = "Updated " + new Date().toLocaleTimeString();
+  } catch (err) {
+    showError(err);
+  }
+}
+
+refresh();
+setInterval(refresh, refreshInterval);
@@ -0,0 +1,127 @@
+package uptime
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// serviceLabel is the label tying a check to the service whose deploys
+// may break it.
+const serviceLabel = "service"
+
+// maxDeploys is how many of the latest deploy events are kept.
+const maxDeploys = 1000
+
+// deployEvent is a release of a service, reported by its deploy pipeline.
+type deployEvent struct {
+	Id        string    `json:"id"`
+	Service   string    `json:"service"`
+	Version   string    `json:"version"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// deployLog keeps the latest deploy events, ordered by when they happened,
+// to correlate incidents with. Incidents opening within window of a deploy
+// of their check's service are attributed to it; a zero window disables
+// that.
+type deployLog struct {
+	window time.Duration
+
+	mu     sync.Mutex
+	events []deployEvent
+}
+
+func newDeployLog(window time.Duration) *deployLog {
+	return &deployLog{window: window}
+}
+
+func (l *deployLog) record(e deployEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	i := len(l.events)
+	for i > 0 && l.events[i-1].Timestamp.After(e.Timestamp) {
+		i--
+	}
+	l.events = append(l.events[:i], append([]deployEvent{e}, l.events[i:]...)...)
+	if len(l.events) > maxDeploys {
+		l.events = l.events[len(l.events)-maxDeploys:]
+	}
+}
+
+// list returns the deploys of a service, of every service if it is empty,
+// latest first.
+func (l *deployLog) list(service string) []deployEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	list := []deployEvent{}
+	for i := len(l.events) - 1; i >= 0; i-- {
+		if service == "" || l.events[i].Service == service {
+			list = append(list, l.events[i])
+		}
+	}
+	return list
+}
+
+// correlate returns the latest deploy of a service an incident opening at
+// at follows closely enough to be attributed to it, if any.
+func (l *deployLog) correlate(service string, at time.Time) *deployEvent {
+	if l == nil || service == "" || l.window <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := len(l.events) - 1; i >= 0; i-- {
+		e := l.events[i]
+		if e.Timestamp.After(at) || e.Service != service {
+			continue
+		}
+		if at.Sub(e.Timestamp) > l.window {
+			return nil
+		}
+		return &e
+	}
+	return nil
+}
+
+// follows reports whether an incident opening at at is attributed to the
+// deploy.
+func (l *deployLog) follows(e deployEvent, at time.Time) bool {
+	return l != nil && l.window > 0 && !at.Before(e.Timestamp) && at.Sub(e.Timestamp) <= l.window
+}
+
+// handleDeployEvents serves POST /events/deploy, which records a deploy of
+// {"service": ..., "version": ..., "timestamp": ...}, now if there is no
+// timestamp, and GET, which lists the latest deploys, of ?service= if set.
+func (h *HealthcheckServer) handleDeployEvents(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(h.deploys.list(r.URL.Query().Get("service")))
+	case http.MethodPost:
+		var e deployEvent
+		err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&e)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if e.Service == "" || e.Version == "" {
+			writeError(w, http.StatusBadRequest, errors.New("service and version are required"))
+			return
+		}
+		e.Id = newUUID()
+		if e.Timestamp.IsZero() {
+			e.Timestamp = h.clock.Now()
+		}
+		h.deploys.record(e)
+		// The deploy may be reported after the incidents it caused opened.
+		h.incidents.attribute(e)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(e)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,417 @@
+package uptime
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// checkTypeDoH queries a DNS-over-HTTPS (RFC 8484) resolver.
+	checkTypeDoH = "doh"
+	// checkTypeDoT queries a DNS-over-TLS (RFC 7858) resolver.
+	checkTypeDoT = "dot"
+	// checkTypeDNS queries a resolver over plain DNS, on UDP or TCP.
+	checkTypeDNS = "dns"
+)
+
+const dnsMessageType = "application/dns-message"
+
+// maxDNSMessageBytes bounds the size of DNS responses read by checks.
+const maxDNSMessageBytes = 65535
+
+var dotPorts = map[string]string{
+	"tls": "853",
+}
+
+var dnsPorts = map[string]string{
+	"udp": "53",
+	"tcp": "53",
+}
+
+var dnsRecordTypes = map[string]dnsmessage.Type{
+	"A":     dnsmessage.TypeA,
+	"AAAA":  dnsmessage.TypeAAAA,
+	"CNAME": dnsmessage.TypeCNAME,
+	"MX":    dnsmessage.TypeMX,
+	"NS":    dnsmessage.TypeNS,
+	"TXT":   dnsmessage.TypeTXT,
+}
+
+var dnsRcodes = map[string]dnsmessage.RCode{
+	"NOERROR":  dnsmessage.RCodeSuccess,
+	"FORMERR":  dnsmessage.RCodeFormatError,
+	"SERVFAIL": dnsmessage.RCodeServerFailure,
+	"NXDOMAIN": dnsmessage.RCodeNameError,
+	"NOTIMP":   dnsmessage.RCodeNotImplemented,
+	"REFUSED":  dnsmessage.RCodeRefused,
+}
+
+// DNSQuery is the question DNS checks ask their resolver, and what they
+// expect in return: the response code, and answers that must all be among
+// the records returned.
+type DNSQuery struct {
+	Name            string   `json:"name"`
+	RecordType      string   `json:"record_type"`
+	ExpectedRcode   string   `json:"expected_rcode"`
+	ExpectedAnswers []string `json:"expected_answers,omitempty"`
+}
+
+func (q *DNSQuery) validate() error {
+	if q.Name == "" {
+		return errors.New("dns.name is required")
+	}
+	if !strings.HasSuffix(q.Name, ".") {
+		q.Name += "."
+	}
+	if _, err := dnsmessage.NewName(q.Name); err != nil {
+		return fmt.Errorf("invalid dns.name %q: %w", q.Name, err)
+	}
+	q.RecordType = strings.ToUpper(q.RecordType)
+	if q.RecordType == "" {
+		q.RecordType = "A"
+	}
+	if _, ok := dnsRecordTypes[q.RecordType]; !ok {
+		return fmt.Errorf("invalid dns.record_type %q, expected one of A, AAAA, CNAME, MX, NS, TXT", q.RecordType)
+	}
+	q.ExpectedRcode = strings.ToUpper(q.ExpectedRcode)
+	if q.ExpectedRcode == "" {
+		q.ExpectedRcode = "NOERROR"
+	}
+	if _, ok := dnsRcodes[q.ExpectedRcode]; !ok {
+		return fmt.Errorf("invalid dns.expected_rcode %q", q.ExpectedRcode)
+	}
+	for i, answer := range q.ExpectedAnswers {
+		if q.RecordType == "CNAME" || q.RecordType == "MX" || q.RecordType == "NS" {
+			if !strings.HasSuffix(answer, ".") {
+				q.ExpectedAnswers[i] = answer + "."
+			}
+		}
+	}
+	return nil
+}
+
+func (q *DNSQuery) equal(other *DNSQuery) bool {
+	if q == nil || other == nil {
+		return q == other
+	}
+	if q.Name != other.Name || q.RecordType != other.RecordType || q.ExpectedRcode != other.ExpectedRcode {
+		return false
+	}
+	a := append([]string{}, q.ExpectedAnswers...)
+	b := append([]string{}, other.ExpectedAnswers...)
+	sort.Strings(a)
+	sort.Strings(b)
+	return strings.Join(a, "\n") == strings.Join(b, "\n")
+}
+
+// message builds the query with the given id, asking for recursion.
+func (q *DNSQuery) message(id uint16) ([]byte, error) {
+	name, err := dnsmessage.NewName(q.Name)
+	if err != nil {
+		return nil, err
+	}
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  name,
+			Type:  dnsRecordTypes[q.RecordType],
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	return msg.Pack()
+}
+
+// checkAnswer verifies a response to the query sent with the given id,
+// returning the answers of the queried type.
+func (q *DNSQuery) checkAnswer(data []byte, id uint16) ([]string, error) {
+	var msg dnsmessage.Message
+	err := msg.Unpack(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DNS response: %w", err)
+	}
+	if msg.Header.ID != id || !msg.Header.Response {
+		return nil, errors.New("DNS response doesn't answer the query")
+	}
+	if msg.Header.RCode != dnsRcodes[q.ExpectedRcode] {
+		return nil, fmt.Errorf("Unexpected DNS response code, %s != %s", rcodeName(msg.Header.RCode), q.ExpectedRcode)
+	}
+
+	var answers []string
+	for _, rr := range msg.Answers {
+		if rr.Header.Type != dnsRecordTypes[q.RecordType] {
+			continue
+		}
+		switch body := rr.Body.(type) {
+		case *dnsmessage.AResource:
+			answers = append(answers, net.IP(body.A[:]).String())
+		case *dnsmessage.AAAAResource:
+			answers = append(answers, net.IP(body.AAAA[:]).String())
+		case *dnsmessage.CNAMEResource:
+			answers = append(answers, body.CNAME.String())
+		case *dnsmessage.MXResource:
+			answers = append(answers, body.MX.String())
+		case *dnsmessage.NSResource:
+			answers = append(answers, body.NS.String())
+		case *dnsmessage.TXTResource:
+			answers = append(answers, strings.Join(body.TXT, ""))
+		}
+	}
+	for _, expected := range q.ExpectedAnswers {
+		found := false
+		for _, answer := range answers {
+			if strings.EqualFold(answer, expected) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("DNS answer %q not found in [%s]", expected, strings.Join(answers, ", "))
+		}
+	}
+	return answers, nil
+}
+
+func rcodeName(rcode dnsmessage.RCode) string {
+	for name, code := range dnsRcodes {
+		if code == rcode {
+			return name
+		}
+	}
+	return rcode.String()
+}
+
+// normalizeDoTURL normalizes the address of a DNS-over-TLS resolver, given
+// as tls://host[:port] or just host[:port].
+func normalizeDoTURL(raw string) (string, error) {
+	normalized, err := normalizeURLSchemes(raw, "tls", dotPorts)
+	if err != nil {
+		return "", err
+	}
+	u, _ := url.Parse(normalized)
+	if u.Path != "" && u.Path != "/" || u.RawQuery != "" {
+		return "", fmt.Errorf("invalid url %q: dot urls can't have a path or query", raw)
+	}
+	u.Path = ""
+	return u.String(), nil
+}
+
+// checkDoH sends the query to a DNS-over-HTTPS resolver, with GET or POST
+// as RFC 8484 describes. Queries use id 0, as the RFC recommends.
+func (h HealthcheckQuery) checkDoH(ctx context.Context, dial *dialTracer) (result HealthcheckResponse) {
+	msg, err := h.DNS.message(0)
+	if err != nil {
+		return failCheck(ctx, "%v", err)
+	}
+	var req *http.Request
+	switch h.Method {
+	case http.MethodGet:
+		u, _ := url.Parse(h.Url)
+		query := u.Query()
+		query.Set("dns", base64.RawURLEncoding.EncodeToString(msg))
+		u.RawQuery = query.Encode()
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	case http.MethodPost:
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, h.Url, bytes.NewReader(msg))
+		if err == nil {
+			req.Header.Set("Content-Type", dnsMessageType)
+		}
+	default:
+		return failCheck(ctx, "method %s not supported", h.Method)
+	}
+	if err != nil {
+		return failCheck(ctx, "%v", err)
+	}
+	req.Header.Set("Accept", dnsMessageType)
+	req.Header.Set(correlationHeader, correlationId(ctx))
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), probeConnStats.trace()))
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), dial.trace()))
+	req = withTransferTrace(req)
+	resp, err := probeClient(ctx).Do(req)
+	if err != nil {
+		return failCheck(ctx, "%v", err)
+	}
+	defer func() {
+		resp.Body.Close()
+		result.StatusCode = resp.StatusCode
+	}()
+	if resp.StatusCode != h.ExpectedStatus {
+		return failCheckReason(ctx, reasonUnexpectedStatus, "Unexpected status code, %d != %d", resp.StatusCode, h.ExpectedStatus)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDNSMessageBytes))
+	if err != nil {
+		return failCheck(ctx, "Error reading response body: %v", err)
+	}
+	_, err = h.DNS.checkAnswer(data, 0)
+	if err != nil {
+		return failCheckReason(ctx, reasonAssertionFailed, "%v", err)
+	}
+	return HealthcheckResponse{Status: true}
+}
+
+// checkDoT sends the query to a DNS-over-TLS resolver, over a new
+// connection.
+func (h HealthcheckQuery) checkDoT(ctx context.Context) HealthcheckResponse {
+	u, err := url.Parse(h.Url)
+	if err != nil {
+		return failCheck(ctx, "%v", err)
+	}
+	id := uint16(rand.Intn(1 << 16))
+	msg, err := h.DNS.message(id)
+	if err != nil {
+		return failCheck(ctx, "%v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.timeout())
+	defer cancel()
+	port := u.Port()
+	if port == "" {
+		port = dotPorts["tls"]
+	}
+	conn, err := dialProbeTLS(ctx, net.JoinHostPort(u.Hostname(), port), &tls.Config{ServerName: u.Hostname()})
+	if err != nil {
+		return failCheck(ctx, "%v", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	data, err := exchangeStream(conn, msg)
+	if err != nil {
+		return failCheck(ctx, "%v", err)
+	}
+	_, err = h.DNS.checkAnswer(data, id)
+	if err != nil {
+		return failCheckReason(ctx, reasonAssertionFailed, "%v", err)
+	}
+	return HealthcheckResponse{Status: true}
+}
+
+// exchangeStream sends a query over a stream connection and reads its
+// response. Over TCP, messages are prefixed with their length.
+func exchangeStream(conn net.Conn, msg []byte) ([]byte, error) {
+	framed := binary.BigEndian.AppendUint16(nil, uint16(len(msg)))
+	_, err := conn.Write(append(framed, msg...))
+	if err != nil {
+		return nil, err
+	}
+	var length uint16
+	err = binary.Read(conn, binary.BigEndian, &length)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading DNS response: %w", err)
+	}
+	data := make([]byte, length)
+	_, err = io.ReadFull(conn, data)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading DNS response: %w", err)
+	}
+	return data, nil
+}
+
+// normalizeDNSURL normalizes the address of a resolver, given as
+// udp://host[:port], tcp://host[:port] or just host[:port] for UDP.
+func normalizeDNSURL(raw string) (string, error) {
+	normalized, err := normalizeURLSchemes(raw, "udp", dnsPorts)
+	if err != nil {
+		return "", err
+	}
+	u, _ := url.Parse(normalized)
+	if u.Path != "" && u.Path != "/" || u.RawQuery != "" {
+		return "", fmt.Errorf("invalid url %q: dns urls can't have a path or query", raw)
+	}
+	u.Path = ""
+	return u.String(), nil
+}
+
+// checkDNS sends the query to a resolver over UDP, retrying over TCP if
+// the response is truncated, or over TCP right away for tcp:// resolvers.
+// Unless another response code is expected, the name must resolve to at
+// least one record of the queried type.
+func (h HealthcheckQuery) checkDNS(ctx context.Context) HealthcheckResponse {
+	u, err := url.Parse(h.Url)
+	if err != nil {
+		return failCheck(ctx, "%v", err)
+	}
+	id := uint16(rand.Intn(1 << 16))
+	msg, err := h.DNS.message(id)
+	if err != nil {
+		return failCheck(ctx, "%v", err)
+	}
+	timeout := h.timeout()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	port := u.Port()
+	if port == "" {
+		port = dnsPorts[u.Scheme]
+	}
+	address := net.JoinHostPort(u.Hostname(), port)
+
+	data, err := exchangeDNS(ctx, u.Scheme, address, msg)
+	if err == nil && u.Scheme == "udp" && truncated(data) {
+		data, err = exchangeDNS(ctx, "tcp", address, msg)
+	}
+	if err != nil {
+		return failCheck(ctx, "%v", err)
+	}
+	answers, err := h.DNS.checkAnswer(data, id)
+	if err != nil {
+		return failCheckReason(ctx, reasonAssertionFailed, "%v", err)
+	}
+	if h.DNS.ExpectedRcode == "NOERROR" && len(answers) == 0 {
+		return failCheckReason(ctx, reasonDNSFailed, "No %s records for %s", h.DNS.RecordType, h.DNS.Name)
+	}
+	return HealthcheckResponse{Status: true}
+}
+
+// exchangeDNS sends a query to a resolver over a new connection, and
+// reads its response.
+func exchangeDNS(ctx context.Context, network string, address string, msg []byte) ([]byte, error) {
+	dialer, err := probeDialer(ctx, network)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	conn = countTransfer(ctx, conn)
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if network == "tcp" {
+		return exchangeStream(conn, msg)
+	}
+	_, err = conn.Write(msg)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, maxDNSMessageBytes)
+	n, err := conn.Read(data)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading DNS response: %w", err)
+	}
+	return data[:n], nil
+}
+
+// truncated reports whether a response has its TC bit set, meaning it
+// didn't fit in a UDP datagram.
+func truncated(data []byte) bool {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(data)
+	return err == nil && header.Truncated
+}
@@ -0,0 +1,134 @@
+package uptime
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// smtpMailer sends alerts by email. The connection is upgraded with
+// STARTTLS when the server offers it, and credentials, if any, are only
+// sent over TLS or to localhost.
+type smtpMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	To       []string
+	// AckAddress, if set, is the mailbox replies acknowledging alerts go
+	// to: alerts carrying an acknowledgement token are sent with a
+	// Reply-To of the address plus the token, e.g.
+	// alerts+ack-...@example.com.
+	AckAddress string
+}
+
+func newSMTPMailer(host string, port int, username string, password string, from string, to string) (*smtpMailer, error) {
+	m := &smtpMailer{Host: host, Port: port, Username: username, Password: password, From: from}
+	for _, address := range strings.Split(to, ",") {
+		address = strings.TrimSpace(address)
+		if address != "" {
+			m.To = append(m.To, address)
+		}
+	}
+	if len(m.To) == 0 {
+		return nil, fmt.Errorf("no recipients")
+	}
+	if m.From == "" {
+		return nil, fmt.Errorf("no sender")
+	}
+	return m, nil
+}
+
+// emailAlert is a plain text email, to the mailer's recipients unless to
+// names others.
+type emailAlert struct {
+	to       []string
+	subject  string
+	body     string
+	ackToken string
+}
+
+// replyTo returns the address replies acknowledging an alert with the
+// given token go to, or "" if there is none.
+func (m *smtpMailer) replyTo(ackToken string) string {
+	local, domain, ok := strings.Cut(m.AckAddress, "@")
+	if ackToken == "" || !ok {
+		return ""
+	}
+	return local + "+" + ackToken + "@" + domain
+}
+
+func (m *smtpMailer) send(alert emailAlert) error {
+	to := alert.to
+	if len(to) == 0 {
+		to = m.To
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", m.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	if replyTo := m.replyTo(alert.ackToken); replyTo != "" {
+		fmt.Fprintf(&msg, "Reply-To: %s\r\n", replyTo)
+	}
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", alert.subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-Id: <%s@%s>\r\n", newUUID(), m.Host)
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(&msg, "\r\n")
+	msg.WriteString(strings.ReplaceAll(alert.body, "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	return smtp.SendMail(net.JoinHostPort(m.Host, strconv.Itoa(m.Port)), auth, m.From, to, msg.Bytes())
+}
+
+// emailTransitionAlert is the email announcing a transition or an
+// escalation, with the status code observed and why the check failed, if
+// it did, worded in locale.
+func emailTransitionAlert(event transitionEvent, locale *alertLocale) emailAlert {
+	healthcheck, resp := event.Job, event.Result
+	state := locale.SubjectDown
+	switch {
+	case event.State == "UP":
+		state = locale.SubjectRecovered
+	case event.State == string(stateDegraded):
+		state = locale.SubjectDegraded
+	case event.Escalation > 0:
+		state = fmt.Sprintf(locale.SubjectEscalation, event.Escalation)
+	}
+	var body strings.Builder
+	fmt.Fprintf(&body, locale.StateAsOf+"\n\n", healthcheck.Method, healthcheck.Url, locale.state(event.State), locale.formatTime(resp.Timestamp))
+	fmt.Fprintf(&body, "%s: #%d (%s)\n", locale.Check, healthcheck.Alias, healthcheck.Id)
+	if resp.StatusCode != 0 {
+		fmt.Fprintf(&body, "%s: %d\n", locale.StatusCode, resp.StatusCode)
+	}
+	if resp.Error != "" {
+		fmt.Fprintf(&body, "%s: %s\n", locale.Reason, resp.Error)
+	}
+	if event.AckToken != "" {
+		fmt.Fprintf(&body, "%s: %s\n", locale.Acknowledge, event.AckToken)
+	}
+	if d := event.Deploy; d != nil && event.State == "DOWN" {
+		fmt.Fprintf(&body, "%s: %s %s (%s)\n", locale.FollowingDeploy, d.Service, d.Version, locale.formatTime(d.Timestamp))
+	}
+	if source := resp.Source.String(); source != "" {
+		fmt.Fprintf(&body, "%s: %s\n", locale.Source, source)
+	}
+	subject := fmt.Sprintf("[%s] %s %s", state, healthcheck.Method, healthcheck.Url)
+	if event.AckToken != "" {
+		subject += " (" + event.AckToken + ")"
+	}
+	return emailAlert{
+		subject:  subject,
+		body:     body.String(),
+		ackToken: event.AckToken,
+	}
+}
@@ -0,0 +1,81 @@
+package uptime
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTransitionAlertsCarryAckToken(t *testing.T) {
+	const token = "ack-d3234a11ea97a9e4372b30fc"
+	n, err := newTransitionNotifier("http://203.0.113.1/hook", "http://203.0.113.1/slack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Email = &smtpMailer{Host: "smtp.example.com", From: "uptime@example.com", To: []string{"ops@example.com"}}
+	healthcheck := HealthcheckQuery{Alias: 3, Method: "GET", Url: "https://example.com"}
+	resp := HealthcheckResponse{Status: false, Error: "unexpected status 500", Timestamp: testEpoch}
+	acknowledged := testEpoch.Add(time.Minute)
+
+	tests := []struct {
+		name     string
+		to       string
+		incident *incident
+		want     bool
+	}{
+		{"down", "DOWN", &incident{Token: token}, true},
+		{"acknowledged", "DOWN", &incident{Token: token, AcknowledgedAt: &acknowledged}, false},
+		{"recovered", "UP", &incident{Token: token}, false},
+	}
+	for _, test := range tests {
+		from := "UP"
+		if test.to == "UP" {
+			from = "DOWN"
+		}
+		n.notify(healthcheck, from, test.to, resp, test.incident)
+		if len(n.queue) != 3 {
+			t.Fatalf("%s: got %d deliveries, want a webhook, Slack and email one", test.name, len(n.queue))
+		}
+		for len(n.queue) > 0 {
+			d := <-n.queue
+			var text string
+			switch {
+			case d.email != nil:
+				text = d.email.subject + "\n" + d.email.body
+				if got := strings.Contains(d.email.subject, token); got != test.want {
+					t.Errorf("%s: token in email subject: %t, want %t", test.name, got, test.want)
+				}
+			case d.url == n.SlackWebhook:
+				var message struct{ Text string }
+				json.Unmarshal(d.payload, &message)
+				text = message.Text
+			default:
+				var event transitionEvent
+				json.Unmarshal(d.payload, &event)
+				text = event.AckToken
+			}
+			if got := strings.Contains(text, token); got != test.want {
+				t.Errorf("%s: token in delivery to %q (email: %t): %t, want %t", test.name, d.url, d.email != nil, got, test.want)
+			}
+		}
+	}
+}
+
+func TestReplyTo(t *testing.T) {
+	tests := []struct {
+		ackAddress string
+		token      string
+		replyTo    string
+	}{
+		{"alerts@example.com", "ack-d3234a11ea97a9e4372b30fc", "alerts+ack-d3234a11ea97a9e4372b30fc@example.com"},
+		{"alerts@example.com", "", ""},
+		{"", "ack-d3234a11ea97a9e4372b30fc", ""},
+	}
+	for _, test := range tests {
+		m := &smtpMailer{AckAddress: test.ackAddress}
+		if got := m.replyTo(test.token); got != test.replyTo {
+			t.Errorf("%q with token %q: got %q, want %q", test.ackAddress, test.token, got, test.replyTo)
+		}
+	}
+}
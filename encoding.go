@@ -0,0 +1,73 @@
+package uptime
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"golang.org/x/net/html/charset"
+)
+
+// acceptEncoding is advertised by every probe that doesn't request a byte
+// range. Setting it explicitly keeps the transport from decompressing
+// responses on its own, so decodeContent decides what is decoded.
+const acceptEncoding = "gzip, deflate, br"
+
+func prepareEncoding(req *http.Request) {
+	if req.Header.Get("Range") != "" {
+		return
+	}
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+}
+
+// decodeContent undoes the response's Content-Encoding.
+func decodeContent(resp *http.Response) (io.Reader, error) {
+	switch encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))); encoding {
+	case "", "identity":
+		return resp.Body, nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(resp.Body)
+	case "deflate":
+		return zlib.NewReader(resp.Body)
+	case "br":
+		return brotli.NewReader(resp.Body), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+}
+
+// decodeCharset converts a body in the charset declared by the response's
+// Content-Type to UTF-8.
+func decodeCharset(resp *http.Response, body []byte) ([]byte, error) {
+	_, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return body, nil
+	}
+	label := strings.ToLower(params["charset"])
+	if label == "" || label == "utf-8" || label == "utf8" {
+		return body, nil
+	}
+	r, err := charset.NewReaderLabel(label, strings.NewReader(string(body)))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported charset %q", label)
+	}
+	return io.ReadAll(r)
+}
+
+// checkContentEncoding verifies the encoding a check with decompression
+// disabled expects the body to be delivered with.
+func (h HealthcheckQuery) checkContentEncoding(resp *http.Response) error {
+	if h.ExpectedContentEncoding == "" {
+		return nil
+	}
+	encoding := strings.TrimSpace(resp.Header.Get("Content-Encoding"))
+	if !strings.EqualFold(encoding, h.ExpectedContentEncoding) {
+		return fmt.Errorf("Unexpected content encoding, %q != %q", encoding, h.ExpectedContentEncoding)
+	}
+	return nil
+}
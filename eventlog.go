@@ -0,0 +1,126 @@
+package uptime
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	eventResult = "result"
+	eventState  = "state"
+	eventConfig = "config"
+)
+
+// logEvent is one line of the event log: a check result, a check changing
+// state, or a change to a check's definition.
+type logEvent struct {
+	Time   time.Time            `json:"time"`
+	Type   string               `json:"type"`
+	Action string               `json:"action,omitempty"`
+	From   string               `json:"from,omitempty"`
+	To     string               `json:"to,omitempty"`
+	Job    *HealthcheckQuery    `json:"job,omitempty"`
+	Result *HealthcheckResponse `json:"result,omitempty"`
+}
+
+// eventLog appends events as JSON lines to a file. Once the file grows past
+// maxSize, it is rotated: path becomes path.1, path.1 becomes path.2 and so
+// on, keeping at most maxFiles rotated files. A nil eventLog discards
+// everything.
+type eventLog struct {
+	logger   *slog.Logger
+	mu       sync.Mutex
+	path     string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+}
+
+func openEventLog(path string, maxSize int64, maxFiles int) (*eventLog, error) {
+	l := &eventLog{logger: slog.Default(), path: path, maxSize: maxSize, maxFiles: maxFiles}
+	err := l.open()
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *eventLog) open() error {
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	l.file = file
+	l.size = info.Size()
+	return nil
+}
+
+func (l *eventLog) rotate() error {
+	l.file.Close()
+	l.file = nil
+	if l.maxFiles <= 0 {
+		os.Remove(l.path)
+	} else {
+		os.Remove(fmt.Sprintf("%s.%d", l.path, l.maxFiles))
+		for i := l.maxFiles - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+		}
+		err := os.Rename(l.path, l.path+".1")
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return l.open()
+}
+
+func (l *eventLog) write(event logEvent) {
+	if l == nil {
+		return
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		l.logger.Error("event-log-encode-failed", slog.String("error", err.Error()))
+		return
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil && l.maxSize > 0 && l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		err = l.rotate()
+		if err != nil {
+			l.logger.Error("event-log-rotate-failed", slog.String("path", l.path), slog.String("error", err.Error()))
+		}
+	}
+	if l.file == nil {
+		// A failed rotation leaves the log closed; try again next time.
+		if l.open() != nil {
+			return
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		l.logger.Error("event-log-write-failed", slog.String("path", l.path), slog.String("error", err.Error()))
+	}
+}
+
+func (h *HealthcheckServer) logConfigEvent(action string, healthcheck HealthcheckQuery) {
+	h.config.EventLog.write(logEvent{
+		Time:   h.clock.Now(),
+		Type:   eventConfig,
+		Action: action,
+		Job:    &healthcheck,
+	})
+}
@@ -0,0 +1,241 @@
+package uptime
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxTracedBody is how much of a body an explanation quotes.
+const maxTracedBody = 1024
+
+// redactedHeaders are the request headers whose values explanations leave
+// out.
+var redactedHeaders = map[string]bool{
+	"Authorization":        true,
+	"Proxy-Authorization":  true,
+	"Cookie":               true,
+	"X-Amz-Security-Token": true,
+}
+
+// checkTrace records what a check did, step by step, to explain its
+// result: the requests it sent, what came back and how long each phase
+// took, and the verdict of each assertion. Checks record into the trace of
+// their context, if any; a nil trace records nothing.
+type checkTrace struct {
+	mu         sync.Mutex
+	Exchanges  []*traceExchange `json:"exchanges"`
+	Assertions []traceAssertion `json:"assertions"`
+}
+
+type traceExchange struct {
+	Request  traceRequest   `json:"request"`
+	Response *traceResponse `json:"response,omitempty"`
+	Phases   tracePhases    `json:"phases"`
+
+	start, dnsStart, connectStart, tlsStart time.Time
+}
+
+type traceRequest struct {
+	Method  string            `json:"method"`
+	Url     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	// BodyBytes is the size of the request body.
+	BodyBytes int64 `json:"body_bytes,omitempty"`
+}
+
+type traceResponse struct {
+	Proto      string            `json:"proto"`
+	StatusCode int               `json:"status_code"`
+	Headers    map[string]string `json:"headers"`
+	// ContentLength is as the response announced it, -1 if it didn't.
+	ContentLength int64 `json:"content_length"`
+}
+
+// tracePhases are how long each phase of an exchange took, in
+// milliseconds; phases that didn't happen, e.g. DNS lookups over a reused
+// connection, are left out. FirstByteMs is from the start of the exchange.
+type tracePhases struct {
+	DNSMs       *float64 `json:"dns_ms,omitempty"`
+	ConnectMs   *float64 `json:"connect_ms,omitempty"`
+	TLSMs       *float64 `json:"tls_ms,omitempty"`
+	FirstByteMs *float64 `json:"first_byte_ms,omitempty"`
+	ReusedConn  bool     `json:"reused_conn"`
+}
+
+// traceAssertion is an assertion's input, what it was compared against,
+// and its verdict.
+type traceAssertion struct {
+	Name     string      `json:"name"`
+	Expected interface{} `json:"expected,omitempty"`
+	Actual   interface{} `json:"actual,omitempty"`
+	Passed   bool        `json:"passed"`
+	Error    string      `json:"error,omitempty"`
+}
+
+type checkTraceKey struct{}
+
+// withCheckTrace makes checks run with ctx record what they do into the
+// returned trace.
+func withCheckTrace(ctx context.Context) (context.Context, *checkTrace) {
+	t := &checkTrace{Exchanges: []*traceExchange{}, Assertions: []traceAssertion{}}
+	return context.WithValue(ctx, checkTraceKey{}, t), t
+}
+
+func traceFrom(ctx context.Context) *checkTrace {
+	t, _ := ctx.Value(checkTraceKey{}).(*checkTrace)
+	return t
+}
+
+func milliseconds(d time.Duration) *float64 {
+	ms := float64(d) / float64(time.Millisecond)
+	return &ms
+}
+
+func traceHeaders(header http.Header, redact bool) map[string]string {
+	headers := make(map[string]string, len(header))
+	for name, values := range header {
+		if redact && redactedHeaders[name] {
+			headers[name] = "[redacted]"
+			continue
+		}
+		headers[name] = strings.Join(values, ", ")
+	}
+	return headers
+}
+
+// request records a request about to be sent, and returns it with its
+// phases traced.
+func (t *checkTrace) request(req *http.Request) *http.Request {
+	if t == nil {
+		return req
+	}
+	e := &traceExchange{
+		Request: traceRequest{
+			Method:    req.Method,
+			Url:       req.URL.String(),
+			Headers:   traceHeaders(req.Header, true),
+			BodyBytes: req.ContentLength,
+		},
+		start: time.Now(),
+	}
+	t.mu.Lock()
+	t.Exchanges = append(t.Exchanges, e)
+	t.mu.Unlock()
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			e.dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			e.Phases.DNSMs = milliseconds(time.Since(e.dnsStart))
+		},
+		ConnectStart: func(string, string) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if e.connectStart.IsZero() {
+				e.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(_, _ string, err error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if err == nil && e.Phases.ConnectMs == nil {
+				e.Phases.ConnectMs = milliseconds(time.Since(e.connectStart))
+			}
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			e.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			e.Phases.TLSMs = milliseconds(time.Since(e.tlsStart))
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			e.Phases.ReusedConn = info.Reused
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			e.Phases.FirstByteMs = milliseconds(time.Since(e.start))
+		},
+	}))
+}
+
+// response records the response to the latest request.
+func (t *checkTrace) response(resp *http.Response) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.Exchanges) == 0 {
+		return
+	}
+	t.Exchanges[len(t.Exchanges)-1].Response = &traceResponse{
+		Proto:         resp.Proto,
+		StatusCode:    resp.StatusCode,
+		Headers:       traceHeaders(resp.Header, false),
+		ContentLength: resp.ContentLength,
+	}
+}
+
+// assert records an assertion's verdict: it passed unless err is set.
+func (t *checkTrace) assert(name string, expected, actual interface{}, err error) {
+	if t == nil {
+		return
+	}
+	a := traceAssertion{Name: name, Expected: expected, Actual: actual, Passed: err == nil}
+	if err != nil {
+		a.Error = err.Error()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Assertions = append(t.Assertions, a)
+}
+
+// excerpt quotes the start of a body.
+func excerpt(body []byte) string {
+	if len(body) > maxTracedBody {
+		return string(body[:maxTracedBody]) + "..."
+	}
+	return string(body)
+}
+
+// checkExplanation is a check's result along with the trace of the run
+// that produced it.
+type checkExplanation struct {
+	Result HealthcheckResponse `json:"result"`
+	*checkTrace
+}
+
+// handleExplainJob serves GET /jobs/{id}/explain, which runs a check once,
+// out of band like POST /jobs/{id}/run, and responds with its result along
+// with a trace of the run, answering why the check is in the state it is.
+func (h *HealthcheckServer) handleExplainJob(w http.ResponseWriter, r *http.Request, jobId healthcheckId) {
+	healthcheck, ok := h.GetHealthcheck(jobId)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	ctx, trace := withCheckTrace(r.Context())
+	resp := h.runOutOfBand(healthcheck, r.WithContext(ctx))
+
+	trace.mu.Lock()
+	defer trace.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(checkExplanation{Result: resp, checkTrace: trace})
+}
@@ -0,0 +1,131 @@
+package uptime
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http/httptrace"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/exp/slog"
+)
+
+// dialOutcome records how the connection for a probe was established on
+// dual-stack targets: which address family ended up being used, and which
+// families had connection attempts fail outright. Attempts abandoned
+// because the other family won the race aren't failures, and a reused
+// connection says nothing about either family.
+type dialOutcome struct {
+	Family         string   `json:"family,omitempty"`
+	FailedFamilies []string `json:"failed_families,omitempty"`
+	Reused         bool     `json:"reused,omitempty"`
+}
+
+func (d *dialOutcome) logAttrs() []slog.Attr {
+	attrs := []slog.Attr{slog.String("address-family", d.Family)}
+	if len(d.FailedFamilies) > 0 {
+		attrs = append(attrs, slog.String("failed-address-families", strings.Join(d.FailedFamilies, ",")))
+	}
+	return attrs
+}
+
+type dialTracer struct {
+	mu      sync.Mutex
+	outcome dialOutcome
+}
+
+func addressFamily(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil:
+		return ""
+	case ip.To4() != nil:
+		return "ipv4"
+	default:
+		return "ipv6"
+	}
+}
+
+func (t *dialTracer) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		ConnectDone: func(network, addr string, err error) {
+			if err == nil || errors.Is(err, context.Canceled) {
+				return
+			}
+			family := addressFamily(addr)
+			if family == "" {
+				return
+			}
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			for _, f := range t.outcome.FailedFamilies {
+				if f == family {
+					return
+				}
+			}
+			t.outcome.FailedFamilies = append(t.outcome.FailedFamilies, family)
+			sort.Strings(t.outcome.FailedFamilies)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.outcome.Family = addressFamily(info.Conn.RemoteAddr().String())
+			t.outcome.Reused = info.Reused
+		},
+	}
+}
+
+func (t *dialTracer) result() *dialOutcome {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.outcome.Family == "" && len(t.outcome.FailedFamilies) == 0 {
+		return nil
+	}
+	outcome := t.outcome
+	return &outcome
+}
+
+// observeAddressFamilies tracks, per job, for how many consecutive passing
+// runs an address family failed to connect, and warns once a family has
+// been broken for long enough even though the check itself passes. Runs
+// that failed or didn't dial a new connection are ignored.
+func (h *HealthcheckServer) observeAddressFamilies(job *healthcheckJob, resp HealthcheckResponse) {
+	threshold := h.config.AddressFamilyAlertAfter
+	if threshold <= 0 || !resp.Status || resp.Dial == nil || resp.Dial.Reused {
+		return
+	}
+	if job.familyFailures == nil {
+		job.familyFailures = make(map[string]int)
+	}
+	failed := make(map[string]bool)
+	for _, family := range resp.Dial.FailedFamilies {
+		failed[family] = true
+	}
+	for _, family := range []string{"ipv4", "ipv6"} {
+		if !failed[family] {
+			if job.familyFailures[family] >= threshold {
+				h.logger.Info("address-family-recovered",
+					slog.String("url", job.healthcheck.Url),
+					slog.String("family", family),
+				)
+			}
+			job.familyFailures[family] = 0
+			continue
+		}
+		job.familyFailures[family]++
+		if job.familyFailures[family] == threshold {
+			h.logger.Warn("address-family-broken",
+				slog.String("url", job.healthcheck.Url),
+				slog.String("family", family),
+				slog.Int("consecutive-runs", threshold),
+				slog.String("correlation-id", resp.CorrelationId),
+			)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package uptime
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// maxGapsPerJob bounds how many gaps are remembered for each job.
+const maxGapsPerJob = 100
+
+// missedRunGap is a stretch of time during which a job's scheduled runs
+// didn't happen, e.g. because the host was suspended or the probe limit
+// starved the job.
+type missedRunGap struct {
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+	MissedRuns int       `json:"missed_runs"`
+}
+
+type gapLog struct {
+	mu   sync.Mutex
+	gaps map[healthcheckId][]missedRunGap
+}
+
+func newGapLog() *gapLog {
+	return &gapLog{gaps: make(map[healthcheckId][]missedRunGap)}
+}
+
+func (g *gapLog) record(id healthcheckId, gap missedRunGap) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	gaps := append(g.gaps[id], gap)
+	if len(gaps) > maxGapsPerJob {
+		gaps = gaps[len(gaps)-maxGapsPerJob:]
+	}
+	g.gaps[id] = gaps
+}
+
+func (g *gapLog) list(id healthcheckId) []missedRunGap {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]missedRunGap{}, g.gaps[id]...)
+}
+
+func (g *gapLog) forget(id healthcheckId) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.gaps, id)
+}
+
+// detectGap compares the wall clock time between two runs against the
+// job's frequency. Wall clock time is used on purpose: the monotonic clock
+// stops while the host is suspended, so the scheduler doesn't notice suspensions.
+func detectGap(lastRun time.Time, now time.Time, frequency time.Duration) (missedRunGap, bool) {
+	if lastRun.IsZero() || frequency <= 0 {
+		return missedRunGap{}, false
+	}
+	elapsed := now.Round(0).Sub(lastRun.Round(0))
+	if elapsed < 2*frequency {
+		return missedRunGap{}, false
+	}
+	return missedRunGap{
+		From:       lastRun.Round(0),
+		To:         now.Round(0),
+		MissedRuns: int(elapsed/frequency) - 1,
+	}, true
+}
+
+// clockJumpThreshold is how far the wall clock must run ahead of the
+// monotonic clock between two observations to count as a suspension.
+const clockJumpThreshold = 5 * time.Second
+
+// watchClock detects host suspensions and, if catch-up is enabled, asks
+// every job to probe immediately instead of waiting until it is next due.
+func (h *HealthcheckServer) watchClock() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	last := time.Now()
+	for tick(ticker, h.done) {
+		now := time.Now()
+		jump := now.Round(0).Sub(last.Round(0)) - now.Sub(last)
+		last = now
+		if jump < clockJumpThreshold {
+			continue
+		}
+		h.logger.Warn("clock-jump-detected", slog.Duration("suspended-for", jump))
+		if h.config.CatchUp {
+			h.catchUp()
+		}
+	}
+}
+
+func (h *HealthcheckServer) catchUp() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, job := range h.healthchecks {
+		h.scheduler.runNow(job)
+	}
+}
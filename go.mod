@@ -2,14 +2,18 @@ module github.com/otonnesen/uptime-checker
 
 go 1.21.0
 
-require golang.org/x/exp v0.0.0-20230817173708-d852ddb80c63
+require (
+	github.com/andybalholm/brotli v1.0.5
+	github.com/itchyny/gojq v0.12.13
+	github.com/mattn/go-sqlite3 v1.14.24
+	github.com/tetratelabs/wazero v1.8.2
+	golang.org/x/exp v0.0.0-20230817173708-d852ddb80c63
+	golang.org/x/net v0.14.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
-	github.com/itchyny/gojq v0.12.13 // indirect
 	github.com/itchyny/timefmt-go v0.1.5 // indirect
-	github.com/mattn/go-isatty v0.0.19 // indirect
-	github.com/mattn/go-runewidth v0.0.14 // indirect
-	github.com/rivo/uniseg v0.4.4 // indirect
 	golang.org/x/sys v0.11.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	golang.org/x/text v0.12.0 // indirect
 )
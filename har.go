@@ -0,0 +1,384 @@
+package uptime
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxHARBytes bounds the size of an imported HAR recording, which includes
+// the responses' content.
+const maxHARBytes = 32 << 20
+
+// harFile is the part of a HAR 1.2 recording that imports use.
+type harFile struct {
+	Log struct {
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harEntry struct {
+	Request struct {
+		Method   string         `json:"method"`
+		Url      string         `json:"url"`
+		Headers  []harNameValue `json:"headers"`
+		PostData *struct {
+			MimeType string         `json:"mimeType"`
+			Text     string         `json:"text"`
+			Params   []harNameValue `json:"params"`
+		} `json:"postData"`
+	} `json:"request"`
+	Response struct {
+		Status int `json:"status"`
+	} `json:"response"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// secretNameRegex matches the names of headers, query parameters and body
+// fields whose values are likely credentials.
+var secretNameRegex = regexp.MustCompile(`(?i)auth|token|secret|passw|session|cookie|csrf|xsrf|key|signature|otp`)
+
+// harSecret is a header, query parameter or body field of the recording
+// that looks like a credential, named e.g. header:Authorization or
+// body:password, and the steps sending it.
+type harSecret struct {
+	Name  string `json:"name"`
+	Steps []int  `json:"steps"`
+}
+
+// harSecretChoice is what to do with a secret: keep the recorded value,
+// drop it, or replace it with another value.
+type harSecretChoice struct {
+	Keep  bool    `json:"keep"`
+	Drop  bool    `json:"drop"`
+	Value *string `json:"value"`
+}
+
+func (c harSecretChoice) validate() error {
+	set := 0
+	for _, ok := range []bool{c.Keep, c.Drop, c.Value != nil} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return errors.New("set one of keep, drop or value")
+	}
+	return nil
+}
+
+// harConversion turns HAR entries into transaction steps, applying the
+// choices made for their secrets and collecting the secrets nobody chose
+// for.
+type harConversion struct {
+	choices    map[string]harSecretChoice
+	used       map[string]bool
+	unresolved map[string][]int
+}
+
+// scrub returns a secret's value according to the choice made for it, and
+// whether to keep it at all.
+func (c *harConversion) scrub(step int, name string, value string) (string, bool) {
+	c.used[name] = true
+	choice, ok := c.choices[name]
+	switch {
+	case !ok:
+		if steps := c.unresolved[name]; len(steps) == 0 || steps[len(steps)-1] != step {
+			c.unresolved[name] = append(steps, step)
+		}
+		return value, true
+	case choice.Drop:
+		return "", false
+	case choice.Value != nil:
+		return *choice.Value, true
+	}
+	return value, true
+}
+
+func (c *harConversion) step(n int, entry harEntry) (TransactionStep, error) {
+	request := entry.Request
+	if entry.Response.Status == 0 {
+		return TransactionStep{}, errors.New("no response, e.g. the request was blocked or cancelled")
+	}
+	step := TransactionStep{
+		Method:         request.Method,
+		ExpectedStatus: entry.Response.Status,
+	}
+
+	u, err := url.Parse(request.Url)
+	if err != nil {
+		return TransactionStep{}, fmt.Errorf("invalid url %q: %w", request.Url, err)
+	}
+	query := u.Query()
+	changed := false
+	for name, values := range query {
+		if !secretNameRegex.MatchString(name) {
+			continue
+		}
+		value, keep := c.scrub(n, "query:"+name, values[0])
+		if keep {
+			query.Set(name, value)
+		} else {
+			query.Del(name)
+		}
+		changed = changed || !keep || value != values[0]
+	}
+	if changed {
+		u.RawQuery = query.Encode()
+	}
+	step.Url = u.String()
+
+	for _, header := range request.Headers {
+		name := http.CanonicalHeaderKey(header.Name)
+		switch {
+		case strings.HasPrefix(name, ":"):
+			// HTTP/2 pseudo-headers.
+			continue
+		case name == "Content-Type":
+			step.ContentType = header.Value
+			continue
+		case reservedRequestHeaders[name]:
+			continue
+		}
+		value, keep := header.Value, true
+		if secretNameRegex.MatchString(name) {
+			value, keep = c.scrub(n, "header:"+name, value)
+		}
+		if keep {
+			if step.Headers == nil {
+				step.Headers = make(map[string]string)
+			}
+			step.Headers[name] = value
+		}
+	}
+
+	if data := request.PostData; data != nil {
+		if step.ContentType == "" {
+			step.ContentType = data.MimeType
+		}
+		step.RequestBody = data.Text
+		if step.RequestBody == "" && len(data.Params) > 0 {
+			form := url.Values{}
+			for _, param := range data.Params {
+				form.Add(param.Name, param.Value)
+			}
+			step.RequestBody = form.Encode()
+		}
+		step.RequestBody = c.scrubBody(n, step.ContentType, step.RequestBody)
+	}
+	if step.RequestBody == "" {
+		step.ContentType = ""
+	}
+	return step, nil
+}
+
+// scrubBody applies secret choices to the fields of form and JSON object
+// bodies.
+func (c *harConversion) scrubBody(n int, contentType string, body string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		form, err := url.ParseQuery(body)
+		if err != nil {
+			return body
+		}
+		changed := false
+		for name, values := range form {
+			if !secretNameRegex.MatchString(name) {
+				continue
+			}
+			value, keep := c.scrub(n, "body:"+name, values[0])
+			if keep {
+				form.Set(name, value)
+			} else {
+				form.Del(name)
+			}
+			changed = changed || !keep || value != values[0]
+		}
+		if changed {
+			return form.Encode()
+		}
+	case strings.HasSuffix(mediaType, "json"):
+		var fields map[string]json.RawMessage
+		if json.Unmarshal([]byte(body), &fields) != nil {
+			return body
+		}
+		changed := false
+		for name, raw := range fields {
+			if !secretNameRegex.MatchString(name) {
+				continue
+			}
+			var recorded string
+			if json.Unmarshal(raw, &recorded) != nil {
+				recorded = string(raw)
+			}
+			value, keep := c.scrub(n, "body:"+name, recorded)
+			switch {
+			case !keep:
+				delete(fields, name)
+			case value != recorded:
+				fields[name], _ = json.Marshal(value)
+			default:
+				continue
+			}
+			changed = true
+		}
+		if changed {
+			scrubbed, _ := json.Marshal(fields)
+			return string(scrubbed)
+		}
+	}
+	return body
+}
+
+// convertHAR turns the selected entries of a recording, all of them if
+// none are, into the steps of a transaction check. Unless a choice was
+// made for every secret the entries send, it returns the ones left.
+func convertHAR(file harFile, selected []int, choices map[string]harSecretChoice) ([]TransactionStep, []harSecret, error) {
+	entries := file.Log.Entries
+	if selected == nil {
+		if len(entries) > maxTransactionSteps {
+			return nil, nil, fmt.Errorf("the recording has %d entries, select at most %d with entries", len(entries), maxTransactionSteps)
+		}
+		for i := range entries {
+			selected = append(selected, i)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, nil, errors.New("no entries selected")
+	}
+	for name, choice := range choices {
+		err := choice.validate()
+		if err != nil {
+			return nil, nil, fmt.Errorf("secrets[%q]: %w", name, err)
+		}
+	}
+
+	c := &harConversion{
+		choices:    choices,
+		used:       make(map[string]bool),
+		unresolved: make(map[string][]int),
+	}
+	var steps []TransactionStep
+	for i, index := range selected {
+		if index < 0 || index >= len(entries) {
+			return nil, nil, fmt.Errorf("no entry %d, the recording has %d", index, len(entries))
+		}
+		step, err := c.step(i+1, entries[index])
+		if err != nil {
+			return nil, nil, fmt.Errorf("entry %d: %w", index, err)
+		}
+		steps = append(steps, step)
+	}
+	for name := range choices {
+		if !c.used[name] {
+			return nil, nil, fmt.Errorf("secrets[%q] isn't sent by any selected entry", name)
+		}
+	}
+	if len(c.unresolved) > 0 {
+		var secrets []harSecret
+		for name, steps := range c.unresolved {
+			secrets = append(secrets, harSecret{Name: name, Steps: steps})
+		}
+		sort.Slice(secrets, func(i, j int) bool {
+			return secrets[i].Name < secrets[j].Name
+		})
+		return nil, secrets, nil
+	}
+	return steps, nil, nil
+}
+
+// handleJobFromHAR creates a transaction check from a HAR recording, e.g.
+// of a login flow exported from a browser. The request body is
+// {"har": {...}, "entries": [...], "secrets": {...}}, along with any other
+// job fields; entries are the indices of the recording's entries to make
+// steps of, and secrets say what to do with each credential they send.
+// If any is left undecided, nothing is created and the response lists
+// them.
+func (h *HealthcheckServer) handleJobFromHAR(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var overrides map[string]json.RawMessage
+	err := json.NewDecoder(io.LimitReader(r.Body, maxHARBytes)).Decode(&overrides)
+	if err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var file harFile
+	if raw, ok := overrides["har"]; ok {
+		err = json.Unmarshal(raw, &file)
+	}
+	if err != nil || len(file.Log.Entries) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("har must be a HAR recording with entries"))
+		return
+	}
+	var selected []int
+	if raw, ok := overrides["entries"]; ok {
+		err = json.Unmarshal(raw, &selected)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid entries: %w", err))
+			return
+		}
+	}
+	var choices map[string]harSecretChoice
+	if raw, ok := overrides["secrets"]; ok {
+		err = json.Unmarshal(raw, &choices)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid secrets: %w", err))
+			return
+		}
+	}
+	delete(overrides, "har")
+	delete(overrides, "entries")
+	delete(overrides, "secrets")
+
+	steps, secrets, err := convertHAR(file, selected, choices)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(secrets) > 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(struct {
+			Error   string      `json:"error"`
+			Secrets []harSecret `json:"secrets"`
+		}{
+			Error:   "the recording sends what look like credentials, say whether to keep, drop or replace each of them in secrets",
+			Secrets: secrets,
+		})
+		return
+	}
+	fields := map[string]interface{}{
+		"type":      checkTypeTransaction,
+		"frequency": "1m",
+		"steps":     steps,
+	}
+	for k, v := range overrides {
+		fields[k] = v
+	}
+	merged, err := json.Marshal(fields)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	var healthcheck HealthcheckQuery
+	err = json.Unmarshal(merged, &healthcheck)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	h.createJob(w, r, healthcheck)
+}
@@ -0,0 +1,185 @@
+package uptime
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// loginHAR is a recording of a login flow, as exported by a browser, with
+// a request blocked at the end.
+const loginHAR = `{"log": {"version": "1.2", "entries": [
+	{
+		"request": {"method": "GET", "url": "https://app.example.com/login", "headers": [
+			{"name": ":method", "value": "GET"},
+			{"name": "host", "value": "app.example.com"},
+			{"name": "accept", "value": "text/html"},
+			{"name": "accept-encoding", "value": "gzip, br"}
+		]},
+		"response": {"status": 200}
+	},
+	{
+		"request": {"method": "POST", "url": "https://app.example.com/session", "headers": [
+			{"name": "Content-Type", "value": "application/x-www-form-urlencoded"},
+			{"name": "Cookie", "value": "csrftoken=abc"}
+		], "postData": {"mimeType": "application/x-www-form-urlencoded", "params": [
+			{"name": "username", "value": "alice"},
+			{"name": "password", "value": "hunter2"}
+		]}},
+		"response": {"status": 302}
+	},
+	{
+		"request": {"method": "GET", "url": "https://app.example.com/api/me?access_token=t1&fields=name", "headers": [
+			{"name": "Authorization", "value": "Bearer t2"}
+		]},
+		"response": {"status": 200}
+	},
+	{
+		"request": {"method": "POST", "url": "https://app.example.com/api/items", "headers": [], "postData": {
+			"mimeType": "application/json", "text": "{\"name\": \"x\", \"api_key\": \"k\"}"
+		}},
+		"response": {"status": 201}
+	},
+	{
+		"request": {"method": "GET", "url": "https://cdn.example.com/app.js", "headers": []},
+		"response": {"status": 0}
+	}
+]}}`
+
+func TestConvertHAR(t *testing.T) {
+	var file harFile
+	err := json.Unmarshal([]byte(loginHAR), &file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := func(s string) *string { return &s }
+	tests := []struct {
+		name     string
+		selected []int
+		choices  map[string]harSecretChoice
+		steps    []TransactionStep
+		secrets  []harSecret
+		err      string
+	}{
+		{
+			name: "every entry",
+			err:  "entry 4: no response",
+		},
+		{
+			name:     "no secrets",
+			selected: []int{0},
+			steps: []TransactionStep{
+				{Method: "GET", Url: "https://app.example.com/login", Headers: map[string]string{"Accept": "text/html"}, ExpectedStatus: 200},
+			},
+		},
+		{
+			name:     "undecided secrets",
+			selected: []int{1, 2, 3},
+			choices:  map[string]harSecretChoice{"header:Cookie": {Drop: true}},
+			secrets: []harSecret{
+				{Name: "body:api_key", Steps: []int{3}},
+				{Name: "body:password", Steps: []int{1}},
+				{Name: "header:Authorization", Steps: []int{2}},
+				{Name: "query:access_token", Steps: []int{2}},
+			},
+		},
+		{
+			name:     "decided secrets",
+			selected: []int{1, 2, 3},
+			choices: map[string]harSecretChoice{
+				"header:Cookie":        {Drop: true},
+				"body:password":        {Value: value("from-vault")},
+				"header:Authorization": {Keep: true},
+				"query:access_token":   {Drop: true},
+				"body:api_key":         {Value: value("k2")},
+			},
+			steps: []TransactionStep{
+				{Method: "POST", Url: "https://app.example.com/session", ContentType: "application/x-www-form-urlencoded", RequestBody: "password=from-vault&username=alice", ExpectedStatus: 302},
+				{Method: "GET", Url: "https://app.example.com/api/me?fields=name", Headers: map[string]string{"Authorization": "Bearer t2"}, ExpectedStatus: 200},
+				{Method: "POST", Url: "https://app.example.com/api/items", ContentType: "application/json", RequestBody: `{"api_key":"k2","name":"x"}`, ExpectedStatus: 201},
+			},
+		},
+		{
+			name:     "secret not sent",
+			selected: []int{0},
+			choices:  map[string]harSecretChoice{"header:Cookie": {Keep: true}},
+			err:      `secrets["header:Cookie"] isn't sent by any selected entry`,
+		},
+		{
+			name:     "ambiguous choice",
+			selected: []int{1},
+			choices:  map[string]harSecretChoice{"header:Cookie": {Keep: true, Drop: true}},
+			err:      "set one of keep, drop or value",
+		},
+		{
+			name:     "no such entry",
+			selected: []int{9},
+			err:      "no entry 9",
+		},
+		{
+			name:     "nothing selected",
+			selected: []int{},
+			err:      "no entries selected",
+		},
+	}
+	for _, test := range tests {
+		steps, secrets, err := convertHAR(file, test.selected, test.choices)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(steps, test.steps) {
+			t.Errorf("%s: got steps %+v, want %+v", test.name, steps, test.steps)
+		}
+		if !reflect.DeepEqual(secrets, test.secrets) {
+			t.Errorf("%s: got secrets %+v, want %+v", test.name, secrets, test.secrets)
+		}
+	}
+}
+
+func TestJobFromHAR(t *testing.T) {
+	h, _ := newTestServer(t, func(healthcheck HealthcheckQuery, ctx context.Context) HealthcheckResponse {
+		return HealthcheckResponse{Status: true}
+	})
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/jobs/from-har", strings.NewReader(body)))
+		return w
+	}
+
+	w := post(`{"har": ` + loginHAR + `, "entries": [0, 2]}`)
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), `"query:access_token"`) {
+		t.Errorf("got status %d, want 422 listing the secrets: %s", w.Code, w.Body)
+	}
+	w = post(`{"har": ` + loginHAR + `, "entries": [0, 2], "secrets": {"header:Authorization": {"value": "Bearer new"}, "query:access_token": {"drop": true}}, "frequency": "5m"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("got status %d, want 201: %s", w.Code, w.Body)
+	}
+	var created struct {
+		Id healthcheckId `json:"id"`
+	}
+	err := json.Unmarshal(w.Body.Bytes(), &created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The API redacts the token, which the check itself sends.
+	h.mu.Lock()
+	stored := h.healthchecks[created.Id].healthcheck
+	h.mu.Unlock()
+	if stored.Type != checkTypeTransaction || stored.Frequency.String() != "5m0s" || len(stored.Steps) != 2 || stored.Steps[1].Headers["Authorization"] != "Bearer new" {
+		t.Errorf("got a %s check every %s with steps %+v, want 2 steps every 5m, the second with the replaced token", stored.Type, stored.Frequency, stored.Steps)
+	}
+	if w := post(`{"har": {"log": {"entries": []}}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("got status %d for an empty recording, want 400", w.Code)
+	}
+}
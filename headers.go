@@ -0,0 +1,137 @@
+package uptime
+
+import (
+	"fmt"
+	"net/http"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// reservedRequestHeaders are the headers checks set themselves, which
+// custom headers can't replace.
+var reservedRequestHeaders = map[string]bool{
+	"Host":              true,
+	"Content-Length":    true,
+	"Content-Type":      true,
+	"Transfer-Encoding": true,
+	"Connection":        true,
+	"Accept-Encoding":   true,
+	correlationHeader:   true,
+}
+
+// BasicAuth is the credentials an http check authenticates with.
+type BasicAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// redacted returns a copy of the credentials without the password.
+func (a *BasicAuth) redacted() *BasicAuth {
+	if a == nil || a.Password == "" {
+		return a
+	}
+	return &BasicAuth{Username: a.Username, Password: redactedSecret}
+}
+
+// keepSecrets restores the password of old sent back redacted.
+func (a *BasicAuth) keepSecrets(old *BasicAuth) {
+	if a != nil && old != nil && a.Password == redactedSecret {
+		a.Password = old.Password
+	}
+}
+
+// sensitiveHeader returns whether a request header's value is a
+// credential, e.g. Authorization, Cookie or X-Api-Key.
+func sensitiveHeader(name string) bool {
+	return secretNameRegex.MatchString(name)
+}
+
+// redactHeaders returns a copy of request headers with the values of
+// sensitive ones replaced by redactedSecret.
+func redactHeaders(headers map[string]string) map[string]string {
+	if headers == nil {
+		return nil
+	}
+	redacted := make(map[string]string, len(headers))
+	for name, value := range headers {
+		if sensitiveHeader(name) {
+			value = redactedSecret
+		}
+		redacted[name] = value
+	}
+	return redacted
+}
+
+// keepHeaderSecrets restores the values of sensitive headers of old sent
+// back redacted.
+func keepHeaderSecrets(headers map[string]string, old map[string]string) {
+	for name, value := range headers {
+		if oldValue, ok := old[name]; ok && value == redactedSecret && sensitiveHeader(name) {
+			headers[name] = oldValue
+		}
+	}
+}
+
+func (a *BasicAuth) validate() error {
+	if a.Username == "" {
+		return fmt.Errorf("basic_auth requires a username")
+	}
+	return nil
+}
+
+func (a *BasicAuth) equal(other *BasicAuth) bool {
+	if a == nil || other == nil {
+		return a == other
+	}
+	return *a == *other
+}
+
+// normalizeRequestHeaders validates custom request headers, and returns
+// them with canonical names.
+func normalizeRequestHeaders(headers map[string]string) (map[string]string, error) {
+	if len(headers) == 0 {
+		return nil, nil
+	}
+	normalized := make(map[string]string, len(headers))
+	for name, value := range headers {
+		if !httpguts.ValidHeaderFieldName(name) {
+			return nil, fmt.Errorf("invalid header name %q", name)
+		}
+		if !httpguts.ValidHeaderFieldValue(value) {
+			return nil, fmt.Errorf("invalid value for header %s", name)
+		}
+		name = http.CanonicalHeaderKey(name)
+		if reservedRequestHeaders[name] {
+			return nil, fmt.Errorf("header %s can't be set", name)
+		}
+		if _, ok := normalized[name]; ok {
+			return nil, fmt.Errorf("header %s is set more than once", name)
+		}
+		normalized[name] = value
+	}
+	return normalized, nil
+}
+
+// equalHeaders reports whether two sets of custom headers are the same.
+func equalHeaders(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, value := range a {
+		if other, ok := b[name]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
+
+// applyHeaders sets a check's custom headers and credentials on its
+// request.
+func (h HealthcheckQuery) applyHeaders(req *http.Request) {
+	for name, value := range h.Headers {
+		req.Header.Set(name, value)
+	}
+	if h.BasicAuth != nil {
+		req.SetBasicAuth(h.BasicAuth.Username, h.BasicAuth.Password)
+	}
+}
@@ -0,0 +1,44 @@
+package uptime
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+var heartbeatClient = &http.Client{
+	Timeout: 10 * time.Second,
+}
+
+// emitHeartbeats periodically pings the configured heartbeat URL, so that
+// an external service (e.g. healthchecks.io, or a peer instance) notices
+// when this server stops running.
+func (h *HealthcheckServer) emitHeartbeats() {
+	h.sendHeartbeat()
+	ticker := time.NewTicker(h.config.HeartbeatInterval)
+	defer ticker.Stop()
+	for tick(ticker, h.done) {
+		h.sendHeartbeat()
+	}
+}
+
+func (h *HealthcheckServer) sendHeartbeat() {
+	resp, err := heartbeatClient.Get(h.config.HeartbeatUrl)
+	if err != nil {
+		h.logger.Error("heartbeat-failed", slog.String("url", h.config.HeartbeatUrl), slog.String("error", err.Error()))
+		return
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBytes))
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		h.logger.Error("heartbeat-failed", slog.String("url", h.config.HeartbeatUrl), slog.Int("status", resp.StatusCode))
+	}
+}
+
+// handleHealthz lets peers (or another uptime checker) monitor this one.
+func (h *HealthcheckServer) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, "ok\n")
+}
@@ -0,0 +1,238 @@
+package uptime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// checkTypeICMP pings a host, for hosts that expose no TCP or HTTP
+// services at all.
+const checkTypeICMP = "icmp"
+
+const defaultPingCount = 3
+
+// PingQuery is how many pings ICMP checks send, and the average
+// round-trip time they may take.
+type PingQuery struct {
+	Count  int    `json:"count"`
+	MaxRtt string `json:"max_rtt,omitempty"`
+	maxRtt time.Duration
+}
+
+func (q *PingQuery) validate() error {
+	if q.Count == 0 {
+		q.Count = defaultPingCount
+	}
+	if q.Count < 0 || q.Count > 100 {
+		return fmt.Errorf("invalid ping.count %d, expected 1 to 100", q.Count)
+	}
+	q.maxRtt = 0
+	if q.MaxRtt != "" {
+		var err error
+		q.maxRtt, err = time.ParseDuration(q.MaxRtt)
+		if err != nil {
+			return fmt.Errorf("invalid ping.max_rtt %q: %w", q.MaxRtt, err)
+		}
+		if q.maxRtt <= 0 {
+			return fmt.Errorf("invalid ping.max_rtt %q, must be positive", q.MaxRtt)
+		}
+	}
+	return nil
+}
+
+func (q *PingQuery) equal(other *PingQuery) bool {
+	if q == nil || other == nil {
+		return q == other
+	}
+	return q.Count == other.Count && q.maxRtt == other.maxRtt
+}
+
+var icmpPorts = map[string]string{
+	"icmp": "",
+}
+
+// normalizeICMPURL normalizes the host of an ICMP check, given as
+// icmp://host or just host.
+func normalizeICMPURL(raw string) (string, error) {
+	normalized, err := normalizeURLSchemes(raw, "icmp", icmpPorts)
+	if err != nil {
+		return "", err
+	}
+	u, _ := url.Parse(normalized)
+	if u.Port() != "" || u.Path != "" && u.Path != "/" || u.RawQuery != "" {
+		return "", fmt.Errorf("invalid url %q: icmp urls are just a host", raw)
+	}
+	u.Path = ""
+	return u.String(), nil
+}
+
+// pingPayload is the data of echo requests, and pingBytes their size.
+var pingPayload = []byte("uptime-checker")
+
+var pingBytes = int64(8 + len(pingPayload))
+
+// pingConn is a socket to send echo requests from: an unprivileged ICMP
+// datagram socket where the system allows it, or a raw one otherwise.
+type pingConn struct {
+	*icmp.PacketConn
+	ipv6 bool
+	raw  bool
+}
+
+func listenPing(ipv6 bool, source netip.Addr) (*pingConn, error) {
+	network, rawNetwork, address := "udp4", "ip4:icmp", "0.0.0.0"
+	if ipv6 {
+		network, rawNetwork, address = "udp6", "ip6:ipv6-icmp", "::"
+	}
+	if source.IsValid() {
+		address = source.String()
+	}
+	conn, err := icmp.ListenPacket(network, address)
+	if err == nil {
+		return &pingConn{PacketConn: conn, ipv6: ipv6}, nil
+	}
+	conn, rawErr := icmp.ListenPacket(rawNetwork, address)
+	if rawErr != nil {
+		return nil, fmt.Errorf("can't open an icmp socket: %w", errors.Join(err, rawErr))
+	}
+	return &pingConn{PacketConn: conn, ipv6: ipv6, raw: true}, nil
+}
+
+// ping sends an echo request and waits for its reply until deadline,
+// returning the round-trip time.
+func (c *pingConn) ping(addr netip.Addr, id, seq int, deadline time.Time) (time.Duration, error) {
+	var msgType icmp.Type = ipv4.ICMPTypeEcho
+	var replyType icmp.Type = ipv4.ICMPTypeEchoReply
+	protocol := 1
+	if c.ipv6 {
+		msgType, replyType, protocol = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply, 58
+	}
+	msg := icmp.Message{
+		Type: msgType,
+		Body: &icmp.Echo{ID: id, Seq: seq, Data: pingPayload},
+	}
+	packet, err := msg.Marshal(nil)
+	if err != nil {
+		return 0, err
+	}
+	var dst net.Addr = &net.UDPAddr{IP: addr.AsSlice()}
+	if c.raw {
+		dst = &net.IPAddr{IP: addr.AsSlice()}
+	}
+	err = c.SetReadDeadline(deadline)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	_, err = c.WriteTo(packet, dst)
+	if err != nil {
+		return 0, err
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := c.ReadFrom(buf)
+		if err != nil {
+			return 0, err
+		}
+		reply, err := icmp.ParseMessage(protocol, buf[:n])
+		if err != nil || reply.Type != replyType {
+			continue
+		}
+		echo, ok := reply.Body.(*icmp.Echo)
+		// Datagram sockets get their id from the system, and only receive
+		// their own replies.
+		if !ok || echo.Seq != seq || c.raw && echo.ID != id {
+			continue
+		}
+		return time.Since(start), nil
+	}
+}
+
+// checkICMP pings the check's host Ping.Count times, one after the
+// other, within its timeout. It is down if no ping is answered, or if
+// they took longer than Ping.MaxRtt on average, and degraded if only some
+// are.
+func (h HealthcheckQuery) checkICMP(ctx context.Context) HealthcheckResponse {
+	u, err := url.Parse(h.Url)
+	if err != nil {
+		return failCheck(ctx, "%v", err)
+	}
+	query := h.Ping
+	if query == nil {
+		query = &PingQuery{Count: defaultPingCount}
+	}
+	timeout := h.timeout()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	addrs, err := probeResolver(ctx).LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return failCheck(ctx, "%v", err)
+	}
+	addr := addrs[0].Unmap()
+	if rules, ok := ctx.Value(addressRulesKey{}).(addressRules); ok && !rules.permits(addr) {
+		return failCheckReason(ctx, reasonConnectionFailed, "connecting to %s is not allowed", addr)
+	}
+	source, err := sourceAddressFrom(ctx)
+	if err != nil {
+		return failCheck(ctx, "%v", err)
+	}
+	if source.IsValid() && source.Is6() != addr.Is6() {
+		return failCheckReason(ctx, reasonConnectionFailed, "%v", errSourceFamily)
+	}
+	conn, err := listenPing(addr.Is6(), source)
+	if err != nil {
+		return failCheck(ctx, "%v", err)
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	perPing := time.Until(deadline) / time.Duration(query.Count)
+	id := os.Getpid() & 0xffff
+	received := 0
+	var total time.Duration
+	var lastErr error
+	counter := transferCounterFrom(ctx)
+	for seq := 0; seq < query.Count; seq++ {
+		counter.request()
+		rtt, err := conn.ping(addr, id, seq, time.Now().Add(perPing))
+		if counter != nil {
+			counter.sent.Add(pingBytes)
+			if err == nil {
+				counter.received.Add(pingBytes)
+			}
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		received++
+		total += rtt
+	}
+	if received == 0 {
+		return failCheck(ctx, "No reply to %d pings to %s: %v", query.Count, addr, lastErr)
+	}
+	average := total / time.Duration(received)
+	if query.maxRtt > 0 && average > query.maxRtt {
+		return failCheckReason(ctx, reasonAssertionFailed, "Average round-trip time to %s, %s > %s", addr, average, query.maxRtt)
+	}
+	if received < query.Count {
+		return HealthcheckResponse{
+			Status: true,
+			State:  stateDegraded,
+			Reason: reasonPacketLoss,
+			Error:  fmt.Sprintf("%d of %d pings to %s lost, average round-trip time %s", query.Count-received, query.Count, addr, average),
+		}
+	}
+	return HealthcheckResponse{Status: true}
+}
@@ -0,0 +1,25 @@
+package uptime
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// healthcheckId is a random (version 4) UUID, so ids stay unique across
+// restarts and never collide with ids recorded by external systems.
+type healthcheckId string
+
+func newHealthcheckId() healthcheckId {
+	return healthcheckId(newUUID())
+}
+
+func newUUID() string {
+	var b [16]byte
+	_, err := rand.Read(b[:])
+	if err != nil {
+		panic(err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,96 @@
+package uptime
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// freshConnectionClient never reuses connections, so every request through
+// it dials the target from scratch.
+var freshConnectionClient = &http.Client{
+	Transport: newFreshConnectionTransport(),
+}
+
+func newFreshConnectionTransport() *http.Transport {
+	t := newProbeTransport()
+	t.DisableKeepAlives = true
+	return t
+}
+
+type freshConnectionKey struct{}
+
+// withFreshConnection makes checks run with ctx dial a new connection
+// rather than reuse a pooled one.
+func withFreshConnection(ctx context.Context) context.Context {
+	return context.WithValue(ctx, freshConnectionKey{}, true)
+}
+
+func freshConnection(ctx context.Context) bool {
+	fresh, _ := ctx.Value(freshConnectionKey{}).(bool)
+	return fresh
+}
+
+// interval returns how often the check runs, depending on whether it is
+// currently down.
+func (h HealthcheckQuery) interval(down bool) time.Duration {
+	if down && h.DownFrequency > 0 {
+		return h.DownFrequency
+	}
+	return h.Frequency
+}
+
+// confirmRecovery re-probes a check that just passed after being down, on
+// a fresh connection, so that a recovery isn't declared on the strength of
+// a lucky pooled connection. Its result replaces the one that passed.
+func (h *HealthcheckServer) confirmRecovery(healthcheck HealthcheckQuery, ctx context.Context) HealthcheckResponse {
+	h.logger.Info("healthcheck-confirming-recovery",
+		slog.String("url", healthcheck.Url),
+		slog.String("correlation-id", correlationId(ctx)),
+	)
+	return h.check(healthcheck, withFreshConnection(ctx))
+}
+
+// maxThreshold is the most consecutive results a check may need to change
+// state.
+const maxThreshold = 100
+
+// threshold returns how many consecutive results it takes for the check to
+// leave its current state.
+func (h HealthcheckQuery) threshold(down bool) int {
+	threshold := h.FailureThreshold
+	if down {
+		threshold = h.SuccessThreshold
+	}
+	return max(threshold, 1)
+}
+
+// observe counts a result towards the job's threshold, and reports whether
+// it changes the job's state. A job's first result always decides its state.
+func (j *healthcheckJob) observe(up bool, first bool) bool {
+	if up != j.down {
+		j.streak = 0
+		return false
+	}
+	j.streak++
+	if !first && j.streak < j.healthcheck.threshold(j.down) {
+		return false
+	}
+	j.streak = 0
+	return true
+}
+
+// state returns the job's state as announced: DOWN, DEGRADED while its
+// passing results are, or UP.
+func (j *healthcheckJob) state() string {
+	switch {
+	case j.down:
+		return "DOWN"
+	case j.degraded:
+		return string(stateDegraded)
+	default:
+		return "UP"
+	}
+}
@@ -0,0 +1,396 @@
+package uptime
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// labelRequirement is a single term of a label selector.
+type labelRequirement struct {
+	key   string
+	op    string
+	value string
+}
+
+const (
+	selectorEquals    = "="
+	selectorNotEquals = "!="
+	selectorExists    = "exists"
+	selectorNotExists = "!exists"
+)
+
+// labelSelector matches checks by their labels. Its syntax follows
+// Kubernetes equality-based selectors: comma separated terms, each one of
+// key=value, key!=value, key (the label is set) or !key (it isn't), all of
+// which must hold.
+type labelSelector []labelRequirement
+
+func parseLabelSelector(s string) (labelSelector, error) {
+	var selector labelSelector
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		var req labelRequirement
+		switch {
+		case term == "":
+			return nil, fmt.Errorf("invalid selector %q, empty term", s)
+		case strings.Contains(term, "!="):
+			key, value, _ := strings.Cut(term, "!=")
+			req = labelRequirement{strings.TrimSpace(key), selectorNotEquals, strings.TrimSpace(value)}
+		case strings.Contains(term, "="):
+			key, value, _ := strings.Cut(term, "=")
+			req = labelRequirement{strings.TrimSpace(key), selectorEquals, strings.TrimSpace(value)}
+		case strings.HasPrefix(term, "!"):
+			req = labelRequirement{key: strings.TrimSpace(term[1:]), op: selectorNotExists}
+		default:
+			req = labelRequirement{key: term, op: selectorExists}
+		}
+		if err := validateLabelKey(req.key); err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %w", s, err)
+		}
+		selector = append(selector, req)
+	}
+	return selector, nil
+}
+
+func validateLabelKey(key string) error {
+	if key == "" || strings.ContainsAny(key, "=!, ") {
+		return fmt.Errorf("invalid label key %q", key)
+	}
+	return nil
+}
+
+// normalizeTags trims tags and drops duplicates, keeping their order.
+func normalizeTags(tags []string) ([]string, error) {
+	var normalized []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || strings.ContainsAny(tag, ", ") {
+			return nil, fmt.Errorf("invalid tag %q", tag)
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized, nil
+}
+
+// hasTags reports whether a check has every one of tags.
+func (h HealthcheckQuery) hasTags(tags []string) bool {
+	for _, tag := range tags {
+		found := false
+		for _, t := range h.Tags {
+			if t == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (s labelSelector) matches(labels map[string]string) bool {
+	for _, req := range s {
+		value, ok := labels[req.key]
+		switch req.op {
+		case selectorEquals:
+			if !ok || value != req.value {
+				return false
+			}
+		case selectorNotEquals:
+			if ok && value == req.value {
+				return false
+			}
+		case selectorExists:
+			if !ok {
+				return false
+			}
+		case selectorNotExists:
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// SetPaused pauses or resumes every check matching the selector, and
+// returns the checks that matched. A paused check keeps its definition and
+// history but isn't probed.
+func (h *HealthcheckServer) SetPaused(selector labelSelector, paused bool) []HealthcheckQuery {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	matched := []HealthcheckQuery{}
+	for _, old := range h.healthchecks {
+		healthcheck := old.healthcheck
+		if !selector.matches(healthcheck.Labels) {
+			continue
+		}
+		matched = append(matched, h.setJobPausedLocked(old, paused, time.Time{}))
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].Alias < matched[j].Alias
+	})
+	return matched
+}
+
+// setJobPaused pauses or resumes a single check, returning its definition.
+// Checks paused until resumeAt, if set, are resumed then.
+func (h *HealthcheckServer) setJobPaused(id healthcheckId, paused bool, resumeAt time.Time) (HealthcheckQuery, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	job, ok := h.healthchecks[id]
+	if !ok {
+		return HealthcheckQuery{}, false
+	}
+	return h.setJobPausedLocked(job, paused, resumeAt), true
+}
+
+// setJobPausedLocked pauses or resumes a job, until resumeAt if set, unless
+// it already is, and returns its definition. The job is changed in place,
+// like when it is relabeled, so that it stays down or up, and in its
+// incident, across a pause. A run in progress finishes as usual. h.mu must
+// be held.
+func (h *HealthcheckServer) setJobPausedLocked(job *healthcheckJob, paused bool, resumeAt time.Time) HealthcheckQuery {
+	if job.healthcheck.Paused == paused && job.healthcheck.ResumeAt.Equal(resumeAt) {
+		return job.healthcheck
+	}
+	now := h.clock.Now()
+	healthcheck := h.scheduler.edit(job, func(healthcheck *HealthcheckQuery) {
+		healthcheck.Paused = paused
+		healthcheck.ResumeAt = resumeAt
+		healthcheck.UpdatedAt = now
+		healthcheck.Version++
+		if !paused {
+			healthcheck.ArchivedAt = time.Time{}
+			healthcheck.resumedAt = now
+		}
+	})
+	if paused {
+		h.scheduler.suspend(job)
+	} else {
+		// A check archived for having run MaxRuns times runs them again.
+		h.scheduler.resetRuns(job)
+		h.config.JobStore.saveRuns(job.healthcheck.Id, 0)
+		h.scheduleJob(job)
+	}
+	h.scheduleResumeLocked(job)
+	h.config.JobStore.save(healthcheck)
+	if paused {
+		h.logConfigEvent("pause", healthcheck)
+	} else {
+		h.logConfigEvent("resume", healthcheck)
+	}
+	return healthcheck
+}
+
+// scheduleResumeLocked resumes the job at its ResumeAt, if it is paused
+// until then, instead of whenever it was to be resumed before. Resumes
+// that were due while the server was down happen right away. h.mu must be
+// held.
+func (h *HealthcheckServer) scheduleResumeLocked(job *healthcheckJob) {
+	h.cancelResumeLocked(job)
+	resumeAt := job.healthcheck.ResumeAt
+	if !job.healthcheck.Paused || resumeAt.IsZero() {
+		return
+	}
+	t := h.clock.NewTimer(resumeAt.Sub(h.clock.Now()))
+	cancelled := make(chan struct{})
+	job.cancelResume = func() {
+		t.Stop()
+		close(cancelled)
+	}
+	go func() {
+		select {
+		case <-t.C():
+		case <-cancelled:
+			return
+		case <-h.done:
+			return
+		}
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		select {
+		case <-cancelled:
+			// Cancelled while waiting for the lock.
+		default:
+			h.setJobPausedLocked(job, false, time.Time{})
+		}
+	}()
+}
+
+// cancelResumeLocked cancels resuming the job at its ResumeAt, e.g. once
+// it is resumed or deleted. h.mu must be held.
+func (h *HealthcheckServer) cancelResumeLocked(job *healthcheckJob) {
+	if job.cancelResume != nil {
+		job.cancelResume()
+		job.cancelResume = nil
+	}
+}
+
+// handleSetPaused serves POST /jobs/pause and /jobs/resume, which apply
+// to every check matching the selector query parameter.
+func (h *HealthcheckServer) handleSetPaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	selector, err := parseLabelSelector(r.URL.Query().Get("selector"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(h.SetPaused(selector, paused))
+}
+
+// handleJobSetPaused serves POST /jobs/{id}/pause and /jobs/{id}/resume,
+// which apply to a single check and return it.
+func (h *HealthcheckServer) handleJobSetPaused(w http.ResponseWriter, r *http.Request, jobId healthcheckId, paused bool) {
+	healthcheck, ok := h.setJobPaused(jobId, paused, time.Time{})
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(healthcheck)
+}
+
+// labelEdit is a change to the labels of every check matching Selector:
+// Set adds or overwrites labels, and Remove deletes them.
+type labelEdit struct {
+	Selector string            `json:"selector"`
+	Set      map[string]string `json:"set"`
+	Remove   []string          `json:"remove"`
+	// DryRun reports what the edit would change without changing it.
+	DryRun bool `json:"dry_run"`
+}
+
+// apply returns labels as edited, and whether that changes them.
+func (e labelEdit) apply(labels map[string]string) (map[string]string, bool) {
+	edited := make(map[string]string, len(labels)+len(e.Set))
+	for key, value := range labels {
+		edited[key] = value
+	}
+	changed := false
+	for key, value := range e.Set {
+		if old, ok := edited[key]; !ok || old != value {
+			edited[key] = value
+			changed = true
+		}
+	}
+	for _, key := range e.Remove {
+		if _, ok := edited[key]; ok {
+			delete(edited, key)
+			changed = true
+		}
+	}
+	if len(edited) == 0 {
+		edited = nil
+	}
+	return edited, changed
+}
+
+// EditLabels applies an edit to the labels of every check matching the
+// selector at once, and returns the checks that matched, as edited, and
+// how many of them changed. Unless it is a dry run, changed checks are
+// updated, keeping their state, runs and history.
+func (h *HealthcheckServer) EditLabels(selector labelSelector, edit labelEdit) ([]HealthcheckQuery, int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	matched := []HealthcheckQuery{}
+	changed := 0
+	for _, job := range h.healthchecks {
+		healthcheck := job.healthcheck
+		if !selector.matches(healthcheck.Labels) {
+			continue
+		}
+		labels, ok := edit.apply(healthcheck.Labels)
+		if ok {
+			changed++
+			healthcheck.Labels = labels
+			if !edit.DryRun {
+				healthcheck = h.relabelJobLocked(job, labels)
+			}
+		}
+		matched = append(matched, healthcheck)
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].Alias < matched[j].Alias
+	})
+	return matched, changed
+}
+
+// relabelJobLocked changes a job's labels in place: its schedule doesn't
+// depend on them, so it isn't rescheduled, nor waits for a run in
+// progress, and keeps its state. h.mu must be held.
+func (h *HealthcheckServer) relabelJobLocked(job *healthcheckJob, labels map[string]string) HealthcheckQuery {
+	now := h.clock.Now()
+	healthcheck := h.scheduler.edit(job, func(healthcheck *HealthcheckQuery) {
+		healthcheck.Labels = labels
+		healthcheck.UpdatedAt = now
+		healthcheck.Version++
+	})
+	h.config.JobStore.save(healthcheck)
+	h.logConfigEvent("relabel", healthcheck)
+	return healthcheck
+}
+
+// handleEditLabels serves POST /jobs/labels, which edits the labels of
+// every check matching a selector in one call, e.g. to rename a team.
+func (h *HealthcheckServer) handleEditLabels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var edit labelEdit
+	err := json.NewDecoder(r.Body).Decode(&edit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	selector, err := parseLabelSelector(edit.Selector)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(edit.Set) == 0 && len(edit.Remove) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("nothing to edit, expected labels to set or remove"))
+		return
+	}
+	for key := range edit.Set {
+		err = validateLabelKey(key)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	for _, key := range edit.Remove {
+		err = validateLabelKey(key)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if _, ok := edit.Set[key]; ok {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("label %q is both set and removed", key))
+			return
+		}
+	}
+	matched, changed := h.EditLabels(selector, edit)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(struct {
+		Matched int                `json:"matched"`
+		Changed int                `json:"changed"`
+		DryRun  bool               `json:"dry_run,omitempty"`
+		Jobs    []HealthcheckQuery `json:"jobs"`
+	}{len(matched), changed, edit.DryRun, matched})
+}
@@ -0,0 +1,160 @@
+package uptime
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// busRecorder records the events it is subscribed to.
+type busRecorder struct {
+	mu     sync.Mutex
+	events []busEvent
+}
+
+func (r *busRecorder) handle(event busEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *busRecorder) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.events)
+}
+
+func TestPauseKeepsJobState(t *testing.T) {
+	runs := 0
+	h, clk := newTestServer(t, func(healthcheck HealthcheckQuery, ctx context.Context) HealthcheckResponse {
+		runs++
+		return failCheckReason(ctx, reasonUnexpectedStatus, "unexpected status 500")
+	})
+	changes := &busRecorder{}
+	h.bus.subscribe(changes, busStateChanged)
+	healthcheck := h.AddHealthcheck(HealthcheckQuery{Url: "http://203.0.113.1", Frequency: time.Minute})
+	h.mu.Lock()
+	job := h.healthchecks[healthcheck.Id]
+	h.mu.Unlock()
+	step := func(d time.Duration) {
+		clk.Advance(d)
+		h.scheduler.dispatchDue()
+		h.scheduler.waitIdle()
+	}
+	post := func(action string) {
+		r := httptest.NewRequest(http.MethodPost, "/jobs/"+string(healthcheck.Id)+"/"+action, nil)
+		w := httptest.NewRecorder()
+		h.Handler().ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: got status %d, want 200: %s", action, w.Code, w.Body)
+		}
+	}
+
+	step(time.Minute)
+	incidents := h.incidents.forJob(healthcheck.Id)
+	if changes.count() != 1 || len(incidents) != 1 {
+		t.Fatalf("got %d state changes and %d incidents, want the check down", changes.count(), len(incidents))
+	}
+
+	post("pause")
+	step(time.Hour)
+	if runs != 1 {
+		t.Fatalf("got %d runs while paused, want none after the first", runs-1)
+	}
+	post("resume")
+	step(time.Minute)
+	if runs != 2 {
+		t.Fatalf("got %d runs after resuming, want 2", runs)
+	}
+
+	h.mu.Lock()
+	resumed := h.healthchecks[healthcheck.Id]
+	h.mu.Unlock()
+	if resumed != job || !job.down {
+		t.Errorf("the check isn't the same job, still down")
+	}
+	if changes.count() != 1 {
+		t.Errorf("got %d state changes, want the check to stay down without alerting again", changes.count())
+	}
+	if current := h.incidents.forJob(healthcheck.Id); len(current) != 1 || current[0].Id != incidents[0].Id || current[0].ClosedAt != nil {
+		t.Errorf("got %d incidents, want the first to stay open", len(current))
+	}
+	if gaps := h.gaps.list(healthcheck.Id); len(gaps) != 0 {
+		t.Errorf("got %d gaps, want the pause not to count as missed runs", len(gaps))
+	}
+}
+
+// eventually reports whether cond holds within a second, for what other
+// goroutines do once the simulated clock is advanced.
+func eventually(cond func() bool) bool {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if cond() {
+			return true
+		}
+	}
+	return cond()
+}
+
+func TestTimedResume(t *testing.T) {
+	h, clk := newTestServer(t, func(healthcheck HealthcheckQuery, ctx context.Context) HealthcheckResponse {
+		return HealthcheckResponse{Status: true}
+	})
+	healthcheck := h.AddHealthcheck(HealthcheckQuery{Url: "http://203.0.113.1", Frequency: time.Minute})
+	paused := func() bool {
+		current, _ := h.GetHealthcheck(healthcheck.Id)
+		return current.Paused
+	}
+
+	h.setJobPaused(healthcheck.Id, true, clk.Now().Add(time.Hour))
+	clk.Advance(30 * time.Minute)
+	if !paused() {
+		t.Fatal("the check was resumed early")
+	}
+	clk.Advance(30 * time.Minute)
+	if !eventually(func() bool { return !paused() }) {
+		t.Fatal("the check wasn't resumed after an hour")
+	}
+	if current, _ := h.GetHealthcheck(healthcheck.Id); !current.ResumeAt.IsZero() {
+		t.Errorf("got resume_at %s once resumed, want none", current.ResumeAt)
+	}
+
+	// Resuming and pausing again for good cancels the timed resume.
+	h.setJobPaused(healthcheck.Id, true, clk.Now().Add(time.Hour))
+	h.setJobPaused(healthcheck.Id, false, time.Time{})
+	h.setJobPaused(healthcheck.Id, true, time.Time{})
+	clk.Advance(2 * time.Hour)
+	if eventually(func() bool { return !paused() }) {
+		t.Error("a cancelled timed resume resumed the check")
+	}
+}
+
+func TestTimedResumeRestored(t *testing.T) {
+	h, clk := newTestServer(t, func(healthcheck HealthcheckQuery, ctx context.Context) HealthcheckResponse {
+		return HealthcheckResponse{Status: true}
+	})
+	stored := HealthcheckQuery{Id: newHealthcheckId(), Alias: 1, Url: "http://203.0.113.1", Frequency: time.Minute, Paused: true, ResumeAt: clk.Now().Add(time.Hour)}
+	definition, err := stored.marshalStored()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restored HealthcheckQuery
+	err = restored.restoreMetadata(definition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !restored.ResumeAt.Equal(stored.ResumeAt) {
+		t.Fatalf("got resume_at %s after a reload, want %s", restored.ResumeAt, stored.ResumeAt)
+	}
+
+	h.RestoreHealthcheck(stored)
+	clk.Advance(time.Hour)
+	if !eventually(func() bool {
+		current, _ := h.GetHealthcheck(stored.Id)
+		return !current.Paused
+	}) {
+		t.Error("a restored check wasn't resumed at its resume_at")
+	}
+}
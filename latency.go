@@ -0,0 +1,72 @@
+package uptime
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// defaultLatencyWindow is the window GET /jobs/{id}/latency reports on
+// unless asked otherwise.
+const defaultLatencyWindow = "1h"
+
+// latencyStats are the percentiles of a check's latency over a rolling
+// window, in milliseconds, nil if there are no samples.
+type latencyStats struct {
+	Window  string   `json:"window"`
+	Samples int      `json:"samples"`
+	P50Ms   *float64 `json:"p50_ms"`
+	P95Ms   *float64 `json:"p95_ms"`
+	P99Ms   *float64 `json:"p99_ms"`
+}
+
+// percentile returns the nearest-rank percentile p of sorted latencies.
+func percentile(sorted []time.Duration, p float64) *float64 {
+	if len(sorted) == 0 {
+		return nil
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return milliseconds(sorted[max(rank, 1)-1])
+}
+
+// latencyPercentiles computes the percentiles of the latencies of results.
+// Neutral results, e.g. throttled ones, are left out; failures aren't, so
+// that time outs show in the higher percentiles.
+func latencyPercentiles(results []HealthcheckResponse, window string) latencyStats {
+	var latencies []time.Duration
+	for _, resp := range results {
+		if !resp.neutral() {
+			latencies = append(latencies, resp.Latency)
+		}
+	}
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+	return latencyStats{
+		Window:  window,
+		Samples: len(latencies),
+		P50Ms:   percentile(latencies, 50),
+		P95Ms:   percentile(latencies, 95),
+		P99Ms:   percentile(latencies, 99),
+	}
+}
+
+// handleGetJobLatency serves GET /jobs/{id}/latency, the percentiles of a
+// check's latency over the window query parameter, e.g. 15m or 1d, out of
+// its latest results.
+func (h *HealthcheckServer) handleGetJobLatency(w http.ResponseWriter, r *http.Request, jobId healthcheckId) {
+	name := r.URL.Query().Get("window")
+	if name == "" {
+		name = defaultLatencyWindow
+	}
+	window, err := parseStatsWindow(name)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	results := h.results.list(jobId, h.clock.Now().Add(-window), resultsPerJob)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(latencyPercentiles(results, name))
+}
@@ -0,0 +1,113 @@
+package uptime
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+type lintProblem struct {
+	Check   *int   `json:"check,omitempty"`
+	Message string `json:"message"`
+}
+
+type lintReport struct {
+	File     string        `json:"file"`
+	Valid    bool          `json:"valid"`
+	Problems []lintProblem `json:"problems"`
+}
+
+// lintChecksFile validates a checks file without running anything:
+// every check must decode like an API request would, must not duplicate
+// another check, and must not run more often than minFrequency.
+func lintChecksFile(path string, minFrequency time.Duration) lintReport {
+	report := lintReport{File: path, Problems: []lintProblem{}}
+	checks, err := readChecksFile(path)
+	if err != nil {
+		report.Problems = append(report.Problems, lintProblem{Message: err.Error()})
+		return report
+	}
+
+	var valid []HealthcheckQuery
+	var indexes []int
+	for i, data := range checks {
+		i := i
+		problem := func(format string, args ...interface{}) {
+			report.Problems = append(report.Problems, lintProblem{Check: &i, Message: fmt.Sprintf(format, args...)})
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err := dec.Decode(&healthcheckQueryInput{})
+		if err != nil {
+			problem("%v", err)
+			continue
+		}
+		var healthcheck HealthcheckQuery
+		err = json.Unmarshal(data, &healthcheck)
+		if err != nil {
+			problem("%v", err)
+			continue
+		}
+		if healthcheck.Frequency < minFrequency {
+			problem("frequency %s is below the minimum of %s", healthcheck.Frequency, minFrequency)
+		}
+		for j, other := range valid {
+			if healthcheck.equivalent(other) {
+				problem("duplicates check %d", indexes[j])
+				break
+			}
+		}
+		valid = append(valid, healthcheck)
+		indexes = append(indexes, i)
+	}
+	report.Valid = len(report.Problems) == 0
+	return report
+}
+
+func writeLintReport(w io.Writer, report lintReport, format string) {
+	if format == "json" {
+		json.NewEncoder(w).Encode(report)
+		return
+	}
+	for _, p := range report.Problems {
+		if p.Check != nil {
+			fmt.Fprintf(w, "%s: check %d: %s\n", report.File, *p.Check, p.Message)
+		} else {
+			fmt.Fprintf(w, "%s: %s\n", report.File, p.Message)
+		}
+	}
+	if report.Valid {
+		fmt.Fprintf(w, "%s: ok\n", report.File)
+	}
+}
+
+// runLint implements the lint subcommand and returns the exit code.
+func runLint(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	minFrequency := flags.Duration("min-frequency", 10*time.Second, "minimum allowed check frequency")
+	format := flags.String("format", "text", "output format, text or json")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s lint [flags] checks.yaml...\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	code := 0
+	for _, path := range flags.Args() {
+		report := lintChecksFile(path, *minFrequency)
+		writeLintReport(os.Stdout, report, *format)
+		if !report.Valid {
+			code = 1
+		}
+	}
+	return code
+}
@@ -0,0 +1,279 @@
+package uptime
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultAlertLocale is the locale of alerts whose channel doesn't set one.
+const defaultAlertLocale = "en"
+
+// alertLocale is the wording of Slack and email alerts in a language.
+// StillDown and SubjectEscalation take the escalation step, and StateAsOf
+// the check's method, url, state and the time, which is formatted with
+// TimeLayout, with {weekday} replaced by the day's name from Weekdays.
+type alertLocale struct {
+	Down              string   `yaml:"down"`
+	Recovered         string   `yaml:"recovered"`
+	Degraded          string   `yaml:"degraded"`
+	StillDown         string   `yaml:"still_down"`
+	StatusCode        string   `yaml:"status_code"`
+	Reason            string   `yaml:"reason"`
+	FollowingDeploy   string   `yaml:"following_deploy"`
+	Source            string   `yaml:"source"`
+	Acknowledge       string   `yaml:"acknowledge"`
+	SLOBreached       string   `yaml:"slo_breached"`
+	SLOMet            string   `yaml:"slo_met"`
+	Check             string   `yaml:"check"`
+	StateAsOf         string   `yaml:"state_as_of"`
+	SubjectDown       string   `yaml:"subject_down"`
+	SubjectRecovered  string   `yaml:"subject_recovered"`
+	SubjectDegraded   string   `yaml:"subject_degraded"`
+	SubjectEscalation string   `yaml:"subject_escalation"`
+	StateUp           string   `yaml:"state_up"`
+	StateDown         string   `yaml:"state_down"`
+	StateDegraded     string   `yaml:"state_degraded"`
+	TimeLayout        string   `yaml:"time_layout"`
+	Weekdays          []string `yaml:"weekdays"`
+}
+
+// alertLocales are the locales alerts can be worded in, by name: the
+// bundled ones, and those added or changed with -alert-locales.
+var alertLocales = map[string]*alertLocale{
+	"en": {
+		Down:              "Down",
+		Recovered:         "Recovered",
+		Degraded:          "Degraded",
+		StillDown:         "Still down (escalation %d)",
+		StatusCode:        "Status code",
+		Reason:            "Reason",
+		FollowingDeploy:   "Following deploy",
+		Source:            "Source",
+		Acknowledge:       "Acknowledge with",
+		SLOBreached:       "Latency SLO breached",
+		SLOMet:            "Latency SLO met",
+		Check:             "Check",
+		StateAsOf:         "%[1]s %[2]s is %[3]s as of %[4]s.",
+		SubjectDown:       "DOWN",
+		SubjectRecovered:  "RECOVERED",
+		SubjectDegraded:   "DEGRADED",
+		SubjectEscalation: "ESCALATION %d",
+		StateUp:           "UP",
+		StateDown:         "DOWN",
+		StateDegraded:     "DEGRADED",
+		TimeLayout:        time.RFC1123,
+	},
+	"de": {
+		Down:              "Ausgefallen",
+		Recovered:         "Wiederhergestellt",
+		Degraded:          "Beeinträchtigt",
+		StillDown:         "Weiterhin ausgefallen (Eskalation %d)",
+		StatusCode:        "Statuscode",
+		Reason:            "Grund",
+		FollowingDeploy:   "Nach Deployment",
+		Source:            "Quelle",
+		Acknowledge:       "Bestätigen mit",
+		SLOBreached:       "Latenz-SLO verletzt",
+		SLOMet:            "Latenz-SLO eingehalten",
+		Check:             "Prüfung",
+		StateAsOf:         "%[1]s %[2]s: %[3]s seit %[4]s.",
+		SubjectDown:       "AUSGEFALLEN",
+		SubjectRecovered:  "WIEDERHERGESTELLT",
+		SubjectDegraded:   "BEEINTRÄCHTIGT",
+		SubjectEscalation: "ESKALATION %d",
+		StateUp:           "VERFÜGBAR",
+		StateDown:         "AUSGEFALLEN",
+		StateDegraded:     "BEEINTRÄCHTIGT",
+		TimeLayout:        "{weekday}, 02.01.2006 15:04:05 MST",
+		Weekdays:          []string{"So.", "Mo.", "Di.", "Mi.", "Do.", "Fr.", "Sa."},
+	},
+	"fr": {
+		Down:              "En panne",
+		Recovered:         "Rétabli",
+		Degraded:          "Dégradé",
+		StillDown:         "Toujours en panne (escalade %d)",
+		StatusCode:        "Code de statut",
+		Reason:            "Raison",
+		FollowingDeploy:   "Après le déploiement",
+		Source:            "Source",
+		Acknowledge:       "Acquitter avec",
+		SLOBreached:       "SLO de latence non respecté",
+		SLOMet:            "SLO de latence respecté",
+		Check:             "Vérification",
+		StateAsOf:         "%[1]s %[2]s : %[3]s depuis le %[4]s.",
+		SubjectDown:       "EN PANNE",
+		SubjectRecovered:  "RÉTABLI",
+		SubjectDegraded:   "DÉGRADÉ",
+		SubjectEscalation: "ESCALADE %d",
+		StateUp:           "OPÉRATIONNEL",
+		StateDown:         "EN PANNE",
+		StateDegraded:     "DÉGRADÉ",
+		TimeLayout:        "{weekday} 02/01/2006 15:04:05 MST",
+		Weekdays:          []string{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."},
+	},
+	"es": {
+		Down:              "Caído",
+		Recovered:         "Recuperado",
+		Degraded:          "Degradado",
+		StillDown:         "Sigue caído (escalado %d)",
+		StatusCode:        "Código de estado",
+		Reason:            "Motivo",
+		FollowingDeploy:   "Tras el despliegue",
+		Source:            "Origen",
+		Acknowledge:       "Reconocer con",
+		SLOBreached:       "SLO de latencia incumplido",
+		SLOMet:            "SLO de latencia cumplido",
+		Check:             "Comprobación",
+		StateAsOf:         "%[1]s %[2]s: %[3]s desde el %[4]s.",
+		SubjectDown:       "CAÍDO",
+		SubjectRecovered:  "RECUPERADO",
+		SubjectDegraded:   "DEGRADADO",
+		SubjectEscalation: "ESCALADO %d",
+		StateUp:           "ACTIVO",
+		StateDown:         "CAÍDO",
+		StateDegraded:     "DEGRADADO",
+		TimeLayout:        "{weekday} 02/01/2006 15:04:05 MST",
+		Weekdays:          []string{"dom.", "lun.", "mar.", "mié.", "jue.", "vie.", "sáb."},
+	},
+	"ja": {
+		Down:              "ダウン",
+		Recovered:         "復旧",
+		Degraded:          "劣化",
+		StillDown:         "ダウン継続中（エスカレーション %d）",
+		StatusCode:        "ステータスコード",
+		Reason:            "理由",
+		FollowingDeploy:   "直前のデプロイ",
+		Source:            "実行元",
+		Acknowledge:       "確認トークン",
+		SLOBreached:       "レイテンシSLO違反",
+		SLOMet:            "レイテンシSLO回復",
+		Check:             "チェック",
+		StateAsOf:         "%[1]s %[2]s は %[4]s 時点で %[3]s です。",
+		SubjectDown:       "ダウン",
+		SubjectRecovered:  "復旧",
+		SubjectDegraded:   "劣化",
+		SubjectEscalation: "エスカレーション %d",
+		StateUp:           "稼働中",
+		StateDown:         "ダウン",
+		StateDegraded:     "劣化",
+		TimeLayout:        "2006年01月02日({weekday}) 15:04:05 MST",
+		Weekdays:          []string{"日", "月", "火", "水", "木", "金", "土"},
+	},
+}
+
+// lookupAlertLocale returns the locale named, the default one if the name
+// is empty.
+func lookupAlertLocale(name string) *alertLocale {
+	if name == "" {
+		name = defaultAlertLocale
+	}
+	if l, ok := alertLocales[name]; ok {
+		return l
+	}
+	return alertLocales[defaultAlertLocale]
+}
+
+func validateAlertLocale(name string) error {
+	if _, ok := alertLocales[name]; name != "" && !ok {
+		return fmt.Errorf("unknown locale %q", name)
+	}
+	return nil
+}
+
+// formatTime formats a timestamp of an alert, in UTC.
+func (l *alertLocale) formatTime(t time.Time) string {
+	t = t.UTC()
+	formatted := t.Format(l.TimeLayout)
+	if len(l.Weekdays) == 7 {
+		formatted = strings.ReplaceAll(formatted, "{weekday}", l.Weekdays[t.Weekday()])
+	}
+	return formatted
+}
+
+// state translates a transition's state.
+func (l *alertLocale) state(state string) string {
+	switch state {
+	case "UP":
+		return l.StateUp
+	case string(stateDegraded):
+		return l.StateDegraded
+	}
+	return l.StateDown
+}
+
+func (l *alertLocale) validate() error {
+	for name, text := range map[string]string{
+		"down":               l.Down,
+		"recovered":          l.Recovered,
+		"degraded":           l.Degraded,
+		"status_code":        l.StatusCode,
+		"reason":             l.Reason,
+		"following_deploy":   l.FollowingDeploy,
+		"source":             l.Source,
+		"acknowledge":        l.Acknowledge,
+		"slo_breached":       l.SLOBreached,
+		"slo_met":            l.SLOMet,
+		"check":              l.Check,
+		"state_as_of":        l.StateAsOf,
+		"subject_down":       l.SubjectDown,
+		"subject_recovered":  l.SubjectRecovered,
+		"subject_degraded":   l.SubjectDegraded,
+		"state_up":           l.StateUp,
+		"state_down":         l.StateDown,
+		"state_degraded":     l.StateDegraded,
+		"time_layout":        l.TimeLayout,
+		"still_down":         l.StillDown,
+		"subject_escalation": l.SubjectEscalation,
+	} {
+		if text == "" {
+			return fmt.Errorf("%s is empty", name)
+		}
+	}
+	if !strings.Contains(l.StillDown, "%d") || !strings.Contains(l.SubjectEscalation, "%d") {
+		return fmt.Errorf("still_down and subject_escalation must include the escalation step, %%d")
+	}
+	if l.Weekdays != nil && len(l.Weekdays) != 7 {
+		return fmt.Errorf("weekdays must name the 7 days, from Sunday")
+	}
+	return nil
+}
+
+type alertLocalesFile struct {
+	Locales map[string]yaml.Node `yaml:"locales"`
+}
+
+// readAlertLocales adds the locales of a YAML file to the bundled ones.
+// Locales that are already bundled only change the phrases the file
+// sets; new ones start from English.
+func readAlertLocales(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var file alertLocalesFile
+	err = yaml.Unmarshal(data, &file)
+	if err != nil {
+		return fmt.Errorf("invalid alert locales: %w", err)
+	}
+	for name, node := range file.Locales {
+		base, ok := alertLocales[name]
+		if !ok {
+			base = alertLocales[defaultAlertLocale]
+		}
+		locale := *base
+		err = node.Decode(&locale)
+		if err != nil {
+			return fmt.Errorf("locale %q: %w", name, err)
+		}
+		err = locale.validate()
+		if err != nil {
+			return fmt.Errorf("locale %q: %w", name, err)
+		}
+		alertLocales[name] = &locale
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package uptime
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// slowLocationFactor is how many times slower than the median of the
+// other locations a location must be to be flagged as degraded.
+const slowLocationFactor = 2
+
+// locationResults keeps the latest result of every check per probe
+// location, so that the same check seen from several regions can be
+// compared.
+type locationResults struct {
+	mu     sync.Mutex
+	latest map[healthcheckId]map[string]HealthcheckResponse
+}
+
+func newLocationResults() *locationResults {
+	return &locationResults{latest: make(map[healthcheckId]map[string]HealthcheckResponse)}
+}
+
+func (l *locationResults) record(id healthcheckId, resp HealthcheckResponse) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	byLocation, ok := l.latest[id]
+	if !ok {
+		byLocation = make(map[string]HealthcheckResponse)
+		l.latest[id] = byLocation
+	}
+	// Uploaded results may arrive late, and out of order.
+	if latest, ok := byLocation[resp.Source.Location]; ok && latest.Timestamp.After(resp.Timestamp) {
+		return
+	}
+	byLocation[resp.Source.Location] = resp
+}
+
+func (l *locationResults) forget(id healthcheckId) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.latest, id)
+}
+
+type locationComparison struct {
+	Location  string    `json:"location"`
+	Status    string    `json:"status"`
+	Duration  int64     `json:"duration_ms"`
+	Timestamp time.Time `json:"timestamp"`
+	Error     string    `json:"error,omitempty"`
+	// Degraded flags a location that is down while others are up, or much
+	// slower than the others.
+	Degraded bool   `json:"degraded"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+func medianDuration(durations []time.Duration) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	mid := len(durations) / 2
+	if len(durations)%2 == 0 {
+		return (durations[mid-1] + durations[mid]) / 2
+	}
+	return durations[mid]
+}
+
+// compare returns the latest result of a check per location, sorted by
+// location, each flagged if it stands out from the others.
+func (l *locationResults) compare(id healthcheckId) []locationComparison {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	byLocation := l.latest[id]
+	comparison := make([]locationComparison, 0, len(byLocation))
+	for location, resp := range byLocation {
+		c := locationComparison{
+			Location:  location,
+			Status:    resp.statusString(),
+			Duration:  resp.Duration.Milliseconds(),
+			Timestamp: resp.Timestamp,
+			Error:     resp.Error,
+		}
+
+		othersUp := 0
+		var otherDurations []time.Duration
+		for other, otherResp := range byLocation {
+			if other == location || !otherResp.Status {
+				continue
+			}
+			othersUp++
+			otherDurations = append(otherDurations, otherResp.Duration)
+		}
+		median := medianDuration(otherDurations)
+		switch {
+		case !resp.Status && !resp.neutral() && othersUp > 0:
+			c.Degraded = true
+			c.Reason = "down here only"
+		case resp.Status && median > 0 && resp.Duration > slowLocationFactor*median:
+			c.Degraded = true
+			c.Reason = "slower than other locations (median " + median.Round(time.Millisecond).String() + ")"
+		}
+		comparison = append(comparison, c)
+	}
+	sort.Slice(comparison, func(i, j int) bool {
+		return comparison[i].Location < comparison[j].Location
+	})
+	return comparison
+}
+
+// handleGetJobLocations serves GET /jobs/{id}/locations.
+func (h *HealthcheckServer) handleGetJobLocations(w http.ResponseWriter, r *http.Request, jobId healthcheckId) {
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(h.locations.compare(jobId))
+}
@@ -0,0 +1,60 @@
+package uptime
+
+import (
+	"context"
+	"math/rand"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	logResultsAll      = "all"
+	logResultsFailures = "failures"
+	logResultsChanges  = "changes"
+)
+
+func validLogResults(mode string) bool {
+	return mode == logResultsAll || mode == logResultsFailures || mode == logResultsChanges
+}
+
+// shouldLogResult decides whether a run's result is logged. It only
+// affects logging: every result is still recorded and published.
+// changed is whether the run changed the check's status, which a check's
+// first run always does.
+func (h *HealthcheckServer) shouldLogResult(resp HealthcheckResponse, changed bool) bool {
+	switch h.config.LogResults {
+	case logResultsFailures:
+		if !resp.Status || changed {
+			return true
+		}
+	case logResultsChanges:
+		if changed {
+			return true
+		}
+	default:
+		return true
+	}
+	return resp.Status && rand.Float64() < h.config.LogSuccessSampleRate
+}
+
+func (h *HealthcheckServer) logResult(healthcheck HealthcheckQuery, resp HealthcheckResponse) {
+	if resp.Error != "" {
+		h.logger.Warn("healthcheck-error",
+			slog.String("correlation-id", resp.CorrelationId),
+			slog.String("error", resp.Error),
+		)
+	}
+	attrs := []slog.Attr{
+		slog.String("url", healthcheck.Url),
+		slog.String("method", healthcheck.Method),
+		slog.Int("expected-status", healthcheck.ExpectedStatus),
+		slog.String("priority", healthcheck.Priority.String()),
+		slog.String("status", resp.statusString()),
+		slog.String("correlation-id", resp.CorrelationId),
+	}
+	if resp.Dial != nil {
+		attrs = append(attrs, resp.Dial.logAttrs()...)
+	}
+	attrs = append(attrs, resp.Source.logAttrs()...)
+	h.logger.LogAttrs(context.Background(), slog.LevelInfo, "healthcheck-done", attrs...)
+}
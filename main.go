@@ -1,13 +1,21 @@
-package main
+package uptime
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/http/httptrace"
+	"os"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,56 +23,441 @@ import (
 	"golang.org/x/exp/slog"
 )
 
+// httpClient makes probe requests, which their check's timeout bounds
+// through their context rather than the client.
 var httpClient = &http.Client{
-	Timeout: 10 * time.Second,
+	Transport: newProbeTransport(),
 }
 
-type healthcheckId int
+const (
+	// defaultCheckTimeout is how long a check may take, unless it says
+	// otherwise.
+	defaultCheckTimeout = 10 * time.Second
+	maxCheckTimeout     = 5 * time.Minute
+)
+
+// maxDrainBytes bounds how much of an unread response body is discarded so
+// its connection can go back to the pool. Larger bodies are just closed.
+const maxDrainBytes = 1 << 20
 
+// healthcheckJob is run by at most one scheduler worker at a time: its
+// run state (lastRun through throttled) is only used by that worker, and
+// its scheduling state only under the scheduler's lock. A job is never
+// restarted; to change a job, stop it and start a new one in its place.
 type healthcheckJob struct {
 	healthcheck HealthcheckQuery
-	quit        chan struct{}
-	ticker      *time.Ticker
+	lastRun     time.Time
+	// storedRun is when the job last ran before the server restarted, if
+	// it did.
+	storedRun time.Time
+	// familyFailures counts consecutive passing runs during which an
+	// address family failed to connect.
+	familyFailures map[string]int
+	// down is whether the check is considered down, which only changes
+	// after its failure or success threshold of consecutive results.
+	down bool
+	// streak counts the consecutive results disagreeing with down.
+	streak int
+	// degraded is whether the last passing result was DEGRADED.
+	degraded bool
+	// throttled is whether the last run was throttled, which put this one
+	// off on purpose, and throttledSince since when the target has been
+	// throttling the job.
+	throttled      bool
+	throttledSince time.Time
+	// runs counts the job's runs, towards its MaxRuns. It is guarded by
+	// the scheduler's mu, and stored so that a restart doesn't reset it.
+	runs int
+
+	interval     time.Duration
+	next         time.Time
+	seq          uint64
+	pendingIndex int
+	readyIndex   int
+	running      bool
+	removed      bool
+	inFlight     sync.WaitGroup
+	// stopped is closed once the job is removed, which cancels its run in
+	// progress.
+	stopped chan struct{}
+	// blocked is the job this one replaced, whose run in progress it waits
+	// for before being scheduled. It is guarded by the server's mu.
+	blocked *healthcheckJob
+	// cancelResume, if set, cancels resuming the job at its ResumeAt. It is
+	// guarded by the server's mu.
+	cancelResume func()
+}
+
+func newHealthcheckJob(healthcheck HealthcheckQuery) *healthcheckJob {
+	return &healthcheckJob{
+		healthcheck:  healthcheck,
+		stopped:      make(chan struct{}),
+		pendingIndex: -1,
+		readyIndex:   -1,
+	}
+}
+
+type Config struct {
+	// MaxConcurrentChecks is the number of workers running probes. When
+	// all of them are busy, higher priority checks are run first.
+	MaxConcurrentChecks int
+	// TransientRetries is how many times a run may be retried right away
+	// after transient network errors, on top of a check's own retries.
+	TransientRetries int
+	// CatchUp makes every job probe immediately after the host wakes up
+	// from a suspension, rather than on its next tick.
+	CatchUp bool
+	// HeartbeatUrl, if set, is requested every HeartbeatInterval so that
+	// something else can notice when this server goes down.
+	HeartbeatUrl      string
+	HeartbeatInterval time.Duration
+	// Source is stamped on every result produced by this server.
+	Source ResultSource
+	// Listen is the address the API is served on, when not given a
+	// listener.
+	Listen string
+	// BasePath is the path prefix everything is served under, e.g. /uptime
+	// behind a reverse proxy forwarding that path.
+	BasePath string
+	// ReadOnly rejects every API request that would change anything.
+	ReadOnly bool
+	// SuppressNotifications keeps checks running without notifying
+	// anyone of their results.
+	SuppressNotifications bool
+	// StartupGrace is how long after the server starts notifications are
+	// suppressed, so that checks found failing after the server was down
+	// don't set off a storm of alerts.
+	StartupGrace time.Duration
+	// AddressFamilyAlertAfter is how many consecutive passing runs an
+	// address family (IPv4 or IPv6) may fail to connect before a warning
+	// is raised. Zero disables the warning.
+	AddressFamilyAlertAfter int
+	// AddressPolicy, if set, restricts the addresses checks may connect
+	// to.
+	AddressPolicy *addressPolicy
+	// Logger is what the server and its subsystems log with, the default
+	// logger if nil.
+	Logger *slog.Logger
+	// SourceAddress, if set, is the local address or network interface
+	// checks connect from, unless they set their own.
+	SourceAddress string
+	// LogResults is which results are logged: all of them, only failures
+	// (and recoveries) or only changes of status. Successes that aren't
+	// logged are still sampled at LogSuccessSampleRate.
+	LogResults           string
+	LogSuccessSampleRate float64
+	// RecordingRules, if set, derive series from check results.
+	RecordingRules *recordingRules
+	// ReconcileSource is the file or URL GET /reconcile/diff pulls the
+	// declarative config from.
+	ReconcileSource string
+	// ChatOpsSigningSecret verifies Slack slash commands, and ChatOpsToken
+	// Mattermost ones. Chat commands are disabled unless one is set.
+	ChatOpsSigningSecret string
+	ChatOpsToken         string
+	// APIKeys, if any, are the keys API requests must carry as bearer
+	// tokens: admin keys to change anything, and with AuthenticateReads,
+	// any key to read.
+	APIKeys           *apiKeys
+	AuthenticateReads bool
+	// EventLog, if set, records results, state changes and changes to
+	// checks.
+	EventLog *eventLog
+	// LogShipper, if set, pushes results to Loki and/or Elasticsearch.
+	LogShipper *logShipper
+	// JobStore, if set, persists checks across restarts.
+	JobStore *jobStore
+	// Uploader, if set, uploads results to a central server.
+	Uploader *resultUploader
+	// RunBudget, if set, alerts when running checks takes up most of the
+	// workers' time.
+	RunBudget *runBudget
+	// Transitions, if set, posts checks going down or coming back up to
+	// webhooks, Slack and email.
+	Transitions *transitionNotifier
+	// PublicSigner signs the responses of the public API, which is only
+	// served if it is set.
+	PublicSigner *jwsSigner
+	// PublicURLs shows the URLs of public checks in the public API, which
+	// otherwise only identifies them by id and group.
+	PublicURLs bool
+	// StaleChecks, if set, flags checks whose target looks decommissioned.
+	StaleChecks *staleChecks
+	// DeployWindow is how soon after a deploy of a check's service an
+	// incident must open to be attributed to it. Zero disables that.
+	DeployWindow time.Duration
 }
 
 type HealthcheckServer struct {
-	healthchecks      map[healthcheckId]healthcheckJob
-	wg                sync.WaitGroup
-	nextHealthcheckId healthcheckId
-	httpServer        *http.Server
+	config        Config
+	logger        *slog.Logger
+	clock         Clock
+	check         func(HealthcheckQuery, context.Context) HealthcheckResponse
+	scheduler     *scheduler
+	gaps          *gapLog
+	subscriptions *subscriptionManager
+	rollups       *uptimeRollups
+	incidents     *incidentLog
+	deploys       *deployLog
+	locations     *locationResults
+	results       *resultStore
+	annotations   *annotationStore
+	slos          *latencySLOs
+	stream        *eventStream
+	backfills     *backfills
+	maintenance   *maintenanceWindows
+	transfers     *transferStats
+	keys          *apiKeys
+	bus           *eventBus
+	metrics       *checkMetrics
+	uploads       *batchLog
+	skews         *agentSkews
+	mu            sync.Mutex
+	healthchecks  map[healthcheckId]*healthcheckJob
+	aliases       map[int]healthcheckId
+	nextAlias     int
+	notifiers     []*notifierQueue
+	listener      net.Listener
+	httpServer    *http.Server
+	served        chan error
+	startedAt     time.Time
+	// done is closed once the server is stopped, for everything running
+	// in the background to return.
+	done     chan struct{}
+	stopOnce sync.Once
 }
 
-func (h *HealthcheckServer) runJob(id healthcheckId) {
-	defer h.wg.Done()
-	job := h.healthchecks[id]
-	for {
+// scheduleJob hands a new job to the scheduler, unless it is paused or
+// may not run from this server's location.
+func (h *HealthcheckServer) scheduleJob(job *healthcheckJob) {
+	if !job.healthcheck.Paused && job.healthcheck.allowedAt(h.config.Source.Location) {
+		h.scheduler.add(job)
+		h.bus.publish(busEvent{Type: busCheckScheduled, Job: job.healthcheck, Time: h.clock.Now()})
+	}
+}
+
+// replaceJobLocked replaces a check's job with another, e.g. of its new
+// definition. A run of the old job in progress isn't waited for, which
+// would hold up every request needing h.mu for as long as the probe takes:
+// the new job is only scheduled once the run finishes instead, so that a
+// check is never probed twice at once. h.mu must be held.
+func (h *HealthcheckServer) replaceJobLocked(id healthcheckId, old *healthcheckJob, job *healthcheckJob) {
+	h.healthchecks[id] = job
+	h.cancelResumeLocked(old)
+	// A job that never got scheduled waits for the same run as it did.
+	blocked := old.blocked
+	if h.scheduler.unschedule(old) {
+		blocked = old
+	}
+	if blocked == nil {
+		h.scheduleJob(job)
+		return
+	}
+	job.blocked = blocked
+	go func() {
+		blocked.inFlight.Wait()
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		job.blocked = nil
+		if h.healthchecks[id] == job {
+			h.scheduleJob(job)
+		}
+	}()
+}
+
+// runContext returns the context of a run of job, cancelled once the job
+// is removed or the server stops, so that neither waits for a probe and its
+// retries.
+func (h *HealthcheckServer) runContext(job *healthcheckJob) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
 		select {
-		case <-job.ticker.C:
-			resp := job.healthcheck.check()
-			var status string
-			if resp.Status {
-				status = "UP"
-			} else {
-				status = "DOWN"
-			}
-			slog.Info("healthcheck-done",
-				slog.String("url", job.healthcheck.Url),
-				slog.String("method", job.healthcheck.Method),
-				slog.Int("expected-status", job.healthcheck.ExpectedStatus),
-				slog.String("status", status),
-			)
-
-		case <-job.quit:
-			job.ticker.Stop()
-			return
+		case <-job.stopped:
+		case <-h.done:
+		case <-ctx.Done():
+		}
+		cancel()
+	}()
+	return ctx, cancel
+}
+
+// runProbe runs a single probe for the job. It is called by the
+// scheduler's workers.
+func (h *HealthcheckServer) runProbe(job *healthcheckJob) {
+	if h.scheduler.ranOut(job) {
+		return
+	}
+	// Labels may be edited during the run, which only sees them as they
+	// were when it started.
+	healthcheck := h.scheduler.definition(job)
+	now := h.clock.Now()
+	maintenance := h.maintenance.activeFor(healthcheck, now)
+	if maintenance != nil && maintenance.Mode == maintenanceSkip {
+		h.skipForMaintenance(job, healthcheck, maintenance, now)
+		return
+	}
+	runs, ok := h.scheduler.countRun(job)
+	if !ok {
+		return
+	}
+	if healthcheck.MaxRuns > 0 {
+		h.config.JobStore.saveRuns(healthcheck.Id, runs)
+	}
+	if runs == healthcheck.MaxRuns {
+		defer func() {
+			// Archiving waits for this run to finish.
+			go h.archiveJob(healthcheck.Id, h.clock.Now(), "max_runs")
+		}()
+	}
+	h.bus.publish(busEvent{Type: busCheckStarted, Job: healthcheck, Time: now})
+	lastRun := job.lastRun
+	if lastRun.IsZero() {
+		lastRun = job.storedRun
+	}
+	if lastRun.Before(healthcheck.resumedAt) {
+		lastRun = healthcheck.resumedAt
+	}
+	if gap, ok := detectGap(lastRun, now, healthcheck.interval(job.down)); ok && !job.throttled {
+		h.gaps.record(healthcheck.Id, gap)
+		h.logger.Warn("healthcheck-missed-runs",
+			slog.String("url", healthcheck.Url),
+			slog.Time("from", gap.From),
+			slog.Time("to", gap.To),
+			slog.Int("missed-runs", gap.MissedRuns),
+		)
+	}
+	changed := job.lastRun.IsZero()
+	previousState := "UNKNOWN"
+	if !changed {
+		previousState = job.state()
+	}
+	job.lastRun = now
+	h.config.JobStore.saveLastRun(healthcheck.Id, now)
+	runCtx, cancel := h.runContext(job)
+	defer cancel()
+	ctx, correlationId := withCorrelationId(runCtx)
+	ctx = withAddressRules(ctx, h.config.AddressPolicy.rules(healthcheck.Namespace))
+	ctx = withSourceAddress(ctx, h.sourceAddress(healthcheck))
+	ctx = withResolvers(ctx, healthcheck.Resolvers)
+	ctx, transfer := withTransferCounter(ctx)
+	resp := h.probe(healthcheck, ctx)
+	if resp.Status && job.down && healthcheck.ConfirmRecovery {
+		resp = h.confirmRecovery(healthcheck, ctx)
+	}
+	if runCtx.Err() != nil {
+		// The job was removed or the server stopped: the run was cut short,
+		// so its result says nothing about the target.
+		return
+	}
+	usage := transfer.usage()
+	resp.Transfer = &usage
+	resp.Duration = h.clock.Now().Sub(now)
+	h.config.RunBudget.record(resp.Duration)
+	retryAfter, throttled := resp.RetryAfter, resp.Throttled
+	if !throttled {
+		job.throttledSince = time.Time{}
+	} else if job.throttledSince.IsZero() {
+		job.throttledSince = now
+	} else if now.Sub(job.throttledSince) >= maxThrottledFor {
+		// A target throttling the check for this long keeps it from being
+		// monitored at all, which is as good as down.
+		resp.Throttled = false
+		resp.Error = fmt.Sprintf("%s, throttled since %s", resp.Error, job.throttledSince.Format(time.RFC3339))
+	}
+	if maintenance != nil {
+		resp.Maintenance = maintenance.Id
+		if !resp.Status && !resp.neutral() {
+			// Failures are expected while under maintenance.
+			resp.State = stateMaintenance
+		}
+	}
+	job.throttled = throttled
+	switch {
+	case resp.Throttled:
+		h.scheduler.delay(job, retryAfter)
+	case resp.neutral():
+		// Neutral results, e.g. throttled ones, say nothing about whether
+		// the target is up.
+	default:
+		if job.observe(resp.Status, changed) {
+			changed = true
+			job.down = !resp.Status
+		}
+		if resp.Status {
+			job.degraded = resp.State == stateDegraded
 		}
+		h.scheduler.setInterval(job, healthcheck.interval(job.down))
+		if throttled {
+			// Still, the next run is put off as the target asked.
+			h.scheduler.delay(job, retryAfter)
+		}
+	}
+	resp.CorrelationId = correlationId
+	resp.Timestamp = now
+	resp.Source = h.config.Source
+	h.bus.publish(busEvent{Type: busCheckCompleted, Job: healthcheck, Time: now, Result: resp})
+	h.observeAddressFamilies(job, resp)
+	incident := h.incidents.observe(healthcheck, resp, job.down)
+	suppressed := h.notificationsSuppressed(now) || maintenance != nil
+	h.evaluateLatencySLO(healthcheck, now, suppressed)
+	if state := job.state(); !resp.neutral() && state != previousState {
+		h.bus.publish(busEvent{
+			Type:       busStateChanged,
+			Job:        healthcheck,
+			Time:       now,
+			Result:     resp,
+			From:       previousState,
+			To:         state,
+			Incident:   incident,
+			Suppressed: suppressed,
+		})
 	}
+	// Once an incident is acknowledged, nobody needs to be told again that
+	// it is still down; subscribers still get every result.
+	if !suppressed && incident != nil && incident.AcknowledgedAt == nil && job.down {
+		h.config.Transitions.escalate(healthcheck, incident, resp)
+	}
+	if !suppressed {
+		h.subscriptions.publish(healthcheck, resp, incident)
+	}
+	if h.shouldLogResult(resp, changed) {
+		h.logResult(healthcheck, resp)
+	}
+}
+
+// notificationsSuppressed reports whether results at now go unannounced:
+// always if notifications are suppressed, and otherwise during the startup
+// grace period.
+func (h *HealthcheckServer) notificationsSuppressed(now time.Time) bool {
+	return h.config.SuppressNotifications || now.Before(h.startedAt.Add(h.config.StartupGrace))
 }
 
-var jobPathRegex = regexp.MustCompile("^/jobs/([0-9]+)$")
+var jobPathRegex = regexp.MustCompile("^/jobs/([0-9a-f-]+)$")
+var jobActionPathRegex = regexp.MustCompile("^/jobs/([0-9a-f-]+)/([a-z]+)$")
 
 func (h *HealthcheckServer) handle(w http.ResponseWriter, r *http.Request) {
 	switch {
+	case r.URL.Path == "/":
+		h.handleDashboard(w, r)
+	case r.URL.Path == "/jobs/pause":
+		h.handleSetPaused(w, r, true)
+	case r.URL.Path == "/jobs/resume":
+		h.handleSetPaused(w, r, false)
+	case r.URL.Path == "/jobs/labels":
+		h.handleEditLabels(w, r)
+	case r.URL.Path == "/jobs/from-curl":
+		h.handleJobFromCurl(w, r)
+	case r.URL.Path == "/jobs/from-har":
+		h.handleJobFromHAR(w, r)
+	case r.URL.Path == "/jobs/bulk":
+		switch r.Method {
+		case http.MethodPost:
+			h.handleBulkAddJobs(w, r)
+		case http.MethodDelete:
+			h.handleBulkDeleteJobs(w, r)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
 	case r.URL.Path == "/jobs" || r.URL.Path == "/jobs/":
 		switch r.Method {
 		case http.MethodGet:
@@ -81,14 +474,12 @@ func (h *HealthcheckServer) handle(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		s, err := strconv.Atoi(string(matches[1]))
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
+		jobId, ok := h.resolveId(string(matches[1]))
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
 			return
 		}
 
-		jobId := healthcheckId(s)
-
 		switch r.Method {
 		case http.MethodGet:
 			h.handleGetJob(w, r, jobId)
@@ -99,18 +490,88 @@ func (h *HealthcheckServer) handle(w http.ResponseWriter, r *http.Request) {
 		default:
 			w.WriteHeader(http.StatusMethodNotAllowed)
 		}
+	case jobActionPathRegex.MatchString(r.URL.Path):
+		matches := jobActionPathRegex.FindSubmatch([]byte(r.URL.Path))
+		jobId, ok := h.resolveId(string(matches[1]))
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		switch action := string(matches[2]); {
+		case action == "clone" && r.Method == http.MethodPost:
+			h.handleCloneJob(w, r, jobId)
+		case action == "gaps" && r.Method == http.MethodGet:
+			h.handleGetJobGaps(w, r, jobId)
+		case action == "locations" && r.Method == http.MethodGet:
+			h.handleGetJobLocations(w, r, jobId)
+		case action == "results" && r.Method == http.MethodGet:
+			h.handleGetJobResults(w, r, jobId)
+		case action == "annotations":
+			h.handleJobAnnotations(w, r, jobId)
+		case action == "run" && r.Method == http.MethodPost:
+			h.handleRunJob(w, r, jobId)
+		case action == "import" && r.Method == http.MethodPost:
+			h.handleImportJobHistory(w, r, jobId)
+		case action == "latency" && r.Method == http.MethodGet:
+			h.handleGetJobLatency(w, r, jobId)
+		case action == "maintenance" && r.Method == http.MethodGet:
+			h.handleGetJobMaintenance(w, r, jobId)
+		case action == "transfer" && r.Method == http.MethodGet:
+			h.handleGetJobTransfer(w, r, jobId)
+		case action == "stats" && r.Method == http.MethodGet:
+			h.handleGetJobStats(w, r, jobId)
+		case action == "explain" && r.Method == http.MethodGet:
+			h.handleExplainJob(w, r, jobId)
+		case action == "pause" && r.Method == http.MethodPost:
+			h.handleJobSetPaused(w, r, jobId, true)
+		case action == "resume" && r.Method == http.MethodPost:
+			h.handleJobSetPaused(w, r, jobId, false)
+		case action == "clone" || action == "gaps" || action == "locations" || action == "results" || action == "pause" || action == "resume" || action == "run" || action == "explain" || action == "stats" || action == "latency" || action == "import" || action == "maintenance" || action == "transfer":
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
 	default:
 		w.WriteHeader(http.StatusNotFound)
 	}
 }
 
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
+
 func (h *HealthcheckServer) handleGetAllJobs(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	var jobs []HealthcheckQuery
-	for _, job := range h.healthchecks {
-		jobs = append(jobs, job.healthcheck)
+	filter, err := parseJobFilter(r.URL.Query(), h.clock.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var stale *bool
+	if value := r.URL.Query().Get("stale"); value != "" {
+		s, err := strconv.ParseBool(value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("stale must be true or false"))
+			return
+		}
+		stale = &s
 	}
-	json.NewEncoder(w).Encode(jobs)
+	now := h.clock.Now()
+	healthchecks := []HealthcheckQuery{}
+	for _, healthcheck := range h.ListHealthchecks() {
+		if !filter.matches(healthcheck) {
+			continue
+		}
+		if stale != nil && *stale != h.config.StaleChecks.isStale(healthcheck.Id, now) {
+			continue
+		}
+		healthchecks = append(healthchecks, healthcheck)
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(healthchecks)
 	return
 }
 
@@ -118,274 +579,1938 @@ func (h *HealthcheckServer) handleAddJob(w http.ResponseWriter, r *http.Request)
 	var healthcheck HealthcheckQuery
 	err := json.NewDecoder(r.Body).Decode(&healthcheck)
 	if err != nil {
-		fmt.Printf("Error decoding json: %v\n", err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	h.createJob(w, r, healthcheck)
+}
+
+// handleCloneJob creates a copy of an existing job. The request body may
+// contain any subset of the job fields, which override the copied values.
+func (h *HealthcheckServer) handleCloneJob(w http.ResponseWriter, r *http.Request, jobId healthcheckId) {
+	existing, ok := h.GetHealthcheck(jobId)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	base, err := existing.marshalStored()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	fields := make(map[string]json.RawMessage)
+	json.Unmarshal(base, &fields)
+
+	var overrides map[string]json.RawMessage
+	err = json.NewDecoder(r.Body).Decode(&overrides)
+	if err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	for k, v := range overrides {
+		fields[k] = v
+	}
+
+	merged, err := json.Marshal(fields)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	var healthcheck HealthcheckQuery
+	err = json.Unmarshal(merged, &healthcheck)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	h.createJob(w, r, healthcheck)
+}
+
+func (h *HealthcheckServer) createJob(w http.ResponseWriter, r *http.Request, healthcheck HealthcheckQuery) {
+	err := h.config.AddressPolicy.validateTarget(healthcheck)
+	if err == nil {
+		err = healthcheck.validateRunAt(h.clock.Now())
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
 		return
 	}
-	newId := h.AddHealthcheck(healthcheck)
-	healthcheck.Id = newId
+	healthcheck.CreatedBy = requestActor(r)
+	added, _, existingId := h.addHealthchecksUnlessDuplicate([]HealthcheckQuery{healthcheck}, r.URL.Query().Get("force") == "true")
+	if added == nil {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(struct {
+			Error      string        `json:"error"`
+			ExistingId healthcheckId `json:"existing_id"`
+		}{
+			Error:      fmt.Sprintf("an equivalent job already exists (id %s), use ?force=true to create it anyway", existingId),
+			ExistingId: existingId,
+		})
+		return
+	}
+	healthcheck = added[0]
+	w.Header().Set("ETag", versionETag(healthcheck.Version))
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(healthcheck)
-	return
 }
 
 func (h *HealthcheckServer) handleGetJob(w http.ResponseWriter, r *http.Request, jobId healthcheckId) {
-	job, ok := h.healthchecks[jobId]
+	healthcheck, ok := h.GetHealthcheck(jobId)
 	if !ok {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
+	w.Header().Set("ETag", versionETag(healthcheck.Version))
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(job.healthcheck)
+	json.NewEncoder(w).Encode(healthcheck)
 	return
 }
 
+func (h *HealthcheckServer) handleGetJobGaps(w http.ResponseWriter, r *http.Request, jobId healthcheckId) {
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(h.gaps.list(jobId))
+}
+
 func (h *HealthcheckServer) handleDeleteJob(w http.ResponseWriter, r *http.Request, jobId healthcheckId) {
 	h.StopHealthcheck(jobId)
 	w.WriteHeader(http.StatusNoContent)
 	return
 }
 
+// handlePutJob replaces a check's definition. The update must be based on
+// the check's current version, given in an If-Match header or as the
+// body's version, so that concurrent edits don't overwrite one another.
 func (h *HealthcheckServer) handlePutJob(w http.ResponseWriter, r *http.Request, jobId healthcheckId) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
 	var healthcheck HealthcheckQuery
-	err := json.NewDecoder(r.Body).Decode(&healthcheck)
+	err = json.Unmarshal(body, &healthcheck)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	precondition, err := parsePrecondition(r.Header.Get("If-Match"), body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if precondition == nil {
+		writeError(w, http.StatusPreconditionRequired, errVersionRequired)
+		return
+	}
+	err = h.config.AddressPolicy.validateTarget(healthcheck)
+	if current, ok := h.GetHealthcheck(jobId); err == nil && ok && !healthcheck.RunAt.Equal(current.RunAt) {
+		// A run_at past by now may be sent back unchanged.
+		err = healthcheck.validateRunAt(h.clock.Now())
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	healthcheck, err = h.updateHealthcheck(jobId, healthcheck, precondition)
+	if errors.Is(err, errVersionConflict) {
+		w.Header().Set("ETag", versionETag(healthcheck.Version))
+		writeError(w, http.StatusConflict, err)
+		return
+	}
 	if err != nil {
-		fmt.Printf("Error decoding json: %v\n", err)
-		w.WriteHeader(http.StatusBadRequest)
+		w.WriteHeader(http.StatusNotFound)
 		return
 	}
-	h.UpdateHealthcheck(jobId, healthcheck)
+	w.Header().Set("ETag", versionETag(healthcheck.Version))
 	w.WriteHeader(http.StatusOK)
-	healthcheck.Id = jobId
 	json.NewEncoder(w).Encode(healthcheck)
 	return
 }
 
+// Run starts the server and serves the API until it is stopped.
 func (h *HealthcheckServer) Run() {
-	defer h.wg.Wait()
-	mux := http.NewServeMux()
-	mux.HandleFunc("/", h.handle)
-	h.httpServer = &http.Server{
-		Addr:    ":8081",
-		Handler: mux,
-	}
-	err := h.httpServer.ListenAndServe()
+	err := h.Start()
 	if err != nil {
-		fmt.Printf("Error starting web server: %v\n", err)
+		h.logger.Error("server-start-failed", slog.String("error", err.Error()))
+		return
 	}
+	h.wait()
 }
 
-func NewHealthcheckServer() HealthcheckServer {
+// wait blocks until the started server stops serving the API and running
+// checks.
+func (h *HealthcheckServer) wait() {
+	err := <-h.served
+	if err != http.ErrServerClosed {
+		h.logger.Error("server-failed", slog.String("error", err.Error()))
+	}
+	h.scheduler.wait()
+}
+
+func NewHealthcheckServer(config Config) HealthcheckServer {
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	deploys := newDeployLog(config.DeployWindow)
+	rollups, locations, results, metrics, stream := newUptimeRollups(), newLocationResults(), newResultStore(), newCheckMetrics(), newEventStream()
+	// Subsystems following checks see each event in the order they
+	// subscribe.
+	bus := newEventBus()
+	bus.subscribe(rollups, busCheckCompleted)
+	bus.subscribe(locations, busCheckCompleted, busResultUploaded)
+	bus.subscribe(results, busCheckCompleted)
+	bus.subscribe(metrics, busCheckCompleted, busNotificationSent)
+	bus.subscribe(config.StaleChecks, busCheckCompleted)
+	bus.subscribe(config.EventLog, busCheckCompleted, busResultUploaded, busStateChanged)
+	bus.subscribe(stream, busCheckCompleted, busResultUploaded, busStateChanged)
+	bus.subscribe(config.LogShipper, busCheckCompleted, busResultUploaded)
+	bus.subscribe(config.Uploader, busCheckCompleted)
+	bus.subscribe(config.Transitions, busStateChanged)
+	transfers := newTransferStats()
+	keys := config.APIKeys
+	if keys == nil {
+		keys = newAPIKeys()
+	}
+	bus.subscribe(transfers, busCheckCompleted, busResultUploaded)
+	if config.Transitions != nil {
+		config.Transitions.bus = bus
+		config.Transitions.addressPolicy = config.AddressPolicy
+		config.Transitions.logger = logger
+	}
+	stream.logger = logger
+	subscriptions := newSubscriptionManager()
+	subscriptions.logger = logger
+	if config.EventLog != nil {
+		config.EventLog.logger = logger
+	}
+	if config.LogShipper != nil {
+		config.LogShipper.logger = logger
+	}
+	if config.Uploader != nil {
+		config.Uploader.logger = logger
+	}
+	if config.JobStore != nil {
+		config.JobStore.logger = logger
+	}
+	if config.RunBudget != nil {
+		config.RunBudget.logger = logger
+	}
+	if config.RecordingRules != nil {
+		config.RecordingRules.logger = logger
+	}
 	return HealthcheckServer{
-		healthchecks: make(map[healthcheckId]healthcheckJob),
+		config:        config,
+		logger:        logger,
+		clock:         realClock{},
+		check:         HealthcheckQuery.check,
+		scheduler:     newScheduler(realClock{}),
+		gaps:          newGapLog(),
+		subscriptions: subscriptions,
+		rollups:       rollups,
+		incidents:     newIncidentLog(deploys),
+		deploys:       deploys,
+		locations:     locations,
+		results:       results,
+		annotations:   newAnnotationStore(),
+		slos:          newLatencySLOs(),
+		stream:        stream,
+		backfills:     newBackfills(),
+		maintenance:   newMaintenanceWindows(),
+		transfers:     transfers,
+		keys:          keys,
+		bus:           bus,
+		metrics:       metrics,
+		uploads:       newBatchLog(),
+		skews:         newAgentSkews(),
+		healthchecks:  make(map[healthcheckId]*healthcheckJob),
+		aliases:       make(map[int]healthcheckId),
+		nextAlias:     config.JobStore.lastAlias(),
+		done:          make(chan struct{}),
 	}
 }
 
-func (h *HealthcheckServer) AddHealthcheck(healthcheck HealthcheckQuery) healthcheckId {
-	h.nextHealthcheckId++
-	healthcheck.Id = h.nextHealthcheckId
-	quit := make(chan struct{})
-	ticker := time.NewTicker(healthcheck.Frequency)
-	h.healthchecks[h.nextHealthcheckId] = healthcheckJob{
-		healthcheck: healthcheck,
-		quit:        quit,
-		ticker:      ticker,
+// resolveId looks up a healthcheck by its id or by its numeric alias.
+func (h *HealthcheckServer) resolveId(s string) (healthcheckId, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if alias, err := strconv.Atoi(s); err == nil {
+		id, ok := h.aliases[alias]
+		return id, ok
 	}
-	h.wg.Add(1)
-	go h.runJob(h.nextHealthcheckId)
-	return h.nextHealthcheckId
+	_, ok := h.healthchecks[healthcheckId(s)]
+	return healthcheckId(s), ok
 }
 
-func (h *HealthcheckServer) UpdateHealthcheck(id healthcheckId, healthcheck HealthcheckQuery) {
+func (h *HealthcheckServer) GetHealthcheck(id healthcheckId) (HealthcheckQuery, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 	job, ok := h.healthchecks[id]
 	if !ok {
-		return
+		return HealthcheckQuery{}, false
 	}
-	job.healthcheck = healthcheck
-	job.ticker.Stop()
-	job.ticker = time.NewTicker(healthcheck.Frequency)
-	close(job.quit)
-	job.quit = make(chan struct{})
-	h.wg.Add(1)
-	h.healthchecks[id] = job
-	go h.runJob(id)
+	return job.healthcheck, true
 }
 
-func (h *HealthcheckServer) StopHealthcheck(id healthcheckId) {
-	job, ok := h.healthchecks[id]
+// ListHealthchecks returns all healthchecks ordered by id.
+func (h *HealthcheckServer) ListHealthchecks() []HealthcheckQuery {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	healthchecks := make([]HealthcheckQuery, 0, len(h.healthchecks))
+	for _, job := range h.healthchecks {
+		healthchecks = append(healthchecks, job.healthcheck)
+	}
+	sort.Slice(healthchecks, func(i, j int) bool {
+		return healthchecks[i].Alias < healthchecks[j].Alias
+	})
+	return healthchecks
+}
+
+func (h *HealthcheckServer) AddHealthcheck(healthcheck HealthcheckQuery) HealthcheckQuery {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.addHealthcheckLocked(healthcheck)
+}
+
+func (h *HealthcheckServer) addHealthcheckLocked(healthcheck HealthcheckQuery) HealthcheckQuery {
+	h.nextAlias++
+	healthcheck.Id = newHealthcheckId()
+	healthcheck.Alias = h.nextAlias
+	healthcheck.CreatedAt = h.clock.Now()
+	healthcheck.UpdatedAt = healthcheck.CreatedAt
+	healthcheck.Version = 1
+	job := newHealthcheckJob(healthcheck)
+	h.healthchecks[healthcheck.Id] = job
+	h.aliases[healthcheck.Alias] = healthcheck.Id
+	h.scheduleJob(job)
+	h.config.JobStore.save(healthcheck)
+	h.logConfigEvent("create", healthcheck)
+	return healthcheck
+}
+
+// findDuplicate returns the id of an existing healthcheck probing the same
+// URL and method with the same assertions, if any.
+func (h *HealthcheckServer) findDuplicate(healthcheck HealthcheckQuery) (healthcheckId, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.findDuplicateLocked(healthcheck)
+}
+
+func (h *HealthcheckServer) findDuplicateLocked(healthcheck HealthcheckQuery) (healthcheckId, bool) {
+	for id, job := range h.healthchecks {
+		if job.healthcheck.equivalent(healthcheck) {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// UpdateHealthcheck replaces the definition of a running healthcheck. The
+// old job is fully stopped before its replacement starts, so a given id is
+// never probed twice at once.
+func (h *HealthcheckServer) UpdateHealthcheck(id healthcheckId, healthcheck HealthcheckQuery) (HealthcheckQuery, bool) {
+	healthcheck, err := h.updateHealthcheck(id, healthcheck, nil)
+	return healthcheck, err == nil
+}
+
+// updateHealthcheck updates a healthcheck unless its version doesn't meet
+// precondition, if any, in which case it returns the current definition
+// along with errVersionConflict.
+func (h *HealthcheckServer) updateHealthcheck(id healthcheckId, healthcheck HealthcheckQuery, precondition *versionPrecondition) (HealthcheckQuery, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	old, ok := h.healthchecks[id]
 	if !ok {
-		return
+		return HealthcheckQuery{}, errJobNotFound
+	}
+	if !precondition.matches(old.healthcheck.Version) {
+		return old.healthcheck, fmt.Errorf("%w, its current version is %d", errVersionConflict, old.healthcheck.Version)
+	}
+	healthcheck.keepSecrets(old.healthcheck)
+	healthcheck.Id = id
+	healthcheck.Alias = old.healthcheck.Alias
+	healthcheck.CreatedAt = old.healthcheck.CreatedAt
+	healthcheck.CreatedBy = old.healthcheck.CreatedBy
+	healthcheck.UpdatedAt = h.clock.Now()
+	healthcheck.Version = old.healthcheck.Version + 1
+	if healthcheck.Paused {
+		healthcheck.ArchivedAt = old.healthcheck.ArchivedAt
+		healthcheck.ResumeAt = old.healthcheck.ResumeAt
 	}
-	close(job.quit)
-	delete(h.healthchecks, id)
+	job := newHealthcheckJob(healthcheck)
+	h.replaceJobLocked(id, old, job)
+	h.scheduleResumeLocked(job)
+	h.config.StaleChecks.forget(id)
+	h.config.JobStore.save(healthcheck)
+	// The updated check runs MaxRuns times anew.
+	h.config.JobStore.saveRuns(id, 0)
+	h.logConfigEvent("update", healthcheck)
+	return healthcheck, nil
 }
 
+// StopHealthcheck removes a healthcheck. It returns once a run of it in
+// progress finished, without holding up other requests meanwhile, so that
+// nothing of the check is kept afterwards.
+func (h *HealthcheckServer) StopHealthcheck(id healthcheckId) {
+	h.StopHealthchecks([]healthcheckId{id})
+}
+
+// StopHealthchecks removes several healthchecks at once: all of them are
+// unscheduled before waiting for their runs in progress, which are cut
+// short together rather than one after the other.
+func (h *HealthcheckServer) StopHealthchecks(ids []healthcheckId) {
+	var jobs, blocked []*healthcheckJob
+	h.mu.Lock()
+	for _, id := range ids {
+		job, ok := h.healthchecks[id]
+		if !ok {
+			continue
+		}
+		h.scheduler.unschedule(job)
+		h.cancelResumeLocked(job)
+		if job.blocked != nil {
+			blocked = append(blocked, job.blocked)
+		}
+		delete(h.healthchecks, id)
+		delete(h.aliases, job.healthcheck.Alias)
+		jobs = append(jobs, job)
+	}
+	h.mu.Unlock()
+	for _, job := range append(jobs, blocked...) {
+		job.inFlight.Wait()
+	}
+	for _, job := range jobs {
+		h.forgetHealthcheck(job.healthcheck)
+	}
+}
+
+// forgetHealthcheck drops everything kept about a removed healthcheck.
+func (h *HealthcheckServer) forgetHealthcheck(healthcheck HealthcheckQuery) {
+	id := healthcheck.Id
+	h.gaps.forget(id)
+	h.rollups.forget(id)
+	h.incidents.forget(id)
+	h.locations.forget(id)
+	h.results.forget(id)
+	h.annotations.forget(id)
+	h.slos.forget(id)
+	h.backfills.forget(id)
+	h.maintenance.forget(id)
+	h.transfers.forget(id)
+	h.metrics.forget(id)
+	h.config.StaleChecks.forget(id)
+	h.config.JobStore.delete(id)
+	h.logConfigEvent("delete", healthcheck)
+}
+
+// JqQuery asserts on the values a jq query produces from a JSON response
+// body. Mode decides which of them must equal the expectation.
 type JqQuery struct {
 	Query       *gojq.Query
 	Expectation string
+	Mode        string
+	// code is Query compiled, once when the check is defined.
+	code *gojq.Code
+}
+
+// compile parses and compiles query, so that queries that can't run, e.g.
+// calling functions that don't exist, are rejected when the check is
+// defined.
+func (q *JqQuery) compile(query string) error {
+	parsed, err := gojq.Parse(query)
+	if err != nil {
+		return err
+	}
+	q.code, err = gojq.Compile(parsed)
+	if err != nil {
+		return err
+	}
+	q.Query = parsed
+	return nil
 }
 
+const (
+	// jqMatchFirst only looks at the first value.
+	jqMatchFirst = "first"
+	jqMatchAll   = "all"
+	jqMatchAny   = "any"
+	jqMatchNone  = "none"
+)
+
+// maxJqResults bounds how many values a jq query may produce, so that a
+// query generating endless values can't hang a check.
+const maxJqResults = 1000
+
 func UnsafeNewJqQuery(query string, expectation string) JqQuery {
-	q, err := gojq.Parse(query)
+	q := JqQuery{Expectation: expectation, Mode: jqMatchFirst}
+	err := q.compile(query)
 	if err != nil {
 		panic(err)
 	}
-	return JqQuery{
-		Query:       q,
-		Expectation: expectation,
+	return q
+}
+
+const (
+	checkTypeHttp = "http"
+	checkTypeS3   = "s3"
+)
+
+// httpCheckMethods are the methods http checks may use.
+var httpCheckMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+}
+
+// defaultContentType is the content type of a request body that doesn't
+// say: JSON if it parses as such, plain text otherwise.
+func defaultContentType(body string) string {
+	if json.Valid([]byte(body)) {
+		return "application/json"
 	}
+	return "text/plain; charset=utf-8"
 }
 
 type HealthcheckQuery struct {
-	Id             healthcheckId
-	Url            string
-	Method         string
+	Id    healthcheckId
+	Alias int
+	// CreatedAt, UpdatedAt, CreatedBy and Version are kept by the server,
+	// and can't be set through the API.
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	CreatedBy string
+	// Version counts the check's changes, starting at 1, so that updates
+	// can be made conditional on it.
+	Version int
+	// ArchivedAt is when the check was paused for being stale or having
+	// run MaxRuns times, until it is resumed.
+	ArchivedAt time.Time
+	// ResumeAt, if set, is when the check, paused for a while, is resumed.
+	// It is kept by the server too.
+	ResumeAt time.Time
+	Type     string
+	Group    string
+	// Public checks are shown on the status page.
+	Public bool
+	// Namespace is the tenant a check belongs to, which decides the
+	// address policy it is held to.
+	Namespace string
+	// Labels are free-form key/value pairs checks can be selected by.
+	Labels map[string]string
+	// Tags are free-form names checks can be listed by.
+	Tags []string
+	// Paused checks aren't probed.
+	Paused bool
+	// Locations, if set, are the only probe locations the check may run
+	// from, and it never runs from ExcludeLocations, e.g. for targets
+	// behind geo-fencing.
+	Locations        []string
+	ExcludeLocations []string
+	Url              string
+	Method           string
+	// RequestBody, if set, is sent with the request as ContentType.
+	RequestBody string
+	ContentType string
+	// Headers are sent with the request, along with BasicAuth
+	// credentials if set.
+	Headers        map[string]string
+	BasicAuth      *BasicAuth
 	ExpectedStatus int
 	Frequency      time.Duration
+	// RunAt, if set, is when the check first runs, instead of one
+	// frequency after it is scheduled.
+	RunAt time.Time
+	// MaxRuns, if set, is how many times the check runs before it is
+	// archived. A check running once, at RunAt, is a one-shot check.
+	MaxRuns int
+	// Timeout, if set, is how long the check may take instead of the
+	// default 10 seconds: for an http check to respond, including its body
+	// and any validator, for a tcp or tls check to connect, an icmp check
+	// to ping or a dns check to resolve, and for each step of a transaction
+	// check.
+	Timeout time.Duration
+	// DownFrequency, if set, replaces Frequency while the check is down.
+	DownFrequency time.Duration
+	// SourceAddress, if set, is the local address or network interface
+	// the check connects from instead of the configured one, so that its
+	// traffic leaves a multi-homed host through the intended network.
+	SourceAddress string
+	// Resolvers, if set, are the DNS servers the check resolves names
+	// with instead of the host's, e.g. an internal resolver for
+	// split-horizon names, as address:port.
+	Resolvers []string
+	// ConfirmRecovery re-probes a check that passes after being down on a
+	// fresh connection, and only considers it up if that passes too.
+	ConfirmRecovery bool
+	// FailureThreshold and SuccessThreshold, if set, are how many
+	// consecutive failing results it takes for the check to be considered
+	// down, and passing ones for it to be considered back up, instead of
+	// one.
+	FailureThreshold int
+	SuccessThreshold int
+	// Retries, if set, is how many times a failing run is retried before
+	// its result is taken, RetryInterval after the failure and then twice
+	// as long after each retry.
+	Retries       int
+	RetryInterval time.Duration
+	// HonorRetryAfter reports 429 and 503 responses with a Retry-After
+	// header as throttled rather than down, and puts the next run off
+	// accordingly.
+	HonorRetryAfter bool
+	// ExpectFailure inverts the check: it is up when the target can't be
+	// reached or fails its assertions, and down when it passes them.
+	ExpectFailure bool
+	// Webhooks, if set, are notified of the check going down or coming
+	// back up instead of the configured ones.
+	Webhooks []string
+	// SlackWebhook, if set, is the Slack incoming webhook the check going
+	// down or coming back up is announced to instead of the configured
+	// one.
+	SlackWebhook string
+	// LatencySLO, if set, is the check's latency objective, alerted on
+	// apart from the check going down.
+	LatencySLO *LatencySLO
+	// Warnings, if set, are where the check becoming DEGRADED is announced.
+	Warnings       *WarningChannels
+	Priority       checkPriority
 	JqQuery        JqQuery
+	ExpectedBody   *string
+	ExpectedSha256 string
+	// Validator, if set, is an HTTP service the response is POSTed to,
+	// and which decides whether it passes.
+	Validator string
+	// DisableDecompression runs body assertions on the body as delivered,
+	// e.g. to verify compressed delivery along with
+	// ExpectedContentEncoding.
+	DisableDecompression    bool
+	ExpectedContentEncoding string
+	Artifact                *ArtifactCheck
+	S3                      *S3Check
+	DNS                     *DNSQuery
+	Ping                    *PingQuery
+	TLS                     *TLSQuery
+	// Steps are the requests of a transaction check.
+	Steps []TransactionStep
+	// Plugin holds the settings of a check implemented by a plugin, which
+	// are up to the plugin.
+	Plugin json.RawMessage
+
+	// resumedAt is when the check was last resumed; runs weren't missed
+	// while it was paused.
+	resumedAt time.Time
+}
+
+// equivalent reports whether two healthchecks probe the same target in the
+// same way, ignoring their ids and frequencies.
+func (h HealthcheckQuery) equivalent(other HealthcheckQuery) bool {
+	if h.Type != other.Type || h.Namespace != other.Namespace || h.Url != other.Url || h.Method != other.Method || h.ExpectedStatus != other.ExpectedStatus {
+		return false
+	}
+	if h.RequestBody != other.RequestBody || h.ContentType != other.ContentType {
+		return false
+	}
+	if !equalHeaders(h.Headers, other.Headers) || !h.BasicAuth.equal(other.BasicAuth) {
+		return false
+	}
+	if h.ExpectFailure != other.ExpectFailure || h.SourceAddress != other.SourceAddress || !equalResolvers(h.Resolvers, other.Resolvers) {
+		return false
+	}
+	if (h.ExpectedBody == nil) != (other.ExpectedBody == nil) ||
+		(h.ExpectedBody != nil && *h.ExpectedBody != *other.ExpectedBody) {
+		return false
+	}
+	if h.ExpectedSha256 != other.ExpectedSha256 || h.Validator != other.Validator {
+		return false
+	}
+	if h.DisableDecompression != other.DisableDecompression ||
+		!strings.EqualFold(h.ExpectedContentEncoding, other.ExpectedContentEncoding) {
+		return false
+	}
+	if (h.Artifact == nil) != (other.Artifact == nil) ||
+		(h.Artifact != nil && *h.Artifact != *other.Artifact) {
+		return false
+	}
+	if (h.S3 == nil) != (other.S3 == nil) ||
+		(h.S3 != nil && *h.S3 != *other.S3) {
+		return false
+	}
+	if !h.DNS.equal(other.DNS) || !h.Ping.equal(other.Ping) || !h.TLS.equal(other.TLS) || !equalSteps(h.Steps, other.Steps) || !bytes.Equal(h.Plugin, other.Plugin) {
+		return false
+	}
+	if (h.JqQuery.Query == nil) != (other.JqQuery.Query == nil) {
+		return false
+	}
+	if h.JqQuery.Query == nil {
+		return true
+	}
+	return h.JqQuery.Query.String() == other.JqQuery.Query.String() &&
+		h.JqQuery.Expectation == other.JqQuery.Expectation &&
+		h.JqQuery.Mode == other.JqQuery.Mode
+}
+
+type marshalledJqQuery struct {
+	Query       string `json:"query"`
+	Expectation string `json:"expectation"`
+	Mode        string `json:"mode,omitempty"`
 }
 
+// redactedSecret stands in for secrets in the API's view of a check. An
+// update sending it back keeps the secret as it was.
+const redactedSecret = "********"
+
+// MarshalJSON encodes a check as the API, events and notifications show
+// it, with its secrets redacted. Only the job store keeps them, through
+// marshalStored.
 func (h HealthcheckQuery) MarshalJSON() ([]byte, error) {
-	type marshalledJqQuery struct {
-		Query       string `json:"query"`
-		Expectation string `json:"expectation"`
+	return h.redacted().marshalStored()
+}
+
+// redacted returns a copy of the check with its secrets replaced by
+// redactedSecret.
+func (h HealthcheckQuery) redacted() HealthcheckQuery {
+	h.S3 = h.S3.redacted()
+	h.BasicAuth = h.BasicAuth.redacted()
+	h.Headers = redactHeaders(h.Headers)
+	if h.Steps != nil {
+		steps := make([]TransactionStep, len(h.Steps))
+		for i, step := range h.Steps {
+			step.Headers = redactHeaders(step.Headers)
+			steps[i] = step
+		}
+		h.Steps = steps
+	}
+	return h
+}
+
+// keepSecrets restores the secrets of old that an update sent back
+// redacted.
+func (h *HealthcheckQuery) keepSecrets(old HealthcheckQuery) {
+	h.S3.keepSecrets(old.S3)
+	h.BasicAuth.keepSecrets(old.BasicAuth)
+	keepHeaderSecrets(h.Headers, old.Headers)
+	for i := range h.Steps {
+		if i < len(old.Steps) {
+			keepHeaderSecrets(h.Steps[i].Headers, old.Steps[i].Headers)
+		}
 	}
+}
+
+// marshalStored encodes a check along with its secrets.
+func (h HealthcheckQuery) marshalStored() ([]byte, error) {
 	var jqQuery *marshalledJqQuery
 	if h.JqQuery.Query == nil {
 		jqQuery = nil
 	} else {
 		jqQuery = &marshalledJqQuery{
-			h.JqQuery.Query.String(),
-			h.JqQuery.Expectation,
+			Query:       h.JqQuery.Query.String(),
+			Expectation: h.JqQuery.Expectation,
 		}
+		if h.JqQuery.Mode != jqMatchFirst {
+			jqQuery.Mode = h.JqQuery.Mode
+		}
+	}
+	var downFrequency string
+	if h.DownFrequency > 0 {
+		downFrequency = h.DownFrequency.String()
+	}
+	var timeout string
+	if h.Timeout > 0 {
+		timeout = h.Timeout.String()
+	}
+	var retryInterval string
+	if h.Retries > 0 {
+		retryInterval = h.RetryInterval.String()
 	}
 	return json.Marshal(struct {
-		Id             healthcheckId      `json:"id"`
-		Url            string             `json:"url"`
-		Method         string             `json:"method"`
-		ExpectedStatus int                `json:"expected_status"`
-		Frequency      string             `json:"frequency"`
-		JqQuery        *marshalledJqQuery `json:"jq_query,omitempty"`
+		Id                      healthcheckId      `json:"id"`
+		Alias                   int                `json:"alias"`
+		CreatedAt               *time.Time         `json:"created_at,omitempty"`
+		UpdatedAt               *time.Time         `json:"updated_at,omitempty"`
+		CreatedBy               string             `json:"created_by,omitempty"`
+		ArchivedAt              *time.Time         `json:"archived_at,omitempty"`
+		ResumeAt                *time.Time         `json:"resume_at,omitempty"`
+		Version                 int                `json:"version,omitempty"`
+		Type                    string             `json:"type"`
+		Group                   string             `json:"group,omitempty"`
+		Public                  bool               `json:"public,omitempty"`
+		Namespace               string             `json:"namespace,omitempty"`
+		Labels                  map[string]string  `json:"labels,omitempty"`
+		Tags                    []string           `json:"tags,omitempty"`
+		Paused                  bool               `json:"paused,omitempty"`
+		Locations               []string           `json:"locations,omitempty"`
+		ExcludeLocations        []string           `json:"exclude_locations,omitempty"`
+		Url                     string             `json:"url"`
+		Method                  string             `json:"method"`
+		RequestBody             string             `json:"request_body,omitempty"`
+		ContentType             string             `json:"content_type,omitempty"`
+		Headers                 map[string]string  `json:"headers,omitempty"`
+		BasicAuth               *BasicAuth         `json:"basic_auth,omitempty"`
+		ExpectedStatus          int                `json:"expected_status"`
+		Frequency               string             `json:"frequency"`
+		RunAt                   *time.Time         `json:"run_at,omitempty"`
+		MaxRuns                 int                `json:"max_runs,omitempty"`
+		Timeout                 string             `json:"timeout,omitempty"`
+		DownFrequency           string             `json:"down_frequency,omitempty"`
+		SourceAddress           string             `json:"source_address,omitempty"`
+		Resolvers               []string           `json:"resolvers,omitempty"`
+		ConfirmRecovery         bool               `json:"confirm_recovery,omitempty"`
+		FailureThreshold        int                `json:"failure_threshold,omitempty"`
+		SuccessThreshold        int                `json:"success_threshold,omitempty"`
+		Retries                 int                `json:"retries,omitempty"`
+		RetryInterval           string             `json:"retry_interval,omitempty"`
+		HonorRetryAfter         bool               `json:"honor_retry_after,omitempty"`
+		ExpectFailure           bool               `json:"expect_failure,omitempty"`
+		Webhooks                []string           `json:"webhooks,omitempty"`
+		SlackWebhook            string             `json:"slack_webhook,omitempty"`
+		LatencySLO              *LatencySLO        `json:"latency_slo,omitempty"`
+		Warnings                *WarningChannels   `json:"warnings,omitempty"`
+		Priority                checkPriority      `json:"priority"`
+		JqQuery                 *marshalledJqQuery `json:"jq_query,omitempty"`
+		ExpectedBody            *string            `json:"expected_body,omitempty"`
+		ExpectedSha256          string             `json:"expected_sha256,omitempty"`
+		Validator               string             `json:"validator,omitempty"`
+		DisableDecompression    bool               `json:"disable_decompression,omitempty"`
+		ExpectedContentEncoding string             `json:"expected_content_encoding,omitempty"`
+		Artifact                *ArtifactCheck     `json:"artifact,omitempty"`
+		S3                      *S3Check           `json:"s3,omitempty"`
+		DNS                     *DNSQuery          `json:"dns,omitempty"`
+		Ping                    *PingQuery         `json:"ping,omitempty"`
+		TLS                     *TLSQuery          `json:"tls,omitempty"`
+		Steps                   []TransactionStep  `json:"steps,omitempty"`
+		Plugin                  json.RawMessage    `json:"plugin,omitempty"`
 	}{
-		Id:             h.Id,
-		Url:            h.Url,
-		Method:         h.Method,
-		ExpectedStatus: h.ExpectedStatus,
-		Frequency:      h.Frequency.String(),
-		JqQuery:        jqQuery,
+		Id:                      h.Id,
+		Alias:                   h.Alias,
+		CreatedAt:               optionalTime(h.CreatedAt),
+		UpdatedAt:               optionalTime(h.UpdatedAt),
+		CreatedBy:               h.CreatedBy,
+		ArchivedAt:              optionalTime(h.ArchivedAt),
+		ResumeAt:                optionalTime(h.ResumeAt),
+		Version:                 h.Version,
+		Type:                    h.Type,
+		Group:                   h.Group,
+		Public:                  h.Public,
+		Namespace:               h.Namespace,
+		Labels:                  h.Labels,
+		Tags:                    h.Tags,
+		Paused:                  h.Paused,
+		Locations:               h.Locations,
+		ExcludeLocations:        h.ExcludeLocations,
+		Url:                     h.Url,
+		Method:                  h.Method,
+		RequestBody:             h.RequestBody,
+		ContentType:             h.ContentType,
+		Headers:                 h.Headers,
+		BasicAuth:               h.BasicAuth,
+		ExpectedStatus:          h.ExpectedStatus,
+		Frequency:               h.Frequency.String(),
+		RunAt:                   optionalTime(h.RunAt),
+		MaxRuns:                 h.MaxRuns,
+		Timeout:                 timeout,
+		DownFrequency:           downFrequency,
+		SourceAddress:           h.SourceAddress,
+		Resolvers:               h.Resolvers,
+		ConfirmRecovery:         h.ConfirmRecovery,
+		FailureThreshold:        h.FailureThreshold,
+		SuccessThreshold:        h.SuccessThreshold,
+		Retries:                 h.Retries,
+		RetryInterval:           retryInterval,
+		HonorRetryAfter:         h.HonorRetryAfter,
+		ExpectFailure:           h.ExpectFailure,
+		Webhooks:                h.Webhooks,
+		SlackWebhook:            h.SlackWebhook,
+		LatencySLO:              h.LatencySLO,
+		Warnings:                h.Warnings,
+		Priority:                h.Priority,
+		JqQuery:                 jqQuery,
+		ExpectedBody:            h.ExpectedBody,
+		ExpectedSha256:          h.ExpectedSha256,
+		Validator:               h.Validator,
+		DisableDecompression:    h.DisableDecompression,
+		ExpectedContentEncoding: h.ExpectedContentEncoding,
+		Artifact:                h.Artifact,
+		S3:                      h.S3,
+		DNS:                     h.DNS,
+		Ping:                    h.Ping,
+		TLS:                     h.TLS,
+		Steps:                   h.Steps,
+		Plugin:                  h.Plugin,
 	})
 }
 
+// healthcheckQueryInput is the accepted JSON representation of a
+// HealthcheckQuery, before validation.
+type healthcheckQueryInput struct {
+	Type                    string             `json:"type"`
+	Group                   string             `json:"group"`
+	Public                  bool               `json:"public"`
+	Namespace               string             `json:"namespace"`
+	Labels                  map[string]string  `json:"labels"`
+	Tags                    []string           `json:"tags"`
+	Paused                  bool               `json:"paused"`
+	Locations               []string           `json:"locations"`
+	ExcludeLocations        []string           `json:"exclude_locations"`
+	Url                     string             `json:"url"`
+	Method                  string             `json:"method"`
+	RequestBody             string             `json:"request_body"`
+	ContentType             string             `json:"content_type"`
+	Headers                 map[string]string  `json:"headers"`
+	BasicAuth               *BasicAuth         `json:"basic_auth"`
+	ExpectedStatus          int                `json:"expected_status"`
+	Frequency               string             `json:"frequency"`
+	RunAt                   time.Time          `json:"run_at"`
+	MaxRuns                 int                `json:"max_runs"`
+	Timeout                 string             `json:"timeout"`
+	DownFrequency           string             `json:"down_frequency"`
+	SourceAddress           string             `json:"source_address"`
+	Resolvers               []string           `json:"resolvers"`
+	ConfirmRecovery         bool               `json:"confirm_recovery"`
+	FailureThreshold        int                `json:"failure_threshold"`
+	SuccessThreshold        int                `json:"success_threshold"`
+	Retries                 int                `json:"retries"`
+	RetryInterval           string             `json:"retry_interval"`
+	HonorRetryAfter         bool               `json:"honor_retry_after"`
+	ExpectFailure           bool               `json:"expect_failure"`
+	Webhooks                []string           `json:"webhooks"`
+	SlackWebhook            string             `json:"slack_webhook"`
+	LatencySLO              *LatencySLO        `json:"latency_slo"`
+	Warnings                *WarningChannels   `json:"warnings"`
+	Priority                checkPriority      `json:"priority"`
+	JqQuery                 *marshalledJqQuery `json:"jq_query"`
+	ExpectedBody            *string            `json:"expected_body"`
+	ExpectedSha256          string             `json:"expected_sha256"`
+	Validator               string             `json:"validator"`
+	DisableDecompression    bool               `json:"disable_decompression"`
+	ExpectedContentEncoding string             `json:"expected_content_encoding"`
+	Artifact                *ArtifactCheck     `json:"artifact"`
+	S3                      *S3Check           `json:"s3"`
+	DNS                     *DNSQuery          `json:"dns"`
+	Ping                    *PingQuery         `json:"ping"`
+	TLS                     *TLSQuery          `json:"tls"`
+	Steps                   []TransactionStep  `json:"steps"`
+	Plugin                  json.RawMessage    `json:"plugin"`
+}
+
 func (h *HealthcheckQuery) UnmarshalJSON(data []byte) error {
-	type marshalledJqQuery struct {
-		Query       string `json:"query"`
-		Expectation string `json:"expectation"`
-	}
-	d := struct {
-		Url            string             `json:"url"`
-		Method         string             `json:"method"`
-		ExpectedStatus int                `json:"expected_status"`
-		Frequency      string             `json:"frequency"`
-		JqQuery        *marshalledJqQuery `json:"jq_query"`
-	}{
-		Url:            "",
-		Method:         "",
-		ExpectedStatus: 0,
-		Frequency:      "",
-		JqQuery:        nil,
+	d := healthcheckQueryInput{
+		Type:                    checkTypeHttp,
+		Group:                   "",
+		Public:                  false,
+		Namespace:               "",
+		Labels:                  nil,
+		Tags:                    nil,
+		Paused:                  false,
+		Locations:               nil,
+		ExcludeLocations:        nil,
+		Url:                     "",
+		Method:                  "",
+		RequestBody:             "",
+		ContentType:             "",
+		Headers:                 nil,
+		BasicAuth:               nil,
+		ExpectedStatus:          0,
+		Frequency:               "",
+		RunAt:                   time.Time{},
+		MaxRuns:                 0,
+		Timeout:                 "",
+		DownFrequency:           "",
+		SourceAddress:           "",
+		Resolvers:               nil,
+		ConfirmRecovery:         false,
+		FailureThreshold:        0,
+		SuccessThreshold:        0,
+		Retries:                 0,
+		RetryInterval:           "",
+		HonorRetryAfter:         false,
+		ExpectFailure:           false,
+		Webhooks:                nil,
+		SlackWebhook:            "",
+		LatencySLO:              nil,
+		Warnings:                nil,
+		Priority:                priorityNormal,
+		JqQuery:                 nil,
+		ExpectedBody:            nil,
+		ExpectedSha256:          "",
+		Validator:               "",
+		DisableDecompression:    false,
+		ExpectedContentEncoding: "",
+		Artifact:                nil,
+		S3:                      nil,
+		DNS:                     nil,
+		Ping:                    nil,
+		TLS:                     nil,
+		Steps:                   nil,
+		Plugin:                  nil,
 	}
 	err := json.Unmarshal(data, &d)
+	if err != nil {
+		return err
+	}
 
-	h.Url = d.Url
-	h.Method = d.Method
-	h.ExpectedStatus = d.ExpectedStatus
-	h.Frequency, err = time.ParseDuration(d.Frequency)
-
+	switch {
+	case d.Type == checkTypeDoT:
+		h.Url, err = normalizeDoTURL(d.Url)
+	case d.Type == checkTypeDNS:
+		h.Url, err = normalizeDNSURL(d.Url)
+	case d.Type == checkTypeTCP:
+		h.Url, err = normalizeTCPURL(d.Url)
+	case d.Type == checkTypeICMP:
+		h.Url, err = normalizeICMPURL(d.Url)
+	case d.Type == checkTypeTLS:
+		h.Url, err = normalizeTLSURL(d.Url)
+	case d.Type == checkTypeTransaction && d.Url == "":
+		// Defaults to the first step's.
+		h.Url = ""
+	case checkPlugins[d.Type] != nil:
+		h.Url, err = normalizePluginURL(d.Url)
+	default:
+		h.Url, err = normalizeURL(d.Url)
+	}
 	if err != nil {
 		return err
 	}
-	if d.JqQuery == nil {
-		h.JqQuery.Query = nil
-	} else {
-		q, err := gojq.Parse(d.JqQuery.Query)
+	h.Group = d.Group
+	h.Public = d.Public
+	h.Namespace = d.Namespace
+	for key := range d.Labels {
+		err = validateLabelKey(key)
 		if err != nil {
 			return err
 		}
-		h.JqQuery.Query = q
-		h.JqQuery.Expectation = d.JqQuery.Expectation
 	}
-	return nil
+	h.Labels = d.Labels
+	h.Tags, err = normalizeTags(d.Tags)
+	if err != nil {
+		return err
+	}
+	h.Paused = d.Paused
+	err = validateLocationPatterns("locations", d.Locations)
+	if err != nil {
+		return err
+	}
+	err = validateLocationPatterns("exclude_locations", d.ExcludeLocations)
+	if err != nil {
+		return err
+	}
+	h.Locations = d.Locations
+	h.ExcludeLocations = d.ExcludeLocations
+	h.Method = strings.ToUpper(d.Method)
+	h.RequestBody = d.RequestBody
+	h.ContentType = d.ContentType
+	if h.RequestBody == "" && h.ContentType != "" {
+		return errors.New("content_type requires a request_body")
+	}
+	h.ExpectedStatus = d.ExpectedStatus
+	h.Priority = d.Priority
+	h.ExpectedBody = d.ExpectedBody
+	h.ExpectedSha256, err = parseSha256(d.ExpectedSha256)
+	if err != nil {
+		return err
+	}
+	h.Validator = ""
+	if d.Validator != "" {
+		h.Validator, err = normalizeURL(d.Validator)
+		if err != nil {
+			return fmt.Errorf("invalid validator: %w", err)
+		}
+	}
+	h.DisableDecompression = d.DisableDecompression
+	h.ExpectedContentEncoding = d.ExpectedContentEncoding
+	if h.ExpectedContentEncoding != "" && !h.DisableDecompression {
+		return errors.New("expected_content_encoding requires disable_decompression")
+	}
+	if d.MaxRuns < 0 {
+		return fmt.Errorf("invalid max_runs %d, must be positive", d.MaxRuns)
+	}
+	h.RunAt = d.RunAt
+	h.MaxRuns = d.MaxRuns
+	if d.Frequency == "" && d.MaxRuns == 1 {
+		// One-shot checks don't repeat.
+		d.Frequency = oneShotFrequency.String()
+	}
+	h.Frequency, err = time.ParseDuration(d.Frequency)
+	if err != nil {
+		return err
+	}
+	if h.Frequency <= 0 {
+		return fmt.Errorf("invalid frequency %q, must be positive", d.Frequency)
+	}
+	h.Timeout = 0
+	if d.Timeout != "" {
+		h.Timeout, err = time.ParseDuration(d.Timeout)
+		if err != nil {
+			return err
+		}
+		if h.Timeout <= 0 || h.Timeout > maxCheckTimeout {
+			return fmt.Errorf("invalid timeout %q, must be positive and at most %s", d.Timeout, maxCheckTimeout)
+		}
+	}
+	h.DownFrequency = 0
+	if d.DownFrequency != "" {
+		h.DownFrequency, err = time.ParseDuration(d.DownFrequency)
+		if err != nil {
+			return err
+		}
+		if h.DownFrequency <= 0 {
+			return fmt.Errorf("invalid down_frequency %q, must be positive", d.DownFrequency)
+		}
+	}
+	h.SourceAddress = d.SourceAddress
+	h.Resolvers, err = parseResolvers(d.Resolvers)
+	if err != nil {
+		return err
+	}
+	h.ConfirmRecovery = d.ConfirmRecovery
+	if d.FailureThreshold < 0 || d.FailureThreshold > maxThreshold {
+		return fmt.Errorf("invalid failure_threshold %d, expected 1 to %d", d.FailureThreshold, maxThreshold)
+	}
+	if d.SuccessThreshold < 0 || d.SuccessThreshold > maxThreshold {
+		return fmt.Errorf("invalid success_threshold %d, expected 1 to %d", d.SuccessThreshold, maxThreshold)
+	}
+	h.FailureThreshold = d.FailureThreshold
+	h.SuccessThreshold = d.SuccessThreshold
+	err = h.parseRetries(d.Retries, d.RetryInterval)
+	if err != nil {
+		return err
+	}
+	h.HonorRetryAfter = d.HonorRetryAfter
+	h.ExpectFailure = d.ExpectFailure
+	h.Webhooks = nil
+	for _, url := range d.Webhooks {
+		url, err := normalizeURL(url)
+		if err != nil {
+			return fmt.Errorf("invalid webhook: %w", err)
+		}
+		h.Webhooks = append(h.Webhooks, url)
+	}
+	h.SlackWebhook = ""
+	if d.SlackWebhook != "" {
+		h.SlackWebhook, err = normalizeURL(d.SlackWebhook)
+		if err != nil {
+			return fmt.Errorf("invalid slack_webhook: %w", err)
+		}
+	}
+	h.LatencySLO = d.LatencySLO
+	if h.LatencySLO != nil {
+		err = h.LatencySLO.validate()
+		if err != nil {
+			return err
+		}
+	}
+	h.Warnings = d.Warnings
+	if h.Warnings != nil {
+		err = h.Warnings.validate()
+		if err != nil {
+			return fmt.Errorf("warnings: %w", err)
+		}
+	}
+	if d.JqQuery == nil {
+		h.JqQuery = JqQuery{}
+	} else {
+		err = h.JqQuery.compile(d.JqQuery.Query)
+		if err != nil {
+			return fmt.Errorf("invalid jq_query: %w", err)
+		}
+		h.JqQuery.Expectation = d.JqQuery.Expectation
+		switch d.JqQuery.Mode {
+		case "":
+			h.JqQuery.Mode = jqMatchFirst
+		case jqMatchFirst, jqMatchAll, jqMatchAny, jqMatchNone:
+			h.JqQuery.Mode = d.JqQuery.Mode
+		default:
+			return fmt.Errorf("invalid jq_query mode %q, expected one of first, all, any, none", d.JqQuery.Mode)
+		}
+	}
+	h.Artifact = d.Artifact
+	if h.Artifact != nil {
+		err = h.Artifact.validate(*h)
+		if err != nil {
+			return err
+		}
+	}
+
+	h.Type = d.Type
+	if h.RequestBody != "" && h.Type != checkTypeHttp {
+		return errors.New("request_body is only allowed for http checks")
+	}
+	h.Headers, err = normalizeRequestHeaders(d.Headers)
+	if err != nil {
+		return err
+	}
+	h.BasicAuth = d.BasicAuth
+	if (h.Headers != nil || h.BasicAuth != nil) && h.Type != checkTypeHttp {
+		return errors.New("headers and basic_auth are only allowed for http checks")
+	}
+	if h.BasicAuth != nil {
+		err = h.BasicAuth.validate()
+		if err != nil {
+			return err
+		}
+		if _, ok := h.Headers["Authorization"]; ok {
+			return errors.New("basic_auth and an Authorization header can't both be set")
+		}
+	}
+	h.S3 = d.S3
+	h.Plugin = d.Plugin
+	if string(h.Plugin) == "null" {
+		h.Plugin = nil
+	}
+	if h.Plugin != nil && checkPlugins[h.Type] == nil {
+		return errors.New("plugin settings are only allowed for plugin checks")
+	}
+	h.DNS = d.DNS
+	if h.DNS != nil && h.Type != checkTypeDoH && h.Type != checkTypeDoT && h.Type != checkTypeDNS {
+		return errors.New("dns settings are only allowed for dns, doh and dot checks")
+	}
+	h.Ping = d.Ping
+	if h.Ping != nil && h.Type != checkTypeICMP {
+		return errors.New("ping settings are only allowed for icmp checks")
+	}
+	h.TLS = d.TLS
+	if h.TLS != nil && h.Type != checkTypeTLS {
+		return errors.New("tls settings are only allowed for tls checks")
+	}
+	h.Steps = d.Steps
+	if h.Steps != nil && h.Type != checkTypeTransaction {
+		return errors.New("steps are only allowed for transaction checks")
+	}
+	switch h.Type {
+	case checkTypeHttp:
+		if h.S3 != nil {
+			return errors.New("s3 settings are only allowed for s3 checks")
+		}
+		if h.Method == "" {
+			h.Method = http.MethodGet
+		}
+		if !httpCheckMethods[h.Method] {
+			return fmt.Errorf("method %s not supported, expected GET, HEAD, POST, PUT, PATCH, DELETE or OPTIONS", h.Method)
+		}
+		if h.RequestBody != "" {
+			if h.Method != http.MethodPost && h.Method != http.MethodPut && h.Method != http.MethodPatch {
+				return fmt.Errorf("request_body isn't supported for %s checks", h.Method)
+			}
+			if h.ContentType == "" {
+				h.ContentType = defaultContentType(h.RequestBody)
+			}
+		}
+		if h.Method == http.MethodHead && h.hasBodyAssertions() {
+			return errors.New("body assertions aren't supported for HEAD checks")
+		}
+	case checkTypeS3:
+		if h.S3 == nil {
+			return errors.New("s3 checks require s3 settings")
+		}
+		err = h.S3.validate()
+		if err != nil {
+			return err
+		}
+		if h.Method == "" {
+			h.Method = http.MethodHead
+		}
+		if h.Method != http.MethodHead && h.Method != http.MethodGet {
+			return fmt.Errorf("method %s not supported for s3 checks, expected HEAD or GET", h.Method)
+		}
+	case checkTypeDoH, checkTypeDoT, checkTypeDNS:
+		if h.S3 != nil {
+			return errors.New("s3 settings are only allowed for s3 checks")
+		}
+		if h.DNS == nil {
+			return errors.New("dns, doh and dot checks require dns settings")
+		}
+		err = h.DNS.validate()
+		if err != nil {
+			return err
+		}
+		if h.hasBodyAssertions() || h.Artifact != nil {
+			return errors.New("body and artifact assertions aren't supported for dns, doh and dot checks")
+		}
+		if h.Type == checkTypeDNS && (h.Method != "" || h.ExpectedStatus != 0) {
+			return errors.New("method and expected_status aren't supported for dns checks")
+		}
+		if h.Type == checkTypeDoH {
+			if h.Method == "" {
+				h.Method = http.MethodPost
+			}
+			if h.ExpectedStatus == 0 {
+				h.ExpectedStatus = http.StatusOK
+			}
+		}
+	case checkTypeTCP:
+		if h.S3 != nil {
+			return errors.New("s3 settings are only allowed for s3 checks")
+		}
+		if h.hasBodyAssertions() || h.Artifact != nil {
+			return errors.New("body and artifact assertions aren't supported for tcp checks")
+		}
+		if h.Method != "" || h.ExpectedStatus != 0 {
+			return errors.New("method and expected_status aren't supported for tcp checks")
+		}
+	case checkTypeICMP:
+		if h.S3 != nil {
+			return errors.New("s3 settings are only allowed for s3 checks")
+		}
+		if h.hasBodyAssertions() || h.Artifact != nil {
+			return errors.New("body and artifact assertions aren't supported for icmp checks")
+		}
+		if h.Method != "" || h.ExpectedStatus != 0 {
+			return errors.New("method and expected_status aren't supported for icmp checks")
+		}
+		if h.Ping != nil {
+			err = h.Ping.validate()
+			if err != nil {
+				return err
+			}
+		}
+	case checkTypeTLS:
+		if h.S3 != nil {
+			return errors.New("s3 settings are only allowed for s3 checks")
+		}
+		if h.hasBodyAssertions() || h.Artifact != nil {
+			return errors.New("body and artifact assertions aren't supported for tls checks")
+		}
+		if h.Method != "" || h.ExpectedStatus != 0 {
+			return errors.New("method and expected_status aren't supported for tls checks")
+		}
+		if h.TLS != nil {
+			err = h.TLS.validate()
+			if err != nil {
+				return err
+			}
+		}
+	case checkTypeTransaction:
+		if h.S3 != nil {
+			return errors.New("s3 settings are only allowed for s3 checks")
+		}
+		if h.hasBodyAssertions() || h.Artifact != nil {
+			return errors.New("body and artifact assertions aren't supported for transaction checks")
+		}
+		if h.Method != "" || h.ExpectedStatus != 0 {
+			return errors.New("method and expected_status are set by each step of transaction checks")
+		}
+		err = h.validateTransaction()
+		if err != nil {
+			return err
+		}
+	default:
+		if _, ok := checkPlugins[h.Type]; !ok {
+			return fmt.Errorf("invalid type %q, expected http, s3, dns, doh, dot, tcp, icmp, tls, transaction or a plugin's", h.Type)
+		}
+		if h.S3 != nil {
+			return errors.New("s3 settings are only allowed for s3 checks")
+		}
+		if h.hasBodyAssertions() || h.Artifact != nil {
+			return errors.New("body and artifact assertions aren't supported for plugin checks")
+		}
+	}
+	return nil
 }
 
 type HealthcheckResponse struct {
+	// Status is whether the target is available: the result is UP or
+	// DEGRADED.
 	Status bool
+	// State, if set, is the result's state; see state.
+	State resultState
+	// Reason is a code classifying why the result is in its state, e.g.
+	// why the check failed.
+	Reason string
+	// Throttled results are neither up nor down: the target asked to be
+	// retried after RetryAfter.
+	Throttled  bool
+	RetryAfter time.Duration
+	// Error is why the check failed.
+	Error string
+	// StatusCode is the HTTP status the target responded with, if any.
+	StatusCode    int
+	CorrelationId string
+	Timestamp     time.Time
+	// Duration is how long the run took, including any confirmation.
+	Duration time.Duration
+	// Latency is how long the check itself took, without retries or
+	// confirmations, e.g. the time to a response and its body.
+	Latency time.Duration
+	Source  ResultSource
+	Dial    *dialOutcome
+	// Certificate describes the certificate a tls check was presented.
+	Certificate *certificateInfo
+	// Retries is how many times the check was retried before this result.
+	Retries int
+	// Annotations are the texts of the annotations of the time the result
+	// covers, set when listing a job's results.
+	Annotations []string
+	// Maintenance is the id of the maintenance window the check was under.
+	Maintenance string
+	// Transfer is the requests the run made and the bytes it transferred.
+	Transfer *transferUsage
+	// TransientRetries is how many times the run was retried right away
+	// after a transient network error.
+	TransientRetries int
+	// targetGone is whether the target looked decommissioned: its name
+	// didn't resolve, or it refused the connection.
+	targetGone bool
+	// transient is whether the check failed on a network blip rather than
+	// because of the target; see transientError.
+	transient bool
+}
+
+func (r HealthcheckResponse) statusString() string {
+	return string(r.state())
+}
+
+func (r HealthcheckResponse) MarshalJSON() ([]byte, error) {
+	var retryAfter string
+	if r.Throttled {
+		retryAfter = r.RetryAfter.String()
+	}
+	return json.Marshal(struct {
+		Status           string           `json:"status"`
+		Reason           string           `json:"reason,omitempty"`
+		Error            string           `json:"error,omitempty"`
+		StatusCode       int              `json:"status_code,omitempty"`
+		RetryAfter       string           `json:"retry_after,omitempty"`
+		CorrelationId    string           `json:"correlation_id"`
+		Timestamp        time.Time        `json:"timestamp"`
+		DurationMs       float64          `json:"duration_ms"`
+		LatencyMs        float64          `json:"latency_ms"`
+		Source           ResultSource     `json:"source"`
+		Dial             *dialOutcome     `json:"dial,omitempty"`
+		Certificate      *certificateInfo `json:"certificate,omitempty"`
+		Retries          int              `json:"retries,omitempty"`
+		TransientRetries int              `json:"transient_retries,omitempty"`
+		Annotations      []string         `json:"annotations,omitempty"`
+		Maintenance      string           `json:"maintenance,omitempty"`
+		Transfer         *transferUsage   `json:"transfer,omitempty"`
+	}{
+		Status:           r.statusString(),
+		Reason:           r.Reason,
+		Error:            r.Error,
+		StatusCode:       r.StatusCode,
+		RetryAfter:       retryAfter,
+		CorrelationId:    r.CorrelationId,
+		Timestamp:        r.Timestamp,
+		DurationMs:       float64(r.Duration) / float64(time.Millisecond),
+		LatencyMs:        float64(r.Latency) / float64(time.Millisecond),
+		Source:           r.Source,
+		Dial:             r.Dial,
+		Certificate:      r.Certificate,
+		Retries:          r.Retries,
+		TransientRetries: r.TransientRetries,
+		Annotations:      r.Annotations,
+		Maintenance:      r.Maintenance,
+		Transfer:         r.Transfer,
+	})
 }
 
-func (h HealthcheckQuery) check() HealthcheckResponse {
-	if h.Method != http.MethodGet {
-		fmt.Printf("Error: method %s not supported\n", h.Method)
-		return HealthcheckResponse{Status: false}
+func (r *HealthcheckResponse) UnmarshalJSON(data []byte) error {
+	d := struct {
+		Status           string           `json:"status"`
+		Reason           string           `json:"reason"`
+		Error            string           `json:"error"`
+		StatusCode       int              `json:"status_code"`
+		RetryAfter       string           `json:"retry_after"`
+		CorrelationId    string           `json:"correlation_id"`
+		Timestamp        time.Time        `json:"timestamp"`
+		DurationMs       float64          `json:"duration_ms"`
+		LatencyMs        float64          `json:"latency_ms"`
+		Source           ResultSource     `json:"source"`
+		Dial             *dialOutcome     `json:"dial"`
+		Certificate      *certificateInfo `json:"certificate"`
+		Retries          int              `json:"retries"`
+		TransientRetries int              `json:"transient_retries"`
+		Maintenance      string           `json:"maintenance"`
+		Transfer         *transferUsage   `json:"transfer"`
+	}{}
+	err := json.Unmarshal(data, &d)
+	if err != nil {
+		return err
+	}
+	r.Reason = d.Reason
+	// Older agents report throttled results as THROTTLED.
+	if d.Status == "THROTTLED" {
+		d.Status = string(stateSkipped)
+		r.Reason = reasonThrottled
 	}
+	r.State, err = parseResultState(d.Status)
+	if err != nil {
+		return err
+	}
+	r.Status = r.State == stateUp || r.State == stateDegraded
+	if r.State == stateSkipped && r.Reason == reasonThrottled {
+		r.Throttled = true
+		r.RetryAfter, err = time.ParseDuration(d.RetryAfter)
+		if err != nil {
+			return fmt.Errorf("invalid retry_after: %w", err)
+		}
+	}
+	r.Error = d.Error
+	r.StatusCode = d.StatusCode
+	r.CorrelationId = d.CorrelationId
+	r.Timestamp = d.Timestamp
+	r.Duration = time.Duration(d.DurationMs * float64(time.Millisecond))
+	r.Latency = time.Duration(d.LatencyMs * float64(time.Millisecond))
+	r.Source = d.Source
+	r.Dial = d.Dial
+	r.Certificate = d.Certificate
+	r.Retries = d.Retries
+	r.TransientRetries = d.TransientRetries
+	r.Maintenance = d.Maintenance
+	r.Transfer = d.Transfer
+	return nil
+}
 
-	req, err := http.NewRequest(h.Method, h.Url, nil)
+// timeout returns how long the check may take.
+func (h HealthcheckQuery) timeout() time.Duration {
+	if h.Timeout > 0 {
+		return h.Timeout
+	}
+	return defaultCheckTimeout
+}
+
+func (h HealthcheckQuery) check(ctx context.Context) (result HealthcheckResponse) {
+	var dial dialTracer
+	start := time.Now()
+	defer func() {
+		result.Latency = time.Since(start)
+		result.Dial = dial.result()
+		if h.ExpectFailure {
+			result = h.expectFailure(ctx, result)
+		}
+	}()
+	if h.Type != checkTypeTransaction {
+		// Transaction checks time each step out on its own.
+		runCtx, cancel := context.WithTimeout(ctx, h.timeout())
+		defer cancel()
+		ctx = runCtx
+	}
+
+	switch h.Type {
+	case checkTypeDoH:
+		return h.checkDoH(ctx, &dial)
+	case checkTypeDoT:
+		return h.checkDoT(ctx)
+	case checkTypeDNS:
+		return h.checkDNS(ctx)
+	case checkTypeTCP:
+		return h.checkTCP(ctx)
+	case checkTypeICMP:
+		return h.checkICMP(ctx)
+	case checkTypeTLS:
+		return h.checkTLS(ctx)
+	case checkTypeTransaction:
+		return h.checkTransaction(ctx, &dial)
+	}
+	if p, ok := checkPlugins[h.Type]; ok {
+		return h.checkPlugin(ctx, p)
+	}
+	var body io.Reader
+	if h.RequestBody != "" {
+		body = strings.NewReader(h.RequestBody)
+	}
+	req, err := http.NewRequestWithContext(ctx, h.Method, h.Url, body)
 	if err != nil {
-		fmt.Printf("Error: %v\n", err)
-		return HealthcheckResponse{Status: false}
+		return failCheck(ctx, "%v", err)
 	}
 	req.Header.Add("Accept", "application/json")
-	resp, err := httpClient.Do(req)
+	if h.RequestBody != "" {
+		req.Header.Set("Content-Type", h.ContentType)
+	}
+	h.applyHeaders(req)
+	req.Header.Set(correlationHeader, correlationId(ctx))
+	if h.Artifact != nil {
+		h.Artifact.prepare(req)
+	}
+	prepareEncoding(req)
+	if h.S3 != nil {
+		h.S3.sign(req, time.Now())
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), probeConnStats.trace()))
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), dial.trace()))
+	req = withTransferTrace(req)
+	trace := traceFrom(ctx)
+	req = trace.request(req)
+	resp, err := probeClient(ctx).Do(req)
 	if err != nil {
-		fmt.Printf("Error: %v\n", err)
-		return HealthcheckResponse{Status: false}
+		return failCheck(ctx, "%v", err)
 	}
-	if resp.StatusCode != h.ExpectedStatus {
-		fmt.Printf("Error: Unexpected status code, %d != %d\n", resp.StatusCode, h.ExpectedStatus)
-		return HealthcheckResponse{Status: false}
+	trace.response(resp)
+	defer func() {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBytes))
+		resp.Body.Close()
+		result.StatusCode = resp.StatusCode
+	}()
+	if retryAfter, ok := throttled(resp, time.Now()); ok && h.HonorRetryAfter && resp.StatusCode != h.ExpectedStatus {
+		result := failCheckReason(ctx, reasonThrottled, "Throttled with status code %d, retrying after %s", resp.StatusCode, retryAfter)
+		result.Throttled = true
+		result.RetryAfter = retryAfter
+		return result
 	}
 	if resp.StatusCode != h.ExpectedStatus {
-		fmt.Printf("Error: Unexpected status code, %d != %d\n", resp.StatusCode, h.ExpectedStatus)
-		return HealthcheckResponse{Status: false}
+		err = fmt.Errorf("Unexpected status code, %d != %d", resp.StatusCode, h.ExpectedStatus)
+	}
+	trace.assert("expected_status", h.ExpectedStatus, resp.StatusCode, err)
+	if err != nil {
+		return failCheckReason(ctx, reasonUnexpectedStatus, "%v", err)
+	}
+	err = h.checkContentEncoding(resp)
+	if h.ExpectedContentEncoding != "" {
+		trace.assert("expected_content_encoding", h.ExpectedContentEncoding, resp.Header.Get("Content-Encoding"), err)
+	}
+	if err != nil {
+		return failCheckReason(ctx, reasonAssertionFailed, "%v", err)
 	}
 
-	// Optionally check the response body against a jq query
-	// We expect exactly one result
-	if h.JqQuery.Query != nil {
-		err = checkJSON(h, resp)
+	if h.Artifact != nil {
+		err = h.Artifact.check(resp)
+		trace.assert("artifact", nil, nil, err)
 		if err != nil {
-			fmt.Printf("Error: %v\n", err)
-			return HealthcheckResponse{Status: false}
+			return failCheckReason(ctx, reasonAssertionFailed, "%v", err)
 		}
 	}
 
-	return HealthcheckResponse{Status: true}
+	if h.hasBodyAssertions() {
+		err = checkBody(ctx, h, resp)
+		if err != nil {
+			// Unless reading the body failed, an assertion did.
+			reason := failureReason([]interface{}{err})
+			if reason == reasonCheckFailed {
+				reason = reasonAssertionFailed
+			}
+			return failCheckReason(ctx, reason, "%v", err)
+		}
+	}
 
+	return HealthcheckResponse{Status: true}
 }
 
-func checkJSON(h HealthcheckQuery, resp *http.Response) error {
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Printf("Error: %v\n", err)
-		return errors.New("Error reading response body")
-	}
+// checkJSON runs the check's jq query on the response body, for no longer
+// than ctx allows, i.e. the check's timeout.
+func checkJSON(ctx context.Context, h HealthcheckQuery, body []byte) error {
 	var data interface{}
-	err = json.Unmarshal(body, &data)
+	err := json.Unmarshal(body, &data)
 	if err != nil {
 		return errors.New("Error deserializing response body")
 	}
-	iter := h.JqQuery.Query.Run(data)
+	code := h.JqQuery.code
+	if code == nil {
+		// The query was set without going through compile, e.g. by a
+		// program embedding the checker.
+		code, err = gojq.Compile(h.JqQuery.Query)
+		if err != nil {
+			return fmt.Errorf("Error compiling jq query: %w", err)
+		}
+	}
+	iter := code.RunWithContext(ctx, data)
 
-	v, ok := iter.Next()
-	if !ok {
+	var values []interface{}
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			return fmt.Errorf("Error running jq query: %w", err)
+		}
+		values = append(values, v)
+		if h.JqQuery.Mode == jqMatchFirst {
+			break
+		}
+		if len(values) > maxJqResults {
+			return fmt.Errorf("jq query produced more than %d values", maxJqResults)
+		}
+	}
+	if len(values) == 0 {
 		return errors.New("Error parsing response body")
 	}
-	if v != h.JqQuery.Expectation {
-		return errors.New("Expectation failed")
+
+	matching := 0
+	for _, v := range values {
+		if v == h.JqQuery.Expectation {
+			matching++
+		}
+	}
+	var ok bool
+	switch h.JqQuery.Mode {
+	case jqMatchFirst, jqMatchAll:
+		ok = matching == len(values)
+	case jqMatchAny:
+		ok = matching > 0
+	case jqMatchNone:
+		ok = matching == 0
+	}
+	if !ok {
+		produced, _ := json.Marshal(values)
+		return fmt.Errorf("Expectation failed: jq query produced %s, expected %s to equal %q", produced, h.JqQuery.Mode, h.JqQuery.Expectation)
 	}
 	return nil
 }
 
-func main() {
-	healthcheckServer := NewHealthcheckServer()
-	healthcheckServer.Run()
+// getenvDefault returns the environment variable key, or fallback if it is
+// unset or empty.
+func getenvDefault(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// Main runs the uptime-checker command: a server configured by its flags,
+// or the lint and simulate subcommands.
+func Main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "lint":
+			os.Exit(runLint(os.Args[2:]))
+		case "simulate":
+			os.Exit(runSimulate(os.Args[2:]))
+		}
+	}
+
+	config := DefaultConfig()
+	flag.StringVar(&config.Listen, "listen", getenvDefault("UPTIME_LISTEN", config.Listen), "address to serve the API on, e.g. 127.0.0.1:8081 to only accept local connections")
+	flag.StringVar(&config.BasePath, "base-path", os.Getenv("UPTIME_BASE_PATH"), "path prefix to serve everything under, e.g. /uptime behind a reverse proxy")
+	flag.IntVar(&config.MaxConcurrentChecks, "max-concurrent-checks", config.MaxConcurrentChecks, "maximum number of checks probing at once")
+	flag.IntVar(&config.TransientRetries, "transient-retries", config.TransientRetries, "how many times a run is retried right away after DNS timeouts and reset connections (0 disables)")
+	flag.BoolVar(&config.CatchUp, "catch-up", false, "probe every job immediately after the host wakes up from a suspension")
+	flag.StringVar(&config.HeartbeatUrl, "heartbeat-url", "", "URL to request periodically to signal this server is alive")
+	flag.DurationVar(&config.HeartbeatInterval, "heartbeat-interval", config.HeartbeatInterval, "how often to request the heartbeat URL")
+	flag.StringVar(&config.Source.Location, "location", "", "probe location stamped on every result, e.g. eu-west-1")
+	flag.StringVar(&config.Source.Environment, "environment", "", "environment stamped on every result, e.g. production")
+	flag.StringVar(&config.Source.InstanceId, "instance-id", config.Source.InstanceId, "instance id stamped on every result")
+	flag.BoolVar(&config.ReadOnly, "read-only", false, "serve API reads but reject all changes")
+	flag.BoolVar(&config.SuppressNotifications, "suppress-notifications", false, "run checks without sending any notifications")
+	flag.DurationVar(&config.StartupGrace, "startup-grace", 0, "how long after starting to run checks without sending any notifications")
+	flag.StringVar(&config.SourceAddress, "source-address", "", "local address or network interface checks connect from, unless they set their own source_address")
+	flag.IntVar(&config.AddressFamilyAlertAfter, "address-family-alert-after", 0, "warn when IPv4 or IPv6 fails to connect for this many consecutive passing runs (0 disables)")
+	flag.StringVar(&config.LogResults, "log-results", config.LogResults, "which results to log: all, failures or changes")
+	flag.Float64Var(&config.LogSuccessSampleRate, "log-success-sample-rate", 0, "fraction of successes to log anyway when -log-results skips them")
+	flag.StringVar(&config.ReconcileSource, "reconcile-source", "", "checks file path or URL that GET /reconcile/diff compares the running checks against")
+	flag.StringVar(&config.ChatOpsSigningSecret, "chatops-signing-secret", os.Getenv("CHATOPS_SIGNING_SECRET"), "Slack signing secret verifying slash commands sent to /chatops/command")
+	flag.StringVar(&config.ChatOpsToken, "chatops-token", os.Getenv("CHATOPS_TOKEN"), "Mattermost token verifying slash commands sent to /chatops/command")
+	apiToken := flag.String("api-token", os.Getenv("API_TOKEN"), "admin key API requests changing anything must carry as a bearer token (default: none, the API is open)")
+	apiTokenFile := flag.String("api-token-file", "", "file to read the admin key from, instead of -api-token")
+	apiKeysPath := flag.String("api-keys", "", "YAML file with named API keys and their roles, read, admin or upload")
+	flag.BoolVar(&config.AuthenticateReads, "authenticate-reads", false, "require an API key to read too, except the dashboard, status page and public API")
+	eventLogPath := flag.String("event-log", "", "file to append results, state changes and config changes to as JSON lines")
+	eventLogMaxSize := flag.Int64("event-log-max-size", 100<<20, "size in bytes past which the event log is rotated (0 disables rotation)")
+	eventLogMaxFiles := flag.Int("event-log-max-files", 5, "how many rotated event log files to keep")
+	lokiUrl := flag.String("loki-url", "", "Loki base URL to push results to")
+	elasticsearchUrl := flag.String("elasticsearch-url", "", "Elasticsearch base URL to bulk index results into")
+	elasticsearchIndex := flag.String("elasticsearch-index", "uptime-checker", "Elasticsearch index results are written to")
+	uploadUrl := flag.String("upload-url", "", "central server's /results/upload URL to upload results to, as an agent")
+	uploadSpool := flag.String("upload-spool", "results-spool", "directory buffering results until they are uploaded")
+	uploadInterval := flag.Duration("upload-interval", 30*time.Second, "how often to upload buffered results")
+	uploadToken := flag.String("upload-token", os.Getenv("UPLOAD_TOKEN"), "API token of the central server to upload results with")
+	configPath := flag.String("config", "", "YAML or JSON checks file whose checks are registered on startup")
+	dbPath := flag.String("db", "", "SQLite database to persist checks in, reloaded on startup")
+	recordingRulesPath := flag.String("recording-rules", "", "YAML file with recording rules deriving series from check results")
+	addressPolicyPath := flag.String("address-policy", "", "YAML file with the networks checks may not connect to")
+	alertLocalesPath := flag.String("alert-locales", "", "YAML file with locales to word Slack and email alerts in, in addition to the bundled ones")
+	slackLocale := flag.String("slack-locale", defaultAlertLocale, "locale of Slack alerts, unless a notification policy says otherwise")
+	emailLocale := flag.String("email-locale", defaultAlertLocale, "locale of alert emails, unless a notification policy says otherwise")
+	notificationPoliciesPath := flag.String("notification-policies", "", "YAML file with the default notification channels and escalations of namespaces")
+	runBudgetAlertAt := flag.Float64("run-budget-alert-at", 0.8, "fraction of the workers' time spent running checks past which to alert (0 disables)")
+	runBudgetWebhook := flag.String("run-budget-webhook", "", "URL to POST run budget alerts to")
+	flag.BoolVar(&config.PublicURLs, "public-urls", false, "show the URLs of public checks in the public API")
+	publicSigningKey := flag.String("public-signing-key", "", "Ed25519 PKCS #8 PEM key signing public API responses (default: a key generated on startup)")
+	webhooks := flag.String("webhooks", "", "comma-separated URLs to POST checks going down or coming back up to")
+	pluginsDir := flag.String("plugins", "", "directory to load WebAssembly check type and notifier plugins from")
+	smtpHost := flag.String("smtp-host", "", "SMTP server to email checks going down or coming back up through")
+	smtpPort := flag.Int("smtp-port", 587, "SMTP server port")
+	smtpUsername := flag.String("smtp-username", "", "SMTP username")
+	smtpPassword := flag.String("smtp-password", os.Getenv("SMTP_PASSWORD"), "SMTP password")
+	smtpFrom := flag.String("smtp-from", "", "address alert emails are sent from")
+	smtpTo := flag.String("smtp-to", "", "comma-separated addresses alert emails are sent to")
+	smtpAckAddress := flag.String("smtp-ack-address", "", "mailbox replies to alert emails go to, plus their acknowledgement token, e.g. alerts@example.com for alerts+ack-...@example.com")
+	staleAfter := flag.Duration("stale-after", 7*24*time.Hour, "how long a check's target must fail to resolve or refuse connections to be flagged as stale (0 disables)")
+	archiveStaleAfter := flag.Duration("archive-stale-after", 0, "how long a check's target must fail to resolve or refuse connections for the check to be archived (0 disables)")
+	flag.DurationVar(&config.DeployWindow, "deploy-window", config.DeployWindow, "how soon after a deploy of a check's service an incident must open to be attributed to it (0 disables)")
+	slackWebhook := flag.String("slack-webhook", os.Getenv("SLACK_WEBHOOK_URL"), "Slack incoming webhook URL to announce checks going down or coming back up to")
+	flag.Parse()
+
+	if !validLogResults(config.LogResults) || config.LogSuccessSampleRate < 0 || config.LogSuccessSampleRate > 1 || *runBudgetAlertAt < 0 || config.TransientRetries < 0 || *staleAfter < 0 || *archiveStaleAfter < 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	logger := slog.Default()
+	config.APIKeys = newAPIKeys()
+	if *apiTokenFile != "" {
+		token, err := readTokenFile(*apiTokenFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "-api-token-file: %v\n", err)
+			os.Exit(1)
+		}
+		*apiToken = token
+	}
+	if *apiToken != "" {
+		config.APIKeys.add("default", *apiToken, roleAdmin, time.Now())
+	}
+	if *apiKeysPath != "" {
+		err := readAPIKeys(*apiKeysPath, config.APIKeys)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", *apiKeysPath, err)
+			os.Exit(1)
+		}
+	}
+	if *addressPolicyPath != "" {
+		policy, err := readAddressPolicy(*addressPolicyPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", *addressPolicyPath, err)
+			os.Exit(1)
+		}
+		config.AddressPolicy = policy
+	}
+	if config.SourceAddress != "" {
+		err := validateSourceAddress(config.SourceAddress)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "-source-address: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *recordingRulesPath != "" {
+		rules, err := readRecordingRules(*recordingRulesPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", *recordingRulesPath, err)
+			os.Exit(1)
+		}
+		config.RecordingRules = rules
+	}
+
+	if *eventLogPath != "" {
+		eventLog, err := openEventLog(*eventLogPath, *eventLogMaxSize, *eventLogMaxFiles)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", *eventLogPath, err)
+			os.Exit(1)
+		}
+		config.EventLog = eventLog
+	}
+
+	if *lokiUrl != "" || *elasticsearchUrl != "" {
+		shipper, err := newLogShipper(*lokiUrl, *elasticsearchUrl, *elasticsearchIndex)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "log shipping: %v\n", err)
+			os.Exit(1)
+		}
+		config.LogShipper = shipper
+	}
+
+	if *uploadUrl != "" {
+		uploader, err := newResultUploader(*uploadUrl, *uploadSpool, *uploadInterval, config.Source.InstanceId, *uploadToken)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "result upload: %v\n", err)
+			os.Exit(1)
+		}
+		config.Uploader = uploader
+	}
+
+	if *runBudgetAlertAt > 0 {
+		config.RunBudget = &runBudget{logger: logger, AlertAt: *runBudgetAlertAt, WebhookUrl: *runBudgetWebhook}
+	}
+
+	if *staleAfter > 0 {
+		config.StaleChecks = newStaleChecks(*staleAfter, *archiveStaleAfter)
+	}
+
+	if *alertLocalesPath != "" {
+		err := readAlertLocales(*alertLocalesPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", *alertLocalesPath, err)
+			os.Exit(1)
+		}
+	}
+	transitions, err := newTransitionNotifier(*webhooks, *slackWebhook)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "webhooks: %v\n", err)
+		os.Exit(1)
+	}
+	for _, locale := range []string{*slackLocale, *emailLocale} {
+		err = validateAlertLocale(locale)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "alert locales: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	transitions.SlackLocale = *slackLocale
+	transitions.EmailLocale = *emailLocale
+	if *smtpHost != "" {
+		transitions.Email, err = newSMTPMailer(*smtpHost, *smtpPort, *smtpUsername, *smtpPassword, *smtpFrom, *smtpTo)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "smtp: %v\n", err)
+			os.Exit(1)
+		}
+		transitions.Email.AckAddress = *smtpAckAddress
+		if *smtpAckAddress != "" && !strings.Contains(*smtpAckAddress, "@") {
+			fmt.Fprintf(os.Stderr, "smtp: invalid -smtp-ack-address %q\n", *smtpAckAddress)
+			os.Exit(1)
+		}
+	}
+	if *notificationPoliciesPath != "" {
+		transitions.Policies, err = readNotificationPolicies(*notificationPoliciesPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", *notificationPoliciesPath, err)
+			os.Exit(1)
+		}
+		if transitions.Policies.usesEmail() && transitions.Email == nil {
+			fmt.Fprintf(os.Stderr, "%s: email_to requires -smtp-host\n", *notificationPoliciesPath)
+			os.Exit(1)
+		}
+	}
+	if *pluginsDir != "" {
+		transitions.Plugins, err = loadPlugins(*pluginsDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "plugins: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	config.Transitions = transitions
+
+	if *publicSigningKey != "" {
+		config.PublicSigner, err = readSigningKey(*publicSigningKey)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", *publicSigningKey, err)
+			os.Exit(1)
+		}
+	} else {
+		config.PublicSigner, err = generateSigningKey()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "public signing key: %v\n", err)
+			os.Exit(1)
+		}
+		logger.Warn("public-signing-key-generated", slog.String("kid", config.PublicSigner.kid))
+	}
+
+	var configured []HealthcheckQuery
+	if *configPath != "" {
+		configured, err = loadChecksFile(*configPath, config.AddressPolicy)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", *configPath, err)
+			os.Exit(1)
+		}
+	}
+
+	// The command builds its server like a program embedding one would.
+	opts := []Option{WithConfig(config), WithLogger(logger)}
+	if *dbPath != "" {
+		opts = append(opts, WithDatabase(*dbPath))
+	}
+	healthcheckServer, err := NewServer(opts...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	// Checks already restored from the database aren't registered again.
+	for _, healthcheck := range configured {
+		if _, ok := healthcheckServer.findDuplicate(healthcheck); !ok {
+			healthcheckServer.AddHealthcheck(healthcheck)
+		}
+	}
+	err = healthcheckServer.Start()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	healthcheckServer.wait()
 }
@@ -0,0 +1,131 @@
+package uptime
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// newTestServer returns a server on a simulated clock whose checks are
+// run by check, with its workers started but not its scheduler loop: tests
+// dispatch due checks themselves, like simulate does. It notifies nobody.
+func newTestServer(t *testing.T, check func(HealthcheckQuery, context.Context) HealthcheckResponse) (*HealthcheckServer, *simulatedClock) {
+	t.Helper()
+	return newConfiguredTestServer(t, Config{SuppressNotifications: true}, check)
+}
+
+// newConfiguredTestServer is newTestServer with the given config.
+func newConfiguredTestServer(t *testing.T, config Config, check func(HealthcheckQuery, context.Context) HealthcheckResponse) (*HealthcheckServer, *simulatedClock) {
+	t.Helper()
+	clk := newSimulatedClock(testEpoch)
+	config.MaxConcurrentChecks = 1
+	config.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	h := NewHealthcheckServer(config)
+	h.clock = clk
+	h.scheduler = newScheduler(clk)
+	h.check = check
+	h.scheduler.startWorkers(1, h.runProbe)
+	t.Cleanup(func() {
+		h.scheduler.stop()
+		h.scheduler.wait()
+	})
+	return &h, clk
+}
+
+func TestStopHealthcheckDuringRun(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	h, _ := newTestServer(t, func(healthcheck HealthcheckQuery, ctx context.Context) HealthcheckResponse {
+		close(started)
+		// A probe slow to notice it was cut short.
+		<-release
+		return HealthcheckResponse{Status: true}
+	})
+	defer func() {
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+	}()
+	healthcheck := h.AddHealthcheck(HealthcheckQuery{Url: "http://example.com", Frequency: time.Minute})
+	h.mu.Lock()
+	job := h.healthchecks[healthcheck.Id]
+	h.mu.Unlock()
+	h.scheduler.runNow(job)
+	<-started
+
+	stopped := make(chan struct{})
+	go func() {
+		h.StopHealthcheck(healthcheck.Id)
+		close(stopped)
+	}()
+	<-job.stopped
+
+	// Waiting for the run doesn't keep the server locked.
+	listed := make(chan []HealthcheckQuery)
+	go func() {
+		listed <- h.ListHealthchecks()
+	}()
+	select {
+	case healthchecks := <-listed:
+		if len(healthchecks) != 0 {
+			t.Errorf("got %d checks, want none", len(healthchecks))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the server stayed locked while waiting for the run")
+	}
+	select {
+	case <-stopped:
+		t.Fatal("StopHealthcheck returned while the check was running")
+	default:
+	}
+
+	close(release)
+	<-stopped
+	if results := h.results.list(healthcheck.Id, time.Time{}, 10); len(results) != 0 {
+		t.Errorf("got %d results, want the run cut short to be dropped", len(results))
+	}
+}
+
+func TestCreateJobConcurrentDuplicates(t *testing.T) {
+	h, _ := newTestServer(t, func(healthcheck HealthcheckQuery, ctx context.Context) HealthcheckResponse {
+		return HealthcheckResponse{Status: true}
+	})
+	handler := h.Handler()
+	const requests = 20
+	statuses := make(chan int, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := httptest.NewRequest(http.MethodPost, "/jobs", strings.NewReader(`{"url":"http://203.0.113.1","expected_status":200,"frequency":"1m"}`))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			statuses <- w.Code
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+	created := 0
+	for status := range statuses {
+		switch status {
+		case http.StatusCreated:
+			created++
+		case http.StatusConflict:
+		default:
+			t.Errorf("got status %d, want 201 or 409", status)
+		}
+	}
+	if created != 1 || len(h.ListHealthchecks()) != 1 {
+		t.Errorf("created %d checks, %d listed, want 1", created, len(h.ListHealthchecks()))
+	}
+}
@@ -0,0 +1,421 @@
+package uptime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The modes of maintenance windows.
+const (
+	// maintenanceSuppress runs checks as usual, but their failures are
+	// MAINTENANCE results: they don't alert, open incidents or count
+	// against uptime.
+	maintenanceSuppress = "suppress"
+	// maintenanceSkip doesn't run checks at all.
+	maintenanceSkip = "skip"
+)
+
+// minMaintenanceEvery is how far apart recurring maintenance windows must
+// start at least.
+const minMaintenanceEvery = time.Hour
+
+// maintenanceWindow is a period checks are under maintenance, e.g. while
+// their service is deployed: once from Start for Duration, or, with Every
+// set, from Start and every Every after that until Until, if set. It
+// applies to the checks in Jobs, to those in Groups and to those whose
+// labels match Selector, the latter two including checks created after
+// the window.
+type maintenanceWindow struct {
+	Id        string          `json:"id"`
+	Name      string          `json:"name,omitempty"`
+	Jobs      []healthcheckId `json:"jobs,omitempty"`
+	Groups    []string        `json:"groups,omitempty"`
+	Selector  string          `json:"selector,omitempty"`
+	Start     time.Time       `json:"start"`
+	Duration  string          `json:"duration"`
+	Every     string          `json:"every,omitempty"`
+	Until     *time.Time      `json:"until,omitempty"`
+	Mode      string          `json:"mode"`
+	CreatedAt time.Time       `json:"created_at"`
+	selector  labelSelector
+	duration  time.Duration
+	every     time.Duration
+}
+
+func (m *maintenanceWindow) validate() error {
+	var err error
+	if len(m.Jobs) == 0 && len(m.Groups) == 0 && m.Selector == "" {
+		return errors.New("a maintenance window needs jobs, groups or a selector")
+	}
+	for _, group := range m.Groups {
+		if group == "" {
+			return errors.New("invalid group, must not be empty")
+		}
+	}
+	if m.Selector != "" {
+		m.selector, err = parseLabelSelector(m.Selector)
+		if err != nil {
+			return err
+		}
+	}
+	if m.Start.IsZero() {
+		return errors.New("start is required")
+	}
+	m.duration, err = time.ParseDuration(m.Duration)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", m.Duration, err)
+	}
+	if m.duration <= 0 {
+		return fmt.Errorf("invalid duration %q, must be positive", m.Duration)
+	}
+	if m.Every != "" {
+		m.every, err = time.ParseDuration(m.Every)
+		if err != nil {
+			return fmt.Errorf("invalid every %q: %w", m.Every, err)
+		}
+		if m.every < m.duration || m.every < minMaintenanceEvery {
+			return fmt.Errorf("invalid every %q, must be at least the duration and %s", m.Every, minMaintenanceEvery)
+		}
+	}
+	if m.Until != nil && !m.Until.After(m.Start) {
+		return errors.New("until must be after start")
+	}
+	switch m.Mode {
+	case "":
+		m.Mode = maintenanceSuppress
+	case maintenanceSuppress, maintenanceSkip:
+	default:
+		return fmt.Errorf("invalid mode %q, expected suppress or skip", m.Mode)
+	}
+	return nil
+}
+
+// The ways a maintenance window may cover a check.
+const (
+	maintenanceViaJob      = "job"
+	maintenanceViaGroup    = "group"
+	maintenanceViaSelector = "selector"
+)
+
+// appliesTo reports whether the window covers a check.
+func (m *maintenanceWindow) appliesTo(healthcheck HealthcheckQuery) bool {
+	return m.via(healthcheck) != ""
+}
+
+// via returns how the window covers a check: by being given the check
+// itself, its group or a selector matching its labels, in that order. It
+// is empty if the window doesn't cover the check.
+func (m *maintenanceWindow) via(healthcheck HealthcheckQuery) string {
+	for _, id := range m.Jobs {
+		if id == healthcheck.Id {
+			return maintenanceViaJob
+		}
+	}
+	for _, group := range m.Groups {
+		if healthcheck.Group == group {
+			return maintenanceViaGroup
+		}
+	}
+	if m.selector != nil && m.selector.matches(healthcheck.Labels) {
+		return maintenanceViaSelector
+	}
+	return ""
+}
+
+// active reports whether the window is open at now.
+func (m *maintenanceWindow) active(now time.Time) bool {
+	if now.Before(m.Start) || m.Until != nil && !now.Before(*m.Until) {
+		return false
+	}
+	offset := now.Sub(m.Start)
+	if m.every > 0 {
+		offset %= m.every
+	}
+	return offset < m.duration
+}
+
+// periods returns when the window is open between from and to, oldest
+// first.
+func (m *maintenanceWindow) periods(from, to time.Time) [][2]time.Time {
+	var periods [][2]time.Time
+	n := 0
+	if m.every > 0 && from.After(m.Start) {
+		n = int(from.Sub(m.Start) / m.every)
+	}
+	for ; ; n++ {
+		start := m.Start.Add(time.Duration(n) * m.every)
+		if !start.Before(to) || m.Until != nil && !start.Before(*m.Until) {
+			break
+		}
+		end := start.Add(m.duration)
+		if m.Until != nil && end.After(*m.Until) {
+			end = *m.Until
+		}
+		if end.After(from) {
+			periods = append(periods, [2]time.Time{maxTime(start, from), minTime(end, to)})
+		}
+		if m.every == 0 {
+			break
+		}
+	}
+	return periods
+}
+
+// maintenanceWindows keeps the maintenance windows checks are under.
+type maintenanceWindows struct {
+	mu      sync.Mutex
+	windows map[string]*maintenanceWindow
+}
+
+func newMaintenanceWindows() *maintenanceWindows {
+	return &maintenanceWindows{windows: make(map[string]*maintenanceWindow)}
+}
+
+func (w *maintenanceWindows) add(m *maintenanceWindow) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.windows[m.Id] = m
+}
+
+func (w *maintenanceWindows) get(id string) (*maintenanceWindow, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	m, ok := w.windows[id]
+	return m, ok
+}
+
+func (w *maintenanceWindows) remove(id string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, ok := w.windows[id]
+	delete(w.windows, id)
+	return ok
+}
+
+// list returns the windows, by when they start.
+func (w *maintenanceWindows) list() []*maintenanceWindow {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	list := make([]*maintenanceWindow, 0, len(w.windows))
+	for _, m := range w.windows {
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].Start.Equal(list[j].Start) {
+			return list[i].Start.Before(list[j].Start)
+		}
+		return list[i].Id < list[j].Id
+	})
+	return list
+}
+
+// forget drops a deleted check from the windows, and the windows that
+// only applied to it.
+func (w *maintenanceWindows) forget(id healthcheckId) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for windowId, m := range w.windows {
+		jobs := make([]healthcheckId, 0, len(m.Jobs))
+		for _, job := range m.Jobs {
+			if job != id {
+				jobs = append(jobs, job)
+			}
+		}
+		if len(jobs) == len(m.Jobs) {
+			continue
+		}
+		if len(jobs) == 0 && len(m.Groups) == 0 && m.selector == nil {
+			delete(w.windows, windowId)
+			continue
+		}
+		// Windows are shared with readers, so they are replaced rather
+		// than changed.
+		updated := *m
+		updated.Jobs = jobs
+		w.windows[windowId] = &updated
+	}
+}
+
+// activeFor returns the window a check is under at now, if any. Skipping
+// the check wins over suppressing its failures.
+func (w *maintenanceWindows) activeFor(healthcheck HealthcheckQuery, now time.Time) *maintenanceWindow {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var active *maintenanceWindow
+	for _, m := range w.windows {
+		if !m.appliesTo(healthcheck) || !m.active(now) {
+			continue
+		}
+		if active == nil || m.Mode == maintenanceSkip && active.Mode != maintenanceSkip {
+			active = m
+		}
+	}
+	return active
+}
+
+// periods returns when a check was under maintenance between from and to,
+// oldest first, overlapping windows being merged.
+func (w *maintenanceWindows) periods(healthcheck HealthcheckQuery, from, to time.Time) [][2]time.Time {
+	w.mu.Lock()
+	var periods [][2]time.Time
+	for _, m := range w.windows {
+		if m.appliesTo(healthcheck) {
+			periods = append(periods, m.periods(from, to)...)
+		}
+	}
+	w.mu.Unlock()
+	sort.Slice(periods, func(i, j int) bool {
+		return periods[i][0].Before(periods[j][0])
+	})
+	merged := periods[:0]
+	for _, p := range periods {
+		if last := len(merged) - 1; last >= 0 && !p[0].After(merged[last][1]) {
+			merged[last][1] = maxTime(merged[last][1], p[1])
+			continue
+		}
+		merged = append(merged, p)
+	}
+	return merged
+}
+
+// overlap returns how much of from to to the periods, which don't overlap
+// each other, cover.
+func overlap(from, to time.Time, periods [][2]time.Time) time.Duration {
+	var covered time.Duration
+	for _, p := range periods {
+		start, end := maxTime(p[0], from), minTime(p[1], to)
+		if end.After(start) {
+			covered += end.Sub(start)
+		}
+	}
+	return covered
+}
+
+// skipForMaintenance records a run of a check skipped as it is under
+// maintenance, without probing its target.
+func (h *HealthcheckServer) skipForMaintenance(job *healthcheckJob, healthcheck HealthcheckQuery, window *maintenanceWindow, now time.Time) {
+	if !job.lastRun.IsZero() {
+		// Runs skipped for maintenance aren't missed.
+		job.lastRun = now
+		h.config.JobStore.saveLastRun(healthcheck.Id, now)
+	}
+	_, correlationId := withCorrelationId(context.Background())
+	resp := HealthcheckResponse{
+		State:         stateMaintenance,
+		Reason:        reasonMaintenance,
+		CorrelationId: correlationId,
+		Timestamp:     now,
+		Source:        h.config.Source,
+		Maintenance:   window.Id,
+	}
+	h.bus.publish(busEvent{Type: busCheckCompleted, Job: healthcheck, Time: now, Result: resp})
+	if h.shouldLogResult(resp, false) {
+		h.logResult(healthcheck, resp)
+	}
+}
+
+// maintenanceWindowView is a maintenance window as listed, with whether it
+// is open and, when listed for a check, how it covers the check.
+type maintenanceWindowView struct {
+	*maintenanceWindow
+	Active bool   `json:"active"`
+	Via    string `json:"via,omitempty"`
+}
+
+// handleGetJobMaintenance serves GET /jobs/{id}/maintenance, the
+// maintenance windows a check is under, whether given the check itself or
+// inherited from its group or labels.
+func (h *HealthcheckServer) handleGetJobMaintenance(w http.ResponseWriter, r *http.Request, jobId healthcheckId) {
+	healthcheck, ok := h.GetHealthcheck(jobId)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	now := h.clock.Now()
+	views := []maintenanceWindowView{}
+	for _, m := range h.maintenance.list() {
+		if via := m.via(healthcheck); via != "" {
+			views = append(views, maintenanceWindowView{m, m.active(now), via})
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(views)
+}
+
+var maintenancePathRegex = regexp.MustCompile("^/maintenance/([0-9a-f-]+)$")
+
+// handleMaintenance serves /maintenance, where GET lists the maintenance
+// windows and POST adds one, and /maintenance/{id}, where GET returns a
+// window and DELETE removes it. Checks are given in jobs by id or alias.
+func (h *HealthcheckServer) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/maintenance" || r.URL.Path == "/maintenance/":
+		switch r.Method {
+		case http.MethodGet:
+			now := h.clock.Now()
+			views := []maintenanceWindowView{}
+			for _, m := range h.maintenance.list() {
+				views = append(views, maintenanceWindowView{maintenanceWindow: m, Active: m.active(now)})
+			}
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(views)
+		case http.MethodPost:
+			var m maintenanceWindow
+			err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&m)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			err = m.validate()
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			for i, job := range m.Jobs {
+				id, ok := h.resolveId(string(job))
+				if !ok {
+					writeError(w, http.StatusBadRequest, fmt.Errorf("unknown job %q", job))
+					return
+				}
+				m.Jobs[i] = id
+			}
+			m.Id = newUUID()
+			m.CreatedAt = h.clock.Now()
+			h.maintenance.add(&m)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(maintenanceWindowView{maintenanceWindow: &m, Active: m.active(m.CreatedAt)})
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	case maintenancePathRegex.MatchString(r.URL.Path):
+		id := maintenancePathRegex.FindStringSubmatch(r.URL.Path)[1]
+		switch r.Method {
+		case http.MethodGet:
+			m, ok := h.maintenance.get(id)
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(maintenanceWindowView{maintenanceWindow: m, Active: m.active(h.clock.Now())})
+		case http.MethodDelete:
+			if !h.maintenance.remove(id) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
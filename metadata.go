@@ -0,0 +1,216 @@
+package uptime
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// actorHeader names who makes a request, e.g. set by a proxy that
+// authenticates users. It is recorded as the creator of new checks, unless
+// the request was authenticated with an API key, whose name is.
+const actorHeader = "X-Requested-By"
+
+func requestActor(r *http.Request) string {
+	if name := requestKey(r); name != "" {
+		return name
+	}
+	return r.Header.Get(actorHeader)
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// restoreMetadata reads back the metadata of a stored check, which isn't
+// accepted from API input.
+func (h *HealthcheckQuery) restoreMetadata(definition []byte) error {
+	var metadata struct {
+		CreatedAt  *time.Time `json:"created_at"`
+		UpdatedAt  *time.Time `json:"updated_at"`
+		CreatedBy  string     `json:"created_by"`
+		ArchivedAt *time.Time `json:"archived_at"`
+		ResumeAt   *time.Time `json:"resume_at"`
+		Version    int        `json:"version"`
+	}
+	err := json.Unmarshal(definition, &metadata)
+	if err != nil {
+		return err
+	}
+	if metadata.CreatedAt != nil {
+		h.CreatedAt = *metadata.CreatedAt
+	}
+	if metadata.UpdatedAt != nil {
+		h.UpdatedAt = *metadata.UpdatedAt
+	}
+	h.CreatedBy = metadata.CreatedBy
+	if metadata.ArchivedAt != nil {
+		h.ArchivedAt = *metadata.ArchivedAt
+	}
+	if metadata.ResumeAt != nil {
+		h.ResumeAt = *metadata.ResumeAt
+	}
+	// Checks stored before versions were kept start over at 1.
+	h.Version = max(metadata.Version, 1)
+	return nil
+}
+
+var (
+	errJobNotFound      = errors.New("no such check")
+	errVersionConflict  = errors.New("the check was changed since the version this update is based on")
+	errVersionRequired  = errors.New("updates must be based on the check's current version, given in an If-Match header or as version")
+	errInvalidCondition = errors.New("invalid If-Match header, expected the ETag of a check's version or *")
+)
+
+// versionETag is the entity tag of a check's version.
+func versionETag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// versionPrecondition is the versions of a check an update may apply to.
+// A nil precondition allows any.
+type versionPrecondition struct {
+	any      bool
+	versions []int
+}
+
+func (p *versionPrecondition) matches(version int) bool {
+	if p == nil || p.any {
+		return true
+	}
+	for _, v := range p.versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePrecondition reads the versions an update may apply to from an
+// If-Match header, a list of ETags or *, or else from the version in the
+// request's body. It returns nil if there is neither.
+func parsePrecondition(ifMatch string, body []byte) (*versionPrecondition, error) {
+	if ifMatch = strings.TrimSpace(ifMatch); ifMatch != "" {
+		if ifMatch == "*" {
+			return &versionPrecondition{any: true}, nil
+		}
+		var p versionPrecondition
+		for _, tag := range strings.Split(ifMatch, ",") {
+			// Weak tags never match under If-Match's strong comparison.
+			tag = strings.TrimSpace(tag)
+			if strings.HasPrefix(tag, "W/") {
+				continue
+			}
+			tag, err := strconv.Unquote(tag)
+			if err != nil {
+				return nil, errInvalidCondition
+			}
+			version, err := strconv.Atoi(tag)
+			if err != nil {
+				return nil, errInvalidCondition
+			}
+			p.versions = append(p.versions, version)
+		}
+		return &p, nil
+	}
+	var given struct {
+		Version *int `json:"version"`
+	}
+	err := json.Unmarshal(body, &given)
+	if err != nil || given.Version == nil {
+		return nil, nil
+	}
+	return &versionPrecondition{versions: []int{*given.Version}}, nil
+}
+
+// jobFilter selects checks by their metadata. Zero fields don't filter.
+type jobFilter struct {
+	createdSince  time.Time
+	createdBefore time.Time
+	updatedSince  time.Time
+	updatedBefore time.Time
+	createdBy     string
+	hasCreatedBy  bool
+	archived      *bool
+	tags          []string
+}
+
+// parseJobFilter reads a filter from the query parameters created_since,
+// created_before, updated_since and updated_before, each an RFC 3339 time
+// or a duration before now (e.g. 24h), created_by, archived and tag, which
+// may be repeated for checks having every one of the tags.
+func parseJobFilter(query url.Values, now time.Time) (jobFilter, error) {
+	var filter jobFilter
+	for _, param := range []struct {
+		name string
+		dst  *time.Time
+	}{
+		{"created_since", &filter.createdSince},
+		{"created_before", &filter.createdBefore},
+		{"updated_since", &filter.updatedSince},
+		{"updated_before", &filter.updatedBefore},
+	} {
+		value := query.Get(param.name)
+		if value == "" {
+			continue
+		}
+		t, err := parseTimeOrAgo(value, now)
+		if err != nil {
+			return jobFilter{}, fmt.Errorf("%s must be an RFC 3339 time or a duration", param.name)
+		}
+		*param.dst = t
+	}
+	filter.createdBy = query.Get("created_by")
+	filter.hasCreatedBy = query.Has("created_by")
+	if value := query.Get("archived"); value != "" {
+		archived, err := strconv.ParseBool(value)
+		if err != nil {
+			return jobFilter{}, errors.New("archived must be true or false")
+		}
+		filter.archived = &archived
+	}
+	filter.tags = query["tag"]
+	return filter, nil
+}
+
+func parseTimeOrAgo(value string, now time.Time) (time.Time, error) {
+	if ago, err := time.ParseDuration(value); err == nil {
+		return now.Add(-ago), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// matches tells whether a check passes the filter. Checks created before
+// their metadata was kept only pass filters that don't involve it.
+func (f jobFilter) matches(healthcheck HealthcheckQuery) bool {
+	if !f.createdSince.IsZero() && healthcheck.CreatedAt.Before(f.createdSince) {
+		return false
+	}
+	if !f.createdBefore.IsZero() && (healthcheck.CreatedAt.IsZero() || !healthcheck.CreatedAt.Before(f.createdBefore)) {
+		return false
+	}
+	if !f.updatedSince.IsZero() && healthcheck.UpdatedAt.Before(f.updatedSince) {
+		return false
+	}
+	if !f.updatedBefore.IsZero() && (healthcheck.UpdatedAt.IsZero() || !healthcheck.UpdatedAt.Before(f.updatedBefore)) {
+		return false
+	}
+	if f.hasCreatedBy && healthcheck.CreatedBy != f.createdBy {
+		return false
+	}
+	if f.archived != nil && *f.archived == healthcheck.ArchivedAt.IsZero() {
+		return false
+	}
+	if !healthcheck.hasTags(f.tags) {
+		return false
+	}
+	return true
+}
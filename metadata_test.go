@@ -0,0 +1,98 @@
+package uptime
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePrecondition(t *testing.T) {
+	tests := []struct {
+		ifMatch string
+		body    string
+		// matches lists which of versions 1 to 3 the precondition allows,
+		// nil if there is none.
+		matches []bool
+		err     error
+	}{
+		{`"2"`, `{}`, []bool{false, true, false}, nil},
+		{`"1", "3"`, `{"version":2}`, []bool{true, false, true}, nil},
+		{`*`, `{}`, []bool{true, true, true}, nil},
+		{`W/"2"`, `{}`, []bool{false, false, false}, nil},
+		{``, `{"version":3}`, []bool{false, false, true}, nil},
+		{``, `{}`, nil, nil},
+		{`2`, `{}`, nil, errInvalidCondition},
+		{`"two"`, `{}`, nil, errInvalidCondition},
+	}
+	for _, test := range tests {
+		p, err := parsePrecondition(test.ifMatch, []byte(test.body))
+		if err != test.err {
+			t.Errorf("If-Match %q, body %s: got error %v, want %v", test.ifMatch, test.body, err, test.err)
+			continue
+		}
+		if (p == nil) != (test.matches == nil) {
+			t.Errorf("If-Match %q, body %s: got precondition %v, want one: %t", test.ifMatch, test.body, p, test.matches != nil)
+			continue
+		}
+		for i, want := range test.matches {
+			if got := p.matches(i + 1); got != want {
+				t.Errorf("If-Match %q, body %s: version %d matches: %t, want %t", test.ifMatch, test.body, i+1, got, want)
+			}
+		}
+	}
+}
+
+func TestPutJobVersions(t *testing.T) {
+	h, _ := newTestServer(t, func(healthcheck HealthcheckQuery, ctx context.Context) HealthcheckResponse {
+		return HealthcheckResponse{Status: true}
+	})
+	healthcheck := h.AddHealthcheck(HealthcheckQuery{Url: "http://example.com", Frequency: time.Minute})
+	handler := h.Handler()
+	put := func(id healthcheckId, ifMatch string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPut, "/jobs/"+string(id), strings.NewReader(body))
+		if ifMatch != "" {
+			r.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	steps := []struct {
+		ifMatch string
+		body    string
+		status  int
+		etag    string
+	}{
+		{"", `{"url":"http://example.com","expected_status":200,"frequency":"1m"}`, http.StatusPreconditionRequired, ""},
+		{`"1"`, `{"url":"http://example.com/a","expected_status":200,"frequency":"1m"}`, http.StatusOK, `"2"`},
+		// Based on a version since changed.
+		{`"1"`, `{"url":"http://example.com/b","expected_status":200,"frequency":"1m"}`, http.StatusConflict, `"2"`},
+		{"", `{"url":"http://example.com/b","expected_status":200,"frequency":"1m","version":1}`, http.StatusConflict, `"2"`},
+		{"", `{"url":"http://example.com/b","expected_status":200,"frequency":"1m","version":2}`, http.StatusOK, `"3"`},
+		// If-Match takes precedence over the body's version.
+		{`"2"`, `{"url":"http://example.com/c","expected_status":200,"frequency":"1m","version":3}`, http.StatusConflict, `"3"`},
+		{`*`, `{"url":"http://example.com/c","expected_status":200,"frequency":"1m"}`, http.StatusOK, `"4"`},
+		{`4`, `{"url":"http://example.com/d","expected_status":200,"frequency":"1m"}`, http.StatusBadRequest, ""},
+	}
+	for i, step := range steps {
+		w := put(healthcheck.Id, step.ifMatch, step.body)
+		if w.Code != step.status {
+			t.Fatalf("step %d: got status %d, want %d: %s", i, w.Code, step.status, w.Body)
+		}
+		if etag := w.Header().Get("ETag"); etag != step.etag {
+			t.Errorf("step %d: got ETag %s, want %s", i, etag, step.etag)
+		}
+	}
+	got, _ := h.GetHealthcheck(healthcheck.Id)
+	if got.Url != "http://example.com/c" || got.Version != 4 {
+		t.Errorf("got %s at version %d, want http://example.com/c at version 4", got.Url, got.Version)
+	}
+
+	if w := put(newHealthcheckId(), "*", `{"url":"http://example.com","expected_status":200,"frequency":"1m"}`); w.Code != http.StatusNotFound {
+		t.Errorf("got status %d for an unknown check, want 404", w.Code)
+	}
+}
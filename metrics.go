@@ -0,0 +1,248 @@
+package uptime
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// connectionStats tracks the probe client's connection pool. Go's
+// transport doesn't expose its pool, so connections are counted as they
+// are dialed and closed, and reuse is observed through httptrace.
+type connectionStats struct {
+	open   atomic.Int64
+	dialed atomic.Int64
+	reused atomic.Int64
+	closed atomic.Int64
+}
+
+var probeConnStats connectionStats
+
+type countedConn struct {
+	net.Conn
+	stats  *connectionStats
+	closed atomic.Bool
+}
+
+func (c *countedConn) Close() error {
+	if c.closed.CompareAndSwap(false, true) {
+		c.stats.open.Add(-1)
+		c.stats.closed.Add(1)
+	}
+	return c.Conn.Close()
+}
+
+func (s *connectionStats) wrapDial(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		s.open.Add(1)
+		s.dialed.Add(1)
+		return &countedConn{Conn: conn, stats: s}, nil
+	}
+}
+
+func (s *connectionStats) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				s.reused.Add(1)
+			}
+		},
+	}
+}
+
+func newProbeTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = probeConnStats.wrapDial(func(ctx context.Context, network string, address string) (net.Conn, error) {
+		// Enforces address policies and source addresses; see
+		// probeDialer.
+		dialer, err := probeDialer(ctx, network)
+		if err != nil {
+			return nil, err
+		}
+		dialer.Timeout = 30 * time.Second
+		dialer.KeepAlive = 30 * time.Second
+		conn, err := dialer.DialContext(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		return countTransfer(ctx, conn), nil
+	})
+	return t
+}
+
+// checkSeries is the latest state of a single check, as exported to
+// Prometheus.
+type checkSeries struct {
+	url    string
+	method string
+	// source is where the check's results come from, this server.
+	source   ResultSource
+	up       bool
+	state    resultState
+	duration time.Duration
+	failures int64
+	// notifications and notificationFailures count the notifications
+	// sent about the check, and those that failed.
+	notifications        int64
+	notificationFailures int64
+}
+
+// checkMetrics keeps the per-check series exported on /metrics.
+type checkMetrics struct {
+	mu     sync.Mutex
+	series map[healthcheckId]*checkSeries
+}
+
+func newCheckMetrics() *checkMetrics {
+	return &checkMetrics{series: make(map[healthcheckId]*checkSeries)}
+}
+
+func (m *checkMetrics) record(healthcheck HealthcheckQuery, resp HealthcheckResponse) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.series[healthcheck.Id]
+	if !ok {
+		s = &checkSeries{}
+		m.series[healthcheck.Id] = s
+	}
+	s.url = healthcheck.Url
+	s.method = healthcheck.Method
+	s.source = resp.Source
+	s.duration = resp.Duration
+	s.state = resp.state()
+	// Neutral results say nothing about whether the target is up.
+	if resp.neutral() {
+		return
+	}
+	s.up = resp.Status
+	if !resp.Status {
+		s.failures++
+	}
+}
+
+// recordNotification counts a notification sent about a check still being
+// followed.
+func (m *checkMetrics) recordNotification(id healthcheckId, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.series[id]
+	if !ok {
+		return
+	}
+	s.notifications++
+	if err != nil {
+		s.notificationFailures++
+	}
+}
+
+func (m *checkMetrics) forget(id healthcheckId) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.series, id)
+}
+
+// writeMetrics writes a series per check, labeled by its url, method and
+// id, and by the location, environment and instance running it, so that
+// series scraped from several servers can be told apart.
+func (m *checkMetrics) writeMetrics(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ids := make([]healthcheckId, 0, len(m.series))
+	for id := range m.series {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	labels := func(id healthcheckId) string {
+		s := m.series[id]
+		return fmt.Sprintf("{url=%s,method=%s,id=%s,location=%s,environment=%s,instance=%s}",
+			strconv.Quote(s.url), strconv.Quote(s.method), strconv.Quote(string(id)),
+			strconv.Quote(s.source.Location), strconv.Quote(s.source.Environment), strconv.Quote(s.source.InstanceId))
+	}
+
+	fmt.Fprintf(w, "# HELP uptime_check_up Whether the check passed on its last run.\n")
+	fmt.Fprintf(w, "# TYPE uptime_check_up gauge\n")
+	for _, id := range ids {
+		up := 0
+		if m.series[id].up {
+			up = 1
+		}
+		fmt.Fprintf(w, "uptime_check_up%s %d\n", labels(id), up)
+	}
+	fmt.Fprintf(w, "# HELP uptime_check_state The state of the check's last result, 1 for the series of that state.\n")
+	fmt.Fprintf(w, "# TYPE uptime_check_state gauge\n")
+	for _, id := range ids {
+		for _, state := range []resultState{stateUp, stateDown, stateDegraded, stateMaintenance, stateSkipped, stateUnknown} {
+			value := 0
+			if m.series[id].state == state {
+				value = 1
+			}
+			fmt.Fprintf(w, "uptime_check_state%s %d\n", strings.TrimSuffix(labels(id), "}")+",state="+strconv.Quote(string(state))+"}", value)
+		}
+	}
+	fmt.Fprintf(w, "# HELP uptime_check_duration_seconds How long the check's last run took.\n")
+	fmt.Fprintf(w, "# TYPE uptime_check_duration_seconds gauge\n")
+	for _, id := range ids {
+		fmt.Fprintf(w, "uptime_check_duration_seconds%s %s\n", labels(id), formatMetricValue(m.series[id].duration.Seconds()))
+	}
+	fmt.Fprintf(w, "# HELP uptime_check_failures_total Runs of the check that failed.\n")
+	fmt.Fprintf(w, "# TYPE uptime_check_failures_total counter\n")
+	for _, id := range ids {
+		fmt.Fprintf(w, "uptime_check_failures_total%s %d\n", labels(id), m.series[id].failures)
+	}
+	fmt.Fprintf(w, "# HELP uptime_check_notifications_total Notifications sent about the check.\n")
+	fmt.Fprintf(w, "# TYPE uptime_check_notifications_total counter\n")
+	for _, id := range ids {
+		fmt.Fprintf(w, "uptime_check_notifications_total%s %d\n", labels(id), m.series[id].notifications)
+	}
+	fmt.Fprintf(w, "# HELP uptime_check_notification_failures_total Notifications about the check that failed to be delivered.\n")
+	fmt.Fprintf(w, "# TYPE uptime_check_notification_failures_total counter\n")
+	for _, id := range ids {
+		fmt.Fprintf(w, "uptime_check_notification_failures_total%s %d\n", labels(id), m.series[id].notificationFailures)
+	}
+}
+
+func writeMetric(w io.Writer, name string, kind string, help string, value int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+	fmt.Fprintf(w, "%s %d\n", name, value)
+}
+
+func writeFloatMetric(w io.Writer, name string, kind string, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+	fmt.Fprintf(w, "%s %s\n", name, formatMetricValue(value))
+}
+
+// handleMetrics serves metrics in the Prometheus text exposition format.
+func (h *HealthcheckServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	stats := h.scheduler.stats()
+	writeMetric(w, "uptime_probes_running", "gauge", "Probes currently running.", int64(stats.Running))
+	writeMetric(w, "uptime_probes_waiting", "gauge", "Due probes waiting for a free worker.", int64(stats.Waiting))
+	writeMetric(w, "uptime_probes_skipped_total", "counter", "Runs skipped because the check was still waiting or running when next due.", stats.Skipped)
+	writeMetric(w, "uptime_http_connections_open", "gauge", "Probe connections currently open.", probeConnStats.open.Load())
+	writeMetric(w, "uptime_http_connections_dialed_total", "counter", "Probe connections dialed.", probeConnStats.dialed.Load())
+	writeMetric(w, "uptime_http_connections_closed_total", "counter", "Probe connections closed.", probeConnStats.closed.Load())
+	writeMetric(w, "uptime_http_connections_reused_total", "counter", "Probe requests that reused a pooled connection.", probeConnStats.reused.Load())
+	h.config.RunBudget.writeMetrics(w)
+	h.metrics.writeMetrics(w)
+	h.transfers.writeMetrics(w)
+	h.config.RecordingRules.writeMetrics(w)
+}
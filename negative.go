@@ -0,0 +1,21 @@
+package uptime
+
+import "context"
+
+// expectFailure inverts the result of a check that is meant to fail, e.g.
+// to verify that an internal endpoint isn't reachable from where the
+// checker runs: the check is up when the target can't be reached or fails
+// its assertions, and down when it passes them. Neutral results, e.g.
+// throttled ones, are left alone, as they say nothing either way.
+func (h HealthcheckQuery) expectFailure(ctx context.Context, result HealthcheckResponse) HealthcheckResponse {
+	if result.neutral() {
+		return result
+	}
+	if result.Status {
+		inverted := failCheckReason(ctx, reasonUnexpectedSuccess, "Expected failure, but the check passed")
+		inverted.Dial = result.Dial
+		inverted.StatusCode = result.StatusCode
+		return inverted
+	}
+	return HealthcheckResponse{Status: true, StatusCode: result.StatusCode, Dial: result.Dial}
+}
@@ -0,0 +1,235 @@
+package uptime
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// notificationChannels are where transitions are announced, and the
+// locales Slack messages and emails are worded in.
+type notificationChannels struct {
+	Webhooks     []string `yaml:"webhooks"`
+	SlackWebhook string   `yaml:"slack_webhook"`
+	SlackLocale  string   `yaml:"slack_locale"`
+	EmailTo      []string `yaml:"email_to"`
+	EmailLocale  string   `yaml:"email_locale"`
+}
+
+// override returns c with the channels other sets replaced.
+func (c notificationChannels) override(other notificationChannels) notificationChannels {
+	if len(other.Webhooks) > 0 {
+		c.Webhooks = other.Webhooks
+	}
+	if other.SlackWebhook != "" {
+		c.SlackWebhook = other.SlackWebhook
+	}
+	if other.SlackLocale != "" {
+		c.SlackLocale = other.SlackLocale
+	}
+	if len(other.EmailTo) > 0 {
+		c.EmailTo = other.EmailTo
+	}
+	if other.EmailLocale != "" {
+		c.EmailLocale = other.EmailLocale
+	}
+	return c
+}
+
+func (c *notificationChannels) normalize() error {
+	for i, url := range c.Webhooks {
+		normalized, err := normalizeURL(url)
+		if err != nil {
+			return err
+		}
+		c.Webhooks[i] = normalized
+	}
+	if c.SlackWebhook != "" {
+		normalized, err := normalizeURL(c.SlackWebhook)
+		if err != nil {
+			return err
+		}
+		c.SlackWebhook = normalized
+	}
+	for _, address := range c.EmailTo {
+		if !strings.Contains(address, "@") {
+			return fmt.Errorf("invalid email address %q", address)
+		}
+	}
+	err := validateAlertLocale(c.SlackLocale)
+	if err != nil {
+		return fmt.Errorf("slack_locale: %w", err)
+	}
+	err = validateAlertLocale(c.EmailLocale)
+	if err != nil {
+		return fmt.Errorf("email_locale: %w", err)
+	}
+	return nil
+}
+
+// escalationStep notifies more channels once a check has been down, and
+// its incident unacknowledged, for After.
+type escalationStep struct {
+	After                time.Duration `yaml:"after"`
+	notificationChannels `yaml:",inline"`
+}
+
+// notificationPolicy is the default channels of a namespace's checks, and
+// how their incidents are escalated. Warnings are where their warnings go;
+// see WarningChannels. Priorities, by check priority, change the channels
+// and escalation of the namespace's checks of that priority: channels they
+// set replace the namespace's, and so does their escalation, if set, even
+// to none.
+type notificationPolicy struct {
+	notificationChannels `yaml:",inline"`
+	Escalation           []escalationStep               `yaml:"escalation"`
+	Warnings             notificationChannels           `yaml:"warnings"`
+	Priorities           map[string]*notificationPolicy `yaml:"priorities"`
+	// byPriority are the policies of the namespace's checks of each
+	// priority that has one, Priorities applied.
+	byPriority map[checkPriority]*notificationPolicy
+}
+
+// notificationPolicies are the notification policies of namespaces. Checks
+// inherit their namespace's channels, unless they set their own.
+type notificationPolicies struct {
+	namespaces map[string]*notificationPolicy
+}
+
+type notificationPoliciesFile struct {
+	Namespaces map[string]*notificationPolicy `yaml:"namespaces"`
+}
+
+func readNotificationPolicies(path string) (*notificationPolicies, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file notificationPoliciesFile
+	err = yaml.Unmarshal(data, &file)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notification policies: %w", err)
+	}
+	for name, policy := range file.Namespaces {
+		if policy == nil {
+			return nil, fmt.Errorf("namespace %q: empty policy", name)
+		}
+		err = policy.validate()
+		if err != nil {
+			return nil, fmt.Errorf("namespace %q: %w", name, err)
+		}
+		policy.byPriority = make(map[checkPriority]*notificationPolicy)
+		for text, override := range policy.Priorities {
+			var priority checkPriority
+			err = priority.UnmarshalText([]byte(text))
+			if err == nil && (override == nil || len(override.Priorities) > 0) {
+				err = errors.New("expected channels or an escalation")
+			}
+			if err == nil {
+				override = policy.apply(override)
+				err = override.validate()
+			}
+			if err != nil {
+				return nil, fmt.Errorf("namespace %q: priority %s: %w", name, text, err)
+			}
+			policy.byPriority[priority] = override
+		}
+	}
+	return &notificationPolicies{namespaces: file.Namespaces}, nil
+}
+
+// apply returns the policy of checks of a priority with the override
+// policy.
+func (p *notificationPolicy) apply(override *notificationPolicy) *notificationPolicy {
+	applied := &notificationPolicy{
+		notificationChannels: p.notificationChannels.override(override.notificationChannels),
+		Escalation:           append([]escalationStep{}, p.Escalation...),
+		Warnings:             p.Warnings.override(override.Warnings),
+	}
+	if override.Escalation != nil {
+		applied.Escalation = override.Escalation
+	}
+	return applied
+}
+
+func (p *notificationPolicy) validate() error {
+	err := p.normalize()
+	if err != nil {
+		return err
+	}
+	err = p.Warnings.normalize()
+	if err != nil {
+		return fmt.Errorf("warnings: %w", err)
+	}
+	for i := range p.Escalation {
+		step := &p.Escalation[i]
+		if step.After <= 0 {
+			return fmt.Errorf("escalation %d: after must be positive", i+1)
+		}
+		err = step.normalize()
+		if err != nil {
+			return fmt.Errorf("escalation %d: %w", i+1, err)
+		}
+		if len(step.Webhooks) == 0 && step.SlackWebhook == "" && len(step.EmailTo) == 0 {
+			return fmt.Errorf("escalation %d: no channels", i+1)
+		}
+		// Escalations are worded like the namespace's alerts, unless
+		// they say otherwise.
+		step.notificationChannels = notificationChannels{SlackLocale: p.SlackLocale, EmailLocale: p.EmailLocale}.override(step.notificationChannels)
+	}
+	sort.SliceStable(p.Escalation, func(i, j int) bool {
+		return p.Escalation[i].After < p.Escalation[j].After
+	})
+	return nil
+}
+
+// forCheck returns the policy of a check's namespace, for checks of its
+// priority, or nil.
+func (p *notificationPolicies) forCheck(healthcheck HealthcheckQuery) *notificationPolicy {
+	if p == nil {
+		return nil
+	}
+	policy := p.namespaces[healthcheck.Namespace]
+	if policy == nil {
+		return nil
+	}
+	if byPriority, ok := policy.byPriority[healthcheck.Priority]; ok {
+		return byPriority
+	}
+	return policy
+}
+
+// usesEmail tells whether any policy emails anyone.
+func (p *notificationPolicies) usesEmail() bool {
+	if p == nil {
+		return false
+	}
+	for _, policy := range p.namespaces {
+		if policy.usesEmail() {
+			return true
+		}
+		for _, byPriority := range policy.byPriority {
+			if byPriority.usesEmail() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *notificationPolicy) usesEmail() bool {
+	if len(p.EmailTo) > 0 || len(p.Warnings.EmailTo) > 0 {
+		return true
+	}
+	for _, step := range p.Escalation {
+		if len(step.EmailTo) > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package uptime
+
+import (
+	"fmt"
+	"time"
+)
+
+// oneShotFrequency is the frequency of one-shot checks that don't set
+// one, which only bounds their retries.
+const oneShotFrequency = time.Hour
+
+// validateRunAt rejects a RunAt already past at now: the check would run
+// one frequency from now instead, which isn't what was asked for.
+func (h HealthcheckQuery) validateRunAt(now time.Time) error {
+	if !h.RunAt.IsZero() && h.RunAt.Before(now) {
+		return fmt.Errorf("run_at %s is in the past", h.RunAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// done reports whether the job ran as many times as it may. The
+// scheduler's mu must be held.
+func (j *healthcheckJob) done() bool {
+	return j.healthcheck.MaxRuns > 0 && j.runs >= j.healthcheck.MaxRuns
+}
+
+// ranOut reports whether the job ran as many times as it may.
+func (s *scheduler) ranOut(job *healthcheckJob) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return job.done()
+}
+
+// countRun counts a run of the job towards its MaxRuns, unless it ran out
+// of them, and returns how many times it ran.
+func (s *scheduler) countRun(job *healthcheckJob) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job.done() {
+		return job.runs, false
+	}
+	job.runs++
+	return job.runs, true
+}
+
+// resetRuns lets the job run MaxRuns times again, e.g. once it is resumed.
+func (s *scheduler) resetRuns(job *healthcheckJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job.runs = 0
+}
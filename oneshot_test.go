@@ -0,0 +1,90 @@
+package uptime
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCreateJobRunAt(t *testing.T) {
+	h, _ := newTestServer(t, func(healthcheck HealthcheckQuery, ctx context.Context) HealthcheckResponse {
+		return HealthcheckResponse{Status: true}
+	})
+	handler := h.Handler()
+	tests := []struct {
+		runAt  string
+		status int
+	}{
+		{"1999-12-31T23:59:00Z", http.StatusBadRequest},
+		{"2000-01-01T00:05:00Z", http.StatusCreated},
+		{"2000-01-01T00:00:00Z", http.StatusCreated},
+	}
+	for _, test := range tests {
+		body := `{"url":"http://203.0.113.1","expected_status":200,"max_runs":1,"run_at":"` + test.runAt + `"}`
+		r := httptest.NewRequest(http.MethodPost, "/jobs?force=true", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Errorf("run_at %s: got status %d, want %d: %s", test.runAt, w.Code, test.status, w.Body)
+		}
+	}
+}
+
+func TestMaxRunsStored(t *testing.T) {
+	store, err := openJobStore(filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.close()
+	var runs atomic.Int32
+	check := func(healthcheck HealthcheckQuery, ctx context.Context) HealthcheckResponse {
+		runs.Add(1)
+		return HealthcheckResponse{Status: true}
+	}
+	step := func(h *HealthcheckServer, clk *simulatedClock) {
+		clk.Advance(time.Minute)
+		h.scheduler.dispatchDue()
+		h.scheduler.waitIdle()
+	}
+	h, clk := newConfiguredTestServer(t, Config{SuppressNotifications: true, JobStore: store}, check)
+	healthcheck := h.AddHealthcheck(HealthcheckQuery{Type: "http", Url: "http://203.0.113.1", ExpectedStatus: 200, Frequency: time.Minute, MaxRuns: 3})
+	step(h, clk)
+	step(h, clk)
+
+	// A server restarted on the same database runs the check once more.
+	restarted, clk := newConfiguredTestServer(t, Config{SuppressNotifications: true, JobStore: store}, check)
+	restored, err := store.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, healthcheck := range restored {
+		restarted.RestoreHealthcheck(healthcheck)
+	}
+	archived := func() bool {
+		current, _ := restarted.GetHealthcheck(healthcheck.Id)
+		return current.Paused && !current.ArchivedAt.IsZero()
+	}
+	step(restarted, clk)
+	if !eventually(archived) {
+		t.Fatalf("the check wasn't archived after %d runs, want 3", runs.Load())
+	}
+	step(restarted, clk)
+	if runs.Load() != 3 {
+		t.Fatalf("got %d runs, want 3", runs.Load())
+	}
+
+	// Resuming it runs it max_runs times again.
+	restarted.setJobPaused(healthcheck.Id, false, time.Time{})
+	step(restarted, clk)
+	if runs.Load() != 4 {
+		t.Errorf("got %d runs after resuming, want 4", runs.Load())
+	}
+	if stored := store.runs(healthcheck.Id); stored != 1 {
+		t.Errorf("got %d runs stored after resuming, want 1", stored)
+	}
+}
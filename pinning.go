@@ -0,0 +1,36 @@
+package uptime
+
+import (
+	"fmt"
+	"path"
+)
+
+// allowedAt reports whether the check may run from a probe location. A
+// check with Locations only runs from locations matching one of them, and
+// never from locations matching one of its ExcludeLocations. Patterns are
+// globs, e.g. "eu-*".
+func (h HealthcheckQuery) allowedAt(location string) bool {
+	for _, pattern := range h.ExcludeLocations {
+		if ok, _ := path.Match(pattern, location); ok {
+			return false
+		}
+	}
+	if len(h.Locations) == 0 {
+		return true
+	}
+	for _, pattern := range h.Locations {
+		if ok, _ := path.Match(pattern, location); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func validateLocationPatterns(field string, patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return fmt.Errorf("invalid %s pattern %q", field, pattern)
+		}
+	}
+	return nil
+}
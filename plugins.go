@@ -0,0 +1,388 @@
+package uptime
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"golang.org/x/exp/slog"
+)
+
+// Plugins are WebAssembly modules, loaded from the plugins directory,
+// that implement check types or notifiers. Every call runs in a fresh
+// instance of the module, without access to the filesystem or the
+// environment, and is interrupted at its deadline.
+//
+// A plugin exports alloc(size i32) i32, which returns a buffer the host
+// writes the call's JSON input to, and either or both of:
+//
+//	check(ptr, len i32) i64    runs a check; the plugin is a check type
+//	                           named after its file, e.g. redis.wasm
+//	notify(ptr, len i32) i64   turns a state transition into the HTTP
+//	                           request announcing it
+//
+// Both return their JSON output as ptr<<32 | len. Check plugins may use
+// the host functions of the "uptime" module to talk to their targets over
+// TCP, subject to the address policy like any other check.
+const (
+	pluginModule = "uptime"
+	// maxPluginConns bounds the connections a single call may open.
+	maxPluginConns = 16
+	// maxPluginOutput caps the output of a call.
+	maxPluginOutput = 1 << 20
+)
+
+// builtinCheckTypes can't be taken by plugins.
+var builtinCheckTypes = map[string]bool{
+	checkTypeHttp:        true,
+	checkTypeS3:          true,
+	checkTypeDoH:         true,
+	checkTypeDoT:         true,
+	checkTypeDNS:         true,
+	checkTypeTCP:         true,
+	checkTypeICMP:        true,
+	checkTypeTLS:         true,
+	checkTypeTransaction: true,
+}
+
+// checkPlugins are the check types implemented by plugins, by name. They
+// are loaded on startup, before any check is.
+var checkPlugins = map[string]*wasmPlugin{}
+
+type wasmPlugin struct {
+	name     string
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+	checker  bool
+	notifier bool
+}
+
+// pluginCheckOutput is what a check plugin returns. A state, if given,
+// takes precedence over up.
+type pluginCheckOutput struct {
+	Up         bool   `json:"up"`
+	State      string `json:"state"`
+	Reason     string `json:"reason"`
+	Error      string `json:"error"`
+	StatusCode int    `json:"status_code"`
+}
+
+// pluginRequest is what a notify plugin returns: the request the host
+// sends for it. An empty url sends nothing.
+type pluginRequest struct {
+	Url     string            `json:"url"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
+
+// loadPlugins compiles every .wasm file in dir, registering check plugins
+// in checkPlugins, and returns the notifier plugins.
+func loadPlugins(dir string) ([]*wasmPlugin, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.wasm"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	ctx := context.Background()
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCloseOnContextDone(true))
+	wasi_snapshot_preview1.MustInstantiate(ctx, runtime)
+	err = instantiatePluginHost(ctx, runtime)
+	if err != nil {
+		return nil, err
+	}
+
+	var notifiers []*wasmPlugin
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".wasm")
+		code, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		compiled, err := runtime.CompileModule(ctx, code)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		exports := compiled.ExportedFunctions()
+		p := &wasmPlugin{name: name, runtime: runtime, compiled: compiled}
+		_, p.checker = exports["check"]
+		_, p.notifier = exports["notify"]
+		if _, ok := exports["alloc"]; !ok || !p.checker && !p.notifier {
+			return nil, fmt.Errorf("%s: a plugin must export alloc, and check or notify", path)
+		}
+		if p.checker {
+			if builtinCheckTypes[name] {
+				return nil, fmt.Errorf("%s: %q is a built-in check type", path, name)
+			}
+			checkPlugins[name] = p
+		}
+		if p.notifier {
+			notifiers = append(notifiers, p)
+		}
+		slog.Info("plugin-loaded", slog.String("name", name), slog.Bool("checker", p.checker), slog.Bool("notifier", p.notifier))
+	}
+	return notifiers, nil
+}
+
+// normalizePluginURL only requires plugin check URLs to be absolute, as
+// plugins may speak any protocol.
+func normalizePluginURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid url %q: %w", raw, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid url %q: expected scheme://host", raw)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	return u.String(), nil
+}
+
+// call runs one of the plugin's exports on input in a new instance.
+func (p *wasmPlugin) call(ctx context.Context, export string, input []byte) ([]byte, error) {
+	state := &pluginCall{plugin: p}
+	defer state.close()
+	ctx = context.WithValue(ctx, pluginCallKey{}, state)
+	config := wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions("_initialize").
+		WithStdout(os.Stderr).
+		WithStderr(os.Stderr)
+	mod, err := p.runtime.InstantiateModule(ctx, p.compiled, config)
+	if err != nil {
+		return nil, err
+	}
+	defer mod.Close(ctx)
+
+	results, err := mod.ExportedFunction("alloc").Call(ctx, uint64(len(input)))
+	if err != nil {
+		return nil, err
+	}
+	ptr := uint32(results[0])
+	if !mod.Memory().Write(ptr, input) {
+		return nil, errors.New("alloc returned an invalid buffer")
+	}
+	results, err = mod.ExportedFunction(export).Call(ctx, uint64(ptr), uint64(len(input)))
+	if err != nil {
+		return nil, err
+	}
+	outPtr, outLen := uint32(results[0]>>32), uint32(results[0])
+	if outLen > maxPluginOutput {
+		return nil, fmt.Errorf("output of %d bytes is too large", outLen)
+	}
+	output, ok := mod.Memory().Read(outPtr, outLen)
+	if !ok {
+		return nil, errors.New("returned an invalid buffer")
+	}
+	return bytes.Clone(output), nil
+}
+
+// checkPlugin runs a check implemented by a plugin, which is given the
+// check as its input.
+func (h HealthcheckQuery) checkPlugin(ctx context.Context, p *wasmPlugin) HealthcheckResponse {
+	input, err := json.Marshal(struct {
+		Job HealthcheckQuery `json:"job"`
+	}{h})
+	if err != nil {
+		return failCheck(ctx, "%v", err)
+	}
+	timeout := h.timeout()
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	data, err := p.call(callCtx, "check", input)
+	if err != nil {
+		return failCheck(ctx, "Plugin %s failed: %v", p.name, err)
+	}
+	var output pluginCheckOutput
+	err = json.Unmarshal(data, &output)
+	if err != nil {
+		return failCheck(ctx, "Plugin %s returned invalid output: %v", p.name, err)
+	}
+	result := HealthcheckResponse{Status: true, Error: output.Error}
+	if output.State != "" {
+		result.State, err = parseResultState(output.State)
+		if err != nil {
+			return failCheck(ctx, "Plugin %s returned invalid output: %v", p.name, err)
+		}
+		result.Status = result.State == stateUp || result.State == stateDegraded
+	} else if !output.Up {
+		if output.Error == "" {
+			output.Error = "Check failed"
+		}
+		result = failCheck(ctx, "%s", output.Error)
+	}
+	if output.Reason != "" {
+		result.Reason = output.Reason
+	}
+	result.StatusCode = output.StatusCode
+	return result
+}
+
+// deliver has the plugin turn a transition into a request, and sends it.
+func (p *wasmPlugin) deliver(payload []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookClient.Timeout)
+	defer cancel()
+	data, err := p.call(ctx, "notify", payload)
+	if err != nil {
+		return err
+	}
+	var request pluginRequest
+	err = json.Unmarshal(data, &request)
+	if err != nil {
+		return fmt.Errorf("invalid output: %w", err)
+	}
+	if request.Url == "" {
+		return nil
+	}
+	if request.Method == "" {
+		request.Method = http.MethodPost
+	}
+	req, err := http.NewRequestWithContext(ctx, request.Method, request.Url, strings.NewReader(request.Body))
+	if err != nil {
+		return err
+	}
+	for name, value := range request.Headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBytes))
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+type pluginCallKey struct{}
+
+// pluginCall is the state of a single call: the connections the plugin
+// opened, and the last error a host function ran into.
+type pluginCall struct {
+	plugin  *wasmPlugin
+	conns   []net.Conn
+	lastErr string
+}
+
+func (c *pluginCall) close() {
+	for _, conn := range c.conns {
+		if conn != nil {
+			conn.Close()
+		}
+	}
+}
+
+func (c *pluginCall) fail(err error) int32 {
+	c.lastErr = err.Error()
+	return -1
+}
+
+func (c *pluginCall) conn(handle int32) net.Conn {
+	if handle < 0 || int(handle) >= len(c.conns) {
+		return nil
+	}
+	return c.conns[handle]
+}
+
+func pluginCallState(ctx context.Context) *pluginCall {
+	return ctx.Value(pluginCallKey{}).(*pluginCall)
+}
+
+// instantiatePluginHost provides the host functions plugins may import.
+// Functions that fail return -1, and last_error copies why into a buffer.
+func instantiatePluginHost(ctx context.Context, runtime wazero.Runtime) error {
+	_, err := runtime.NewHostModuleBuilder(pluginModule).
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, ptr, length uint32) {
+		state := pluginCallState(ctx)
+		msg, _ := m.Memory().Read(ptr, length)
+		slog.Info("plugin-log", slog.String("plugin", state.plugin.name), slog.String("message", string(msg)))
+	}).Export("log").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, ptr, length uint32) int32 {
+		msg := pluginCallState(ctx).lastErr
+		if len(msg) > int(length) {
+			msg = msg[:length]
+		}
+		m.Memory().Write(ptr, []byte(msg))
+		return int32(len(msg))
+	}).Export("last_error").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, ptr, length uint32) int32 {
+		state := pluginCallState(ctx)
+		addr, ok := m.Memory().Read(ptr, length)
+		if !ok {
+			return state.fail(errors.New("invalid address buffer"))
+		}
+		if len(state.conns) >= maxPluginConns {
+			return state.fail(errors.New("too many connections"))
+		}
+		dialer, err := probeDialer(ctx, "tcp")
+		if err != nil {
+			return state.fail(err)
+		}
+		conn, err := dialer.DialContext(ctx, "tcp", string(addr))
+		if err != nil {
+			return state.fail(err)
+		}
+		conn = countTransfer(ctx, conn)
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+		state.conns = append(state.conns, conn)
+		return int32(len(state.conns) - 1)
+	}).Export("conn_dial").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, handle int32, ptr, length uint32) int32 {
+		state := pluginCallState(ctx)
+		conn := state.conn(handle)
+		data, ok := m.Memory().Read(ptr, length)
+		if conn == nil || !ok {
+			return state.fail(errors.New("invalid connection or buffer"))
+		}
+		n, err := conn.Write(data)
+		if err != nil {
+			return state.fail(err)
+		}
+		return int32(n)
+	}).Export("conn_write").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, handle int32, ptr, length uint32) int32 {
+		state := pluginCallState(ctx)
+		conn := state.conn(handle)
+		if conn == nil {
+			return state.fail(errors.New("invalid connection"))
+		}
+		buf := make([]byte, length)
+		// 0 bytes read means the connection was closed.
+		n, err := conn.Read(buf)
+		if err != nil && err != io.EOF {
+			return state.fail(err)
+		}
+		if !m.Memory().Write(ptr, buf[:n]) {
+			return state.fail(errors.New("invalid buffer"))
+		}
+		return int32(n)
+	}).Export("conn_read").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, handle int32) {
+		state := pluginCallState(ctx)
+		if conn := state.conn(handle); conn != nil {
+			conn.Close()
+			state.conns[handle] = nil
+		}
+	}).Export("conn_close").
+		Instantiate(ctx)
+	return err
+}
@@ -0,0 +1,39 @@
+package uptime
+
+import "fmt"
+
+type checkPriority int
+
+const (
+	priorityLow checkPriority = iota - 1
+	priorityNormal
+	priorityHigh
+)
+
+var priorityNames = map[checkPriority]string{
+	priorityLow:    "low",
+	priorityNormal: "normal",
+	priorityHigh:   "high",
+}
+
+func (p checkPriority) String() string {
+	return priorityNames[p]
+}
+
+func (p checkPriority) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *checkPriority) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*p = priorityNormal
+		return nil
+	}
+	for priority, name := range priorityNames {
+		if name == string(text) {
+			*p = priority
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid priority %q, expected one of low, normal, high", text)
+}
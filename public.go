@@ -0,0 +1,199 @@
+package uptime
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"time"
+)
+
+const jwsSignatureHeader = "X-JWS-Signature"
+
+// jwsSigner signs public API responses with a detached JWS (RFC 7515,
+// appendix F) using Ed25519, so that consumers can verify status data
+// wasn't altered on its way to them.
+type jwsSigner struct {
+	key ed25519.PrivateKey
+	kid string
+}
+
+func newJWSSigner(key ed25519.PrivateKey) *jwsSigner {
+	s := &jwsSigner{key: key}
+	s.kid = s.thumbprint()
+	return s
+}
+
+// readSigningKey reads an Ed25519 private key from a PKCS #8 PEM file, as
+// written by `openssl genpkey -algorithm ed25519`.
+func readSigningKey(path string) (*jwsSigner, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T, expected ed25519", key)
+	}
+	return newJWSSigner(edKey), nil
+}
+
+func generateSigningKey() (*jwsSigner, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return newJWSSigner(key), nil
+}
+
+func (s *jwsSigner) publicJWK() map[string]string {
+	return map[string]string{
+		"kty": "OKP",
+		"crv": "Ed25519",
+		"x":   base64.RawURLEncoding.EncodeToString(s.key.Public().(ed25519.PublicKey)),
+	}
+}
+
+// thumbprint is the key's RFC 7638 thumbprint, used as its key id.
+func (s *jwsSigner) thumbprint() string {
+	jwk := s.publicJWK()
+	// The members must be in lexicographic order, without whitespace.
+	canonical := `{"crv":"` + jwk["crv"] + `","kty":"` + jwk["kty"] + `","x":"` + jwk["x"] + `"}`
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// sign returns a detached JWS of payload: the compact serialization with
+// an empty payload part.
+func (s *jwsSigner) sign(payload []byte) string {
+	header, _ := json.Marshal(map[string]string{"alg": "EdDSA", "kid": s.kid})
+	protected := base64.RawURLEncoding.EncodeToString(header)
+	input := protected + "." + base64.RawURLEncoding.EncodeToString(payload)
+	signature := ed25519.Sign(s.key, []byte(input))
+	return protected + ".." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// writeSigned writes v as JSON along with its detached signature.
+func (s *jwsSigner) writeSigned(w http.ResponseWriter, v any) {
+	var body bytes.Buffer
+	json.NewEncoder(&body).Encode(v)
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Expose-Headers", jwsSignatureHeader)
+	w.Header().Set(jwsSignatureHeader, s.sign(body.Bytes()))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body.Bytes())
+}
+
+type publicCheckStatus struct {
+	Id          healthcheckId `json:"id"`
+	Group       string        `json:"group,omitempty"`
+	Url         string        `json:"url,omitempty"`
+	Status      string        `json:"status"`
+	LastChecked *time.Time    `json:"last_checked,omitempty"`
+}
+
+type publicStatus struct {
+	GeneratedAt time.Time           `json:"generated_at"`
+	Checks      []publicCheckStatus `json:"checks"`
+}
+
+type publicUptime struct {
+	Id          healthcheckId `json:"id"`
+	GeneratedAt time.Time     `json:"generated_at"`
+	Uptime      *float64      `json:"uptime"`
+	Days        []dayRollup   `json:"days"`
+}
+
+var publicUptimePathRegex = regexp.MustCompile("^/public/jobs/([0-9a-f-]+)/uptime$")
+
+// handlePublic serves the public, read-only subset of the API, every
+// response signed. Only checks with Public set are shown, and only by id,
+// so that other checks can't be found through it:
+//
+//	GET /public/status             the current status of every public check
+//	GET /public/jobs/{id}/uptime   a public check's daily uptime
+//	GET /public/jwks.json          the key responses are signed with
+func (h *HealthcheckServer) handlePublic(w http.ResponseWriter, r *http.Request) {
+	signer := h.config.PublicSigner
+	if signer == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	now := h.clock.Now()
+	switch {
+	case r.URL.Path == "/public/jwks.json":
+		jwk := signer.publicJWK()
+		jwk["kid"] = signer.kid
+		jwk["alg"] = "EdDSA"
+		jwk["use"] = "sig"
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{jwk}})
+	case r.URL.Path == "/public/status":
+		status := publicStatus{GeneratedAt: now, Checks: []publicCheckStatus{}}
+		for _, healthcheck := range h.ListHealthchecks() {
+			if !healthcheck.Public {
+				continue
+			}
+			check := publicCheckStatus{
+				Id:     healthcheck.Id,
+				Group:  healthcheck.Group,
+				Status: "UNKNOWN",
+			}
+			if h.config.PublicURLs {
+				check.Url = healthcheck.Url
+			}
+			if resp, ok := h.rollups.latest(healthcheck.Id); ok {
+				check.Status = resp.statusString()
+				check.LastChecked = &resp.Timestamp
+			}
+			if healthcheck.Paused {
+				check.Status = "PAUSED"
+			}
+			status.Checks = append(status.Checks, check)
+		}
+		signer.writeSigned(w, status)
+	case publicUptimePathRegex.MatchString(r.URL.Path):
+		// Aliases aren't accepted, as they are easily guessed.
+		id := healthcheckId(publicUptimePathRegex.FindStringSubmatch(r.URL.Path)[1])
+		healthcheck, ok := h.GetHealthcheck(id)
+		if !ok || !healthcheck.Public {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		uptime := publicUptime{Id: id, GeneratedAt: now, Days: h.rollups.history(id, now)}
+		up, total := 0, 0
+		for _, d := range uptime.Days {
+			up += d.Up
+			total += d.Total
+		}
+		if total > 0 {
+			u := float64(up) / float64(total)
+			uptime.Uptime = &u
+		}
+		signer.writeSigned(w, uptime)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
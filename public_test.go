@@ -0,0 +1,126 @@
+package uptime
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// rfc8037Key is the Ed25519 key of RFC 8037, appendix A.1.
+func rfc8037Key(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	seed, err := base64.RawURLEncoding.DecodeString("nWGxne_9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ed25519.NewKeyFromSeed(seed)
+}
+
+func TestJWSSignerThumbprint(t *testing.T) {
+	signer := newJWSSigner(rfc8037Key(t))
+	// RFC 8037, appendices A.2 and A.3.
+	if x := signer.publicJWK()["x"]; x != "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo" {
+		t.Errorf("got x %s, want the RFC 8037 public key", x)
+	}
+	if signer.kid != "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k" {
+		t.Errorf("got kid %s, want the RFC 8037 thumbprint", signer.kid)
+	}
+}
+
+// verifyDetachedJWS verifies jws, detached from payload, with the key of
+// jwks its header names, as a consumer of the public API would.
+func verifyDetachedJWS(jwks []byte, jws string, payload []byte) error {
+	var keys struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	err := json.Unmarshal(jwks, &keys)
+	if err != nil {
+		return err
+	}
+	parts := strings.Split(jws, ".")
+	if len(parts) != 3 || parts[1] != "" {
+		return errors.New("not a detached JWS")
+	}
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return err
+	}
+	var header map[string]string
+	err = json.Unmarshal(headerJSON, &header)
+	if err != nil {
+		return err
+	}
+	if header["alg"] != "EdDSA" {
+		return fmt.Errorf("unexpected alg %q", header["alg"])
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return err
+	}
+	for _, key := range keys.Keys {
+		if key["kid"] != header["kid"] {
+			continue
+		}
+		x, err := base64.RawURLEncoding.DecodeString(key["x"])
+		if err != nil {
+			return err
+		}
+		input := parts[0] + "." + base64.RawURLEncoding.EncodeToString(payload)
+		if !ed25519.Verify(ed25519.PublicKey(x), []byte(input), signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("no key %q", header["kid"])
+}
+
+func TestPublicResponsesVerify(t *testing.T) {
+	h, _ := newTestServer(t, func(healthcheck HealthcheckQuery, ctx context.Context) HealthcheckResponse {
+		return HealthcheckResponse{Status: true}
+	})
+	h.config.PublicSigner = newJWSSigner(rfc8037Key(t))
+	healthcheck := h.AddHealthcheck(HealthcheckQuery{Url: "http://203.0.113.1", Public: true})
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: got status %d, want 200", path, w.Code)
+		}
+		return w
+	}
+	jwks := get("/public/jwks.json").Body.Bytes()
+	other, err := generateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/public/status", "/public/jobs/" + string(healthcheck.Id) + "/uptime"} {
+		w := get(path)
+		body := w.Body.Bytes()
+		jws := w.Header().Get(jwsSignatureHeader)
+		tests := []struct {
+			name    string
+			jws     string
+			payload []byte
+			valid   bool
+		}{
+			{"as served", jws, body, true},
+			{"altered payload", jws, append([]byte(" "), body...), false},
+			{"signed by another key", other.sign(body), body, false},
+			{"attached payload", strings.Replace(jws, "..", "."+base64.RawURLEncoding.EncodeToString(body)+".", 1), body, false},
+		}
+		for _, test := range tests {
+			err := verifyDetachedJWS(jwks, test.jws, test.payload)
+			if (err == nil) != test.valid {
+				t.Errorf("%s, %s: got error %v, want it to verify: %t", path, test.name, err, test.valid)
+			}
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package uptime
+
+import (
+	"errors"
+	"net/http"
+)
+
+var errReadOnly = errors.New("the server is in read-only mode, changes are rejected")
+
+// readOnlyPosts are endpoints that take a POST body without changing
+// anything, or that reject changes themselves.
+var readOnlyPosts = map[string]bool{
+	"/reconcile/diff":      true,
+	"/chatops/command":     true,
+	"/grafana/annotations": true,
+}
+
+// readOnlyJobActions are the job actions that take a POST without changing
+// anything.
+var readOnlyJobActions = map[string]bool{
+	"run": true,
+}
+
+func readOnlyJobAction(path string) bool {
+	matches := jobActionPathRegex.FindStringSubmatch(path)
+	return matches != nil && readOnlyJobActions[matches[2]]
+}
+
+// rejectMutations wraps the API so that only reads are served, used while
+// migrating or restoring a server to avoid accidental changes.
+func rejectMutations(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions:
+			next.ServeHTTP(w, r)
+		case r.Method == http.MethodPost && (readOnlyPosts[r.URL.Path] || readOnlyJobAction(r.URL.Path)):
+			next.ServeHTTP(w, r)
+		default:
+			writeError(w, http.StatusServiceUnavailable, errReadOnly)
+		}
+	})
+}
@@ -0,0 +1,226 @@
+package uptime
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxConfigBytes bounds the size of a declarative config posted to or
+// pulled by the reconcile endpoints.
+const maxConfigBytes = 10 << 20
+
+var configClient = &http.Client{
+	Timeout: 30 * time.Second,
+}
+
+// fieldChange is a single job field that differs between the running and
+// the declared check.
+type fieldChange struct {
+	From json.RawMessage `json:"from"`
+	To   json.RawMessage `json:"to"`
+}
+
+type reconcileUpdate struct {
+	Id      healthcheckId          `json:"id"`
+	Alias   int                    `json:"alias"`
+	Changes map[string]fieldChange `json:"changes"`
+}
+
+// reconcilePlan is what applying a declarative config would do to the
+// running checks.
+type reconcilePlan struct {
+	Create    []HealthcheckQuery `json:"create"`
+	Update    []reconcileUpdate  `json:"update"`
+	Delete    []HealthcheckQuery `json:"delete"`
+	Unchanged int                `json:"unchanged"`
+}
+
+// reconcileKey identifies a check across config changes: declared and
+// running checks probing the same target are the same check, and anything
+// else about them is an update.
+type reconcileKey struct {
+	namespace string
+	checkType string
+	url       string
+	method    string
+}
+
+func (h HealthcheckQuery) reconcileKey() reconcileKey {
+	return reconcileKey{h.Namespace, h.Type, h.Url, h.Method}
+}
+
+// planReconcile compares the running checks with the declared ones.
+// Declared checks sharing a key are paired with running ones in order.
+func planReconcile(running []HealthcheckQuery, declared []HealthcheckQuery) (reconcilePlan, error) {
+	plan := reconcilePlan{
+		Create: []HealthcheckQuery{},
+		Update: []reconcileUpdate{},
+		Delete: []HealthcheckQuery{},
+	}
+	byKey := make(map[reconcileKey][]HealthcheckQuery)
+	for _, healthcheck := range running {
+		key := healthcheck.reconcileKey()
+		byKey[key] = append(byKey[key], healthcheck)
+	}
+	for _, healthcheck := range declared {
+		key := healthcheck.reconcileKey()
+		candidates := byKey[key]
+		if len(candidates) == 0 {
+			plan.Create = append(plan.Create, healthcheck)
+			continue
+		}
+		existing := candidates[0]
+		byKey[key] = candidates[1:]
+		changes, err := diffHealthchecks(existing, healthcheck)
+		if err != nil {
+			return reconcilePlan{}, err
+		}
+		if len(changes) == 0 {
+			plan.Unchanged++
+			continue
+		}
+		plan.Update = append(plan.Update, reconcileUpdate{Id: existing.Id, Alias: existing.Alias, Changes: changes})
+	}
+	for _, healthcheck := range running {
+		for _, left := range byKey[healthcheck.reconcileKey()] {
+			if left.Id == healthcheck.Id {
+				plan.Delete = append(plan.Delete, healthcheck)
+			}
+		}
+	}
+	sort.Slice(plan.Delete, func(i, j int) bool {
+		return plan.Delete[i].Alias < plan.Delete[j].Alias
+	})
+	return plan, nil
+}
+
+// diffHealthchecks compares the JSON representations of two checks, so
+// that fields are compared exactly as the API shows them.
+func diffHealthchecks(from HealthcheckQuery, to HealthcheckQuery) (map[string]fieldChange, error) {
+	from.Id, from.Alias = "", 0
+	to.Id, to.Alias = "", 0
+	fromFields, err := jsonFields(from)
+	if err != nil {
+		return nil, err
+	}
+	toFields, err := jsonFields(to)
+	if err != nil {
+		return nil, err
+	}
+	changes := make(map[string]fieldChange)
+	for name := range fromFields {
+		if _, ok := toFields[name]; !ok {
+			toFields[name] = json.RawMessage("null")
+		}
+	}
+	for name, value := range toFields {
+		old, ok := fromFields[name]
+		if !ok {
+			old = json.RawMessage("null")
+		}
+		if !jsonEqual(old, value) {
+			changes[name] = fieldChange{From: old, To: value}
+		}
+	}
+	return changes, nil
+}
+
+func jsonFields(v interface{}) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]json.RawMessage)
+	err = json.Unmarshal(data, &fields)
+	return fields, err
+}
+
+func jsonEqual(a json.RawMessage, b json.RawMessage) bool {
+	var x, y interface{}
+	json.Unmarshal(a, &x)
+	json.Unmarshal(b, &y)
+	return reflect.DeepEqual(x, y)
+}
+
+// decodeDeclaredChecks decodes a checks file into checks, exactly like API
+// requests are decoded.
+func decodeDeclaredChecks(data []byte) ([]HealthcheckQuery, error) {
+	checks, err := parseChecksFile(data)
+	if err != nil {
+		return nil, err
+	}
+	declared := make([]HealthcheckQuery, len(checks))
+	for i := range checks {
+		err = json.Unmarshal(checks[i], &declared[i])
+		if err != nil {
+			return nil, fmt.Errorf("check %d: %w", i, err)
+		}
+	}
+	return declared, nil
+}
+
+// pullConfig reads the configured declarative config, from a file or an
+// http(s) URL.
+func pullConfig(source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.ReadFile(source)
+	}
+	resp, err := configClient.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: unexpected status %d", source, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxConfigBytes))
+}
+
+// handleReconcileDiff returns the plan for reconciling the running checks
+// with a declarative config, without applying it. The config is either
+// posted, or pulled from the configured source on GET.
+func (h *HealthcheckServer) handleReconcileDiff(w http.ResponseWriter, r *http.Request) {
+	var data []byte
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		if h.config.ReconcileSource == "" {
+			writeError(w, http.StatusNotFound, fmt.Errorf("no config source is configured, post the config instead"))
+			return
+		}
+		data, err = pullConfig(h.config.ReconcileSource)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+	case http.MethodPost:
+		data, err = io.ReadAll(io.LimitReader(r.Body, maxConfigBytes))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	declared, err := decodeDeclaredChecks(data)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	plan, err := planReconcile(h.ListHealthchecks(), declared)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(plan)
+}
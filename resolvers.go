@@ -0,0 +1,112 @@
+package uptime
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxResolvers is how many DNS servers a check may resolve with.
+	maxResolvers = 4
+	// resolverDialTimeout bounds connecting to one of a check's DNS
+	// servers, so that the next one is tried in time.
+	resolverDialTimeout = 2 * time.Second
+)
+
+// parseResolvers validates a check's DNS servers, addresses with an
+// optional port, 53 by default, and returns them as address:port.
+func parseResolvers(servers []string) ([]string, error) {
+	if len(servers) > maxResolvers {
+		return nil, fmt.Errorf("invalid resolvers, expected at most %d", maxResolvers)
+	}
+	var resolvers []string
+	for _, server := range servers {
+		if addr, err := netip.ParseAddr(strings.Trim(server, "[]")); err == nil {
+			resolvers = append(resolvers, netip.AddrPortFrom(addr.Unmap(), 53).String())
+			continue
+		}
+		addrPort, err := netip.ParseAddrPort(server)
+		if err != nil {
+			return nil, fmt.Errorf("invalid resolver %q, expected an IP address with an optional port", server)
+		}
+		resolvers = append(resolvers, netip.AddrPortFrom(addrPort.Addr().Unmap(), addrPort.Port()).String())
+	}
+	return resolvers, nil
+}
+
+func equalResolvers(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type resolversKey struct{}
+
+// checkResolver is the resolver of checks resolving with their own DNS
+// servers.
+type checkResolver struct {
+	servers  string
+	resolver *net.Resolver
+}
+
+// withResolvers makes checks run with ctx resolve names with the given DNS
+// servers rather than the host's.
+func withResolvers(ctx context.Context, resolvers []string) context.Context {
+	if len(resolvers) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, resolversKey{}, checkResolver{strings.Join(resolvers, ","), newResolver(resolvers)})
+}
+
+// newResolver returns a resolver querying servers. Each connection goes to
+// the next server, so that the resolver's retries fail over to it.
+func newResolver(servers []string) *net.Resolver {
+	var next atomic.Uint32
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network string, address string) (net.Conn, error) {
+			server := servers[int(next.Add(1)-1)%len(servers)]
+			dialer := net.Dialer{Timeout: resolverDialTimeout}
+			// Queries leave from the check's source address too.
+			source, err := sourceAddressFrom(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if source.IsValid() {
+				if strings.HasPrefix(network, "udp") {
+					dialer.LocalAddr = net.UDPAddrFromAddrPort(netip.AddrPortFrom(source, 0))
+				} else {
+					dialer.LocalAddr = net.TCPAddrFromAddrPort(netip.AddrPortFrom(source, 0))
+				}
+			}
+			return dialer.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// probeResolver returns the resolver checks run with ctx resolve names
+// with.
+func probeResolver(ctx context.Context) *net.Resolver {
+	if r, ok := ctx.Value(resolversKey{}).(checkResolver); ok {
+		return r.resolver
+	}
+	return net.DefaultResolver
+}
+
+// resolversFrom returns the DNS servers checks run with ctx resolve names
+// with, if they have their own.
+func resolversFrom(ctx context.Context) string {
+	r, _ := ctx.Value(resolversKey{}).(checkResolver)
+	return r.servers
+}
@@ -0,0 +1,87 @@
+package uptime
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// resultsPerJob is how many of its latest results are kept per job.
+	resultsPerJob = 1000
+	// defaultResultsLimit is how many results GET /jobs/{id}/results
+	// returns unless asked otherwise.
+	defaultResultsLimit = 100
+)
+
+// resultStore keeps the latest results of every job in memory.
+type resultStore struct {
+	mu      sync.Mutex
+	results map[healthcheckId][]HealthcheckResponse
+}
+
+func newResultStore() *resultStore {
+	return &resultStore{results: make(map[healthcheckId][]HealthcheckResponse)}
+}
+
+func (s *resultStore) record(id healthcheckId, resp HealthcheckResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	results := append(s.results[id], resp)
+	if len(results) > resultsPerJob {
+		results = results[len(results)-resultsPerJob:]
+	}
+	s.results[id] = results
+}
+
+// list returns up to limit of a job's results from since on, newest first.
+func (s *resultStore) list(id healthcheckId, since time.Time, limit int) []HealthcheckResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	results := s.results[id]
+	list := []HealthcheckResponse{}
+	for i := len(results) - 1; i >= 0 && len(list) < limit; i-- {
+		if results[i].Timestamp.Before(since) {
+			break
+		}
+		list = append(list, results[i])
+	}
+	return list
+}
+
+func (s *resultStore) forget(id healthcheckId) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.results, id)
+}
+
+// handleGetJobResults serves GET /jobs/{id}/results. The limit parameter
+// caps how many results are returned, and since, an RFC 3339 time, leaves
+// out older ones.
+func (h *HealthcheckServer) handleGetJobResults(w http.ResponseWriter, r *http.Request, jobId healthcheckId) {
+	limit := defaultResultsLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, errors.New("limit must be a positive integer"))
+			return
+		}
+		limit = n
+	}
+	var since time.Time
+	if s := r.URL.Query().Get("since"); s != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("since must be an RFC 3339 time"))
+			return
+		}
+	}
+	results := h.results.list(jobId, since, limit)
+	h.annotations.annotate(jobId, results)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(results)
+}
@@ -0,0 +1,117 @@
+package uptime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	defaultRetryInterval = time.Second
+	maxRetries           = 5
+)
+
+// parseRetries validates a check's retries, which must all fit within its
+// frequency, and its down frequency if it has one.
+func (h *HealthcheckQuery) parseRetries(retries int, interval string) error {
+	if retries < 0 || retries > maxRetries {
+		return fmt.Errorf("invalid retries %d, expected 0 to %d", retries, maxRetries)
+	}
+	h.Retries = retries
+	h.RetryInterval = 0
+	if interval == "" {
+		if retries > 0 {
+			h.RetryInterval = defaultRetryInterval
+		}
+		return nil
+	}
+	if retries == 0 {
+		return fmt.Errorf("retry_interval requires retries")
+	}
+	var err error
+	h.RetryInterval, err = time.ParseDuration(interval)
+	if err != nil {
+		return fmt.Errorf("invalid retry_interval %q: %w", interval, err)
+	}
+	if h.RetryInterval <= 0 {
+		return fmt.Errorf("invalid retry_interval %q, must be positive", interval)
+	}
+	limit := h.Frequency
+	if h.DownFrequency > 0 && h.DownFrequency < limit {
+		limit = h.DownFrequency
+	}
+	if wait := h.RetryInterval * (1<<retries - 1); wait >= limit {
+		return fmt.Errorf("%d retries wait %s in all, which must be less than %s, how often the check runs", retries, wait, limit)
+	}
+	return nil
+}
+
+// transientError tells whether the first error among args is a network
+// blip worth retrying right away: a DNS lookup that timed out or failed
+// temporarily, or a connection reset or aborted.
+func transientError(args []interface{}) bool {
+	for _, arg := range args {
+		err, ok := arg.(error)
+		if !ok {
+			continue
+		}
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) {
+			return !dnsErr.IsNotFound && (dnsErr.IsTimeout || dnsErr.IsTemporary)
+		}
+		return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNABORTED)
+	}
+	return false
+}
+
+// probe runs a check, and retries it while it fails, up to its Retries,
+// with its retry interval doubling after each retry. Only the last
+// attempt's result is kept. Transient network errors are retried right
+// away, up to the server's TransientRetries per run, as they say nothing
+// about the target.
+func (h *HealthcheckServer) probe(healthcheck HealthcheckQuery, ctx context.Context) HealthcheckResponse {
+	transientRetries := 0
+	attempt := func() HealthcheckResponse {
+		resp := h.check(healthcheck, ctx)
+		for resp.transient && transientRetries < h.config.TransientRetries && ctx.Err() == nil {
+			transientRetries++
+			h.logger.Info("healthcheck-retrying-transient",
+				slog.String("url", healthcheck.Url),
+				slog.String("correlation-id", correlationId(ctx)),
+				slog.Int("retry", transientRetries),
+				slog.String("error", resp.Error),
+			)
+			resp = h.check(healthcheck, ctx)
+		}
+		return resp
+	}
+	resp := attempt()
+	wait := healthcheck.RetryInterval
+	for retry := 1; retry <= healthcheck.Retries && !resp.Status && !resp.neutral(); retry++ {
+		h.logger.Info("healthcheck-retrying",
+			slog.String("url", healthcheck.Url),
+			slog.String("correlation-id", correlationId(ctx)),
+			slog.Int("retry", retry),
+			slog.String("error", resp.Error),
+		)
+		timer := h.clock.NewTimer(wait)
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			// The run is cancelled, e.g. as its job was removed.
+			timer.Stop()
+			resp.TransientRetries = transientRetries
+			return resp
+		}
+		wait *= 2
+		resp = attempt()
+		resp.Retries = retry
+	}
+	resp.TransientRetries = transientRetries
+	return resp
+}
@@ -0,0 +1,126 @@
+package uptime
+
+import (
+	"sync"
+	"time"
+)
+
+// rollupDays is how many days of daily uptime are kept per job.
+const rollupDays = 90
+
+type dayRollup struct {
+	Day   time.Time `json:"day"`
+	Up    int       `json:"up"`
+	Total int       `json:"total"`
+}
+
+// uptime returns the fraction of successful checks, or -1 if there were
+// none.
+func (d dayRollup) uptime() float64 {
+	if d.Total == 0 {
+		return -1
+	}
+	return float64(d.Up) / float64(d.Total)
+}
+
+// uptimeRollups aggregates results into per-day counters, which is enough
+// to render long uptime histories without keeping every result. Neutral
+// results, e.g. throttled ones, don't count either way; degraded ones
+// count as up. Counters imported from other tools are kept apart, so that
+// importing again replaces them.
+type uptimeRollups struct {
+	mu       sync.Mutex
+	days     map[healthcheckId][]dayRollup
+	imported map[healthcheckId][]dayRollup
+	last     map[healthcheckId]HealthcheckResponse
+}
+
+func newUptimeRollups() *uptimeRollups {
+	return &uptimeRollups{
+		days:     make(map[healthcheckId][]dayRollup),
+		imported: make(map[healthcheckId][]dayRollup),
+		last:     make(map[healthcheckId]HealthcheckResponse),
+	}
+}
+
+func (u *uptimeRollups) record(id healthcheckId, resp HealthcheckResponse) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.last[id] = resp
+	if resp.neutral() {
+		return
+	}
+	day := truncateToDay(resp.Timestamp)
+	days := u.days[id]
+	if len(days) == 0 || days[len(days)-1].Day.Before(day) {
+		days = append(days, dayRollup{Day: day})
+		if len(days) > rollupDays {
+			days = days[len(days)-rollupDays:]
+		}
+	}
+	today := &days[len(days)-1]
+	today.Total++
+	if resp.Status {
+		today.Up++
+	}
+	u.days[id] = days
+}
+
+// backfill replaces the counters imported for a job.
+func (u *uptimeRollups) backfill(id healthcheckId, days []dayRollup) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if len(days) > rollupDays {
+		days = days[len(days)-rollupDays:]
+	}
+	u.imported[id] = days
+}
+
+func (u *uptimeRollups) latest(id healthcheckId) (HealthcheckResponse, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	resp, ok := u.last[id]
+	return resp, ok
+}
+
+// history returns one rollup per day for the last rollupDays days ending
+// at now, oldest first, including days without any results.
+func (u *uptimeRollups) history(id healthcheckId, now time.Time) []dayRollup {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	byDay := make(map[time.Time]dayRollup)
+	for _, d := range u.imported[id] {
+		byDay[d.Day] = d
+	}
+	for _, d := range u.days[id] {
+		if imported, ok := byDay[d.Day]; ok {
+			d.Up += imported.Up
+			d.Total += imported.Total
+		}
+		byDay[d.Day] = d
+	}
+	today := truncateToDay(now)
+	history := make([]dayRollup, rollupDays)
+	for i := range history {
+		day := today.AddDate(0, 0, i-rollupDays+1)
+		d, ok := byDay[day]
+		if !ok {
+			d = dayRollup{Day: day}
+		}
+		history[i] = d
+	}
+	return history
+}
+
+func (u *uptimeRollups) forget(id healthcheckId) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.days, id)
+	delete(u.imported, id)
+	delete(u.last, id)
+}
+
+func truncateToDay(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,239 @@
+package uptime
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/itchyny/gojq"
+	"golang.org/x/exp/slog"
+	"gopkg.in/yaml.v3"
+)
+
+var metricNameRegex = regexp.MustCompile("^[a-zA-Z_:][a-zA-Z0-9_:]*$")
+var labelNameRegex = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
+
+// recordingRule derives a series from the latest result of every check.
+// Expr is a jq expression run on the list of {"job": ..., "result": ...}
+// events, like those sent to result subscriptions, and must produce a
+// number. With By set, checks are partitioned by that job field and one
+// series is recorded per value, labelled with it.
+type recordingRule struct {
+	Record string `yaml:"record" json:"record"`
+	Expr   string `yaml:"expr" json:"expr"`
+	By     string `yaml:"by,omitempty" json:"by,omitempty"`
+	query  *gojq.Query
+}
+
+type recordingRulesFile struct {
+	Interval string          `yaml:"interval"`
+	Rules    []recordingRule `yaml:"rules"`
+}
+
+// ruleSeries is a single value recorded by a rule.
+type ruleSeries struct {
+	Record      string            `json:"record"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Value       float64           `json:"value"`
+	EvaluatedAt time.Time         `json:"evaluated_at"`
+}
+
+type recordingRules struct {
+	logger   *slog.Logger
+	interval time.Duration
+	rules    []recordingRule
+	mu       sync.Mutex
+	series   []ruleSeries
+}
+
+func readRecordingRules(path string) (*recordingRules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file recordingRulesFile
+	err = yaml.Unmarshal(data, &file)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recording rules: %w", err)
+	}
+	rules := &recordingRules{logger: slog.Default(), interval: time.Minute, rules: file.Rules}
+	if file.Interval != "" {
+		rules.interval, err = time.ParseDuration(file.Interval)
+		if err != nil {
+			return nil, err
+		}
+		if rules.interval <= 0 {
+			return nil, fmt.Errorf("invalid interval %q, must be positive", file.Interval)
+		}
+	}
+	for i := range rules.rules {
+		rule := &rules.rules[i]
+		if !metricNameRegex.MatchString(rule.Record) {
+			return nil, fmt.Errorf("rule %d: invalid record %q", i, rule.Record)
+		}
+		if rule.By != "" && !labelNameRegex.MatchString(rule.By) {
+			return nil, fmt.Errorf("rule %d: invalid by %q", i, rule.By)
+		}
+		rule.query, err = gojq.Parse(rule.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: invalid expr: %w", i, err)
+		}
+	}
+	return rules, nil
+}
+
+// evaluateRules periodically evaluates every recording rule.
+func (h *HealthcheckServer) evaluateRules() {
+	h.config.RecordingRules.evaluate(h.latestEvents(), h.clock.Now())
+	ticker := time.NewTicker(h.config.RecordingRules.interval)
+	defer ticker.Stop()
+	for tick(ticker, h.done) {
+		h.config.RecordingRules.evaluate(h.latestEvents(), h.clock.Now())
+	}
+}
+
+// latestEvents returns the latest result of every check that has one, in
+// the generic form jq expressions are run on.
+func (h *HealthcheckServer) latestEvents() []interface{} {
+	var events []interface{}
+	for _, healthcheck := range h.ListHealthchecks() {
+		resp, ok := h.rollups.latest(healthcheck.Id)
+		if !ok {
+			continue
+		}
+		data, err := json.Marshal(resultEvent{Job: healthcheck, Result: resp})
+		if err != nil {
+			continue
+		}
+		var event interface{}
+		json.Unmarshal(data, &event)
+		events = append(events, event)
+	}
+	return events
+}
+
+func (r *recordingRules) evaluate(events []interface{}, now time.Time) {
+	var series []ruleSeries
+	for _, rule := range r.rules {
+		partitions := map[string][]interface{}{"": events}
+		if rule.By != "" {
+			partitions = make(map[string][]interface{})
+			for _, event := range events {
+				key := eventLabel(event, rule.By)
+				partitions[key] = append(partitions[key], event)
+			}
+		}
+		for key, partition := range partitions {
+			if partition == nil {
+				partition = []interface{}{}
+			}
+			value, err := evaluateRule(rule.query, partition)
+			if err != nil {
+				r.logger.Warn("recording-rule-failed", slog.String("record", rule.Record), slog.String("error", err.Error()))
+				continue
+			}
+			s := ruleSeries{Record: rule.Record, Value: value, EvaluatedAt: now}
+			if rule.By != "" {
+				s.Labels = map[string]string{rule.By: key}
+			}
+			series = append(series, s)
+		}
+	}
+	sort.SliceStable(series, func(i, j int) bool {
+		if series[i].Record != series[j].Record {
+			return series[i].Record < series[j].Record
+		}
+		return fmt.Sprint(series[i].Labels) < fmt.Sprint(series[j].Labels)
+	})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.series = series
+}
+
+// eventLabel returns the job field an event is partitioned by as a
+// string.
+func eventLabel(event interface{}, field string) string {
+	job, _ := event.(map[string]interface{})["job"].(map[string]interface{})
+	switch v := job[field].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+func evaluateRule(query *gojq.Query, input []interface{}) (float64, error) {
+	v, ok := query.Run(input).Next()
+	if !ok {
+		return 0, fmt.Errorf("expr produced no value")
+	}
+	switch v := v.(type) {
+	case error:
+		return 0, v
+	case int:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	default:
+		return 0, fmt.Errorf("expr produced %v, expected a number", v)
+	}
+}
+
+func (r *recordingRules) list() []ruleSeries {
+	if r == nil {
+		return []ruleSeries{}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]ruleSeries{}, r.series...)
+}
+
+// writeMetrics writes the recorded series in the Prometheus text format.
+func (r *recordingRules) writeMetrics(w io.Writer) {
+	var last string
+	for _, s := range r.list() {
+		if s.Record != last {
+			fmt.Fprintf(w, "# TYPE %s gauge\n", s.Record)
+			last = s.Record
+		}
+		// Rules record at most one label, the one they partition by.
+		var labels string
+		for name, value := range s.Labels {
+			labels = fmt.Sprintf("{%s=%s}", name, strconv.Quote(value))
+		}
+		fmt.Fprintf(w, "%s%s %s\n", s.Record, labels, formatMetricValue(s.Value))
+	}
+}
+
+func formatMetricValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func (h *HealthcheckServer) handleRules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(h.config.RecordingRules.list())
+}
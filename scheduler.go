@@ -0,0 +1,380 @@
+package uptime
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// scheduler runs every job from a single goroutine and a fixed pool of
+// workers, instead of a goroutine and ticker per job, so that an idle job
+// costs a heap entry and the process only wakes up when something is due.
+// Jobs wait in a min-heap keyed by their next run; due jobs are queued for
+// the workers highest priority first, and in the order they became due
+// within a priority.
+type scheduler struct {
+	clock   Clock
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending pendingJobs
+	ready   readyJobs
+	seq     uint64
+	running int
+	workers int
+	skipped int64
+	stopped bool
+	wake    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newScheduler(clock Clock) *scheduler {
+	s := &scheduler{
+		clock: clock,
+		wake:  make(chan struct{}, 1),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// start runs the scheduler with the given number of workers, each calling
+// run for the jobs it picks up.
+func (s *scheduler) start(workers int, run func(*healthcheckJob)) {
+	s.startWorkers(workers, run)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.loop()
+	}()
+}
+
+// startWorkers only starts the workers, leaving it to the caller to
+// dispatch due jobs.
+func (s *scheduler) startWorkers(workers int, run func(*healthcheckJob)) {
+	if workers < 1 {
+		workers = 1
+	}
+	s.mu.Lock()
+	s.workers += workers
+	s.mu.Unlock()
+	s.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer s.wg.Done()
+			s.work(run)
+		}()
+	}
+}
+
+// wait blocks for as long as the scheduler runs, i.e. until it is stopped
+// once it has been started.
+func (s *scheduler) wait() {
+	s.wg.Wait()
+}
+
+// stop makes the scheduler stop dispatching jobs, and its workers return
+// once done with the job they are running.
+func (s *scheduler) stop() {
+	s.mu.Lock()
+	s.stopped = true
+	s.cond.Broadcast()
+	s.mu.Unlock()
+	s.poke()
+}
+
+// add schedules the job's first run at its RunAt if that is still to
+// come, one frequency from now otherwise, unless it is already scheduled or
+// was removed.
+func (s *scheduler) add(job *healthcheckJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job.removed || job.pendingIndex >= 0 {
+		return
+	}
+	job.interval = job.healthcheck.Frequency
+	job.next = s.clock.Now().Add(job.interval)
+	if runAt := job.healthcheck.RunAt; runAt.After(s.clock.Now()) {
+		job.next = runAt
+	}
+	heap.Push(&s.pending, job)
+	if job.pendingIndex == 0 {
+		s.poke()
+	}
+}
+
+// remove unschedules the job, and waits for a run of it already in
+// progress to finish. The job never runs again afterwards.
+func (s *scheduler) remove(job *healthcheckJob) {
+	s.unschedule(job)
+	job.inFlight.Wait()
+}
+
+// unschedule is remove without waiting: it returns whether a run of the
+// job is in progress, which job.inFlight waits for, e.g. once locks the
+// caller holds are released.
+func (s *scheduler) unschedule(job *healthcheckJob) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !job.removed {
+		job.removed = true
+		close(job.stopped)
+	}
+	if job.pendingIndex >= 0 {
+		heap.Remove(&s.pending, job.pendingIndex)
+	}
+	if job.readyIndex >= 0 {
+		heap.Remove(&s.ready, job.readyIndex)
+	}
+	return job.running
+}
+
+// suspend unschedules the job until it is added again, e.g. while it is
+// paused. Unlike unschedule, a run of the job in progress isn't cut short.
+func (s *scheduler) suspend(job *healthcheckJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job.pendingIndex >= 0 {
+		heap.Remove(&s.pending, job.pendingIndex)
+	}
+	if job.readyIndex >= 0 {
+		heap.Remove(&s.ready, job.readyIndex)
+	}
+}
+
+// definition returns the job's definition, as its run sees it.
+func (s *scheduler) definition(job *healthcheckJob) HealthcheckQuery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return job.healthcheck
+}
+
+// edit changes the job's definition in place, e.g. its labels, which its
+// schedule doesn't depend on, and returns it as changed. Runs in progress
+// keep seeing the definition as it was.
+func (s *scheduler) edit(job *healthcheckJob, change func(*HealthcheckQuery)) HealthcheckQuery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	change(&job.healthcheck)
+	return job.healthcheck
+}
+
+// setInterval changes how often the job runs. If the interval changed, the
+// job is next due one new interval from now.
+func (s *scheduler) setInterval(job *healthcheckJob, interval time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job.removed || job.interval == interval {
+		return
+	}
+	job.interval = interval
+	job.next = s.clock.Now().Add(interval)
+	if job.pendingIndex >= 0 {
+		heap.Fix(&s.pending, job.pendingIndex)
+		if job.pendingIndex == 0 {
+			s.poke()
+		}
+	}
+}
+
+// delay puts the job's next run off until at least d from now.
+func (s *scheduler) delay(job *healthcheckJob, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	until := s.clock.Now().Add(d)
+	if job.pendingIndex < 0 || !job.next.Before(until) {
+		return
+	}
+	job.next = until
+	heap.Fix(&s.pending, job.pendingIndex)
+}
+
+// runNow queues the job to run as soon as a worker is free, without
+// changing when it is next due. Jobs that were never added aren't run.
+func (s *scheduler) runNow(job *healthcheckJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job.pendingIndex >= 0 {
+		s.enqueueLocked(job)
+	}
+}
+
+// enqueueLocked queues the job for the workers, unless it is already
+// queued or running.
+func (s *scheduler) enqueueLocked(job *healthcheckJob) {
+	if job.removed || job.readyIndex >= 0 || job.running {
+		return
+	}
+	s.seq++
+	job.seq = s.seq
+	heap.Push(&s.ready, job)
+	s.cond.Signal()
+}
+
+// dispatchDue queues every job that is due and reschedules it. Like a
+// time.Ticker, a job that is still queued or running when it is next due
+// skips that run.
+func (s *scheduler) dispatchDue() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.clock.Now()
+	for len(s.pending) > 0 && !s.pending[0].next.After(now) {
+		job := s.pending[0]
+		if job.readyIndex >= 0 || job.running {
+			s.skipped++
+		}
+		s.enqueueLocked(job)
+		job.next = job.next.Add((now.Sub(job.next)/job.interval + 1) * job.interval)
+		heap.Fix(&s.pending, 0)
+	}
+}
+
+// waitIdle blocks until no job is queued or running.
+func (s *scheduler) waitIdle() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.running > 0 || len(s.ready) > 0 {
+		s.cond.Wait()
+	}
+}
+
+// poke wakes the loop up to reconsider when the next job is due.
+func (s *scheduler) poke() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *scheduler) loop() {
+	for {
+		var due <-chan time.Time
+		var t Timer
+		s.mu.Lock()
+		if s.stopped {
+			s.mu.Unlock()
+			return
+		}
+		if len(s.pending) > 0 {
+			t = s.clock.NewTimer(s.pending[0].next.Sub(s.clock.Now()))
+			due = t.C()
+		}
+		s.mu.Unlock()
+		select {
+		case <-due:
+		case <-s.wake:
+		}
+		if t != nil {
+			t.Stop()
+		}
+		s.dispatchDue()
+	}
+}
+
+func (s *scheduler) work(run func(*healthcheckJob)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		for len(s.ready) == 0 && !s.stopped {
+			s.cond.Wait()
+		}
+		if s.stopped {
+			return
+		}
+		job := heap.Pop(&s.ready).(*healthcheckJob)
+		job.running = true
+		job.inFlight.Add(1)
+		s.running++
+		s.mu.Unlock()
+		run(job)
+		s.mu.Lock()
+		job.running = false
+		job.inFlight.Done()
+		s.running--
+		if s.running == 0 && len(s.ready) == 0 {
+			// Wake up waitIdle; idle workers just go back to waiting.
+			s.cond.Broadcast()
+		}
+	}
+}
+
+type schedulerStats struct {
+	Workers int
+	// Running jobs are being probed, Waiting ones are due but wait for a
+	// free worker, and Scheduled ones aren't due yet.
+	Running   int
+	Waiting   int
+	Scheduled int
+	// Skipped counts runs skipped because the job was still waiting or
+	// running when it was next due.
+	Skipped int64
+}
+
+func (s *scheduler) stats() schedulerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return schedulerStats{
+		Workers:   s.workers,
+		Running:   s.running,
+		Waiting:   len(s.ready),
+		Scheduled: len(s.pending),
+		Skipped:   s.skipped,
+	}
+}
+
+// pendingJobs is a min-heap of jobs by their next run.
+type pendingJobs []*healthcheckJob
+
+func (q pendingJobs) Len() int { return len(q) }
+
+func (q pendingJobs) Less(i, j int) bool { return q[i].next.Before(q[j].next) }
+
+func (q pendingJobs) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].pendingIndex = i
+	q[j].pendingIndex = j
+}
+
+func (q *pendingJobs) Push(x any) {
+	job := x.(*healthcheckJob)
+	job.pendingIndex = len(*q)
+	*q = append(*q, job)
+}
+
+func (q *pendingJobs) Pop() any {
+	old := *q
+	job := old[len(old)-1]
+	*q = old[:len(old)-1]
+	job.pendingIndex = -1
+	return job
+}
+
+// readyJobs is a heap of due jobs, highest priority first.
+type readyJobs []*healthcheckJob
+
+func (q readyJobs) Len() int { return len(q) }
+
+func (q readyJobs) Less(i, j int) bool {
+	if q[i].healthcheck.Priority != q[j].healthcheck.Priority {
+		return q[i].healthcheck.Priority > q[j].healthcheck.Priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q readyJobs) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].readyIndex = i
+	q[j].readyIndex = j
+}
+
+func (q *readyJobs) Push(x any) {
+	job := x.(*healthcheckJob)
+	job.readyIndex = len(*q)
+	*q = append(*q, job)
+}
+
+func (q *readyJobs) Pop() any {
+	old := *q
+	job := old[len(old)-1]
+	*q = old[:len(old)-1]
+	job.readyIndex = -1
+	return job
+}
@@ -0,0 +1,205 @@
+package uptime
+
+import (
+	"container/heap"
+	"testing"
+	"time"
+)
+
+var testEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newTestJob(frequency time.Duration, priority checkPriority) *healthcheckJob {
+	return newHealthcheckJob(HealthcheckQuery{Frequency: frequency, Priority: priority})
+}
+
+// queued pops every job queued for the workers, in the order they would
+// pick them up.
+func queued(s *scheduler) []*healthcheckJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var jobs []*healthcheckJob
+	for len(s.ready) > 0 {
+		jobs = append(jobs, heap.Pop(&s.ready).(*healthcheckJob))
+	}
+	return jobs
+}
+
+func TestSchedulerQueuesByPriority(t *testing.T) {
+	clk := newSimulatedClock(testEpoch)
+	s := newScheduler(clk)
+	low := newTestJob(time.Minute, priorityLow)
+	high := newTestJob(time.Minute, priorityHigh)
+	normal := newTestJob(time.Minute, priorityNormal)
+	laterHigh := newTestJob(2*time.Minute, priorityHigh)
+	for _, job := range []*healthcheckJob{low, high, normal, laterHigh} {
+		s.add(job)
+	}
+
+	clk.Advance(time.Minute)
+	s.dispatchDue()
+	clk.Advance(time.Minute)
+	s.dispatchDue()
+	got := queued(s)
+	// The first three skip their second run, still being queued.
+	want := []*healthcheckJob{high, laterHigh, normal, low}
+	if len(got) != len(want) {
+		t.Fatalf("got %d queued jobs, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("job %d: got priority %s, want %s", i, got[i].healthcheck.Priority, want[i].healthcheck.Priority)
+		}
+	}
+	if skipped := s.stats().Skipped; skipped != 3 {
+		t.Errorf("got %d skipped runs, want 3", skipped)
+	}
+}
+
+func TestSchedulerPendingByNextRun(t *testing.T) {
+	clk := newSimulatedClock(testEpoch)
+	s := newScheduler(clk)
+	slow := newTestJob(time.Hour, priorityNormal)
+	fast := newTestJob(time.Minute, priorityNormal)
+	s.add(slow)
+	s.add(fast)
+
+	clk.Advance(time.Minute)
+	s.dispatchDue()
+	if got := queued(s); len(got) != 1 || got[0] != fast {
+		t.Fatalf("got %d queued jobs, want only the one due every minute", len(got))
+	}
+	if want := testEpoch.Add(2 * time.Minute); !fast.next.Equal(want) {
+		t.Errorf("next run at %s, want %s", fast.next, want)
+	}
+	if s.pending[0] != fast {
+		t.Errorf("the job due soonest isn't first")
+	}
+}
+
+func TestSchedulerSetInterval(t *testing.T) {
+	clk := newSimulatedClock(testEpoch)
+	s := newScheduler(clk)
+	job := newTestJob(time.Minute, priorityNormal)
+	s.add(job)
+
+	clk.Advance(30 * time.Second)
+	s.setInterval(job, 10*time.Second)
+	if want := testEpoch.Add(40 * time.Second); !job.next.Equal(want) {
+		t.Fatalf("next run at %s, want %s", job.next, want)
+	}
+	// The same interval doesn't push the run back.
+	clk.Advance(5 * time.Second)
+	s.setInterval(job, 10*time.Second)
+	if want := testEpoch.Add(40 * time.Second); !job.next.Equal(want) {
+		t.Fatalf("next run at %s, want %s", job.next, want)
+	}
+
+	clk.Advance(5 * time.Second)
+	s.dispatchDue()
+	if got := queued(s); len(got) != 1 {
+		t.Fatalf("got %d queued jobs, want 1", len(got))
+	}
+	if want := testEpoch.Add(50 * time.Second); !job.next.Equal(want) {
+		t.Errorf("next run at %s, want %s", job.next, want)
+	}
+}
+
+func TestSchedulerDelay(t *testing.T) {
+	clk := newSimulatedClock(testEpoch)
+	s := newScheduler(clk)
+	job := newTestJob(time.Minute, priorityNormal)
+	s.add(job)
+
+	s.delay(job, 5*time.Minute)
+	// Delays never bring a run forward.
+	s.delay(job, 10*time.Second)
+	if want := testEpoch.Add(5 * time.Minute); !job.next.Equal(want) {
+		t.Fatalf("next run at %s, want %s", job.next, want)
+	}
+
+	clk.Advance(4 * time.Minute)
+	s.dispatchDue()
+	if got := queued(s); len(got) != 0 {
+		t.Fatalf("got %d queued jobs before the delay is over, want none", len(got))
+	}
+	clk.Advance(time.Minute)
+	s.dispatchDue()
+	if got := queued(s); len(got) != 1 {
+		t.Fatalf("got %d queued jobs once the delay is over, want 1", len(got))
+	}
+	// Back to its frequency afterwards.
+	if want := testEpoch.Add(6 * time.Minute); !job.next.Equal(want) {
+		t.Errorf("next run at %s, want %s", job.next, want)
+	}
+}
+
+func TestSchedulerRunNow(t *testing.T) {
+	clk := newSimulatedClock(testEpoch)
+	s := newScheduler(clk)
+	job := newTestJob(time.Minute, priorityNormal)
+
+	s.runNow(job)
+	if got := queued(s); len(got) != 0 {
+		t.Fatalf("a job never added was queued")
+	}
+
+	s.add(job)
+	s.runNow(job)
+	s.runNow(job)
+	if got := queued(s); len(got) != 1 || got[0] != job {
+		t.Fatalf("got %d queued jobs, want the job once", len(got))
+	}
+	if want := testEpoch.Add(time.Minute); !job.next.Equal(want) {
+		t.Errorf("next run at %s, want %s", job.next, want)
+	}
+}
+
+func TestSchedulerRemoveDuringRun(t *testing.T) {
+	clk := newSimulatedClock(testEpoch)
+	s := newScheduler(clk)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	runs := 0
+	s.startWorkers(1, func(job *healthcheckJob) {
+		runs++
+		close(started)
+		<-release
+	})
+	defer func() {
+		s.stop()
+		s.wait()
+	}()
+	job := newTestJob(time.Minute, priorityNormal)
+	s.add(job)
+	s.runNow(job)
+	<-started
+
+	removed := make(chan struct{})
+	go func() {
+		s.remove(job)
+		close(removed)
+	}()
+	select {
+	case <-removed:
+		t.Fatal("remove returned while the job was running")
+	case <-job.stopped:
+	}
+	select {
+	case <-removed:
+		t.Fatal("remove returned while the job was running")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(release)
+	<-removed
+
+	if job.pendingIndex >= 0 || job.readyIndex >= 0 {
+		t.Errorf("the job is still scheduled")
+	}
+	clk.Advance(time.Hour)
+	s.dispatchDue()
+	s.runNow(job)
+	s.waitIdle()
+	if runs != 1 {
+		t.Errorf("got %d runs, want 1", runs)
+	}
+}
@@ -0,0 +1,371 @@
+package uptime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// defaultListen is the address the API is served on by default.
+const defaultListen = ":8081"
+
+// Option configures a server created with NewServer.
+type Option func(*serverOptions) error
+
+type serverOptions struct {
+	config    Config
+	dbPath    string
+	listener  net.Listener
+	clock     Clock
+	logger    *slog.Logger
+	webhooks  []string
+	notifiers []Notifier
+}
+
+// DefaultConfig returns the configuration the uptime-checker command runs
+// with when given no flags.
+func DefaultConfig() Config {
+	return Config{
+		Listen:              defaultListen,
+		MaxConcurrentChecks: 64,
+		TransientRetries:    2,
+		HeartbeatInterval:   time.Minute,
+		Source:              ResultSource{InstanceId: defaultInstanceId()},
+		LogResults:          logResultsAll,
+		DeployWindow:        15 * time.Minute,
+	}
+}
+
+// WithConfig makes the server start from config rather than from
+// DefaultConfig.
+func WithConfig(config Config) Option {
+	return func(o *serverOptions) error {
+		o.config = config
+		return nil
+	}
+}
+
+// WithDatabase persists checks to a SQLite database, and restores the
+// checks already stored in it.
+func WithDatabase(path string) Option {
+	return func(o *serverOptions) error {
+		o.dbPath = path
+		return nil
+	}
+}
+
+// WithListener makes the server serve its API on listener rather than on
+// the configured address, e.g. on a port picked by the system in tests.
+func WithListener(listener net.Listener) Option {
+	return func(o *serverOptions) error {
+		o.listener = listener
+		return nil
+	}
+}
+
+// WithLogger makes the server log with logger rather than the default
+// logger, which is left alone.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *serverOptions) error {
+		if logger == nil {
+			return errors.New("nil logger")
+		}
+		o.logger = logger
+		return nil
+	}
+}
+
+// WithClock makes the server tell time and schedule checks with clock
+// rather than the system's.
+func WithClock(clock Clock) Option {
+	return func(o *serverOptions) error {
+		o.clock = clock
+		return nil
+	}
+}
+
+// WithWebhooks POSTs checks going down or coming back up to urls.
+func WithWebhooks(urls ...string) Option {
+	return func(o *serverOptions) error {
+		o.webhooks = append(o.webhooks, urls...)
+		return nil
+	}
+}
+
+// WithNotifier tells notifier of checks changing state.
+func WithNotifier(notifier Notifier) Option {
+	return func(o *serverOptions) error {
+		o.notifiers = append(o.notifiers, notifier)
+		return nil
+	}
+}
+
+// Transition is a check changing state, as notified.
+type Transition struct {
+	Check HealthcheckQuery
+	// From and To are the states the check went from and to: UP, DOWN or
+	// DEGRADED.
+	From   string
+	To     string
+	Time   time.Time
+	Result HealthcheckResponse
+}
+
+// Notifier is told of checks changing state, except on their first result
+// and while notifications are suppressed, like webhooks are. It is called
+// from a goroutine of its own, one transition at a time.
+type Notifier interface {
+	Notify(t Transition) error
+}
+
+// notifierQueue hands transitions over to a Notifier without holding up
+// the bus.
+type notifierQueue struct {
+	logger   *slog.Logger
+	notifier Notifier
+	queue    chan Transition
+}
+
+func (q *notifierQueue) handle(e busEvent) {
+	if e.From == "UNKNOWN" || e.Suppressed {
+		return
+	}
+	select {
+	case q.queue <- Transition{Check: e.Job, From: e.From, To: e.To, Time: e.Time, Result: e.Result}:
+	default:
+		q.logger.Warn("notifier-queue-full", slog.String("id", string(e.Job.Id)))
+	}
+}
+
+func (q *notifierQueue) run(done <-chan struct{}) {
+	for {
+		select {
+		case t := <-q.queue:
+			err := q.notifier.Notify(t)
+			if err != nil {
+				q.logger.Error("notifier-failed", slog.String("id", string(t.Check.Id)), slog.String("error", err.Error()))
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// NewServer returns a server configured by opts, ready to have checks
+// added and to be started, so that it can be embedded in another program.
+func NewServer(opts ...Option) (*HealthcheckServer, error) {
+	o := serverOptions{config: DefaultConfig()}
+	for _, opt := range opts {
+		err := opt(&o)
+		if err != nil {
+			return nil, err
+		}
+	}
+	config := o.config
+	if o.logger != nil {
+		config.Logger = o.logger
+	}
+	basePath, err := parseBasePath(config.BasePath)
+	if err != nil {
+		return nil, err
+	}
+	config.BasePath = basePath
+	if config.Transitions == nil {
+		config.Transitions, _ = newTransitionNotifier("", "")
+		config.Transitions.SlackLocale = defaultAlertLocale
+		config.Transitions.EmailLocale = defaultAlertLocale
+	}
+	for _, url := range o.webhooks {
+		url, err := normalizeURL(url)
+		if err != nil {
+			return nil, fmt.Errorf("webhooks: %w", err)
+		}
+		config.Transitions.Webhooks = append(config.Transitions.Webhooks, url)
+	}
+	var restored []HealthcheckQuery
+	if o.dbPath != "" {
+		store, err := openJobStore(o.dbPath)
+		if err == nil {
+			restored, err = store.load()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", o.dbPath, err)
+		}
+		config.JobStore = store
+	}
+
+	h := NewHealthcheckServer(config)
+	if o.clock != nil {
+		h.clock = o.clock
+		h.scheduler = newScheduler(o.clock)
+	}
+	h.listener = o.listener
+	for _, notifier := range o.notifiers {
+		q := &notifierQueue{logger: h.logger, notifier: notifier, queue: make(chan Transition, transitionQueueSize)}
+		h.bus.subscribe(q, busStateChanged)
+		h.notifiers = append(h.notifiers, q)
+	}
+	for _, healthcheck := range restored {
+		h.RestoreHealthcheck(healthcheck)
+	}
+	return &h, nil
+}
+
+// tick waits for the ticker's next tick, and returns false instead once
+// done is closed.
+func tick(ticker *time.Ticker, done <-chan struct{}) bool {
+	select {
+	case <-ticker.C:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// Handler returns the server's API, dashboard and pages, e.g. to serve
+// them along with other handlers.
+func (h *HealthcheckServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", h.handle)
+	mux.Handle("/dashboard/", dashboardHandler)
+	mux.HandleFunc("/metrics", h.handleMetrics)
+	mux.HandleFunc("/healthz", h.handleHealthz)
+	mux.HandleFunc("/status", h.handleStatusPage)
+	mux.HandleFunc("/stats", h.handleStatsPage)
+	mux.HandleFunc("/public/", h.handlePublic)
+	mux.HandleFunc("/subscriptions", h.handleSubscriptions)
+	mux.HandleFunc("/subscriptions/", h.handleSubscriptions)
+	mux.HandleFunc("/rules", h.handleRules)
+	mux.HandleFunc("/reconcile/diff", h.handleReconcileDiff)
+	mux.HandleFunc("/summary", h.handleSummary)
+	mux.HandleFunc("/chatops/command", h.handleChatCommand)
+	mux.HandleFunc("/incidents/ack", h.handleAck)
+	mux.HandleFunc("/calendar.ics", h.handleCalendar)
+	mux.HandleFunc(uploadPath, h.handleUploadResults)
+	mux.HandleFunc("/grafana/", h.handleGrafana)
+	mux.HandleFunc("/events", h.handleEvents)
+	mux.HandleFunc("/events/deploy", h.handleDeployEvents)
+	mux.HandleFunc("/maintenance", h.handleMaintenance)
+	mux.HandleFunc("/maintenance/", h.handleMaintenance)
+	mux.HandleFunc("/transfer", h.handleTransfer)
+	mux.HandleFunc("/keys", h.handleKeys)
+	mux.HandleFunc("/keys/", h.handleKeys)
+	var handler http.Handler = mux
+	if h.config.ReadOnly {
+		handler = rejectMutations(handler)
+	}
+	handler = authenticate(h.keys, h.config.AuthenticateReads, handler)
+	if h.config.BasePath == "" {
+		return handler
+	}
+	prefixed := http.NewServeMux()
+	prefixed.Handle(h.config.BasePath+"/", http.StripPrefix(h.config.BasePath, handler))
+	prefixed.Handle(h.config.BasePath, http.RedirectHandler(h.config.BasePath+"/", http.StatusMovedPermanently))
+	// The mux's own redirect would leave the prefix out.
+	prefixed.Handle(h.config.BasePath+"/dashboard", http.RedirectHandler(h.config.BasePath+"/dashboard/", http.StatusMovedPermanently))
+	return prefixed
+}
+
+// parseBasePath validates a path prefix to serve under, and returns it
+// with a leading slash and no trailing one, or empty for the root.
+func parseBasePath(path string) (string, error) {
+	path = "/" + strings.Trim(path, "/")
+	if path == "/" {
+		return "", nil
+	}
+	if u, err := url.Parse(path); err != nil || u.Path != path || strings.Contains(path, "//") {
+		return "", fmt.Errorf("invalid base path %q, expected a path like /uptime", path)
+	}
+	return path, nil
+}
+
+// Start starts running checks and serving the API, on the server's
+// listener or its configured address, and returns once it is listening.
+func (h *HealthcheckServer) Start() error {
+	if h.httpServer != nil {
+		return errors.New("server already started")
+	}
+	listener := h.listener
+	if listener == nil {
+		var err error
+		address := h.config.Listen
+		if address == "" {
+			address = defaultListen
+		}
+		listener, err = net.Listen("tcp", address)
+		if err != nil {
+			return err
+		}
+	}
+	h.startedAt = h.clock.Now()
+	if h.config.StartupGrace > 0 {
+		h.logger.Info("startup-grace", slog.Time("until", h.startedAt.Add(h.config.StartupGrace)))
+	}
+	h.scheduler.start(h.config.MaxConcurrentChecks, h.runProbe)
+	go h.watchClock()
+	if h.config.HeartbeatUrl != "" && h.config.HeartbeatInterval > 0 {
+		go h.emitHeartbeats()
+	}
+	if h.config.RecordingRules != nil {
+		go h.evaluateRules()
+	}
+	if h.config.LogShipper != nil {
+		go h.config.LogShipper.run(h.done)
+	}
+	if h.config.Uploader != nil {
+		go h.config.Uploader.run(h.done)
+	}
+	if h.config.RunBudget != nil {
+		go h.watchRunBudget()
+	}
+	if h.config.Transitions != nil {
+		go h.config.Transitions.run(h.done)
+	}
+	if h.config.StaleChecks != nil {
+		go h.watchStaleChecks()
+	}
+	for _, q := range h.notifiers {
+		go q.run(h.done)
+	}
+	h.httpServer = &http.Server{Handler: h.Handler()}
+	h.served = make(chan error, 1)
+	go func() {
+		h.served <- h.httpServer.Serve(listener)
+	}()
+	return nil
+}
+
+// Stop stops serving the API, waiting for requests in progress, and stops
+// running checks, waiting for runs in progress, for as long as ctx allows.
+// Pending notifications are dropped.
+func (h *HealthcheckServer) Stop(ctx context.Context) error {
+	if h.httpServer == nil {
+		return errors.New("server not started")
+	}
+	h.stopOnce.Do(func() { close(h.done) })
+	err := h.httpServer.Shutdown(ctx)
+	h.scheduler.stop()
+	// Probe connections kept alive for the next run are no longer needed.
+	httpClient.CloseIdleConnections()
+	stopped := make(chan struct{})
+	go func() {
+		h.scheduler.wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if err != nil {
+		return err
+	}
+	return h.config.JobStore.close()
+}
@@ -0,0 +1,201 @@
+package uptime
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// shipBatchSize and shipInterval bound how long results wait before
+	// being shipped: whichever comes first flushes the batch.
+	shipBatchSize = 500
+	shipInterval  = 5 * time.Second
+	// shipQueueSize bounds how many results may wait for shipping before
+	// new ones are dropped.
+	shipQueueSize = 10000
+)
+
+// logShipper pushes result events to Loki and/or Elasticsearch in batches,
+// so that history can be queried from an existing log stack.
+type logShipper struct {
+	logger             *slog.Logger
+	LokiUrl            string
+	ElasticsearchUrl   string
+	ElasticsearchIndex string
+	queue              chan resultEvent
+}
+
+func newLogShipper(lokiUrl string, elasticsearchUrl string, elasticsearchIndex string) (*logShipper, error) {
+	s := &logShipper{logger: slog.Default(), ElasticsearchIndex: elasticsearchIndex, queue: make(chan resultEvent, shipQueueSize)}
+	var err error
+	if lokiUrl != "" {
+		s.LokiUrl, err = normalizeURL(lokiUrl)
+		if err != nil {
+			return nil, err
+		}
+		s.LokiUrl = strings.TrimSuffix(s.LokiUrl, "/") + "/loki/api/v1/push"
+	}
+	if elasticsearchUrl != "" {
+		s.ElasticsearchUrl, err = normalizeURL(elasticsearchUrl)
+		if err != nil {
+			return nil, err
+		}
+		s.ElasticsearchUrl = strings.TrimSuffix(s.ElasticsearchUrl, "/") + "/_bulk"
+	}
+	return s, nil
+}
+
+// ship queues a result. A nil logShipper discards it.
+func (s *logShipper) ship(healthcheck HealthcheckQuery, resp HealthcheckResponse) {
+	if s == nil {
+		return
+	}
+	select {
+	case s.queue <- resultEvent{Job: healthcheck, Result: resp}:
+	default:
+		s.logger.Warn("log-shipping-queue-full")
+	}
+}
+
+func (s *logShipper) run(done <-chan struct{}) {
+	ticker := time.NewTicker(shipInterval)
+	defer ticker.Stop()
+	var batch []resultEvent
+	for {
+		select {
+		case <-done:
+			if len(batch) > 0 {
+				s.flush(batch)
+			}
+			return
+		case event := <-s.queue:
+			batch = append(batch, event)
+			if len(batch) < shipBatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		s.flush(batch)
+		batch = nil
+	}
+}
+
+func (s *logShipper) flush(batch []resultEvent) {
+	if s.LokiUrl != "" {
+		body, err := lokiPush(batch)
+		if err == nil {
+			err = postBatch(s.LokiUrl, "application/json", body)
+		}
+		if err != nil {
+			s.logger.Error("log-shipping-failed", slog.String("output", "loki"), slog.Int("results", len(batch)), slog.String("error", err.Error()))
+		}
+	}
+	if s.ElasticsearchUrl != "" {
+		body, err := elasticsearchBulk(batch, s.ElasticsearchIndex)
+		if err == nil {
+			err = postBatch(s.ElasticsearchUrl, "application/x-ndjson", body)
+		}
+		if err != nil {
+			s.logger.Error("log-shipping-failed", slog.String("output", "elasticsearch"), slog.Int("results", len(batch)), slog.String("error", err.Error()))
+		}
+	}
+}
+
+func postBatch(url string, contentType string, body []byte) error {
+	resp, err := webhookClient.Post(url, contentType, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBytes))
+	return nil
+}
+
+var lokiLabelInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// lokiLabels returns the stream labels of a result: the check's metadata
+// and labels, and its status. Check labels are prefixed, so they can't
+// collide with the others.
+func lokiLabels(event resultEvent) map[string]string {
+	labels := map[string]string{
+		"service_name": "uptime-checker",
+		"type":         event.Job.Type,
+		"status":       event.Result.statusString(),
+		"job":          strconv.Itoa(event.Job.Alias),
+	}
+	if event.Job.Namespace != "" {
+		labels["namespace"] = event.Job.Namespace
+	}
+	if event.Job.Group != "" {
+		labels["group"] = event.Job.Group
+	}
+	if event.Result.Source.Location != "" {
+		labels["location"] = event.Result.Source.Location
+	}
+	for k, v := range event.Job.Labels {
+		labels["label_"+lokiLabelInvalidChars.ReplaceAllString(k, "_")] = v
+	}
+	return labels
+}
+
+func lokiPush(batch []resultEvent) ([]byte, error) {
+	type stream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+	streams := []*stream{}
+	byLabels := make(map[string]*stream)
+	for _, event := range batch {
+		line, err := json.Marshal(event)
+		if err != nil {
+			return nil, err
+		}
+		labels := lokiLabels(event)
+		// encoding/json sorts map keys, so this identifies the label set.
+		key, _ := json.Marshal(labels)
+		st, ok := byLabels[string(key)]
+		if !ok {
+			st = &stream{Stream: labels}
+			byLabels[string(key)] = st
+			streams = append(streams, st)
+		}
+		st.Values = append(st.Values, [2]string{strconv.FormatInt(event.Result.Timestamp.UnixNano(), 10), string(line)})
+	}
+	return json.Marshal(struct {
+		Streams []*stream `json:"streams"`
+	}{streams})
+}
+
+func elasticsearchBulk(batch []resultEvent, index string) ([]byte, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	for _, event := range batch {
+		err := enc.Encode(map[string]interface{}{"index": map[string]string{"_index": index}})
+		if err != nil {
+			return nil, err
+		}
+		err = enc.Encode(struct {
+			Timestamp time.Time `json:"@timestamp"`
+			resultEvent
+		}{event.Result.Timestamp, event})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b.Bytes(), nil
+}
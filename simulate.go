@@ -0,0 +1,146 @@
+package uptime
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+type simulatedCheck struct {
+	Alias     int    `json:"alias"`
+	Url       string `json:"url"`
+	Frequency string `json:"frequency"`
+	Runs      int    `json:"runs"`
+}
+
+type simulationReport struct {
+	Duration string           `json:"duration"`
+	Runs     int              `json:"runs"`
+	PeakRuns int              `json:"peak_runs"`
+	PeakAt   string           `json:"peak_at,omitempty"`
+	Checks   []simulatedCheck `json:"checks"`
+}
+
+// simulate runs the scheduler over the given checks on a simulated clock,
+// without probing anything, and reports when checks would have run.
+func simulate(config Config, checks []HealthcheckQuery, duration time.Duration, step time.Duration) simulationReport {
+	start := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := newSimulatedClock(start)
+
+	var mu sync.Mutex
+	runs := make(map[healthcheckId]int)
+	runsAt := make(map[time.Time]int)
+
+	config.SuppressNotifications = true
+	h := NewHealthcheckServer(config)
+	h.clock = clk
+	h.scheduler = newScheduler(clk)
+	h.check = func(healthcheck HealthcheckQuery, ctx context.Context) HealthcheckResponse {
+		mu.Lock()
+		runs[healthcheck.Id]++
+		runsAt[clk.Now()]++
+		mu.Unlock()
+		return HealthcheckResponse{Status: true}
+	}
+	added := make([]HealthcheckQuery, 0, len(checks))
+	for _, healthcheck := range checks {
+		added = append(added, h.AddHealthcheck(healthcheck))
+	}
+
+	// The scheduler's loop isn't started: each step dispatches whatever is
+	// due itself, and waits for every dispatched job to be probed before
+	// moving on, so each step sees the state the previous one left behind.
+	h.scheduler.startWorkers(config.MaxConcurrentChecks, h.runProbe)
+	for elapsed := time.Duration(0); elapsed < duration; elapsed += step {
+		clk.Advance(step)
+		h.scheduler.dispatchDue()
+		h.scheduler.waitIdle()
+	}
+	for _, healthcheck := range added {
+		h.StopHealthcheck(healthcheck.Id)
+	}
+
+	report := simulationReport{Duration: duration.String()}
+	for _, healthcheck := range added {
+		report.Checks = append(report.Checks, simulatedCheck{
+			Alias:     healthcheck.Alias,
+			Url:       healthcheck.Url,
+			Frequency: healthcheck.Frequency.String(),
+			Runs:      runs[healthcheck.Id],
+		})
+		report.Runs += runs[healthcheck.Id]
+	}
+	var peakAt time.Time
+	for at, n := range runsAt {
+		if n > report.PeakRuns || (n == report.PeakRuns && at.Before(peakAt)) {
+			report.PeakRuns = n
+			peakAt = at
+		}
+	}
+	if report.PeakRuns > 0 {
+		report.PeakAt = peakAt.Sub(start).String()
+	}
+	return report
+}
+
+func writeSimulationReport(w io.Writer, report simulationReport, format string) {
+	if format == "json" {
+		json.NewEncoder(w).Encode(report)
+		return
+	}
+	fmt.Fprintf(w, "simulated %s: %d runs", report.Duration, report.Runs)
+	if report.PeakRuns > 0 {
+		fmt.Fprintf(w, ", at most %d in one step (at +%s)", report.PeakRuns, report.PeakAt)
+	}
+	fmt.Fprintln(w)
+	for _, c := range report.Checks {
+		fmt.Fprintf(w, "  #%d %s every %s: %d runs\n", c.Alias, c.Url, c.Frequency, c.Runs)
+	}
+}
+
+// runSimulate implements the simulate subcommand and returns the exit code.
+func runSimulate(args []string) int {
+	var config Config
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+	duration := flags.Duration("duration", 24*time.Hour, "how much time to simulate")
+	step := flags.Duration("step", time.Second, "simulation resolution; checks must not run more often than this")
+	format := flags.String("format", "text", "output format, text or json")
+	flags.IntVar(&config.MaxConcurrentChecks, "max-concurrent-checks", 64, "maximum number of checks probing at once")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s simulate [flags] checks.yaml\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 || *step <= 0 {
+		flags.Usage()
+		return 2
+	}
+
+	data, err := readChecksFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", flags.Arg(0), err)
+		return 1
+	}
+	checks := make([]HealthcheckQuery, len(data))
+	for i := range data {
+		err = json.Unmarshal(data[i], &checks[i])
+		if err == nil && checks[i].Frequency < *step {
+			err = fmt.Errorf("frequency %s is below the simulation step %s", checks[i].Frequency, *step)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: check %d: %v\n", flags.Arg(0), i, err)
+			return 1
+		}
+	}
+
+	config.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	writeSimulationReport(os.Stdout, simulate(config, checks, *duration, *step), *format)
+	return 0
+}
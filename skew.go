@@ -0,0 +1,106 @@
+package uptime
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	agentSessionHeader = "X-Agent-Session"
+	agentElapsedHeader = "X-Agent-Elapsed"
+	// reportedSkew is how far off an agent's clock must be for it to be
+	// logged.
+	reportedSkew = time.Second
+)
+
+// spooledResult is a result as an agent spools and uploads it. Along with
+// the wall clock timestamp, it carries when it was produced on the agent's
+// monotonic clock: the time elapsed since the agent session started.
+type spooledResult struct {
+	resultEvent
+	Session string `json:"session,omitempty"`
+	Elapsed int64  `json:"elapsed_ns,omitempty"`
+}
+
+// agentClock is where an upload stands on the agent's monotonic clock.
+type agentClock struct {
+	session string
+	elapsed time.Duration
+	// receivedAt is when the server received the upload, on its own clock.
+	receivedAt time.Time
+}
+
+func parseAgentClock(r *http.Request, receivedAt time.Time) (agentClock, bool) {
+	session := r.Header.Get(agentSessionHeader)
+	elapsed, err := strconv.ParseInt(r.Header.Get(agentElapsedHeader), 10, 64)
+	if session == "" || err != nil || elapsed < 0 {
+		return agentClock{}, false
+	}
+	return agentClock{session: session, elapsed: time.Duration(elapsed), receivedAt: receivedAt}, true
+}
+
+// agentSkews remembers how far off each agent session's wall clock was
+// found to be, to correct results from a session that is no longer the
+// one uploading them, e.g. spooled before the agent restarted.
+type agentSkews struct {
+	mu    sync.Mutex
+	skews map[string]time.Duration
+	order []string
+}
+
+func newAgentSkews() *agentSkews {
+	return &agentSkews{skews: make(map[string]time.Duration)}
+}
+
+func (s *agentSkews) set(session string, skew time.Duration) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, ok := s.skews[session]
+	if !ok {
+		s.order = append(s.order, session)
+		if len(s.order) > seenBatches {
+			delete(s.skews, s.order[0])
+			s.order = s.order[1:]
+		}
+	}
+	s.skews[session] = skew
+	return previous
+}
+
+func (s *agentSkews) get(session string) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	skew, ok := s.skews[session]
+	return skew, ok
+}
+
+// reconcileTimestamp returns when an uploaded result was produced, on the
+// server's clock. A result from the uploading session is placed relative
+// to when the upload arrived, using only the agent's monotonic clock, so
+// that the agent's wall clock doesn't matter; this also measures how far
+// off that wall clock is. Results from earlier sessions are corrected by
+// the skew last measured for them, if any. Network latency is neglected.
+func (h *HealthcheckServer) reconcileTimestamp(result spooledResult, clock agentClock, haveClock bool) time.Time {
+	timestamp := result.Result.Timestamp
+	if haveClock && result.Session == clock.session && result.Elapsed > 0 {
+		reconciled := clock.receivedAt.Add(time.Duration(result.Elapsed) - clock.elapsed)
+		skew := reconciled.Sub(timestamp)
+		previous := h.skews.set(result.Session, skew)
+		if (skew > reportedSkew || skew < -reportedSkew) && (previous-skew > reportedSkew || skew-previous > reportedSkew) {
+			h.logger.Warn("agent-clock-skew",
+				slog.String("location", result.Result.Source.Location),
+				slog.String("instance-id", result.Result.Source.InstanceId),
+				slog.Duration("skew", skew),
+			)
+		}
+		return reconciled
+	}
+	if skew, ok := h.skews.get(result.Session); ok {
+		return timestamp.Add(skew)
+	}
+	return timestamp
+}
@@ -0,0 +1,175 @@
+package uptime
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultStatsWindows are the windows GET /jobs/{id}/stats reports on
+// unless asked otherwise.
+const defaultStatsWindows = "24h,7d,30d"
+
+// maxStatsWindow is the longest window stats are computed over, long
+// enough for a year of imported history.
+const maxStatsWindow = 365 * 24 * time.Hour
+
+// windowStats is a check's availability over a window ending now. Only
+// the part of the window the check was monitored, since Since, counts: by
+// this server, or by the tool its history was imported from.
+type windowStats struct {
+	Window string    `json:"window"`
+	Since  time.Time `json:"since"`
+	// UptimePercent is the share of the time the check was up, nil if it
+	// wasn't monitored during the window at all.
+	UptimePercent *float64 `json:"uptime_percent"`
+	// Outages is how many incidents overlapped the window, and Downtime
+	// how much of it they covered.
+	Outages         int     `json:"outages"`
+	Downtime        string  `json:"downtime"`
+	DowntimeSeconds float64 `json:"downtime_seconds"`
+}
+
+// parseStatsWindow parses a window such as 24h, 7d or 30d.
+func parseStatsWindow(s string) (time.Duration, error) {
+	var window time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		window = time.Duration(n) * 24 * time.Hour
+	} else {
+		window, err = time.ParseDuration(s)
+	}
+	if err != nil || window <= 0 || window > maxStatsWindow {
+		return 0, fmt.Errorf("invalid window %q, expected e.g. 24h or 7d, up to 365d", s)
+	}
+	return window, nil
+}
+
+// availability computes a check's stats over a window ending at now from
+// its incidents, which are only known since the server started, and from
+// its imported history, if any, which ends when the check was created.
+// Time under maintenance, or during which runs were missed, doesn't count,
+// neither as covered nor as down.
+func (h *HealthcheckServer) availability(healthcheck HealthcheckQuery, incidents []*incident, imported *importedHistory, name string, window time.Duration, now time.Time) windowStats {
+	start := now.Add(-window)
+	since := start
+	for _, t := range []time.Time{healthcheck.CreatedAt, h.startedAt} {
+		if t.After(since) {
+			since = t
+		}
+	}
+	unmonitored := h.maintenance.periods(healthcheck, start, now)
+	for _, gap := range h.gaps.list(healthcheck.Id) {
+		unmonitored = append(unmonitored, [2]time.Time{gap.From, gap.To})
+	}
+	unmonitored = unionPeriods(unmonitored)
+	covered := now.Sub(since) - overlap(since, now, unmonitored)
+	periods := make([][2]time.Time, 0, len(incidents))
+	for _, i := range incidents {
+		end := now
+		if i.ClosedAt != nil {
+			end = *i.ClosedAt
+		}
+		periods = append(periods, [2]time.Time{maxTime(i.OpenedAt, since), end})
+	}
+	if imported != nil && imported.To.After(start) {
+		from := maxTime(imported.From, start)
+		covered += imported.To.Sub(from) - overlap(from, imported.To, unmonitored)
+		if from.Before(since) {
+			since = from
+		}
+		for _, o := range imported.Outages {
+			periods = append(periods, [2]time.Time{maxTime(o.From, from), o.To})
+		}
+	}
+	stats := windowStats{Window: name, Since: since}
+	var downtime time.Duration
+	for _, p := range periods {
+		down := p[1].Sub(p[0]) - overlap(p[0], p[1], unmonitored)
+		if down <= 0 {
+			continue
+		}
+		stats.Outages++
+		downtime += down
+	}
+	// Maintenance windows and gaps are wall clock times, while the rest
+	// are monotonic, which may disagree by a hair.
+	if downtime > covered {
+		downtime = covered
+	}
+	if covered > 0 {
+		uptime := 100 * float64(covered-downtime) / float64(covered)
+		stats.UptimePercent = &uptime
+	}
+	stats.Downtime = downtime.Round(time.Second).String()
+	stats.DowntimeSeconds = downtime.Seconds()
+	return stats
+}
+
+// unionPeriods merges overlapping periods, so that time they share is
+// only counted once.
+func unionPeriods(periods [][2]time.Time) [][2]time.Time {
+	sort.Slice(periods, func(i, j int) bool { return periods[i][0].Before(periods[j][0]) })
+	var union [][2]time.Time
+	for _, p := range periods {
+		if n := len(union); n > 0 && !p[0].After(union[n-1][1]) {
+			union[n-1][1] = maxTime(union[n-1][1], p[1])
+			continue
+		}
+		union = append(union, p)
+	}
+	return union
+}
+
+// handleGetJobStats serves GET /jobs/{id}/stats, a check's uptime,
+// outages and downtime over each of the comma separated windows of the
+// window query parameter.
+func (h *HealthcheckServer) handleGetJobStats(w http.ResponseWriter, r *http.Request, jobId healthcheckId) {
+	healthcheck, ok := h.GetHealthcheck(jobId)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	windows := r.URL.Query().Get("window")
+	if windows == "" {
+		windows = defaultStatsWindows
+	}
+	now := h.clock.Now()
+	incidents := h.incidents.forJob(jobId)
+	var imported *importedHistory
+	if history, ok := h.backfills.get(jobId); ok {
+		imported = &history
+	}
+	stats := []windowStats{}
+	for _, name := range strings.Split(windows, ",") {
+		name = strings.TrimSpace(name)
+		window, err := parseStatsWindow(name)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		stats = append(stats, h.availability(healthcheck, incidents, imported, name, window, now))
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(stats)
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,297 @@
+package uptime
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// defaultSLOWindow is the window latency SLOs are evaluated over unless
+	// they set one, and maxSLOWindow the longest, bounded by the results
+	// kept per check.
+	defaultSLOWindow = time.Hour
+	maxSLOWindow     = 24 * time.Hour
+	// sloShortWindowDivisor divides an SLO's window into the short window
+	// that must be burning its budget too, so that an alert stops as soon
+	// as latency is back to normal.
+	sloShortWindowDivisor = 12
+	// minSLOSamples is how many passing runs the window must have for an
+	// SLO to be evaluated.
+	minSLOSamples = 10
+)
+
+// LatencySLO is a latency objective of a check: Percentile percent of its
+// passing runs respond within Threshold, e.g. p95 < 300ms. It is evaluated
+// like a burn rate alert: the SLO is breached while the share of slower
+// runs exceeds its budget, 100 - Percentile percent, BurnRate times over
+// both its Window and the last twelfth of it. Breaches are announced apart
+// from the check going down, to the SLO's own channels if it has any and
+// to the check's otherwise.
+type LatencySLO struct {
+	Percentile   float64  `json:"percentile"`
+	Threshold    string   `json:"threshold"`
+	Window       string   `json:"window,omitempty"`
+	BurnRate     float64  `json:"burn_rate,omitempty"`
+	Webhooks     []string `json:"webhooks,omitempty"`
+	SlackWebhook string   `json:"slack_webhook,omitempty"`
+	EmailTo      []string `json:"email_to,omitempty"`
+	threshold    time.Duration
+	window       time.Duration
+}
+
+func (s *LatencySLO) validate() error {
+	if s.Percentile <= 0 || s.Percentile >= 100 {
+		return fmt.Errorf("invalid latency_slo.percentile %v, expected more than 0 and less than 100", s.Percentile)
+	}
+	var err error
+	s.threshold, err = time.ParseDuration(s.Threshold)
+	if err != nil {
+		return fmt.Errorf("invalid latency_slo.threshold %q: %w", s.Threshold, err)
+	}
+	if s.threshold <= 0 {
+		return fmt.Errorf("invalid latency_slo.threshold %q, must be positive", s.Threshold)
+	}
+	s.window = defaultSLOWindow
+	if s.Window != "" {
+		s.window, err = time.ParseDuration(s.Window)
+		if err != nil {
+			return fmt.Errorf("invalid latency_slo.window %q: %w", s.Window, err)
+		}
+		if s.window <= 0 || s.window > maxSLOWindow {
+			return fmt.Errorf("invalid latency_slo.window %q, must be positive and at most %s", s.Window, maxSLOWindow)
+		}
+	}
+	if s.BurnRate == 0 {
+		s.BurnRate = 1
+	}
+	if s.BurnRate < 0 {
+		return fmt.Errorf("invalid latency_slo.burn_rate %v, must be positive", s.BurnRate)
+	}
+	channels := s.channels()
+	err = channels.normalize()
+	if err != nil {
+		return fmt.Errorf("latency_slo: %w", err)
+	}
+	s.Webhooks, s.SlackWebhook = channels.Webhooks, channels.SlackWebhook
+	return nil
+}
+
+// channels returns the SLO's own channels.
+func (s *LatencySLO) channels() notificationChannels {
+	return notificationChannels{Webhooks: s.Webhooks, SlackWebhook: s.SlackWebhook, EmailTo: s.EmailTo}
+}
+
+// burn returns the share of the passing runs since since slower than the
+// threshold, relative to the SLO's budget, and how many runs there were.
+// Results are newest first.
+func (s *LatencySLO) burn(results []HealthcheckResponse, since time.Time) (float64, int) {
+	slow, samples := 0, 0
+	for _, resp := range results {
+		if resp.Timestamp.Before(since) {
+			break
+		}
+		if !resp.Status || resp.neutral() {
+			continue
+		}
+		samples++
+		if resp.Latency > s.threshold {
+			slow++
+		}
+	}
+	if samples == 0 {
+		return 0, 0
+	}
+	budget := 1 - s.Percentile/100
+	return float64(slow) / float64(samples) / budget, samples
+}
+
+// sloEvent is the payload POSTed to webhooks when a check's latency SLO is
+// breached, or met again.
+type sloEvent struct {
+	Job HealthcheckQuery `json:"job"`
+	// State is BREACHED or MET.
+	State string `json:"state"`
+	// BurnRate and ShortBurnRate are how many times its budget the SLO
+	// burned over its window and the short window.
+	BurnRate      float64   `json:"burn_rate"`
+	ShortBurnRate float64   `json:"short_burn_rate"`
+	PercentileMs  *float64  `json:"percentile_ms"`
+	Samples       int       `json:"samples"`
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+// latencySLOs tracks which checks' latency SLOs are breached.
+type latencySLOs struct {
+	mu       sync.Mutex
+	breached map[healthcheckId]bool
+}
+
+func newLatencySLOs() *latencySLOs {
+	return &latencySLOs{breached: make(map[healthcheckId]bool)}
+}
+
+// set records whether a check's SLO is breached, and reports whether that
+// changed.
+func (l *latencySLOs) set(id healthcheckId, breached bool) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	changed := l.breached[id] != breached
+	if breached {
+		l.breached[id] = true
+	} else {
+		delete(l.breached, id)
+	}
+	return changed
+}
+
+func (l *latencySLOs) forget(id healthcheckId) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.breached, id)
+}
+
+// evaluateLatencySLO evaluates a check's latency SLO after a run, and
+// announces it being breached or met again unless notifications are
+// suppressed.
+func (h *HealthcheckServer) evaluateLatencySLO(healthcheck HealthcheckQuery, now time.Time, suppressed bool) {
+	slo := healthcheck.LatencySLO
+	if slo == nil {
+		return
+	}
+	results := h.results.list(healthcheck.Id, now.Add(-slo.window), resultsPerJob)
+	rate, samples := slo.burn(results, now.Add(-slo.window))
+	shortRate, shortSamples := slo.burn(results, now.Add(-slo.window/sloShortWindowDivisor))
+	if samples < minSLOSamples {
+		return
+	}
+	breached := shortSamples > 0 && rate >= slo.BurnRate && shortRate >= slo.BurnRate
+	if !h.slos.set(healthcheck.Id, breached) {
+		return
+	}
+	var latencies []time.Duration
+	for _, resp := range results {
+		if resp.Status && !resp.neutral() {
+			latencies = append(latencies, resp.Latency)
+		}
+	}
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+	event := sloEvent{
+		Job:           healthcheck,
+		State:         "MET",
+		BurnRate:      rate,
+		ShortBurnRate: shortRate,
+		PercentileMs:  percentile(latencies, slo.Percentile),
+		Samples:       samples,
+		Timestamp:     now,
+	}
+	if breached {
+		event.State = "BREACHED"
+	}
+	h.logger.Warn("healthcheck-latency-slo",
+		slog.String("url", healthcheck.Url),
+		slog.String("state", event.State),
+		slog.Float64("burn-rate", rate),
+		slog.Float64("short-burn-rate", shortRate),
+	)
+	if !suppressed {
+		h.config.Transitions.notifySLO(event)
+	}
+}
+
+// notifySLO queues a latency SLO event for delivery to the SLO's channels,
+// or the check's if it has none. A nil transitionNotifier discards it.
+func (n *transitionNotifier) notifySLO(event sloEvent) {
+	if n == nil {
+		return
+	}
+	healthcheck := event.Job
+	channels := notificationChannels{Webhooks: n.Webhooks, SlackWebhook: n.SlackWebhook}
+	if policy := n.Policies.forCheck(healthcheck); policy != nil {
+		channels = channels.override(policy.notificationChannels)
+	}
+	channels = channels.override(notificationChannels{Webhooks: healthcheck.Webhooks, SlackWebhook: healthcheck.SlackWebhook})
+	if own := healthcheck.LatencySLO.channels(); len(own.Webhooks) > 0 || own.SlackWebhook != "" || len(own.EmailTo) > 0 {
+		channels = notificationChannels{SlackLocale: channels.SlackLocale, EmailLocale: channels.EmailLocale}.override(own)
+	}
+	channels = notificationChannels{SlackLocale: n.SlackLocale, EmailLocale: n.EmailLocale}.override(channels)
+
+	if channels.SlackWebhook != "" {
+		n.enqueue(transitionDelivery{job: healthcheck, url: channels.SlackWebhook, payload: slackSLOMessage(event, lookupAlertLocale(channels.SlackLocale))})
+	}
+	if n.Email != nil {
+		alert := emailSLOAlert(event, lookupAlertLocale(channels.EmailLocale))
+		alert.to = channels.EmailTo
+		n.enqueue(transitionDelivery{job: healthcheck, email: &alert})
+	}
+	if len(channels.Webhooks) == 0 {
+		return
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		n.logger.Error("transition-encode-failed", slog.String("error", err.Error()))
+		return
+	}
+	for _, url := range channels.Webhooks {
+		n.enqueue(transitionDelivery{job: healthcheck, url: url, payload: payload})
+	}
+}
+
+// sloSummary describes the SLO and how it fares, e.g. "p95 412ms > 300ms
+// over 1h0m0s, burn rate 3.2 (short window 4.0)".
+func sloSummary(event sloEvent) string {
+	slo := event.Job.LatencySLO
+	observed := "-"
+	if event.PercentileMs != nil {
+		observed = time.Duration(*event.PercentileMs * float64(time.Millisecond)).Round(time.Millisecond).String()
+	}
+	comparison := ">"
+	if event.State != "BREACHED" {
+		comparison = "vs"
+	}
+	return fmt.Sprintf("p%v %s %s %s over %s, burn rate %.1f (short window %.1f)",
+		slo.Percentile, observed, comparison, slo.threshold, slo.window, event.BurnRate, event.ShortBurnRate)
+}
+
+// slackSLOMessage is the Slack message announcing a latency SLO being
+// breached or met again, worded in locale.
+func slackSLOMessage(event sloEvent, locale *alertLocale) []byte {
+	healthcheck := event.Job
+	var text strings.Builder
+	if event.State == "BREACHED" {
+		fmt.Fprintf(&text, ":snail: *%s*: %s #%d %s", locale.SLOBreached, healthcheck.Method, healthcheck.Alias, healthcheck.Url)
+	} else {
+		fmt.Fprintf(&text, ":white_check_mark: *%s*: %s #%d %s", locale.SLOMet, healthcheck.Method, healthcheck.Alias, healthcheck.Url)
+	}
+	fmt.Fprintf(&text, "\n%s", sloSummary(event))
+	payload, _ := json.Marshal(struct {
+		Text string `json:"text"`
+	}{text.String()})
+	return payload
+}
+
+// emailSLOAlert is the email announcing a latency SLO being breached or
+// met again, worded in locale.
+func emailSLOAlert(event sloEvent, locale *alertLocale) emailAlert {
+	healthcheck := event.Job
+	state := locale.SLOBreached
+	if event.State != "BREACHED" {
+		state = locale.SLOMet
+	}
+	var body strings.Builder
+	fmt.Fprintf(&body, "%s: %s %s\n\n", state, healthcheck.Method, healthcheck.Url)
+	fmt.Fprintf(&body, "%s\n", sloSummary(event))
+	fmt.Fprintf(&body, "%s: #%d (%s)\n", locale.Check, healthcheck.Alias, healthcheck.Id)
+	fmt.Fprintf(&body, "%s\n", locale.formatTime(event.Timestamp))
+	return emailAlert{
+		subject: fmt.Sprintf("[%s] %s %s", strings.ToUpper(state), healthcheck.Method, healthcheck.Url),
+		body:    body.String(),
+	}
+}
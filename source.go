@@ -0,0 +1,44 @@
+package uptime
+
+import (
+	"os"
+	"strings"
+
+	"golang.org/x/exp/slog"
+)
+
+// ResultSource identifies where a result was produced, so results from
+// several instances of the server can be told apart.
+type ResultSource struct {
+	Location    string `json:"location,omitempty"`
+	Environment string `json:"environment,omitempty"`
+	InstanceId  string `json:"instance_id,omitempty"`
+}
+
+func defaultInstanceId() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return hostname
+}
+
+// String describes the source in alerts, e.g. "eu-west / production /
+// host-1", leaving out what isn't set.
+func (s ResultSource) String() string {
+	var parts []string
+	for _, part := range []string{s.Location, s.Environment, s.InstanceId} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, " / ")
+}
+
+func (s ResultSource) logAttrs() []slog.Attr {
+	return []slog.Attr{
+		slog.String("location", s.Location),
+		slog.String("environment", s.Environment),
+		slog.String("instance-id", s.InstanceId),
+	}
+}
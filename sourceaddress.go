@@ -0,0 +1,151 @@
+package uptime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"sync"
+)
+
+type sourceAddressKey struct{}
+
+// withSourceAddress makes checks run with ctx connect from source: a local
+// address, or the name of a network interface. An empty source leaves the
+// choice to the operating system.
+func withSourceAddress(ctx context.Context, source string) context.Context {
+	if source == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, sourceAddressKey{}, source)
+}
+
+// sourceAddress returns the source address a check connects from: its
+// own, or the configured one.
+func (h *HealthcheckServer) sourceAddress(healthcheck HealthcheckQuery) string {
+	if healthcheck.SourceAddress != "" {
+		return healthcheck.SourceAddress
+	}
+	return h.config.SourceAddress
+}
+
+// sourceAddressFrom returns the local address checks run with ctx connect
+// from, if they are bound to one.
+func sourceAddressFrom(ctx context.Context) (netip.Addr, error) {
+	source, _ := ctx.Value(sourceAddressKey{}).(string)
+	if source == "" {
+		return netip.Addr{}, nil
+	}
+	return resolveSourceAddress(source)
+}
+
+// resolveSourceAddress returns the address source stands for: itself if it
+// is an address, or an interface's first IPv4 address, its first global
+// IPv6 address failing that. Interfaces are resolved on every connection,
+// so that their addresses may change.
+func resolveSourceAddress(source string) (netip.Addr, error) {
+	if addr, err := netip.ParseAddr(source); err == nil {
+		return addr.Unmap(), nil
+	}
+	iface, err := net.InterfaceByName(source)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid source address %q, expected an address or a network interface", source)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("interface %s: %w", source, err)
+	}
+	var ipv6 netip.Addr
+	for _, a := range addrs {
+		prefix, err := netip.ParsePrefix(a.String())
+		if err != nil {
+			continue
+		}
+		addr := prefix.Addr().Unmap()
+		if addr.Is4() {
+			return addr, nil
+		}
+		if !ipv6.IsValid() && !addr.IsLinkLocalUnicast() {
+			ipv6 = addr
+		}
+	}
+	if !ipv6.IsValid() {
+		return netip.Addr{}, fmt.Errorf("interface %s has no address", source)
+	}
+	return ipv6, nil
+}
+
+// validateSourceAddress rejects sources that aren't an address of this
+// host or one of its interfaces.
+func validateSourceAddress(source string) error {
+	addr, err := resolveSourceAddress(source)
+	if err != nil {
+		return err
+	}
+	local, err := net.InterfaceAddrs()
+	if err != nil {
+		return err
+	}
+	for _, a := range local {
+		if prefix, err := netip.ParsePrefix(a.String()); err == nil && prefix.Addr().Unmap() == addr {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid source address %q, not an address of this host", source)
+}
+
+// probeDialer returns the dialer checks run with ctx connect over network
+// with: it enforces address policies, resolves with the checks' DNS
+// servers, and binds to their source address if they have one, in which
+// case only targets of its family can be reached.
+func probeDialer(ctx context.Context, network string) (*net.Dialer, error) {
+	dialer := &net.Dialer{ControlContext: controlAddress, Resolver: probeResolver(ctx)}
+	addr, err := sourceAddressFrom(ctx)
+	if err != nil || !addr.IsValid() {
+		return dialer, err
+	}
+	switch network {
+	case "udp", "udp4", "udp6":
+		dialer.LocalAddr = net.UDPAddrFromAddrPort(netip.AddrPortFrom(addr, 0))
+	default:
+		dialer.LocalAddr = net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, 0))
+	}
+	return dialer, nil
+}
+
+// sourceClientKey identifies the client requests from a source address,
+// or resolving with other DNS servers, are made with, apart from the ones
+// of the client they would be made with otherwise.
+type sourceClientKey struct {
+	base      *http.Client
+	source    string
+	resolvers string
+}
+
+// sourceClients are the clients of checks bound to a source address or to
+// DNS servers, so that they don't reuse connections made from another
+// address, or to an address another server resolved.
+var sourceClients = struct {
+	mu      sync.Mutex
+	clients map[sourceClientKey]*http.Client
+}{clients: make(map[sourceClientKey]*http.Client)}
+
+// sourceClient returns a client like base, but with its own connections,
+// for requests from source resolving with resolvers.
+func sourceClient(base *http.Client, source string, resolvers string) *http.Client {
+	sourceClients.mu.Lock()
+	defer sourceClients.mu.Unlock()
+	key := sourceClientKey{base: base, source: source, resolvers: resolvers}
+	client, ok := sourceClients.clients[key]
+	if !ok {
+		client = &http.Client{Transport: base.Transport.(*http.Transport).Clone()}
+		sourceClients.clients[key] = client
+	}
+	return client
+}
+
+// errSourceFamily is returned for pings whose target isn't of the family of
+// their source address.
+var errSourceFamily = errors.New("the source address and the target are of different address families")
@@ -0,0 +1,151 @@
+package uptime
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// staleCheckInterval is how often checks are looked at for staleness.
+const staleCheckInterval = time.Minute
+
+// staleChecks flags checks whose target looks decommissioned: every run
+// for After, its name didn't resolve or it refused the connection. With
+// ArchiveAfter set, checks that stay that way for that long are archived.
+// A nil staleChecks flags nothing.
+type staleChecks struct {
+	After        time.Duration
+	ArchiveAfter time.Duration
+
+	mu sync.Mutex
+	// since is when each job's target started looking gone.
+	since   map[healthcheckId]time.Time
+	flagged map[healthcheckId]bool
+}
+
+func newStaleChecks(after time.Duration, archiveAfter time.Duration) *staleChecks {
+	return &staleChecks{
+		After:        after,
+		ArchiveAfter: archiveAfter,
+		since:        make(map[healthcheckId]time.Time),
+		flagged:      make(map[healthcheckId]bool),
+	}
+}
+
+// targetGone tells whether the first error among args says the target is
+// gone, rather than failing.
+func targetGone(args []interface{}) bool {
+	for _, arg := range args {
+		err, ok := arg.(error)
+		if !ok {
+			continue
+		}
+		var dnsErr *net.DNSError
+		return errors.As(err, &dnsErr) && dnsErr.IsNotFound || errors.Is(err, syscall.ECONNREFUSED)
+	}
+	return false
+}
+
+func (s *staleChecks) record(id healthcheckId, resp HealthcheckResponse, now time.Time) {
+	if s == nil || resp.neutral() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !resp.targetGone {
+		delete(s.since, id)
+		delete(s.flagged, id)
+		return
+	}
+	if _, ok := s.since[id]; !ok {
+		s.since[id] = now
+	}
+}
+
+func (s *staleChecks) forget(id healthcheckId) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.since, id)
+	delete(s.flagged, id)
+}
+
+// isStale tells whether a job's target has looked gone for After.
+func (s *staleChecks) isStale(id healthcheckId, now time.Time) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	since, ok := s.since[id]
+	return ok && now.Sub(since) >= s.After
+}
+
+// sweep flags jobs that became stale, returning them, and returns the jobs
+// due to be archived.
+func (s *staleChecks) sweep(now time.Time) (flagged map[healthcheckId]time.Time, archive []healthcheckId) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	flagged = make(map[healthcheckId]time.Time)
+	for id, since := range s.since {
+		if now.Sub(since) < s.After {
+			continue
+		}
+		if !s.flagged[id] {
+			s.flagged[id] = true
+			flagged[id] = since
+		}
+		if s.ArchiveAfter > 0 && now.Sub(since) >= s.ArchiveAfter {
+			archive = append(archive, id)
+		}
+	}
+	return flagged, archive
+}
+
+func (h *HealthcheckServer) watchStaleChecks() {
+	ticker := time.NewTicker(staleCheckInterval)
+	defer ticker.Stop()
+	for tick(ticker, h.done) {
+		now := h.clock.Now()
+		flagged, archive := h.config.StaleChecks.sweep(now)
+		for id, since := range flagged {
+			if healthcheck, ok := h.GetHealthcheck(id); ok {
+				h.logger.Warn("healthcheck-stale",
+					slog.String("id", string(id)),
+					slog.String("url", healthcheck.Url),
+					slog.Time("since", since),
+				)
+			}
+		}
+		for _, id := range archive {
+			h.archiveJob(id, now, "stale")
+		}
+	}
+}
+
+// archiveJob pauses a check that is stale or ran its maximum number of
+// times, unless it already is paused.
+func (h *HealthcheckServer) archiveJob(id healthcheckId, now time.Time, reason string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	job, ok := h.healthchecks[id]
+	if !ok || job.healthcheck.Paused {
+		return
+	}
+	healthcheck := h.scheduler.edit(job, func(healthcheck *HealthcheckQuery) {
+		healthcheck.Paused = true
+		healthcheck.ArchivedAt = now
+		healthcheck.UpdatedAt = now
+		healthcheck.Version++
+	})
+	h.scheduler.suspend(job)
+	h.config.JobStore.save(healthcheck)
+	h.logConfigEvent("archive", healthcheck)
+	h.logger.Warn("healthcheck-archived", slog.String("id", string(id)), slog.String("url", healthcheck.Url), slog.String("reason", reason))
+}
@@ -0,0 +1,116 @@
+package uptime
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// resultState is the outcome of a check run.
+type resultState string
+
+const (
+	stateUp   resultState = "UP"
+	stateDown resultState = "DOWN"
+	// stateDegraded results are up, but not quite right.
+	stateDegraded resultState = "DEGRADED"
+	// stateMaintenance results were produced while the target was known
+	// to be under maintenance.
+	stateMaintenance resultState = "MAINTENANCE"
+	// stateSkipped results didn't probe the target, e.g. because it asked
+	// to be retried later.
+	stateSkipped resultState = "SKIPPED"
+	// stateUnknown results couldn't tell whether the target is up.
+	stateUnknown resultState = "UNKNOWN"
+)
+
+var resultStates = map[resultState]bool{
+	stateUp:          true,
+	stateDown:        true,
+	stateDegraded:    true,
+	stateMaintenance: true,
+	stateSkipped:     true,
+	stateUnknown:     true,
+}
+
+func parseResultState(s string) (resultState, error) {
+	state := resultState(s)
+	if !resultStates[state] {
+		return "", fmt.Errorf("invalid state %q, expected UP, DOWN, DEGRADED, MAINTENANCE, SKIPPED or UNKNOWN", s)
+	}
+	return state, nil
+}
+
+// Reason codes classify why a result is in its state, for alerts and
+// metrics to tell failures apart without parsing their messages.
+const (
+	reasonConnectionFailed    = "connection_failed"
+	reasonTimeout             = "timeout"
+	reasonDNSFailed           = "dns_failed"
+	reasonTLSFailed           = "tls_failed"
+	reasonUnexpectedStatus    = "unexpected_status"
+	reasonAssertionFailed     = "assertion_failed"
+	reasonUnexpectedSuccess   = "unexpected_success"
+	reasonThrottled           = "throttled"
+	reasonPacketLoss          = "packet_loss"
+	reasonCertificateExpiring = "certificate_expiring"
+	reasonCheckFailed         = "check_failed"
+	reasonMaintenance         = "maintenance"
+)
+
+// state returns the result's state: its State if set, otherwise UP or
+// DOWN as per Status, or SKIPPED if it was throttled.
+func (r HealthcheckResponse) state() resultState {
+	switch {
+	case r.State != "":
+		return r.State
+	case r.Throttled:
+		return stateSkipped
+	case r.Status:
+		return stateUp
+	default:
+		return stateDown
+	}
+}
+
+// neutral reports whether the result says nothing about whether the
+// target is up, so that it doesn't change the check's state or count
+// towards its uptime.
+func (r HealthcheckResponse) neutral() bool {
+	switch r.state() {
+	case stateMaintenance, stateSkipped, stateUnknown:
+		return true
+	}
+	return false
+}
+
+// failureReason classifies the first error among args.
+func failureReason(args []interface{}) string {
+	for _, arg := range args {
+		err, ok := arg.(error)
+		if !ok {
+			continue
+		}
+		var netErr net.Error
+		var dnsErr *net.DNSError
+		var opErr *net.OpError
+		var certErr *tls.CertificateVerificationError
+		var unknownAuthority x509.UnknownAuthorityError
+		var hostnameErr x509.HostnameError
+		var recordErr tls.RecordHeaderError
+		switch {
+		case errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout():
+			return reasonTimeout
+		case errors.As(err, &dnsErr):
+			return reasonDNSFailed
+		case errors.As(err, &certErr) || errors.As(err, &unknownAuthority) || errors.As(err, &hostnameErr) || errors.As(err, &recordErr):
+			return reasonTLSFailed
+		case errors.As(err, &opErr):
+			return reasonConnectionFailed
+		}
+	}
+	return reasonCheckFailed
+}
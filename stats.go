@@ -0,0 +1,158 @@
+package uptime
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"time"
+)
+
+var statsPageTemplate = template.Must(template.New("stats").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Stats</title>
+<style>
+body { font-family: sans-serif; max-width: 60em; margin: 2em auto; color: #222; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+th, td { text-align: left; padding: .3em .6em; border-bottom: 1px solid #ddd; }
+td.n, th.n { text-align: right; }
+</style>
+</head>
+<body>
+<h1>Stats</h1>
+<h2>Scheduler</h2>
+<table>
+<tr><td>Workers busy</td><td class="n">{{.Running}} / {{.Workers}} ({{.Utilization}})</td></tr>
+<tr><td>Due, waiting for a worker</td><td class="n">{{.Waiting}}</td></tr>
+<tr><td>Scheduled</td><td class="n">{{.Scheduled}}</td></tr>
+<tr><td>Paused</td><td class="n">{{.Paused}}</td></tr>
+</table>
+<h2>Queues</h2>
+<table>
+<tr><td>Notifications waiting for delivery</td><td class="n">{{.Notifications}}</td></tr>
+{{if .Shipping}}<tr><td>Results waiting to be shipped</td><td class="n">{{.Shipping}}</td></tr>{{end}}
+</table>
+<h2>Overruns</h2>
+{{if .Overruns}}
+<table>
+<tr><th>Check</th><th class="n">Frequency</th><th class="n">Slowest run</th><th class="n">Runs longer than frequency</th><th class="n">Missed runs</th></tr>
+{{range .Overruns}}<tr><td>#{{.Alias}} {{.Url}}</td><td class="n">{{.Frequency}}</td><td class="n">{{.Slowest}}</td><td class="n">{{.Overruns}}</td><td class="n">{{.MissedRuns}}</td></tr>
+{{end}}
+</table>
+{{else}}
+<p>No check overran or missed a run.</p>
+{{end}}
+</body>
+</html>
+`))
+
+type statsPageOverrun struct {
+	Alias      int
+	Url        string
+	Frequency  string
+	Slowest    string
+	Overruns   int
+	MissedRuns int
+}
+
+type statsPage struct {
+	schedulerStats
+	Utilization   string
+	Paused        int
+	Notifications int
+	Shipping      int
+	Overruns      []statsPageOverrun
+}
+
+// queued returns how many results wait for delivery across subscriptions.
+func (m *subscriptionManager) queued() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, s := range m.subscriptions {
+		n += len(s.queue)
+	}
+	return n
+}
+
+// notificationsQueued returns how many results and transitions wait for
+// delivery: to subscriptions, to webhooks, Slack and email, and to
+// Notifiers.
+func (h *HealthcheckServer) notificationsQueued() int {
+	n := h.subscriptions.queued()
+	if h.config.Transitions != nil {
+		n += len(h.config.Transitions.queue)
+	}
+	for _, q := range h.notifiers {
+		n += len(q.queue)
+	}
+	return n
+}
+
+// overruns returns how many of a job's kept results took longer than the
+// given frequency, and the longest one.
+func (s *resultStore) overruns(id healthcheckId, frequency time.Duration) (overruns int, slowest time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, resp := range s.results[id] {
+		if resp.Duration > frequency {
+			overruns++
+		}
+		if resp.Duration > slowest {
+			slowest = resp.Duration
+		}
+	}
+	return overruns, slowest
+}
+
+// handleStatsPage renders operational stats without needing Prometheus:
+// how busy the scheduler is, how much is waiting in queues, and which
+// checks take longer than their frequency or missed runs.
+func (h *HealthcheckServer) handleStatsPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	page := statsPage{
+		schedulerStats: h.scheduler.stats(),
+		Notifications:  h.notificationsQueued(),
+	}
+	page.Utilization = "0%"
+	if page.Workers > 0 {
+		page.Utilization = fmt.Sprintf("%.0f%%", 100*float64(page.Running)/float64(page.Workers))
+	}
+	if h.config.LogShipper != nil {
+		page.Shipping = len(h.config.LogShipper.queue)
+	}
+	for _, healthcheck := range h.ListHealthchecks() {
+		if healthcheck.Paused {
+			page.Paused++
+		}
+		overruns, slowest := h.results.overruns(healthcheck.Id, healthcheck.Frequency)
+		missed := 0
+		for _, gap := range h.gaps.list(healthcheck.Id) {
+			missed += gap.MissedRuns
+		}
+		if overruns == 0 && missed == 0 {
+			continue
+		}
+		page.Overruns = append(page.Overruns, statsPageOverrun{
+			Alias:      healthcheck.Alias,
+			Url:        healthcheck.Url,
+			Frequency:  healthcheck.Frequency.String(),
+			Slowest:    slowest.Round(time.Millisecond).String(),
+			Overruns:   overruns,
+			MissedRuns: missed,
+		})
+	}
+	sort.SliceStable(page.Overruns, func(i, j int) bool {
+		a, b := page.Overruns[i], page.Overruns[j]
+		return a.Overruns+a.MissedRuns > b.Overruns+b.MissedRuns
+	})
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	statsPageTemplate.Execute(w, page)
+}
@@ -0,0 +1,214 @@
+package uptime
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"time"
+)
+
+var statusPageTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Status</title>
+<style>
+body { font-family: sans-serif; max-width: 60em; margin: 2em auto; color: #222; }
+h2 { display: flex; justify-content: space-between; border-bottom: 1px solid #ddd; }
+.check { margin: 1em 0; }
+.check-header { display: flex; justify-content: space-between; }
+.strip { display: flex; gap: 1px; margin-top: .3em; }
+.day { flex: 1; height: 2em; border-radius: 2px; }
+.up { background: #3ba55c; } .partial { background: #faa61a; } .down { background: #ed4245; } .none { background: #ddd; }
+.UP { color: #3ba55c; } .DOWN { color: #ed4245; } .DEGRADED, .SKIPPED { color: #faa61a; } .MAINTENANCE { color: #5865f2; }
+.incident { margin: .8em 0; } .incident .when { color: #666; font-size: .9em; }
+</style>
+</head>
+<body>
+<h1>Status</h1>
+{{range .Groups}}
+<h2><span>{{.Name}}</span><span>{{.Uptime}}</span></h2>
+{{range .Checks}}
+<div class="check">
+<div class="check-header"><span>{{.Url}}</span><span><span class="{{.Status}}">{{.Status}}</span> &middot; {{.Uptime}}</span></div>
+<div class="strip">{{range .Days}}<div class="day {{.Class}}" title="{{.Title}}"></div>{{end}}</div>
+</div>
+{{end}}
+{{end}}
+<h2>Recent incidents</h2>
+{{range .Incidents}}
+<div class="incident">
+<div><strong>{{.Section}}</strong>: {{.Url}} {{if .Ongoing}}<span class="DOWN">is down</span>{{else}}was down for {{.Duration}}{{end}}</div>
+<div class="when">{{.OpenedAt}}{{if not .Ongoing}} &ndash; {{.ClosedAt}}{{end}}</div>
+</div>
+{{else}}
+<p>No incidents in the last {{.IncidentDays}} days.</p>
+{{end}}
+</body>
+</html>
+`))
+
+type statusPageDay struct {
+	Class string
+	Title string
+}
+
+type statusPageCheck struct {
+	Url    string
+	Status string
+	Uptime string
+	Days   []statusPageDay
+}
+
+type statusPageGroup struct {
+	Name   string
+	Uptime string
+	Checks []statusPageCheck
+}
+
+type statusPageIncident struct {
+	Section  string
+	Url      string
+	OpenedAt string
+	ClosedAt string
+	Duration string
+	Ongoing  bool
+}
+
+type statusPage struct {
+	Groups       []*statusPageGroup
+	Incidents    []statusPageIncident
+	IncidentDays int
+}
+
+const (
+	// ungroupedName is the section checks without a service or group are
+	// shown under.
+	ungroupedName = "Other"
+	// statusPageIncidentDays is how far back the status page lists
+	// incidents, and maxStatusPageIncidents how many it lists at most.
+	statusPageIncidentDays = 14
+	maxStatusPageIncidents = 20
+	statusPageTimeLayout   = "2006-01-02 15:04 MST"
+)
+
+// statusPageSection is the section a check is shown under: its service,
+// as labelled for deploy events, or its group.
+func statusPageSection(healthcheck HealthcheckQuery) string {
+	if service := healthcheck.Labels[serviceLabel]; service != "" {
+		return service
+	}
+	if healthcheck.Group != "" {
+		return healthcheck.Group
+	}
+	return ungroupedName
+}
+
+func formatUptime(up int, total int) string {
+	if total == 0 {
+		return "no data"
+	}
+	return fmt.Sprintf("%.2f%%", 100*float64(up)/float64(total))
+}
+
+func dayClass(d dayRollup) string {
+	switch u := d.uptime(); {
+	case u < 0:
+		return "none"
+	case u == 1:
+		return "up"
+	case u >= 0.95:
+		return "partial"
+	default:
+		return "down"
+	}
+}
+
+// handleStatusPage renders the public checks grouped by service, each with
+// a day-by-day uptime strip and the uptime over the whole period, followed
+// by their recent incidents. It is meant to be shared with customers, so
+// checks only appear on it once they are made public.
+func (h *HealthcheckServer) handleStatusPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	now := h.clock.Now()
+	groups := make(map[string]*statusPageGroup)
+	groupUp := make(map[string]int)
+	groupTotal := make(map[string]int)
+	public := make(map[healthcheckId]HealthcheckQuery)
+	for _, healthcheck := range h.ListHealthchecks() {
+		if !healthcheck.Public {
+			continue
+		}
+		public[healthcheck.Id] = healthcheck
+		name := statusPageSection(healthcheck)
+		group, ok := groups[name]
+		if !ok {
+			group = &statusPageGroup{Name: name}
+			groups[name] = group
+		}
+
+		check := statusPageCheck{Url: healthcheck.Url, Status: "UNKNOWN"}
+		if resp, ok := h.rollups.latest(healthcheck.Id); ok {
+			check.Status = resp.statusString()
+		}
+		if healthcheck.Paused {
+			check.Status = "PAUSED"
+		}
+		up, total := 0, 0
+		for _, d := range h.rollups.history(healthcheck.Id, now) {
+			up += d.Up
+			total += d.Total
+			check.Days = append(check.Days, statusPageDay{
+				Class: dayClass(d),
+				Title: d.Day.Format("2006-01-02") + ": " + formatUptime(d.Up, d.Total),
+			})
+		}
+		check.Uptime = formatUptime(up, total)
+		groupUp[name] += up
+		groupTotal[name] += total
+		group.Checks = append(group.Checks, check)
+	}
+
+	page := statusPage{Groups: make([]*statusPageGroup, 0, len(groups)), IncidentDays: statusPageIncidentDays}
+	for name, group := range groups {
+		group.Uptime = formatUptime(groupUp[name], groupTotal[name])
+		page.Groups = append(page.Groups, group)
+	}
+	sort.Slice(page.Groups, func(i, j int) bool {
+		if (page.Groups[i].Name == ungroupedName) != (page.Groups[j].Name == ungroupedName) {
+			return page.Groups[j].Name == ungroupedName
+		}
+		return page.Groups[i].Name < page.Groups[j].Name
+	})
+
+	// Incidents are listed newest first.
+	incidents := h.incidents.list()
+	since := now.AddDate(0, 0, -statusPageIncidentDays)
+	for i := len(incidents) - 1; i >= 0 && len(page.Incidents) < maxStatusPageIncidents; i-- {
+		incident := incidents[i]
+		healthcheck, ok := public[incident.Job]
+		if !ok || (incident.ClosedAt != nil && incident.ClosedAt.Before(since)) {
+			continue
+		}
+		entry := statusPageIncident{
+			Section:  statusPageSection(healthcheck),
+			Url:      healthcheck.Url,
+			OpenedAt: incident.OpenedAt.UTC().Format(statusPageTimeLayout),
+			Ongoing:  incident.ClosedAt == nil,
+		}
+		if !entry.Ongoing {
+			entry.ClosedAt = incident.ClosedAt.UTC().Format(statusPageTimeLayout)
+			entry.Duration = incident.ClosedAt.Sub(incident.OpenedAt).Round(time.Second).String()
+		}
+		page.Incidents = append(page.Incidents, entry)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	statusPageTemplate.Execute(w, page)
+}
@@ -0,0 +1,283 @@
+package uptime
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"golang.org/x/exp/slog"
+)
+
+// jobStore persists checks to a SQLite database, so that they survive a
+// restart. Checks are stored as their JSON definition along with their
+// secrets and the metadata the server keeps, e.g. their version, apart
+// from when they last ran, how many times towards their MaxRuns and the
+// history imported for them. The last alias handed out is stored too, so
+// that a deleted check's alias never refers to another one. A nil jobStore
+// persists nothing.
+type jobStore struct {
+	logger *slog.Logger
+	db     *sql.DB
+}
+
+func openJobStore(path string) (*jobStore, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite only allows one writer at a time anyway.
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS jobs (
+		id TEXT PRIMARY KEY,
+		alias INTEGER NOT NULL UNIQUE,
+		definition TEXT NOT NULL
+	)`)
+	if err == nil {
+		// Kept apart from the definitions, which don't change on every run.
+		_, err = db.Exec(`CREATE TABLE IF NOT EXISTS last_runs (
+			id TEXT PRIMARY KEY,
+			at INTEGER NOT NULL
+		)`)
+	}
+	if err == nil {
+		_, err = db.Exec(`CREATE TABLE IF NOT EXISTS counters (
+			name TEXT PRIMARY KEY,
+			value INTEGER NOT NULL
+		)`)
+	}
+	if err == nil {
+		_, err = db.Exec(`CREATE TABLE IF NOT EXISTS run_counts (
+			id TEXT PRIMARY KEY,
+			runs INTEGER NOT NULL
+		)`)
+	}
+	if err == nil {
+		_, err = db.Exec(`CREATE TABLE IF NOT EXISTS backfills (
+			id TEXT PRIMARY KEY,
+			history TEXT NOT NULL,
+			days TEXT NOT NULL
+		)`)
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &jobStore{logger: slog.Default(), db: db}, nil
+}
+
+func (s *jobStore) close() error {
+	if s == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+// load returns every stored check, by alias.
+func (s *jobStore) load() ([]HealthcheckQuery, error) {
+	rows, err := s.db.Query(`SELECT id, alias, definition FROM jobs ORDER BY alias`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var healthchecks []HealthcheckQuery
+	for rows.Next() {
+		var id string
+		var alias int
+		var definition string
+		err = rows.Scan(&id, &alias, &definition)
+		if err != nil {
+			return nil, err
+		}
+		var healthcheck HealthcheckQuery
+		err = json.Unmarshal([]byte(definition), &healthcheck)
+		if err != nil {
+			return nil, fmt.Errorf("job %s: %w", id, err)
+		}
+		healthcheck.Id = healthcheckId(id)
+		healthcheck.Alias = alias
+		err = healthcheck.restoreMetadata([]byte(definition))
+		if err != nil {
+			return nil, fmt.Errorf("job %s: %w", id, err)
+		}
+		healthchecks = append(healthchecks, healthcheck)
+	}
+	return healthchecks, rows.Err()
+}
+
+func (s *jobStore) save(healthcheck HealthcheckQuery) {
+	if s == nil {
+		return
+	}
+	definition, err := healthcheck.marshalStored()
+	if err == nil {
+		_, err = s.db.Exec(`INSERT INTO jobs (id, alias, definition) VALUES (?, ?, ?)
+			ON CONFLICT (id) DO UPDATE SET alias = excluded.alias, definition = excluded.definition`,
+			string(healthcheck.Id), healthcheck.Alias, string(definition))
+	}
+	if err == nil {
+		_, err = s.db.Exec(`INSERT INTO counters (name, value) VALUES ('alias', ?)
+			ON CONFLICT (name) DO UPDATE SET value = max(value, excluded.value)`, healthcheck.Alias)
+	}
+	if err != nil {
+		s.logger.Error("job-store-save-failed", slog.String("id", string(healthcheck.Id)), slog.String("error", err.Error()))
+	}
+}
+
+// lastAlias returns the last alias handed out, zero if none was or
+// checks aren't stored.
+func (s *jobStore) lastAlias() int {
+	if s == nil {
+		return 0
+	}
+	var alias int
+	err := s.db.QueryRow(`SELECT value FROM counters WHERE name = 'alias'`).Scan(&alias)
+	if err != nil {
+		return 0
+	}
+	return alias
+}
+
+func (s *jobStore) delete(id healthcheckId) {
+	if s == nil {
+		return
+	}
+	_, err := s.db.Exec(`DELETE FROM jobs WHERE id = ?`, string(id))
+	if err == nil {
+		_, err = s.db.Exec(`DELETE FROM last_runs WHERE id = ?`, string(id))
+	}
+	if err == nil {
+		_, err = s.db.Exec(`DELETE FROM run_counts WHERE id = ?`, string(id))
+	}
+	if err == nil {
+		_, err = s.db.Exec(`DELETE FROM backfills WHERE id = ?`, string(id))
+	}
+	if err != nil {
+		s.logger.Error("job-store-delete-failed", slog.String("id", string(id)), slog.String("error", err.Error()))
+	}
+}
+
+// saveLastRun records when a check last ran, so that runs missed while
+// the server was down are noticed once it is back.
+func (s *jobStore) saveLastRun(id healthcheckId, at time.Time) {
+	if s == nil {
+		return
+	}
+	_, err := s.db.Exec(`INSERT INTO last_runs (id, at) VALUES (?, ?)
+		ON CONFLICT (id) DO UPDATE SET at = excluded.at`, string(id), at.UnixNano())
+	if err != nil {
+		s.logger.Error("job-store-save-failed", slog.String("id", string(id)), slog.String("error", err.Error()))
+	}
+}
+
+// lastRun returns when a check last ran, zero if it never did or isn't
+// stored.
+func (s *jobStore) lastRun(id healthcheckId) time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+	var at int64
+	err := s.db.QueryRow(`SELECT at FROM last_runs WHERE id = ?`, string(id)).Scan(&at)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(0, at)
+}
+
+// saveRuns records how many times a check with a MaxRuns ran.
+func (s *jobStore) saveRuns(id healthcheckId, runs int) {
+	if s == nil {
+		return
+	}
+	var err error
+	if runs == 0 {
+		_, err = s.db.Exec(`DELETE FROM run_counts WHERE id = ?`, string(id))
+	} else {
+		_, err = s.db.Exec(`INSERT INTO run_counts (id, runs) VALUES (?, ?)
+			ON CONFLICT (id) DO UPDATE SET runs = excluded.runs`, string(id), runs)
+	}
+	if err != nil {
+		s.logger.Error("job-store-save-failed", slog.String("id", string(id)), slog.String("error", err.Error()))
+	}
+}
+
+// runs returns how many times a check ran towards its MaxRuns, zero if it
+// never did or isn't stored.
+func (s *jobStore) runs(id healthcheckId) int {
+	if s == nil {
+		return 0
+	}
+	var runs int
+	err := s.db.QueryRow(`SELECT runs FROM run_counts WHERE id = ?`, string(id)).Scan(&runs)
+	if err != nil {
+		return 0
+	}
+	return runs
+}
+
+// saveBackfill records the history imported for a check, replacing any
+// imported before.
+func (s *jobStore) saveBackfill(id healthcheckId, history importedHistory, days []dayRollup) error {
+	if s == nil {
+		return nil
+	}
+	historyJSON, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+	daysJSON, err := json.Marshal(days)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO backfills (id, history, days) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET history = excluded.history, days = excluded.days`,
+		string(id), string(historyJSON), string(daysJSON))
+	return err
+}
+
+// backfill returns the history imported for a check, if any.
+func (s *jobStore) backfill(id healthcheckId) (importedHistory, []dayRollup, bool) {
+	var history importedHistory
+	var days []dayRollup
+	if s == nil {
+		return history, days, false
+	}
+	var historyJSON, daysJSON string
+	err := s.db.QueryRow(`SELECT history, days FROM backfills WHERE id = ?`, string(id)).Scan(&historyJSON, &daysJSON)
+	if err == nil {
+		err = json.Unmarshal([]byte(historyJSON), &history)
+	}
+	if err == nil {
+		err = json.Unmarshal([]byte(daysJSON), &days)
+	}
+	if err != nil {
+		if err != sql.ErrNoRows {
+			s.logger.Error("job-store-load-failed", slog.String("id", string(id)), slog.String("error", err.Error()))
+		}
+		return importedHistory{}, nil, false
+	}
+	return history, days, true
+}
+
+// RestoreHealthcheck schedules a check loaded from the store, keeping its
+// id and alias, when it last ran, how many times towards its MaxRuns and
+// the history imported for it.
+func (h *HealthcheckServer) RestoreHealthcheck(healthcheck HealthcheckQuery) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	job := newHealthcheckJob(healthcheck)
+	job.storedRun = h.config.JobStore.lastRun(healthcheck.Id)
+	job.runs = h.config.JobStore.runs(healthcheck.Id)
+	if history, days, ok := h.config.JobStore.backfill(healthcheck.Id); ok {
+		h.backfills.set(healthcheck.Id, history)
+		h.rollups.backfill(healthcheck.Id, days)
+	}
+	h.healthchecks[healthcheck.Id] = job
+	h.aliases[healthcheck.Alias] = healthcheck.Id
+	if healthcheck.Alias > h.nextAlias {
+		h.nextAlias = healthcheck.Alias
+	}
+	h.scheduleJob(job)
+	h.scheduleResumeLocked(job)
+}
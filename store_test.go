@@ -0,0 +1,36 @@
+package uptime
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAliasesNotReassignedAfterReload(t *testing.T) {
+	store, err := openJobStore(filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.close()
+	check := func(healthcheck HealthcheckQuery, ctx context.Context) HealthcheckResponse {
+		return HealthcheckResponse{Status: true}
+	}
+	h, _ := newConfiguredTestServer(t, Config{SuppressNotifications: true, JobStore: store}, check)
+	h.AddHealthcheck(HealthcheckQuery{Type: "http", Url: "http://203.0.113.1", ExpectedStatus: 200, Frequency: time.Minute})
+	deleted := h.AddHealthcheck(HealthcheckQuery{Type: "http", Url: "http://203.0.113.2", ExpectedStatus: 200, Frequency: time.Minute})
+	h.StopHealthcheck(deleted.Id)
+
+	restarted, _ := newConfiguredTestServer(t, Config{SuppressNotifications: true, JobStore: store}, check)
+	restored, err := store.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, healthcheck := range restored {
+		restarted.RestoreHealthcheck(healthcheck)
+	}
+	added := restarted.AddHealthcheck(HealthcheckQuery{Type: "http", Url: "http://203.0.113.3", ExpectedStatus: 200, Frequency: time.Minute})
+	if added.Alias != 3 {
+		t.Errorf("got alias %d, want 3: alias %d belonged to a deleted check", added.Alias, deleted.Alias)
+	}
+}
@@ -0,0 +1,131 @@
+package uptime
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// streamBuffer is how many events a stream consumer may fall behind by
+	// before events are dropped for it.
+	streamBuffer = 256
+	// streamKeepAlive is how often idle streams send a comment, so that
+	// proxies don't close them.
+	streamKeepAlive = 15 * time.Second
+)
+
+// eventStream fans results and state changes out to the consumers of
+// GET /events as they happen. Consumers too slow to keep up miss events
+// rather than hold up checks.
+type eventStream struct {
+	logger      *slog.Logger
+	mu          sync.Mutex
+	subscribers map[chan logEvent]struct{}
+}
+
+func newEventStream() *eventStream {
+	return &eventStream{logger: slog.Default(), subscribers: make(map[chan logEvent]struct{})}
+}
+
+func (s *eventStream) subscribe() chan logEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ch := make(chan logEvent, streamBuffer)
+	s.subscribers[ch] = struct{}{}
+	return ch
+}
+
+func (s *eventStream) unsubscribe(ch chan logEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subscribers, ch)
+}
+
+func (s *eventStream) publish(event logEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.subscribers {
+		select {
+		case ch <- event:
+		default:
+			s.logger.Warn("event-stream-consumer-behind", slog.String("type", event.Type))
+		}
+	}
+}
+
+// handleEvents serves GET /events, which streams results and state changes
+// as Server-Sent Events while the client stays connected: each event is
+// named after its type, result or state, and its data is the event as
+// written to the event log. ?job= restricts the stream to a check, by id
+// or alias, and ?type= to a comma separated list of types. Streams end
+// when the server stops.
+func (h *HealthcheckServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming isn't supported"))
+		return
+	}
+	var jobId healthcheckId
+	if job := r.URL.Query().Get("job"); job != "" {
+		jobId, ok = h.resolveId(job)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	}
+	types := map[string]bool{eventResult: true, eventState: true}
+	if t := r.URL.Query().Get("type"); t != "" {
+		types = make(map[string]bool)
+		for _, name := range strings.Split(t, ",") {
+			if name != eventResult && name != eventState {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid type %q, expected result or state", name))
+				return
+			}
+			types[name] = true
+		}
+	}
+
+	events := h.stream.subscribe()
+	defer h.stream.unsubscribe(events)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Keeps nginx from buffering the stream.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.done:
+			// The server is stopping, which waits for handlers to return.
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case event := <-events:
+			if !types[event.Type] || (jobId != "" && event.Job.Id != jobId) {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				h.logger.Error("event-stream-encode-failed", slog.String("error", err.Error()))
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+		}
+		flusher.Flush()
+	}
+}
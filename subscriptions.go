@@ -0,0 +1,249 @@
+package uptime
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/itchyny/gojq"
+	"golang.org/x/exp/slog"
+)
+
+// subscriptionQueueSize bounds how many results may wait for delivery to
+// a single subscriber before new ones are dropped.
+const subscriptionQueueSize = 100
+
+// subscriptionFilterTimeout bounds how long a subscription's filter may
+// run on a single result.
+const subscriptionFilterTimeout = time.Second
+
+var webhookClient = &http.Client{
+	Timeout: 10 * time.Second,
+}
+
+// resultEvent is the payload delivered to result subscribers, and the
+// input their filters are evaluated against.
+type resultEvent struct {
+	Job      HealthcheckQuery    `json:"job"`
+	Result   HealthcheckResponse `json:"result"`
+	Incident *incident           `json:"incident,omitempty"`
+}
+
+// resultSubscription delivers every result matching its jq filter to a
+// webhook URL. An empty filter matches every result.
+type resultSubscription struct {
+	logger *slog.Logger
+	Id     string
+	Url    string
+	Filter *gojq.Query
+	filter *gojq.Code
+	// client delivers results, held to the global address rules.
+	client *http.Client
+	queue  chan []byte
+	quit   chan struct{}
+}
+
+func (s *resultSubscription) MarshalJSON() ([]byte, error) {
+	var filter string
+	if s.Filter != nil {
+		filter = s.Filter.String()
+	}
+	return json.Marshal(struct {
+		Id     string `json:"id"`
+		Url    string `json:"url"`
+		Filter string `json:"filter,omitempty"`
+	}{s.Id, s.Url, filter})
+}
+
+func (s *resultSubscription) UnmarshalJSON(data []byte) error {
+	d := struct {
+		Url    string `json:"url"`
+		Filter string `json:"filter"`
+	}{}
+	err := json.Unmarshal(data, &d)
+	if err != nil {
+		return err
+	}
+	s.Url, err = normalizeURL(d.Url)
+	if err != nil {
+		return err
+	}
+	if d.Filter != "" {
+		s.Filter, err = gojq.Parse(d.Filter)
+		if err == nil {
+			s.filter, err = gojq.Compile(s.Filter)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid filter: %w", err)
+		}
+	}
+	return nil
+}
+
+// matches reports whether the filter's first output for the event is
+// truthy, i.e. neither false nor null. Filters taking longer than
+// subscriptionFilterTimeout don't match.
+func (s *resultSubscription) matches(event interface{}) bool {
+	if s.filter == nil {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), subscriptionFilterTimeout)
+	defer cancel()
+	v, ok := s.filter.RunWithContext(ctx, event).Next()
+	if !ok {
+		return false
+	}
+	if err, ok := v.(error); ok {
+		s.logger.Warn("subscription-filter-failed", slog.String("subscription", s.Id), slog.String("error", err.Error()))
+		return false
+	}
+	return v != nil && v != false
+}
+
+func (s *resultSubscription) deliver() {
+	for {
+		select {
+		case payload := <-s.queue:
+			resp, err := s.client.Post(s.Url, "application/json", bytes.NewReader(payload))
+			if err != nil {
+				s.logger.Error("subscription-delivery-failed", slog.String("subscription", s.Id), slog.String("error", err.Error()))
+				continue
+			}
+			io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBytes))
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				s.logger.Error("subscription-delivery-failed", slog.String("subscription", s.Id), slog.Int("status", resp.StatusCode))
+			}
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+type subscriptionManager struct {
+	logger        *slog.Logger
+	mu            sync.Mutex
+	subscriptions map[string]*resultSubscription
+}
+
+func newSubscriptionManager() *subscriptionManager {
+	return &subscriptionManager{logger: slog.Default(), subscriptions: make(map[string]*resultSubscription)}
+}
+
+func (m *subscriptionManager) add(s *resultSubscription) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s.Id = newUUID()
+	s.logger = m.logger
+	s.queue = make(chan []byte, subscriptionQueueSize)
+	s.quit = make(chan struct{})
+	m.subscriptions[s.Id] = s
+	go s.deliver()
+}
+
+func (m *subscriptionManager) remove(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.subscriptions[id]
+	if !ok {
+		return false
+	}
+	close(s.quit)
+	delete(m.subscriptions, id)
+	return true
+}
+
+func (m *subscriptionManager) list() []*resultSubscription {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	subscriptions := make([]*resultSubscription, 0, len(m.subscriptions))
+	for _, s := range m.subscriptions {
+		subscriptions = append(subscriptions, s)
+	}
+	sort.Slice(subscriptions, func(i, j int) bool {
+		return subscriptions[i].Id < subscriptions[j].Id
+	})
+	return subscriptions
+}
+
+// publish queues the result, along with the incident it belongs to, for
+// every subscription whose filter matches it. Delivery is asynchronous; a slow subscriber only drops its own
+// results. Filters run without holding m.mu, so a slow one doesn't hold
+// up adding or listing subscriptions.
+func (m *subscriptionManager) publish(healthcheck HealthcheckQuery, resp HealthcheckResponse, incident *incident) {
+	subscriptions := m.list()
+	if len(subscriptions) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(resultEvent{Job: healthcheck, Result: resp, Incident: incident})
+	if err != nil {
+		m.logger.Error("subscription-encode-failed", slog.String("error", err.Error()))
+		return
+	}
+	var event interface{}
+	json.Unmarshal(payload, &event)
+
+	for _, s := range subscriptions {
+		if !s.matches(event) {
+			continue
+		}
+		select {
+		case s.queue <- payload:
+		default:
+			m.logger.Warn("subscription-queue-full", slog.String("subscription", s.Id))
+		}
+	}
+}
+
+var subscriptionPathRegex = regexp.MustCompile("^/subscriptions/([0-9a-f-]+)$")
+
+func (h *HealthcheckServer) handleSubscriptions(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/subscriptions" || r.URL.Path == "/subscriptions/":
+		switch r.Method {
+		case http.MethodGet:
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(h.subscriptions.list())
+		case http.MethodPost:
+			var s resultSubscription
+			err := json.NewDecoder(r.Body).Decode(&s)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			err = h.config.AddressPolicy.validateCallback("", s.Url)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			s.client = h.config.AddressPolicy.rules("").webhookClient()
+			h.subscriptions.add(&s)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(&s)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	case subscriptionPathRegex.MatchString(r.URL.Path):
+		matches := subscriptionPathRegex.FindStringSubmatch(r.URL.Path)
+		switch r.Method {
+		case http.MethodDelete:
+			if !h.subscriptions.remove(matches[1]) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
@@ -0,0 +1,129 @@
+package uptime
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// summaryDays is the window worst offenders are ranked over.
+	summaryDays = 7
+	// summaryOffenders is how many worst offenders are listed by default.
+	summaryOffenders = 10
+)
+
+type summaryCheck struct {
+	Id    healthcheckId `json:"id"`
+	Alias int           `json:"alias"`
+	Url   string        `json:"url"`
+	Group string        `json:"group,omitempty"`
+}
+
+type summaryOffender struct {
+	summaryCheck
+	DownRuns int     `json:"down_runs"`
+	Runs     int     `json:"runs"`
+	Uptime   float64 `json:"uptime"`
+}
+
+type summaryFailure struct {
+	summaryCheck
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// fleetSummary is an overview of every check, enough for a dashboard or a
+// chat bot to render without listing jobs and results separately.
+type fleetSummary struct {
+	// States counts checks by the state of their latest result (up,
+	// down, degraded, maintenance, skipped, e.g. when throttled by the
+	// target, or unknown, also if there's no result yet) or as paused.
+	States         map[string]int    `json:"states"`
+	WorstOffenders []summaryOffender `json:"worst_offenders"`
+	Failing        []summaryFailure  `json:"failing"`
+}
+
+func (h *HealthcheckServer) summarize(offenders int) fleetSummary {
+	summary := fleetSummary{
+		States:         map[string]int{"up": 0, "down": 0, "degraded": 0, "maintenance": 0, "skipped": 0, "paused": 0, "unknown": 0},
+		WorstOffenders: []summaryOffender{},
+		Failing:        []summaryFailure{},
+	}
+	now := h.clock.Now()
+	for _, healthcheck := range h.ListHealthchecks() {
+		check := summaryCheck{
+			Id:    healthcheck.Id,
+			Alias: healthcheck.Alias,
+			Url:   healthcheck.Url,
+			Group: healthcheck.Group,
+		}
+		resp, ok := h.rollups.latest(healthcheck.Id)
+		switch {
+		case healthcheck.Paused:
+			summary.States["paused"]++
+		case !ok:
+			summary.States["unknown"]++
+		case resp.state() != stateDown:
+			summary.States[strings.ToLower(string(resp.state()))]++
+		default:
+			summary.States["down"]++
+			summary.Failing = append(summary.Failing, summaryFailure{
+				summaryCheck: check,
+				Error:        resp.Error,
+				CheckedAt:    resp.Timestamp,
+			})
+		}
+
+		history := h.rollups.history(healthcheck.Id, now)
+		up, total := 0, 0
+		for _, d := range history[len(history)-summaryDays:] {
+			up += d.Up
+			total += d.Total
+		}
+		if up < total {
+			summary.WorstOffenders = append(summary.WorstOffenders, summaryOffender{
+				summaryCheck: check,
+				DownRuns:     total - up,
+				Runs:         total,
+				Uptime:       float64(up) / float64(total),
+			})
+		}
+	}
+
+	sort.SliceStable(summary.WorstOffenders, func(i, j int) bool {
+		a, b := summary.WorstOffenders[i], summary.WorstOffenders[j]
+		if a.Uptime != b.Uptime {
+			return a.Uptime < b.Uptime
+		}
+		return a.DownRuns > b.DownRuns
+	})
+	if len(summary.WorstOffenders) > offenders {
+		summary.WorstOffenders = summary.WorstOffenders[:offenders]
+	}
+	return summary
+}
+
+// handleSummary returns the fleetSummary. The limit parameter sets how
+// many worst offenders are listed.
+func (h *HealthcheckServer) handleSummary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	offenders := summaryOffenders
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, errors.New("limit must be a non-negative integer"))
+			return
+		}
+		offenders = n
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(h.summarize(offenders))
+}
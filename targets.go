@@ -0,0 +1,287 @@
+package uptime
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// privateNetworks is what the "private" keyword stands for in address
+// policies: loopback, RFC 1918, carrier-grade NAT, link-local (including
+// cloud metadata endpoints such as 169.254.169.254) and unique local
+// addresses.
+var privateNetworks = []string{
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"::/128",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+}
+
+// addressPolicy restricts the addresses checks may connect to, so that the
+// tenants of a shared install can't use checks to probe internal services.
+// Namespaces may deny more networks, or allow some of the globally denied
+// ones back.
+type addressPolicy struct {
+	global     addressRules
+	namespaces map[string]addressRules
+}
+
+type addressPolicyFile struct {
+	Deny       []string `yaml:"deny"`
+	Namespaces map[string]struct {
+		Allow []string `yaml:"allow"`
+		Deny  []string `yaml:"deny"`
+	} `yaml:"namespaces"`
+}
+
+// addressRules are the rules for a single namespace.
+type addressRules struct {
+	deny  []netip.Prefix
+	allow []netip.Prefix
+	// client is used instead of the shared probe client by namespaces
+	// allowed to reach otherwise denied networks, so that other namespaces
+	// can't reuse the connections they make.
+	client *http.Client
+	// webhooks is what requests to URLs given along with checks, e.g.
+	// their webhooks or validator, are made with.
+	webhooks *http.Client
+}
+
+func readAddressPolicy(path string) (*addressPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file addressPolicyFile
+	err = yaml.Unmarshal(data, &file)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address policy: %w", err)
+	}
+
+	policy := &addressPolicy{namespaces: make(map[string]addressRules)}
+	policy.global.deny, err = parsePrefixes(file.Deny)
+	if err != nil {
+		return nil, err
+	}
+	policy.global.webhooks = newWebhookClient(policy.global)
+	for name, ns := range file.Namespaces {
+		rules := addressRules{deny: policy.global.deny}
+		deny, err := parsePrefixes(ns.Deny)
+		if err != nil {
+			return nil, fmt.Errorf("namespace %q: %w", name, err)
+		}
+		rules.deny = append(append([]netip.Prefix{}, rules.deny...), deny...)
+		rules.allow, err = parsePrefixes(ns.Allow)
+		if err != nil {
+			return nil, fmt.Errorf("namespace %q: %w", name, err)
+		}
+		if len(rules.allow) > 0 {
+			rules.client = &http.Client{
+				Transport: newProbeTransport(),
+			}
+		}
+		rules.webhooks = newWebhookClient(rules)
+		policy.namespaces[name] = rules
+	}
+	return policy, nil
+}
+
+func parsePrefixes(networks []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, network := range networks {
+		if network == "private" {
+			for _, private := range privateNetworks {
+				prefixes = append(prefixes, netip.MustParsePrefix(private))
+			}
+			continue
+		}
+		prefix, err := netip.ParsePrefix(network)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(network)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid network %q, expected a CIDR, an address or private", network)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// rules returns the rules checks in the given namespace are held to. A nil
+// policy allows everything.
+func (p *addressPolicy) rules(namespace string) addressRules {
+	if p == nil {
+		return addressRules{}
+	}
+	if rules, ok := p.namespaces[namespace]; ok {
+		return rules
+	}
+	return p.global
+}
+
+func (r addressRules) permits(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range r.allow {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	for _, prefix := range r.deny {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateTarget rejects checks whose host, or the host of any of their
+// steps, is or currently resolves to a denied address, and checks bound to
+// a source address this host doesn't have. This only catches mistakes
+// early: hosts can resolve differently later, so the rules are enforced
+// again on every dial.
+func (p *addressPolicy) validateTarget(healthcheck HealthcheckQuery) error {
+	if healthcheck.SourceAddress != "" {
+		err := validateSourceAddress(healthcheck.SourceAddress)
+		if err != nil {
+			return err
+		}
+	}
+	rules := p.rules(healthcheck.Namespace)
+	if len(rules.deny) == 0 {
+		return nil
+	}
+	resolver := net.DefaultResolver
+	if len(healthcheck.Resolvers) > 0 {
+		resolver = newResolver(healthcheck.Resolvers)
+	}
+	err := rules.validateURL(healthcheck.Url, resolver)
+	if err != nil {
+		return err
+	}
+	for _, step := range healthcheck.Steps {
+		err = rules.validateURL(step.Url, resolver)
+		if err != nil {
+			return err
+		}
+	}
+	// The check's own callbacks are held to the same rules.
+	for _, callback := range append([]string{healthcheck.Validator}, healthcheck.ownWebhooks()...) {
+		err = p.validateCallback(healthcheck.Namespace, callback)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateCallback rejects a URL requests are sent to on behalf of the
+// namespace, e.g. a webhook, if it resolves to an address the namespace's
+// checks may not connect to. Like validateTarget, it only catches mistakes
+// early.
+func (p *addressPolicy) validateCallback(namespace string, rawUrl string) error {
+	rules := p.rules(namespace)
+	if rawUrl == "" || len(rules.deny) == 0 {
+		return nil
+	}
+	return rules.validateURL(rawUrl, net.DefaultResolver)
+}
+
+func (rules addressRules) validateURL(rawUrl string, resolver *net.Resolver) error {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return err
+	}
+	addrs := []netip.Addr{}
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil {
+		addrs = append(addrs, addr)
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		// A host that doesn't resolve right now is left to the dial
+		// time check.
+		addrs, _ = resolver.LookupNetIP(ctx, "ip", u.Hostname())
+	}
+	for _, addr := range addrs {
+		if !rules.permits(addr) {
+			return fmt.Errorf("url resolves to %s, which checks in this namespace may not connect to", addr.Unmap())
+		}
+	}
+	return nil
+}
+
+// newWebhookClient returns a client like webhookClient that may only
+// connect to addresses the rules permit.
+func newWebhookClient(rules addressRules) *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, ControlContext: controlAddress}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network string, address string) (net.Conn, error) {
+		return dialer.DialContext(withAddressRules(ctx, rules), network, address)
+	}
+	return &http.Client{Timeout: webhookClient.Timeout, Transport: transport}
+}
+
+// webhookClient returns the client requests to URLs given along with
+// checks held to the rules are made with, so that their callbacks can't
+// reach what the checks themselves may not.
+func (r addressRules) webhookClient() *http.Client {
+	if r.webhooks == nil {
+		return webhookClient
+	}
+	return r.webhooks
+}
+
+type addressRulesKey struct{}
+
+// withAddressRules makes the probe client refuse to connect to addresses
+// the rules deny while running checks with ctx.
+func withAddressRules(ctx context.Context, rules addressRules) context.Context {
+	return context.WithValue(ctx, addressRulesKey{}, rules)
+}
+
+// controlAddress is run by the probe dialer just before connecting, after
+// name resolution, so it sees the address actually connected to.
+func controlAddress(ctx context.Context, network string, address string, c syscall.RawConn) error {
+	rules, ok := ctx.Value(addressRulesKey{}).(addressRules)
+	if !ok {
+		return nil
+	}
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !rules.permits(addrPort.Addr()) {
+		return fmt.Errorf("connecting to %s is not allowed", addrPort.Addr().Unmap())
+	}
+	return nil
+}
+
+// probeClient returns the client a check run with ctx should use.
+func probeClient(ctx context.Context) *http.Client {
+	client := httpClient
+	if freshConnection(ctx) {
+		client = freshConnectionClient
+	} else if rules, ok := ctx.Value(addressRulesKey{}).(addressRules); ok && rules.client != nil {
+		client = rules.client
+	}
+	source, _ := ctx.Value(sourceAddressKey{}).(string)
+	if resolvers := resolversFrom(ctx); source != "" || resolvers != "" {
+		return sourceClient(client, source, resolvers)
+	}
+	return client
+}
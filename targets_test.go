@@ -0,0 +1,75 @@
+package uptime
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testAddressPolicy(t *testing.T, policy string) *addressPolicy {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	err := os.WriteFile(path, []byte(policy), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := readAddressPolicy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestCreateJobCallbacksAddressPolicy(t *testing.T) {
+	h, _ := newTestServer(t, func(healthcheck HealthcheckQuery, ctx context.Context) HealthcheckResponse {
+		return HealthcheckResponse{Status: true}
+	})
+	h.config.AddressPolicy = testAddressPolicy(t, "deny: [private]\n")
+	handler := h.Handler()
+
+	tests := []struct {
+		name   string
+		fields string
+		status int
+	}{
+		{"webhook", `"webhooks":["http://10.0.0.1/hook"]`, http.StatusBadRequest},
+		{"slack webhook", `"slack_webhook":"http://169.254.169.254/hook"`, http.StatusBadRequest},
+		{"warning webhook", `"warnings":{"webhooks":["http://127.0.0.1:8081/jobs"]}`, http.StatusBadRequest},
+		{"warning slack webhook", `"warnings":{"slack_webhook":"http://192.168.1.1/hook"}`, http.StatusBadRequest},
+		{"public warning webhook", `"warnings":{"webhooks":["http://203.0.113.7/hook"]}`, http.StatusCreated},
+		{"latency SLO webhook", `"latency_slo":{"percentile":95,"threshold":"300ms","webhooks":["http://10.1.2.3/hook"]}`, http.StatusBadRequest},
+		{"latency SLO slack webhook", `"latency_slo":{"percentile":95,"threshold":"300ms","slack_webhook":"http://[::1]/hook"}`, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		body := `{"url":"http://203.0.113.1","expected_status":200,"frequency":"1m",` + test.fields + `}`
+		r := httptest.NewRequest(http.MethodPost, "/jobs?force=true", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Errorf("%s: got status %d, want %d: %s", test.name, w.Code, test.status, w.Body)
+		}
+	}
+}
+
+func TestOwnsWebhook(t *testing.T) {
+	healthcheck := HealthcheckQuery{
+		Webhooks:     []string{"http://203.0.113.1/a"},
+		SlackWebhook: "http://203.0.113.1/b",
+		Warnings:     &WarningChannels{Webhooks: []string{"http://203.0.113.1/c"}, SlackWebhook: "http://203.0.113.1/d"},
+		LatencySLO:   &LatencySLO{Webhooks: []string{"http://203.0.113.1/f"}, SlackWebhook: "http://203.0.113.1/g"},
+	}
+	for _, url := range []string{"http://203.0.113.1/a", "http://203.0.113.1/b", "http://203.0.113.1/c", "http://203.0.113.1/d", "http://203.0.113.1/f", "http://203.0.113.1/g"} {
+		if !healthcheck.ownsWebhook(url) {
+			t.Errorf("%s isn't owned by the check", url)
+		}
+	}
+	for _, url := range []string{"", "http://203.0.113.1/e"} {
+		if healthcheck.ownsWebhook(url) {
+			t.Errorf("%q is owned by the check", url)
+		}
+	}
+}
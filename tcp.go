@@ -0,0 +1,55 @@
+package uptime
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// checkTypeTCP checks that a TCP connection can be established, e.g. to a
+// database or another service that doesn't speak HTTP.
+const checkTypeTCP = "tcp"
+
+var tcpPorts = map[string]string{
+	"tcp": "",
+}
+
+// normalizeTCPURL normalizes the address of a TCP check, given as
+// tcp://host:port or just host:port.
+func normalizeTCPURL(raw string) (string, error) {
+	normalized, err := normalizeURLSchemes(raw, "tcp", tcpPorts)
+	if err != nil {
+		return "", err
+	}
+	u, _ := url.Parse(normalized)
+	if u.Port() == "" {
+		return "", fmt.Errorf("invalid url %q: tcp urls require a port", raw)
+	}
+	if u.Path != "" && u.Path != "/" || u.RawQuery != "" {
+		return "", fmt.Errorf("invalid url %q: tcp urls can't have a path or query", raw)
+	}
+	u.Path = ""
+	return u.String(), nil
+}
+
+// checkTCP is up if a connection to the check's host and port can be
+// established within its timeout. The connection is closed right away.
+func (h HealthcheckQuery) checkTCP(ctx context.Context) HealthcheckResponse {
+	u, err := url.Parse(h.Url)
+	if err != nil {
+		return failCheck(ctx, "%v", err)
+	}
+	timeout := h.timeout()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	dialer, err := probeDialer(ctx, "tcp")
+	if err != nil {
+		return failCheck(ctx, "%v", err)
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", u.Host)
+	if err != nil {
+		return failCheck(ctx, "%v", err)
+	}
+	countTransfer(ctx, conn).Close()
+	return HealthcheckResponse{Status: true}
+}
@@ -0,0 +1,43 @@
+package uptime
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRetryAfter caps how long a target can ask for a check to be put off,
+// so that a misbehaving target can't park a check indefinitely.
+const maxRetryAfter = time.Hour
+
+// maxThrottledFor is how long a target may keep throttling a check before
+// its throttled results count as failures.
+const maxThrottledFor = time.Hour
+
+// throttled reports whether a response asks to be retried later, and after
+// how long. Only 429 and 503 responses with a Retry-After header count.
+func throttled(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+	header := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if header == "" {
+		return 0, false
+	}
+	var delay time.Duration
+	if seconds, err := strconv.Atoi(header); err == nil {
+		delay = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(header); err == nil {
+		delay = at.Sub(now)
+	} else {
+		return 0, false
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	if delay > maxRetryAfter {
+		delay = maxRetryAfter
+	}
+	return delay, true
+}
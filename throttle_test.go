@@ -0,0 +1,102 @@
+package uptime
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestThrottled(t *testing.T) {
+	now := testEpoch
+	tests := []struct {
+		status     int
+		retryAfter string
+		delay      time.Duration
+		throttled  bool
+	}{
+		{http.StatusTooManyRequests, "120", 2 * time.Minute, true},
+		{http.StatusServiceUnavailable, now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second, true},
+		{http.StatusTooManyRequests, now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{http.StatusTooManyRequests, "86400", maxRetryAfter, true},
+		{http.StatusTooManyRequests, "", 0, false},
+		{http.StatusTooManyRequests, "soon", 0, false},
+		{http.StatusInternalServerError, "120", 0, false},
+	}
+	for _, test := range tests {
+		resp := &http.Response{StatusCode: test.status, Header: http.Header{}}
+		if test.retryAfter != "" {
+			resp.Header.Set("Retry-After", test.retryAfter)
+		}
+		delay, ok := throttled(resp, now)
+		if delay != test.delay || ok != test.throttled {
+			t.Errorf("%d with Retry-After %q: got %s, %t, want %s, %t", test.status, test.retryAfter, delay, ok, test.delay, test.throttled)
+		}
+	}
+}
+
+func TestThrottledRuns(t *testing.T) {
+	throttling := true
+	h, clk := newTestServer(t, func(healthcheck HealthcheckQuery, ctx context.Context) HealthcheckResponse {
+		if !throttling {
+			return HealthcheckResponse{Status: true}
+		}
+		resp := failCheckReason(ctx, reasonThrottled, "throttled, retry after %s", 10*time.Minute)
+		resp.Throttled = true
+		resp.RetryAfter = 10 * time.Minute
+		return resp
+	})
+	healthcheck := h.AddHealthcheck(HealthcheckQuery{Url: "http://example.com", Frequency: time.Minute})
+	h.mu.Lock()
+	job := h.healthchecks[healthcheck.Id]
+	h.mu.Unlock()
+	step := func() {
+		clk.Advance(time.Minute)
+		h.scheduler.dispatchDue()
+		h.scheduler.waitIdle()
+	}
+
+	// Runs are put off as asked, without the check going down, for up to
+	// maxThrottledFor.
+	for elapsed := time.Minute; elapsed <= maxThrottledFor; elapsed += time.Minute {
+		step()
+	}
+	results := h.results.list(healthcheck.Id, time.Time{}, 100)
+	if len(results) != 6 {
+		t.Fatalf("got %d results, want one every 10 minutes", len(results))
+	}
+	for _, resp := range results {
+		if resp.state() != stateSkipped {
+			t.Errorf("result at %s is %s, want SKIPPED", resp.Timestamp, resp.state())
+		}
+	}
+	if job.down {
+		t.Errorf("the check went down while throttled")
+	}
+
+	// Throttled for maxThrottledFor now, the next run counts as a failure,
+	// though it still puts the one after off.
+	step()
+	resp := h.results.list(healthcheck.Id, time.Time{}, 1)[0]
+	if resp.state() != stateDown || resp.Reason != reasonThrottled {
+		t.Fatalf("got %s (%s), want DOWN (throttled)", resp.state(), resp.Reason)
+	}
+	if !job.down {
+		t.Errorf("the check isn't down")
+	}
+	if want := clk.Now().Add(10 * time.Minute); !job.next.Equal(want) {
+		t.Errorf("next run at %s, want %s", job.next, want)
+	}
+
+	// Once the target stops throttling, the clock starts over.
+	throttling = false
+	for i := 0; i < 10; i++ {
+		step()
+	}
+	if resp := h.results.list(healthcheck.Id, time.Time{}, 1)[0]; resp.state() != stateUp {
+		t.Fatalf("got %s, want UP", resp.state())
+	}
+	if !job.throttledSince.IsZero() {
+		t.Errorf("still throttled since %s", job.throttledSince)
+	}
+}
@@ -0,0 +1,166 @@
+package uptime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptrace"
+	"strings"
+)
+
+// checkTypeTransaction makes a sequence of requests sharing cookies, e.g.
+// logging in and then loading a page only logged in users can see.
+const checkTypeTransaction = "transaction"
+
+// maxTransactionSteps is the most requests a transaction check may make.
+const maxTransactionSteps = 20
+
+// TransactionStep is one request of a transaction check, and the status
+// it must respond with.
+type TransactionStep struct {
+	Method         string            `json:"method"`
+	Url            string            `json:"url"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	RequestBody    string            `json:"request_body,omitempty"`
+	ContentType    string            `json:"content_type,omitempty"`
+	ExpectedStatus int               `json:"expected_status"`
+}
+
+func (s *TransactionStep) validate(n int) error {
+	var err error
+	s.Url, err = normalizeURL(s.Url)
+	if err != nil {
+		return fmt.Errorf("step %d: %w", n, err)
+	}
+	s.Method = strings.ToUpper(s.Method)
+	if s.Method == "" {
+		s.Method = http.MethodGet
+	}
+	if !httpCheckMethods[s.Method] {
+		return fmt.Errorf("step %d: method %s not supported, expected GET, HEAD, POST, PUT, PATCH, DELETE or OPTIONS", n, s.Method)
+	}
+	s.Headers, err = normalizeRequestHeaders(s.Headers)
+	if err != nil {
+		return fmt.Errorf("step %d: %w", n, err)
+	}
+	if s.RequestBody == "" && s.ContentType != "" {
+		return fmt.Errorf("step %d: content_type requires a request_body", n)
+	}
+	if s.RequestBody != "" {
+		if s.Method != http.MethodPost && s.Method != http.MethodPut && s.Method != http.MethodPatch {
+			return fmt.Errorf("step %d: request_body isn't supported for %s requests", n, s.Method)
+		}
+		if s.ContentType == "" {
+			s.ContentType = defaultContentType(s.RequestBody)
+		}
+	}
+	if s.ExpectedStatus == 0 {
+		s.ExpectedStatus = http.StatusOK
+	}
+	if s.ExpectedStatus < 100 || s.ExpectedStatus > 599 {
+		return fmt.Errorf("step %d: invalid expected_status %d", n, s.ExpectedStatus)
+	}
+	return nil
+}
+
+func (s TransactionStep) equal(other TransactionStep) bool {
+	return s.Method == other.Method && s.Url == other.Url && equalHeaders(s.Headers, other.Headers) &&
+		s.RequestBody == other.RequestBody && s.ContentType == other.ContentType && s.ExpectedStatus == other.ExpectedStatus
+}
+
+func equalSteps(a, b []TransactionStep) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkTransaction makes the check's requests in order, with cookies set
+// by earlier responses sent along with later requests, and without
+// following redirects, which are steps of their own. It fails at the
+// first step that doesn't respond with its expected status.
+func (h HealthcheckQuery) checkTransaction(ctx context.Context, dial *dialTracer) (result HealthcheckResponse) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return failCheck(ctx, "%v", err)
+	}
+	client := *probeClient(ctx)
+	client.Jar = jar
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	trace := traceFrom(ctx)
+	for i, step := range h.Steps {
+		var body io.Reader
+		if step.RequestBody != "" {
+			body = strings.NewReader(step.RequestBody)
+		}
+		stepCtx, cancel := context.WithTimeout(ctx, h.timeout())
+		req, err := http.NewRequestWithContext(stepCtx, step.Method, step.Url, body)
+		if err != nil {
+			cancel()
+			return failCheck(ctx, "Step %d: %v", i+1, err)
+		}
+		req.Header.Add("Accept", "application/json")
+		if step.RequestBody != "" {
+			req.Header.Set("Content-Type", step.ContentType)
+		}
+		for name, value := range step.Headers {
+			req.Header.Set(name, value)
+		}
+		req.Header.Set(correlationHeader, correlationId(ctx))
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), probeConnStats.trace()))
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), dial.trace()))
+		req = withTransferTrace(req)
+		req = trace.request(req)
+		resp, err := client.Do(req)
+		if err != nil {
+			cancel()
+			return failCheck(ctx, "Step %d (%s %s): %v", i+1, step.Method, step.Url, err)
+		}
+		trace.response(resp)
+		io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBytes))
+		resp.Body.Close()
+		cancel()
+		if resp.StatusCode != step.ExpectedStatus {
+			err = fmt.Errorf("unexpected status code, %d != %d", resp.StatusCode, step.ExpectedStatus)
+		}
+		trace.assert(fmt.Sprintf("steps[%d].expected_status", i), step.ExpectedStatus, resp.StatusCode, err)
+		if err != nil {
+			result = failCheckReason(ctx, reasonUnexpectedStatus, "Step %d (%s %s): %v", i+1, step.Method, step.Url, err)
+			result.StatusCode = resp.StatusCode
+			return result
+		}
+		result.StatusCode = resp.StatusCode
+	}
+	result.Status = true
+	return result
+}
+
+// validateTransaction validates the steps of a transaction check.
+func (h *HealthcheckQuery) validateTransaction() error {
+	if len(h.Steps) == 0 {
+		return errors.New("transaction checks require steps")
+	}
+	if len(h.Steps) > maxTransactionSteps {
+		return fmt.Errorf("transaction checks have at most %d steps", maxTransactionSteps)
+	}
+	for i := range h.Steps {
+		err := h.Steps[i].validate(i + 1)
+		if err != nil {
+			return err
+		}
+	}
+	if h.Url == "" {
+		h.Url = h.Steps[0].Url
+	}
+	return nil
+}
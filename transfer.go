@@ -0,0 +1,334 @@
+package uptime
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultTransferLimit is how many checks GET /transfer lists unless asked
+// otherwise.
+const defaultTransferLimit = 20
+
+// transferUsage is what probes cost: the requests they made, i.e. HTTP
+// requests, connections for other checks and pings, and the bytes they
+// sent and received over them. Bytes are counted above TCP and UDP, TLS
+// included, so they approximate the bandwidth used.
+type transferUsage struct {
+	Requests      int64 `json:"requests"`
+	BytesSent     int64 `json:"bytes_sent"`
+	BytesReceived int64 `json:"bytes_received"`
+}
+
+func (u *transferUsage) add(other transferUsage) {
+	u.Requests += other.Requests
+	u.BytesSent += other.BytesSent
+	u.BytesReceived += other.BytesReceived
+}
+
+func (u transferUsage) bytes() int64 {
+	return u.BytesSent + u.BytesReceived
+}
+
+// transferCounter counts a probe's usage as it goes. A nil transferCounter
+// counts nothing.
+type transferCounter struct {
+	requests atomic.Int64
+	sent     atomic.Int64
+	received atomic.Int64
+}
+
+func (c *transferCounter) request() {
+	if c != nil {
+		c.requests.Add(1)
+	}
+}
+
+func (c *transferCounter) usage() transferUsage {
+	return transferUsage{Requests: c.requests.Load(), BytesSent: c.sent.Load(), BytesReceived: c.received.Load()}
+}
+
+type transferCounterKey struct{}
+
+// withTransferCounter returns a context counting the usage of the probes
+// run with it.
+func withTransferCounter(ctx context.Context) (context.Context, *transferCounter) {
+	c := &transferCounter{}
+	return context.WithValue(ctx, transferCounterKey{}, c), c
+}
+
+func transferCounterFrom(ctx context.Context) *transferCounter {
+	c, _ := ctx.Value(transferCounterKey{}).(*transferCounter)
+	return c
+}
+
+// transferConn counts what is sent and received over a probe connection
+// towards the counter of the probe using it, which changes as pooled HTTP
+// connections are reused by other checks.
+type transferConn struct {
+	net.Conn
+	counter atomic.Pointer[transferCounter]
+}
+
+func (c *transferConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if counter := c.counter.Load(); counter != nil {
+		counter.received.Add(int64(n))
+	}
+	return n, err
+}
+
+func (c *transferConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if counter := c.counter.Load(); counter != nil {
+		counter.sent.Add(int64(n))
+	}
+	return n, err
+}
+
+// countTransfer counts the usage of a connection dialed for the probe of
+// ctx. HTTP requests count themselves; see transferTrace.
+func countTransfer(ctx context.Context, conn net.Conn) net.Conn {
+	c := &transferConn{Conn: conn}
+	c.counter.Store(transferCounterFrom(ctx))
+	if _, isHTTP := ctx.Value(transferHTTPKey{}).(bool); !isHTTP {
+		c.counter.Load().request()
+	}
+	return c
+}
+
+// transferHTTPKey marks the contexts of HTTP requests, whose connections
+// don't count as requests of their own.
+type transferHTTPKey struct{}
+
+// transferTrace counts an HTTP request towards the usage of the probe of
+// ctx, along with what goes over its connection, pooled or not.
+func transferTrace(ctx context.Context) (context.Context, *httptrace.ClientTrace) {
+	counter := transferCounterFrom(ctx)
+	return context.WithValue(ctx, transferHTTPKey{}, true), &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			counter.request()
+			conn := info.Conn
+			for conn != nil {
+				switch c := conn.(type) {
+				case *transferConn:
+					c.counter.Store(counter)
+					return
+				case *tls.Conn:
+					conn = c.NetConn()
+				case *countedConn:
+					conn = c.Conn
+				default:
+					return
+				}
+			}
+		},
+	}
+}
+
+// withTransferTrace returns req counting towards its probe's usage.
+func withTransferTrace(req *http.Request) *http.Request {
+	ctx, trace := transferTrace(req.Context())
+	return req.WithContext(httptrace.WithClientTrace(ctx, trace))
+}
+
+// checkTransfer is a check's usage since it was first run.
+type checkTransfer struct {
+	url       string
+	method    string
+	namespace string
+	since     time.Time
+	runs      int64
+	transferUsage
+}
+
+// transferStats adds up the usage of checks, and of namespaces, which
+// keep the usage of their deleted checks.
+type transferStats struct {
+	mu         sync.Mutex
+	checks     map[healthcheckId]*checkTransfer
+	namespaces map[string]*transferUsage
+}
+
+func newTransferStats() *transferStats {
+	return &transferStats{
+		checks:     make(map[healthcheckId]*checkTransfer),
+		namespaces: make(map[string]*transferUsage),
+	}
+}
+
+func (s *transferStats) handle(e busEvent) {
+	if e.Result.Transfer == nil {
+		return
+	}
+	usage := *e.Result.Transfer
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.checks[e.Job.Id]
+	if !ok {
+		c = &checkTransfer{since: e.Time}
+		s.checks[e.Job.Id] = c
+	}
+	c.url, c.method, c.namespace = e.Job.Url, e.Job.Method, e.Job.Namespace
+	c.runs++
+	c.add(usage)
+	n, ok := s.namespaces[e.Job.Namespace]
+	if !ok {
+		n = &transferUsage{}
+		s.namespaces[e.Job.Namespace] = n
+	}
+	n.add(usage)
+}
+
+func (s *transferStats) forget(id healthcheckId) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.checks, id)
+}
+
+func (s *transferStats) get(id healthcheckId) (checkTransfer, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.checks[id]
+	if !ok {
+		return checkTransfer{}, false
+	}
+	return *c, true
+}
+
+// jobTransfer is a check's usage as reported by the API: in total, per run
+// and per day at its current frequency.
+type jobTransfer struct {
+	Id        healthcheckId `json:"id"`
+	Url       string        `json:"url"`
+	Namespace string        `json:"namespace,omitempty"`
+	Since     *time.Time    `json:"since"`
+	Runs      int64         `json:"runs"`
+	transferUsage
+	BytesPerRun float64 `json:"bytes_per_run"`
+	BytesPerDay float64 `json:"bytes_per_day"`
+}
+
+func newJobTransfer(healthcheck HealthcheckQuery, c checkTransfer) jobTransfer {
+	t := jobTransfer{Id: healthcheck.Id, Url: healthcheck.Url, Namespace: healthcheck.Namespace, Runs: c.runs, transferUsage: c.transferUsage}
+	if c.runs > 0 {
+		t.Since = &c.since
+		t.BytesPerRun = float64(c.bytes()) / float64(c.runs)
+		if interval := healthcheck.interval(false); interval > 0 {
+			t.BytesPerDay = t.BytesPerRun * float64(24*time.Hour) / float64(interval)
+		}
+	}
+	return t
+}
+
+// handleGetJobTransfer serves GET /jobs/{id}/transfer, the requests and
+// bytes a check's runs took since it was created or the server started.
+func (h *HealthcheckServer) handleGetJobTransfer(w http.ResponseWriter, r *http.Request, jobId healthcheckId) {
+	healthcheck, ok := h.GetHealthcheck(jobId)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	c, _ := h.transfers.get(jobId)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(newJobTransfer(healthcheck, c))
+}
+
+// handleTransfer serves GET /transfer, the usage of each namespace and of
+// the ?limit= checks using the most bandwidth, most first.
+func (h *HealthcheckServer) handleTransfer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	limit := defaultTransferLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q", value))
+			return
+		}
+	}
+	type namespaceTransfer struct {
+		Namespace string `json:"namespace"`
+		transferUsage
+	}
+	report := struct {
+		Namespaces []namespaceTransfer `json:"namespaces"`
+		Checks     []jobTransfer       `json:"checks"`
+	}{Namespaces: []namespaceTransfer{}, Checks: []jobTransfer{}}
+	h.transfers.mu.Lock()
+	for namespace, usage := range h.transfers.namespaces {
+		report.Namespaces = append(report.Namespaces, namespaceTransfer{namespace, *usage})
+	}
+	checks := make(map[healthcheckId]checkTransfer, len(h.transfers.checks))
+	for id, c := range h.transfers.checks {
+		checks[id] = *c
+	}
+	h.transfers.mu.Unlock()
+	sort.Slice(report.Namespaces, func(i, j int) bool {
+		return report.Namespaces[i].Namespace < report.Namespaces[j].Namespace
+	})
+	for _, healthcheck := range h.ListHealthchecks() {
+		if c, ok := checks[healthcheck.Id]; ok {
+			report.Checks = append(report.Checks, newJobTransfer(healthcheck, c))
+		}
+	}
+	sort.SliceStable(report.Checks, func(i, j int) bool {
+		return report.Checks[i].bytes() > report.Checks[j].bytes()
+	})
+	if len(report.Checks) > limit {
+		report.Checks = report.Checks[:limit]
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+}
+
+// writeMetrics writes the usage of each check, labeled like its other
+// series, and of each namespace.
+func (s *transferStats) writeMetrics(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]healthcheckId, 0, len(s.checks))
+	for id := range s.checks {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	namespaces := make([]string, 0, len(s.namespaces))
+	for namespace := range s.namespaces {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	for _, metric := range []struct {
+		name  string
+		help  string
+		value func(transferUsage) int64
+	}{
+		{"requests_total", "Requests made by %s: HTTP requests, connections or pings.", func(u transferUsage) int64 { return u.Requests }},
+		{"sent_bytes_total", "Bytes sent by %s.", func(u transferUsage) int64 { return u.BytesSent }},
+		{"received_bytes_total", "Bytes received by %s.", func(u transferUsage) int64 { return u.BytesReceived }},
+	} {
+		fmt.Fprintf(w, "# HELP uptime_check_%s %s\n", metric.name, fmt.Sprintf(metric.help, "the check's runs"))
+		fmt.Fprintf(w, "# TYPE uptime_check_%s counter\n", metric.name)
+		for _, id := range ids {
+			c := s.checks[id]
+			fmt.Fprintf(w, "uptime_check_%s{url=%s,method=%s,id=%s} %d\n", metric.name, strconv.Quote(c.url), strconv.Quote(c.method), strconv.Quote(string(id)), metric.value(c.transferUsage))
+		}
+		fmt.Fprintf(w, "# HELP uptime_namespace_%s %s\n", metric.name, fmt.Sprintf(metric.help, "the runs of the namespace's checks"))
+		fmt.Fprintf(w, "# TYPE uptime_namespace_%s counter\n", metric.name)
+		for _, namespace := range namespaces {
+			fmt.Fprintf(w, "uptime_namespace_%s{namespace=%s} %d\n", metric.name, strconv.Quote(namespace), metric.value(*s.namespaces[namespace]))
+		}
+	}
+}
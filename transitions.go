@@ -0,0 +1,329 @@
+package uptime
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// transitionQueueSize bounds how many transition notifications may wait
+// for delivery before new ones are dropped.
+const transitionQueueSize = 1000
+
+// transitionEvent is the payload POSTed to webhooks when a check goes
+// down or comes back up.
+type transitionEvent struct {
+	Job           HealthcheckQuery `json:"job"`
+	PreviousState string           `json:"previous_state"`
+	State         string           `json:"state"`
+	// Escalation, if set, is the escalation step a check still down was
+	// escalated to, from 1.
+	Escalation int                 `json:"escalation,omitempty"`
+	Timestamp  time.Time           `json:"timestamp"`
+	Result     HealthcheckResponse `json:"result"`
+	// Deploy, if set, is the deploy the check's incident is attributed
+	// to.
+	Deploy *deployEvent `json:"deploy,omitempty"`
+	// AckToken, set while the check is down and its incident
+	// unacknowledged, acknowledges the incident; see handleAck.
+	AckToken string `json:"ack_token,omitempty"`
+}
+
+// transitionDelivery is a payload to POST to url or to hand to a notifier
+// plugin, or an email, about job.
+type transitionDelivery struct {
+	job     HealthcheckQuery
+	url     string
+	payload []byte
+	email   *emailAlert
+	plugin  *wasmPlugin
+}
+
+// transitionNotifier POSTs state transitions to webhooks and to a Slack
+// incoming webhook, emails them if Email is set, and hands them to notifier
+// plugins. Channels are a check's own if it has any, its namespace's
+// policy's otherwise, and the configured ones failing that. Checks still
+// down are escalated as their namespace's policy says.
+type transitionNotifier struct {
+	logger       *slog.Logger
+	Webhooks     []string
+	SlackWebhook string
+	// SlackLocale and EmailLocale are the locales of Slack messages and
+	// emails whose channels don't set one.
+	SlackLocale string
+	EmailLocale string
+	Email       *smtpMailer
+	Plugins     []*wasmPlugin
+	Policies    *notificationPolicies
+	queue       chan transitionDelivery
+
+	mu sync.Mutex
+	// escalated is how many escalation steps each check still down was
+	// escalated to.
+	escalated map[healthcheckId]int
+	// bus, if set, is told of every notification sent.
+	bus *eventBus
+	// addressPolicy holds the webhooks checks set to the rules of their
+	// namespace, those configured being trusted.
+	addressPolicy *addressPolicy
+}
+
+func newTransitionNotifier(webhooks string, slackWebhook string) (*transitionNotifier, error) {
+	n := &transitionNotifier{
+		logger:    slog.Default(),
+		queue:     make(chan transitionDelivery, transitionQueueSize),
+		escalated: make(map[healthcheckId]int),
+	}
+	if slackWebhook != "" {
+		var err error
+		n.SlackWebhook, err = normalizeURL(slackWebhook)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, url := range strings.Split(webhooks, ",") {
+		url = strings.TrimSpace(url)
+		if url == "" {
+			continue
+		}
+		url, err := normalizeURL(url)
+		if err != nil {
+			return nil, err
+		}
+		n.Webhooks = append(n.Webhooks, url)
+	}
+	return n, nil
+}
+
+// notify queues a transition for delivery, along with the deploy the
+// incident it opens or closes is attributed to. A nil transitionNotifier
+// discards it. Recoveries are also announced to the channels the check was
+// escalated to, and warnings only to warning channels.
+func (n *transitionNotifier) notify(healthcheck HealthcheckQuery, from string, to string, resp HealthcheckResponse, incident *incident) {
+	if n == nil {
+		return
+	}
+	event := transitionEvent{
+		Job:           healthcheck,
+		PreviousState: from,
+		State:         to,
+		Timestamp:     resp.Timestamp,
+		Result:        resp,
+	}
+	if incident != nil {
+		event.Deploy = incident.Deploy
+		if to == "DOWN" && incident.AcknowledgedAt == nil {
+			event.AckToken = incident.Token
+		}
+	}
+	if from != "DOWN" && to != "DOWN" {
+		// The check became DEGRADED, or is no longer.
+		n.deliver(n.warningChannels(healthcheck), event, false)
+		return
+	}
+	channels := notificationChannels{Webhooks: n.Webhooks, SlackWebhook: n.SlackWebhook}
+	policy := n.Policies.forCheck(healthcheck)
+	if policy != nil {
+		channels = channels.override(policy.notificationChannels)
+	}
+	channels = channels.override(notificationChannels{Webhooks: healthcheck.Webhooks, SlackWebhook: healthcheck.SlackWebhook})
+	n.deliver(channels, event, true)
+
+	n.mu.Lock()
+	escalated := n.escalated[healthcheck.Id]
+	delete(n.escalated, healthcheck.Id)
+	n.mu.Unlock()
+	if to == "DOWN" || policy == nil {
+		return
+	}
+	for i := 0; i < escalated && i < len(policy.Escalation); i++ {
+		n.deliver(policy.Escalation[i].notificationChannels, event, false)
+	}
+}
+
+// escalate delivers the escalation steps of a check's namespace policy
+// that are due for its unacknowledged incident, and haven't been yet.
+func (n *transitionNotifier) escalate(healthcheck HealthcheckQuery, incident *incident, resp HealthcheckResponse) {
+	if n == nil {
+		return
+	}
+	policy := n.Policies.forCheck(healthcheck)
+	if policy == nil {
+		return
+	}
+	down := resp.Timestamp.Sub(incident.OpenedAt)
+	n.mu.Lock()
+	from := n.escalated[healthcheck.Id]
+	to := from
+	for to < len(policy.Escalation) && down >= policy.Escalation[to].After {
+		to++
+	}
+	n.escalated[healthcheck.Id] = to
+	n.mu.Unlock()
+	for i := from; i < to; i++ {
+		n.deliver(policy.Escalation[i].notificationChannels, transitionEvent{
+			Job:           healthcheck,
+			PreviousState: "DOWN",
+			State:         "DOWN",
+			Escalation:    i + 1,
+			Timestamp:     resp.Timestamp,
+			Result:        resp,
+			Deploy:        incident.Deploy,
+			AckToken:      incident.Token,
+		}, false)
+	}
+}
+
+// deliver queues an event for delivery to channels, and to notifier
+// plugins if withPlugins is set. Emails go to the configured recipients
+// unless channels name others.
+func (n *transitionNotifier) deliver(channels notificationChannels, event transitionEvent, withPlugins bool) {
+	channels = notificationChannels{SlackLocale: n.SlackLocale, EmailLocale: n.EmailLocale}.override(channels)
+	if channels.SlackWebhook != "" {
+		n.enqueue(transitionDelivery{job: event.Job, url: channels.SlackWebhook, payload: slackTransitionMessage(event, lookupAlertLocale(channels.SlackLocale))})
+	}
+	if n.Email != nil && (withPlugins || len(channels.EmailTo) > 0) {
+		alert := emailTransitionAlert(event, lookupAlertLocale(channels.EmailLocale))
+		alert.to = channels.EmailTo
+		n.enqueue(transitionDelivery{job: event.Job, email: &alert})
+	}
+	if len(channels.Webhooks) == 0 && (!withPlugins || len(n.Plugins) == 0) {
+		return
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		n.logger.Error("transition-encode-failed", slog.String("error", err.Error()))
+		return
+	}
+	for _, url := range channels.Webhooks {
+		n.enqueue(transitionDelivery{job: event.Job, url: url, payload: payload})
+	}
+	if withPlugins {
+		for _, plugin := range n.Plugins {
+			n.enqueue(transitionDelivery{job: event.Job, plugin: plugin, payload: payload})
+		}
+	}
+}
+
+func (n *transitionNotifier) enqueue(d transitionDelivery) {
+	select {
+	case n.queue <- d:
+	default:
+		n.logger.Warn("transition-queue-full", slog.String("url", d.url))
+	}
+}
+
+// slackTransitionMessage is the Slack message announcing a transition or
+// an escalation, with the status code observed and why the check failed,
+// if it did, worded in locale.
+func slackTransitionMessage(event transitionEvent, locale *alertLocale) []byte {
+	healthcheck, resp := event.Job, event.Result
+	var text strings.Builder
+	switch {
+	case event.State == "UP":
+		fmt.Fprintf(&text, ":large_green_circle: *%s*: %s #%d %s", locale.Recovered, healthcheck.Method, healthcheck.Alias, healthcheck.Url)
+	case event.State == string(stateDegraded):
+		fmt.Fprintf(&text, ":large_yellow_circle: *%s*: %s #%d %s", locale.Degraded, healthcheck.Method, healthcheck.Alias, healthcheck.Url)
+	case event.Escalation > 0:
+		fmt.Fprintf(&text, ":rotating_light: *%s*: %s #%d %s", fmt.Sprintf(locale.StillDown, event.Escalation), healthcheck.Method, healthcheck.Alias, healthcheck.Url)
+	default:
+		fmt.Fprintf(&text, ":red_circle: *%s*: %s #%d %s", locale.Down, healthcheck.Method, healthcheck.Alias, healthcheck.Url)
+	}
+	if resp.StatusCode != 0 {
+		fmt.Fprintf(&text, "\n%s: %d", locale.StatusCode, resp.StatusCode)
+	}
+	if resp.Error != "" {
+		fmt.Fprintf(&text, "\n%s: %s", locale.Reason, resp.Error)
+	}
+	if event.AckToken != "" {
+		fmt.Fprintf(&text, "\n%s: `%s`", locale.Acknowledge, event.AckToken)
+	}
+	if d := event.Deploy; d != nil && event.State == "DOWN" {
+		fmt.Fprintf(&text, "\n%s: %s %s (%s)", locale.FollowingDeploy, d.Service, d.Version, locale.formatTime(d.Timestamp))
+	}
+	if source := resp.Source.String(); source != "" {
+		fmt.Fprintf(&text, "\n%s: %s", locale.Source, source)
+	}
+	payload, _ := json.Marshal(struct {
+		Text string `json:"text"`
+	}{text.String()})
+	return payload
+}
+
+// ownWebhooks returns the URLs given along with the check that its
+// notifications are posted to: its webhooks and Slack webhook, and those
+// its warnings and latency SLO breaches go to.
+func (h HealthcheckQuery) ownWebhooks() []string {
+	webhooks := append([]string{h.SlackWebhook}, h.Webhooks...)
+	if h.Warnings != nil {
+		webhooks = append(append(webhooks, h.Warnings.SlackWebhook), h.Warnings.Webhooks...)
+	}
+	if h.LatencySLO != nil {
+		webhooks = append(append(webhooks, h.LatencySLO.SlackWebhook), h.LatencySLO.Webhooks...)
+	}
+	return webhooks
+}
+
+// ownsWebhook reports whether url is one of the check's own webhooks.
+func (h HealthcheckQuery) ownsWebhook(url string) bool {
+	for _, webhook := range h.ownWebhooks() {
+		if url != "" && url == webhook {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *transitionNotifier) run(done <-chan struct{}) {
+	for {
+		var d transitionDelivery
+		select {
+		case d = <-n.queue:
+		case <-done:
+			return
+		}
+		channel, err := n.send(d)
+		n.bus.publish(busEvent{Type: busNotificationSent, Job: d.job, Time: time.Now(), Channel: channel, Err: err})
+	}
+}
+
+// send delivers d, and returns the channel it went to: the URL it was
+// POSTed to, "email", or the notifier plugin.
+func (n *transitionNotifier) send(d transitionDelivery) (string, error) {
+	if d.email != nil {
+		err := n.Email.send(*d.email)
+		if err != nil {
+			n.logger.Error("transition-email-failed", slog.String("host", n.Email.Host), slog.String("error", err.Error()))
+		}
+		return "email", err
+	}
+	if d.plugin != nil {
+		err := d.plugin.deliver(d.payload)
+		if err != nil {
+			n.logger.Error("transition-plugin-failed", slog.String("plugin", d.plugin.name), slog.String("error", err.Error()))
+		}
+		return "plugin:" + d.plugin.name, err
+	}
+	client := webhookClient
+	if d.job.ownsWebhook(d.url) {
+		client = n.addressPolicy.rules(d.job.Namespace).webhookClient()
+	}
+	resp, err := client.Post(d.url, "application/json", bytes.NewReader(d.payload))
+	if err != nil {
+		n.logger.Error("transition-delivery-failed", slog.String("url", d.url), slog.String("error", err.Error()))
+		return d.url, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBytes))
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		n.logger.Error("transition-delivery-failed", slog.String("url", d.url), slog.Int("status", resp.StatusCode))
+		return d.url, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return d.url, nil
+}
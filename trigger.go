@@ -0,0 +1,44 @@
+package uptime
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"golang.org/x/exp/slog"
+)
+
+// handleRunJob serves POST /jobs/{id}/run, which runs a check once, right
+// away, and responds with its result, e.g. to verify a new check without
+// waiting for it to be scheduled. The run is out of band: it isn't retried,
+// doesn't count towards the check's state or history, and notifies nobody.
+func (h *HealthcheckServer) handleRunJob(w http.ResponseWriter, r *http.Request, jobId healthcheckId) {
+	healthcheck, ok := h.GetHealthcheck(jobId)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	resp := h.runOutOfBand(healthcheck, r)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// runOutOfBand runs a check once on behalf of an API request, with the
+// request's context.
+func (h *HealthcheckServer) runOutOfBand(healthcheck HealthcheckQuery, r *http.Request) HealthcheckResponse {
+	ctx, correlationId := withCorrelationId(r.Context())
+	ctx = withAddressRules(ctx, h.config.AddressPolicy.rules(healthcheck.Namespace))
+	ctx = withSourceAddress(ctx, h.sourceAddress(healthcheck))
+	ctx = withResolvers(ctx, healthcheck.Resolvers)
+	h.logger.Info("healthcheck-manual-run",
+		slog.String("url", healthcheck.Url),
+		slog.String("correlation-id", correlationId),
+		slog.String("actor", requestActor(r)),
+	)
+	now := h.clock.Now()
+	resp := h.check(healthcheck, ctx)
+	resp.Duration = h.clock.Now().Sub(now)
+	resp.CorrelationId = correlationId
+	resp.Timestamp = now
+	resp.Source = h.config.Source
+	return resp
+}
@@ -0,0 +1,316 @@
+package uptime
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// maxBatchResults seals a batch early, so that a single upload stays
+	// small on a slow link.
+	maxBatchResults = 5000
+	// maxSpooledBatches bounds the spool while the central server can't be
+	// reached; the oldest batches are dropped beyond it.
+	maxSpooledBatches = 10000
+	// seenBatches is how many batch ids the central server remembers, to
+	// acknowledge a retried batch without recording it twice.
+	seenBatches = 10000
+	// maxUploadBytes caps a decompressed upload.
+	maxUploadBytes = 64 << 20
+
+	batchIdHeader = "X-Batch-Id"
+)
+
+// resultUploader buffers results in a spool directory and uploads them to
+// a central server in gzipped batches. A batch is only removed from the
+// spool once the server has acknowledged it, so results survive both a
+// lost connection and a restart; the server ignores batches it has already
+// recorded, so retrying one is always safe.
+type resultUploader struct {
+	logger     *slog.Logger
+	url        string
+	dir        string
+	interval   time.Duration
+	instanceId string
+	// token is the central server's API token, if it requires one.
+	token string
+	// session identifies this run of the agent, and started is when it
+	// started on the monotonic clock.
+	session string
+	started time.Time
+
+	mu      sync.Mutex
+	current *os.File
+	results int
+}
+
+func newResultUploader(url string, dir string, interval time.Duration, instanceId string, token string) (*resultUploader, error) {
+	url, err := normalizeURL(url)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	return &resultUploader{
+		logger:     slog.Default(),
+		url:        url,
+		dir:        dir,
+		interval:   interval,
+		instanceId: instanceId,
+		token:      token,
+		session:    newUUID(),
+		started:    time.Now(),
+	}, nil
+}
+
+// record appends a result to the current batch. A nil resultUploader
+// discards it.
+func (u *resultUploader) record(healthcheck HealthcheckQuery, resp HealthcheckResponse) {
+	if u == nil {
+		return
+	}
+	// The result's timestamp still has its monotonic clock reading.
+	line, err := json.Marshal(spooledResult{
+		resultEvent: resultEvent{Job: healthcheck, Result: resp},
+		Session:     u.session,
+		Elapsed:     int64(resp.Timestamp.Sub(u.started)),
+	})
+	if err != nil {
+		u.logger.Error("upload-spool-failed", slog.String("error", err.Error()))
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.current == nil {
+		u.current, err = os.OpenFile(filepath.Join(u.dir, "current.jsonl"), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			u.logger.Error("upload-spool-failed", slog.String("error", err.Error()))
+			return
+		}
+	}
+	_, err = u.current.Write(append(line, '\n'))
+	if err != nil {
+		u.logger.Error("upload-spool-failed", slog.String("error", err.Error()))
+		return
+	}
+	u.results++
+	if u.results >= maxBatchResults {
+		u.sealLocked()
+	}
+}
+
+// sealLocked closes the current batch and queues it for upload. u.mu must
+// be held.
+func (u *resultUploader) sealLocked() {
+	if u.current != nil {
+		u.current.Close()
+		u.current = nil
+	}
+	u.results = 0
+	current := filepath.Join(u.dir, "current.jsonl")
+	info, err := os.Stat(current)
+	if err != nil || info.Size() == 0 {
+		return
+	}
+	name := fmt.Sprintf("batch-%020d.jsonl", time.Now().UnixNano())
+	err = os.Rename(current, filepath.Join(u.dir, name))
+	if err != nil {
+		u.logger.Error("upload-spool-failed", slog.String("error", err.Error()))
+	}
+}
+
+// spooled returns the sealed batches, oldest first, dropping the oldest
+// ones beyond maxSpooledBatches.
+func (u *resultUploader) spooled() []string {
+	batches, _ := filepath.Glob(filepath.Join(u.dir, "batch-*.jsonl"))
+	sort.Strings(batches)
+	if len(batches) > maxSpooledBatches {
+		dropped := batches[:len(batches)-maxSpooledBatches]
+		for _, batch := range dropped {
+			os.Remove(batch)
+		}
+		u.logger.Warn("upload-spool-full", slog.Int("dropped-batches", len(dropped)))
+		batches = batches[len(batches)-maxSpooledBatches:]
+	}
+	return batches
+}
+
+func (u *resultUploader) upload(batch string) error {
+	data, err := os.ReadFile(batch)
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	zw.Write(data)
+	zw.Close()
+
+	req, err := http.NewRequest(http.MethodPost, u.url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set(batchIdHeader, u.instanceId+"/"+strings.TrimSuffix(filepath.Base(batch), ".jsonl"))
+	req.Header.Set(agentSessionHeader, u.session)
+	req.Header.Set(agentElapsedHeader, strconv.FormatInt(int64(time.Since(u.started)), 10))
+	if u.token != "" {
+		req.Header.Set("Authorization", "Bearer "+u.token)
+	}
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBytes))
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return os.Remove(batch)
+}
+
+// run seals and uploads a batch every interval. Batches that fail to
+// upload stay spooled and are retried, in order, next time.
+func (u *resultUploader) run(done <-chan struct{}) {
+	ticker := time.NewTicker(u.interval)
+	defer ticker.Stop()
+	for tick(ticker, done) {
+		u.mu.Lock()
+		u.sealLocked()
+		u.mu.Unlock()
+		for _, batch := range u.spooled() {
+			err := u.upload(batch)
+			if err != nil {
+				u.logger.Warn("upload-failed", slog.String("batch", filepath.Base(batch)), slog.String("error", err.Error()))
+				break
+			}
+		}
+	}
+}
+
+// batchLog remembers the most recent batch ids received.
+type batchLog struct {
+	mu    sync.Mutex
+	seen  map[string]bool
+	order []string
+}
+
+func newBatchLog() *batchLog {
+	return &batchLog{seen: make(map[string]bool)}
+}
+
+// add records a batch id, and reports whether it is new.
+func (l *batchLog) add(id string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.seen[id] {
+		return false
+	}
+	l.seen[id] = true
+	l.order = append(l.order, id)
+	if len(l.order) > seenBatches {
+		delete(l.seen, l.order[0])
+		l.order = l.order[1:]
+	}
+	return true
+}
+
+// handleUploadResults serves POST /results/upload, which receives batches
+// of results from agents. Each result's timestamp is corrected for the
+// agent's clock skew, and the result is matched to the equivalent check
+// here, where it shows up in its locations, the event log and shipped
+// logs; results of checks that don't exist here, or that come from a
+// location the check may not run from, are counted and dropped.
+func (h *HealthcheckServer) handleUploadResults(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	clock, haveClock := parseAgentClock(r, h.clock.Now())
+	batchId := r.Header.Get(batchIdHeader)
+	if batchId == "" {
+		writeError(w, http.StatusBadRequest, errors.New("missing "+batchIdHeader+" header"))
+		return
+	}
+	var body io.Reader = r.Body
+	if strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		defer zr.Close()
+		body = zr
+	}
+
+	var events []spooledResult
+	scanner := bufio.NewScanner(io.LimitReader(body, maxUploadBytes))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var event spooledResult
+		err := json.Unmarshal(scanner.Bytes(), &event)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("result %d: %w", len(events), err))
+			return
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	summary := struct {
+		Accepted  int  `json:"accepted"`
+		Unknown   int  `json:"unknown"`
+		Rejected  int  `json:"rejected,omitempty"`
+		Duplicate bool `json:"duplicate,omitempty"`
+	}{}
+	if !h.uploads.add(batchId) {
+		summary.Duplicate = true
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(summary)
+		return
+	}
+	for _, event := range events {
+		event.Result.Timestamp = h.reconcileTimestamp(event, clock, haveClock)
+		id, ok := h.findDuplicate(event.Job)
+		if !ok {
+			summary.Unknown++
+			continue
+		}
+		healthcheck, ok := h.GetHealthcheck(id)
+		if !ok {
+			summary.Unknown++
+			continue
+		}
+		if !healthcheck.allowedAt(event.Result.Source.Location) {
+			summary.Rejected++
+			continue
+		}
+		h.bus.publish(busEvent{Type: busResultUploaded, Job: healthcheck, Time: event.Result.Timestamp, Result: event.Result})
+		summary.Accepted++
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(summary)
+}
@@ -0,0 +1,74 @@
+package uptime
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// normalizeURL validates a user-supplied check URL and returns it in a
+// canonical form: the scheme defaults to https, the host is lowercased and
+// converted to punycode, default ports are dropped and an empty path
+// becomes "/". Any other trailing slash is kept since servers may treat
+// "/foo" and "/foo/" differently.
+func normalizeURL(raw string) (string, error) {
+	return normalizeURLSchemes(raw, "https", defaultPorts)
+}
+
+// normalizeURLSchemes normalizes a URL like normalizeURL, allowing the
+// schemes in ports, with their default ports.
+func normalizeURLSchemes(raw string, defaultScheme string, ports map[string]string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", fmt.Errorf("url is required")
+	}
+	if !strings.Contains(raw, "://") {
+		raw = defaultScheme + "://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid url %q: %w", raw, err)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if _, ok := ports[u.Scheme]; !ok {
+		return "", fmt.Errorf("invalid url %q: unsupported scheme %q", raw, u.Scheme)
+	}
+
+	host, port := u.Hostname(), u.Port()
+	if host == "" {
+		return "", fmt.Errorf("invalid url %q: missing host", raw)
+	}
+	if net.ParseIP(host) == nil {
+		host, err = idna.Lookup.ToASCII(strings.TrimSuffix(host, "."))
+		if err != nil {
+			return "", fmt.Errorf("invalid url %q: invalid host: %w", raw, err)
+		}
+	}
+	if port == ports[u.Scheme] {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host = host + ":" + port
+	}
+	u.Host = host
+
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	u.Fragment = ""
+
+	return u.String(), nil
+}
@@ -0,0 +1,98 @@
+package uptime
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"unicode/utf8"
+)
+
+const (
+	// maxValidatorBody caps how much of the response body is sent to a
+	// validator.
+	maxValidatorBody = 1 << 20
+	// maxValidatorVerdict caps the validator's response.
+	maxValidatorVerdict = 64 << 10
+)
+
+// validatorRequest is what a check's validator is sent: the check, and
+// the response it got. Bodies that aren't valid UTF-8 are sent base64
+// encoded in body_base64 instead.
+type validatorRequest struct {
+	Job      HealthcheckQuery  `json:"job"`
+	Response validatorResponse `json:"response"`
+}
+
+type validatorResponse struct {
+	StatusCode int         `json:"status_code"`
+	Headers    http.Header `json:"headers"`
+	Body       string      `json:"body,omitempty"`
+	BodyBase64 []byte      `json:"body_base64,omitempty"`
+	// Truncated is set when only the first maxValidatorBody bytes of the
+	// body are sent.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// validatorVerdict is what a validator answers with. Reason explains why
+// the response didn't pass.
+type validatorVerdict struct {
+	Pass   *bool  `json:"pass"`
+	Reason string `json:"reason"`
+}
+
+// callValidator delegates validating a response to the check's validator,
+// an HTTP service that answers whether it passes. A validator that can't
+// be reached or gives no verdict fails the check.
+func callValidator(ctx context.Context, h HealthcheckQuery, resp *http.Response, body []byte) error {
+	request := validatorRequest{
+		Job: h,
+		Response: validatorResponse{
+			StatusCode: resp.StatusCode,
+			Headers:    resp.Header,
+		},
+	}
+	if len(body) > maxValidatorBody {
+		body = body[:maxValidatorBody]
+		request.Response.Truncated = true
+	}
+	if utf8.Valid(body) {
+		request.Response.Body = string(body)
+	} else {
+		request.Response.BodyBase64 = body
+	}
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("Error encoding validator request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.Validator, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("Validator request failed: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(correlationHeader, correlationId(ctx))
+	// The validator is held to the check's address rules, like its target.
+	rules, _ := ctx.Value(addressRulesKey{}).(addressRules)
+	validatorResp, err := rules.webhookClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("Validator request failed: %w", err)
+	}
+	defer validatorResp.Body.Close()
+	if validatorResp.StatusCode >= 300 {
+		return fmt.Errorf("Validator responded with status code %d", validatorResp.StatusCode)
+	}
+	var verdict validatorVerdict
+	err = json.NewDecoder(io.LimitReader(validatorResp.Body, maxValidatorVerdict)).Decode(&verdict)
+	if err != nil || verdict.Pass == nil {
+		return fmt.Errorf("Validator gave no verdict")
+	}
+	if !*verdict.Pass {
+		if verdict.Reason == "" {
+			return fmt.Errorf("Rejected by validator")
+		}
+		return fmt.Errorf("Rejected by validator: %s", verdict.Reason)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package uptime
+
+// WarningChannels are where a check becoming DEGRADED, e.g. its
+// certificate nearing expiry, and no longer being so, is announced.
+// Warnings are less urgent than the check going down, so they only go to
+// warning channels: the check's own, and its namespace policy's warnings
+// otherwise.
+type WarningChannels struct {
+	Webhooks     []string `json:"webhooks,omitempty"`
+	SlackWebhook string   `json:"slack_webhook,omitempty"`
+	EmailTo      []string `json:"email_to,omitempty"`
+}
+
+func (c *WarningChannels) validate() error {
+	channels := c.channels()
+	err := channels.normalize()
+	if err != nil {
+		return err
+	}
+	c.Webhooks, c.SlackWebhook = channels.Webhooks, channels.SlackWebhook
+	return nil
+}
+
+func (c *WarningChannels) channels() notificationChannels {
+	return notificationChannels{Webhooks: c.Webhooks, SlackWebhook: c.SlackWebhook, EmailTo: c.EmailTo}
+}
+
+// warningChannels returns where a check's warnings go.
+func (n *transitionNotifier) warningChannels(healthcheck HealthcheckQuery) notificationChannels {
+	var channels notificationChannels
+	if policy := n.Policies.forCheck(healthcheck); policy != nil {
+		channels = notificationChannels{SlackLocale: policy.SlackLocale, EmailLocale: policy.EmailLocale}.override(policy.Warnings)
+	}
+	if healthcheck.Warnings != nil {
+		channels = channels.override(healthcheck.Warnings.channels())
+	}
+	return channels
+}